@@ -1,22 +1,27 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"nabd/models"
 	"nabd/services"
 	"nabd/utils"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AlertController struct {
 	metricsService *services.MetricsService
+	alertService   *services.AlertService
 }
 
 // NewAlertController creates a new alert controller
-func NewAlertController(metricsService *services.MetricsService) *AlertController {
+func NewAlertController(metricsService *services.MetricsService, alertService *services.AlertService) *AlertController {
 	return &AlertController{
 		metricsService: metricsService,
+		alertService:   alertService,
 	}
 }
 
@@ -31,6 +36,137 @@ func (ac *AlertController) GetAlerts(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": alerts})
 }
 
+// GetAlertHistory returns active and resolved alerts with their durations
+func (ac *AlertController) GetAlertHistory(c *gin.Context) {
+	filter := models.AlertHistoryFilter{
+		Container: c.Query("container"),
+		Type:      c.Query("type"),
+		Severity:  c.Query("severity"),
+	}
+
+	var err error
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100")); err != nil || filter.Limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+	for param, value := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if raw := c.Query(param); raw != "" {
+			if *value, err = time.Parse(time.RFC3339, raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " parameter, expected an RFC 3339 time"})
+				return
+			}
+		}
+	}
+
+	alerts, err := ac.alertService.GetAlertHistory(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": alerts})
+}
+
+// GetAlert returns an alert with its notes
+func (ac *AlertController) GetAlert(c *gin.Context) {
+	id, ok := alertID(c)
+	if !ok {
+		return
+	}
+
+	alert, err := ac.alertService.GetAlert(id)
+	if err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": alert})
+}
+
+// AcknowledgeAlert records who is handling an alert
+func (ac *AlertController) AcknowledgeAlert(c *gin.Context) {
+	ac.changeAlert(c, ac.alertService.Acknowledge)
+}
+
+// ResolveAlert resolves an alert by hand
+func (ac *AlertController) ResolveAlert(c *gin.Context) {
+	ac.changeAlert(c, ac.alertService.Resolve)
+}
+
+// changeAlert binds an acknowledge or resolve request and applies it with change
+func (ac *AlertController) changeAlert(c *gin.Context, change func(id int, by, note string) (models.Alert, error)) {
+	id, ok := alertID(c)
+	if !ok {
+		return
+	}
+
+	var changeRequest struct {
+		By   string `json:"by" binding:"required"`
+		Note string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&changeRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	alert, err := change(id, changeRequest.By, changeRequest.Note)
+	if err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": alert})
+}
+
+// AddAlertNote adds a note to an alert's thread
+func (ac *AlertController) AddAlertNote(c *gin.Context) {
+	id, ok := alertID(c)
+	if !ok {
+		return
+	}
+
+	var noteRequest struct {
+		Author string `json:"author" binding:"required"`
+		Text   string `json:"text" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&noteRequest); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note, err := ac.alertService.AddNote(id, noteRequest.Author, noteRequest.Text)
+	if err != nil {
+		c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": note})
+}
+
+// alertID parses the alert ID path parameter, responding with an error when it is invalid
+func alertID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// alertErrorStatus maps alert service errors to HTTP status codes
+func alertErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrAlertNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAlertResolved), errors.Is(err, services.ErrAlertAcknowledged):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrActorRequired), errors.Is(err, services.ErrInvalidNote):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // AuthController handles authentication
 type AuthController struct {
 	config *models.Config
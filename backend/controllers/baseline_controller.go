@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+	"nabd/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BaselineController struct {
+	baselineService *services.BaselineService
+}
+
+// NewBaselineController creates a new baseline controller
+func NewBaselineController(baselineService *services.BaselineService) *BaselineController {
+	return &BaselineController{
+		baselineService: baselineService,
+	}
+}
+
+// GetBaselines returns the learned baselines of all containers
+func (bc *BaselineController) GetBaselines(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": bc.baselineService.GetBaselines("")})
+}
+
+// GetContainerBaselines returns the learned baselines of a single container
+func (bc *BaselineController) GetContainerBaselines(c *gin.Context) {
+	baselines := bc.baselineService.GetBaselines(c.Param("name"))
+	if len(baselines) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No baselines for container"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": baselines})
+}
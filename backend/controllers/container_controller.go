@@ -1,9 +1,13 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"nabd/services"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,13 +15,15 @@ import (
 type ContainerController struct {
 	dockerService  *services.DockerService
 	metricsService *services.MetricsService
+	leakService    *services.LeakService
 }
 
 // NewContainerController creates a new container controller
-func NewContainerController(dockerService *services.DockerService, metricsService *services.MetricsService) *ContainerController {
+func NewContainerController(dockerService *services.DockerService, metricsService *services.MetricsService, leakService *services.LeakService) *ContainerController {
 	return &ContainerController{
 		dockerService:  dockerService,
 		metricsService: metricsService,
+		leakService:    leakService,
 	}
 }
 
@@ -43,6 +49,71 @@ func (cc *ContainerController) GetMetrics(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": metrics})
 }
 
+// GetCollectionStatus returns recent collection cycle timings and per-container collection errors
+func (cc *ContainerController) GetCollectionStatus(c *gin.Context) {
+	cycles, containers := cc.metricsService.GetCollectionStatus()
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"cycles":     cycles,
+		"containers": containers,
+	}})
+}
+
+// GetMemoryForecasts returns memory trends and projected time-to-OOM for all containers
+func (cc *ContainerController) GetMemoryForecasts(c *gin.Context) {
+	forecasts, err := cc.leakService.GetForecasts()
+	switch {
+	case errors.Is(err, services.ErrLeakDetectionDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": forecasts})
+}
+
+// GetTopContainers ranks containers by cpu, memory, network or block I/O over a window
+func (cc *ContainerController) GetTopContainers(c *gin.Context) {
+	by := c.DefaultQuery("by", "cpu")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	window, err := time.ParseDuration(c.DefaultQuery("window", "1h"))
+	if err != nil || window <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid window parameter"})
+		return
+	}
+
+	top, err := cc.metricsService.GetTopContainers(by, limit, window)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownTopMetric) || errors.Is(err, services.ErrInvalidTopWindow) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": top})
+}
+
+// GetOverview returns a fleet summary for the dashboard
+func (cc *ContainerController) GetOverview(c *gin.Context) {
+	overview, err := cc.metricsService.GetOverview()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": overview})
+}
+
 // GetMetricsHistory returns historical metrics for a container
 func (cc *ContainerController) GetMetricsHistory(c *gin.Context) {
 	containerID := c.Param("id")
@@ -63,6 +134,37 @@ func (cc *ContainerController) GetMetricsHistory(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"data": metrics})
 }
 
+// StreamStats pushes live one-second stats samples for a container over Server-Sent Events.
+// Samples are read from a Docker stats stream held open while the client is connected
+// and are not written to the database.
+func (cc *ContainerController) StreamStats(c *gin.Context) {
+	containerName := c.Param("name")
+
+	samples, err := cc.dockerService.StreamContainerStats(c.Request.Context(), containerName)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "container not found") {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Stream(func(w io.Writer) bool {
+		sample, ok := <-samples
+		if !ok {
+			return false
+		}
+		c.SSEvent("stats", sample)
+		return true
+	})
+}
+
 // GetLogs returns logs for a specific container
 func (cc *ContainerController) GetLogs(c *gin.Context) {
 	containerName := c.Query("container")
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+	"nabd/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DiskController struct {
+	diskService *services.DiskService
+}
+
+// NewDiskController creates a new disk controller
+func NewDiskController(diskService *services.DiskService) *DiskController {
+	return &DiskController{
+		diskService: diskService,
+	}
+}
+
+// GetDiskUsage returns Docker disk usage, writable layer sizes and log file growth
+func (dc *DiskController) GetDiskUsage(c *gin.Context) {
+	refresh := c.Query("refresh") == "true"
+
+	report, err := dc.diskService.GetDiskUsage(refresh)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
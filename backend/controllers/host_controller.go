@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"nabd/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HostController struct {
+	hostService *services.HostService
+}
+
+// NewHostController creates a new host controller
+func NewHostController(hostService *services.HostService) *HostController {
+	return &HostController{
+		hostService: hostService,
+	}
+}
+
+// GetHostMetrics returns the latest host sample and the host metrics history
+func (hc *HostController) GetHostMetrics(c *gin.Context) {
+	hoursStr := c.DefaultQuery("hours", "1")
+	hours, err := strconv.Atoi(hoursStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hours parameter"})
+		return
+	}
+
+	history, err := hc.hostService.GetHostMetricsHistory(hours)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"latest":  hc.hostService.GetLatestHostMetric(),
+		"history": history,
+	}})
+}
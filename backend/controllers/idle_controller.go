@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nabd/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IdleController struct {
+	idleService *services.IdleService
+}
+
+// NewIdleController creates a new idle container controller
+func NewIdleController(idleService *services.IdleService) *IdleController {
+	return &IdleController{
+		idleService: idleService,
+	}
+}
+
+// GetIdleReport returns the idle containers and the resources they hold
+func (ic *IdleController) GetIdleReport(c *gin.Context) {
+	report, err := ic.idleService.GetIdleReport()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// StopIdleContainer stops an idle container once the request confirms it
+func (ic *IdleController) StopIdleContainer(c *gin.Context) {
+	var stopRequest struct {
+		Confirm bool `json:"confirm"`
+	}
+	if err := c.ShouldBindJSON(&stopRequest); err != nil || !stopRequest.Confirm {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `Stopping an idle container must be confirmed with {"confirm": true}`})
+		return
+	}
+
+	event, err := ic.idleService.StopIdleContainer(c.Param("name"))
+	switch {
+	case errors.Is(err, services.ErrIdleStopDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNotIdle):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": event})
+}
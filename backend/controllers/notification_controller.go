@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nabd/models"
+	"nabd/notify"
+	"nabd/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationController struct {
+	notifier     *notify.Dispatcher
+	alertService *services.AlertService
+}
+
+// NewNotificationController creates a new notification controller
+func NewNotificationController(notifier *notify.Dispatcher, alertService *services.AlertService) *NotificationController {
+	return &NotificationController{
+		notifier:     notifier,
+		alertService: alertService,
+	}
+}
+
+// previewRequest selects the template and notification of a preview
+type previewRequest struct {
+	Channel  string                       `json:"channel"`
+	Template *models.NotificationTemplate `json:"template"` // defaults to the configured template
+	AlertID  int                          `json:"alert_id"` // defaults to a sample alert
+}
+
+// GetDeliveries returns the most recent notification delivery outcomes
+func (nc *NotificationController) GetDeliveries(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit parameter"})
+		return
+	}
+
+	deliveries, err := notify.GetDeliveries(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": deliveries})
+}
+
+// SendTest queues a test notification for every channel
+func (nc *NotificationController) SendTest(c *gin.Context) {
+	nc.notifier.Notify(notify.Test())
+	c.JSON(http.StatusAccepted, gin.H{"message": "Test notification queued; see /api/notifications/deliveries for the outcome"})
+}
+
+// GetTemplates returns the notification templates in use
+func (nc *NotificationController) GetTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": nc.notifier.Templates()})
+}
+
+// ReloadTemplates replaces the notification templates with those in the configuration file
+func (nc *NotificationController) ReloadTemplates(c *gin.Context) {
+	if err := nc.notifier.ReloadTemplates(); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, notify.ErrInvalidTemplate) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": nc.notifier.Templates()})
+}
+
+// Preview renders a notification for a channel with a template from the request or the
+// configured one, using a stored alert or a sample alert
+func (nc *NotificationController) Preview(c *gin.Context) {
+	var req previewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	notification := notify.Sample()
+	if req.AlertID != 0 {
+		var err error
+		notification, err = nc.alertService.Notification(req.AlertID)
+		if err != nil {
+			c.JSON(alertErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	rendered, err := nc.notifier.Preview(req.Channel, req.Template, notification)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rendered})
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nabd/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RecommendationController struct {
+	recommendationService *services.RecommendationService
+}
+
+// NewRecommendationController creates a new recommendation controller
+func NewRecommendationController(recommendationService *services.RecommendationService) *RecommendationController {
+	return &RecommendationController{
+		recommendationService: recommendationService,
+	}
+}
+
+// GetRecommendations returns suggested memory and CPU limits for running containers
+func (rc *RecommendationController) GetRecommendations(c *gin.Context) {
+	recommendations, err := rc.recommendationService.GetRecommendations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": recommendations})
+}
+
+// ApplyRecommendation updates a container's limits to the recommended values once the
+// request confirms it
+func (rc *RecommendationController) ApplyRecommendation(c *gin.Context) {
+	var applyRequest struct {
+		Confirm   bool     `json:"confirm"`
+		Resources []string `json:"resources"`
+	}
+	if err := c.ShouldBindJSON(&applyRequest); err != nil || !applyRequest.Confirm {
+		c.JSON(http.StatusBadRequest, gin.H{"error": `Applying a recommendation must be confirmed with {"confirm": true}`})
+		return
+	}
+	for _, resource := range applyRequest.Resources {
+		if resource != "memory" && resource != "cpu" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource: " + resource})
+			return
+		}
+	}
+
+	event, err := rc.recommendationService.ApplyRecommendation(c.Param("name"), applyRequest.Resources)
+	switch {
+	case errors.Is(err, services.ErrApplyDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNoRecommendation):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrLowConfidence):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": event})
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nabd/models"
+	"nabd/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RuleController struct {
+	ruleService *services.RuleService
+}
+
+// NewRuleController creates a new alert rule controller
+func NewRuleController(ruleService *services.RuleService) *RuleController {
+	return &RuleController{
+		ruleService: ruleService,
+	}
+}
+
+// GetRules returns the alert rules being evaluated and the metrics rules can use
+func (rc *RuleController) GetRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"data":    rc.ruleService.GetRules(),
+		"metrics": services.RuleMetricNames(),
+	})
+}
+
+// CreateRule adds an alert rule
+func (rc *RuleController) CreateRule(c *gin.Context) {
+	var rule models.AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := rc.ruleService.CreateRule(rule)
+	if err != nil {
+		c.JSON(ruleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+// UpdateRule replaces an alert rule created through the API
+func (rc *RuleController) UpdateRule(c *gin.Context) {
+	var rule models.AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := rc.ruleService.UpdateRule(c.Param("name"), rule)
+	if err != nil {
+		c.JSON(ruleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+// DeleteRule deletes an alert rule created through the API
+func (rc *RuleController) DeleteRule(c *gin.Context) {
+	if err := rc.ruleService.DeleteRule(c.Param("name")); err != nil {
+		c.JSON(ruleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Alert rule deleted"})
+}
+
+// BacktestRule replays a rule definition over the stored metrics of a time range
+func (rc *RuleController) BacktestRule(c *gin.Context) {
+	var req models.BacktestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := rc.ruleService.Backtest(req)
+	if err != nil {
+		c.JSON(ruleErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// ruleErrorStatus maps rule service errors to HTTP status codes
+func ruleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidRule), errors.Is(err, services.ErrInvalidBacktest):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrRuleExists):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrRuleReadOnly):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"net/http"
+	"nabd/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScrapeController struct {
+	scrapeService *services.ScrapeService
+}
+
+// NewScrapeController creates a new scrape controller
+func NewScrapeController(scrapeService *services.ScrapeService) *ScrapeController {
+	return &ScrapeController{
+		scrapeService: scrapeService,
+	}
+}
+
+// GetTargets returns the containers being scraped and the outcome of their latest scrape
+func (sc *ScrapeController) GetTargets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": sc.scrapeService.GetTargets()})
+}
+
+// GetScrapedMetrics returns the series stored for a container, or the history of one
+// series (or metric) when the series parameter is given
+func (sc *ScrapeController) GetScrapedMetrics(c *gin.Context) {
+	containerID := c.Param("id")
+	series := c.Query("series")
+
+	if series == "" {
+		names, err := sc.scrapeService.GetSeries(containerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": names})
+		return
+	}
+
+	hoursStr := c.DefaultQuery("hours", "24")
+	hours, err := strconv.Atoi(hoursStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hours parameter"})
+		return
+	}
+
+	metrics, err := sc.scrapeService.GetScrapedHistory(containerID, series, hours)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": metrics})
+}
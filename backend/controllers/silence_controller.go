@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"nabd/models"
+	"nabd/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SilenceController struct {
+	silenceService *services.SilenceService
+}
+
+// NewSilenceController creates a new silence controller
+func NewSilenceController(silenceService *services.SilenceService) *SilenceController {
+	return &SilenceController{
+		silenceService: silenceService,
+	}
+}
+
+// GetSilences returns all silences, including expired ones not yet deleted
+func (sc *SilenceController) GetSilences(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": sc.silenceService.GetSilences()})
+}
+
+// GetSilence returns a silence
+func (sc *SilenceController) GetSilence(c *gin.Context) {
+	id, ok := silenceID(c)
+	if !ok {
+		return
+	}
+
+	silence, err := sc.silenceService.GetSilence(id)
+	if err != nil {
+		c.JSON(silenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": silence})
+}
+
+// CreateSilence adds a silence
+func (sc *SilenceController) CreateSilence(c *gin.Context) {
+	var silence models.Silence
+	if err := c.ShouldBindJSON(&silence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := sc.silenceService.CreateSilence(silence)
+	if err != nil {
+		c.JSON(silenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+// UpdateSilence replaces a silence
+func (sc *SilenceController) UpdateSilence(c *gin.Context) {
+	id, ok := silenceID(c)
+	if !ok {
+		return
+	}
+
+	var silence models.Silence
+	if err := c.ShouldBindJSON(&silence); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := sc.silenceService.UpdateSilence(id, silence)
+	if err != nil {
+		c.JSON(silenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+// DeleteSilence deletes a silence
+func (sc *SilenceController) DeleteSilence(c *gin.Context) {
+	id, ok := silenceID(c)
+	if !ok {
+		return
+	}
+
+	if err := sc.silenceService.DeleteSilence(id); err != nil {
+		c.JSON(silenceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Silence deleted"})
+}
+
+// silenceID parses the silence ID path parameter, responding with an error when it is invalid
+func silenceID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid silence ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// silenceErrorStatus maps silence service errors to HTTP status codes
+func silenceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidSilence):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrSilenceNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -3,10 +3,11 @@ package main
 import (
 	"log"
 	"nabd/controllers"
+	"nabd/notify"
 	"nabd/routes"
 	"nabd/services"
+	"nabd/storage"
 	"nabd/utils"
-	"time"
 )
 
 func main() {
@@ -29,30 +30,109 @@ func main() {
 		log.Fatalf("Failed to initialize Docker service: %v", err)
 	}
 
+	// Open the metrics store
+	store, err := storage.Open(config)
+	if err != nil {
+		log.Fatalf("Failed to open metrics store: %v", err)
+	}
+	if config.Storage.Engine == "chunks" && config.Storage.Migrate {
+		moved, err := storage.MigrateRows(store, 5000)
+		if err != nil {
+			log.Fatalf("Failed to migrate metrics: %v", err)
+		}
+		if moved > 0 {
+			log.Printf("Migrated %d metric rows to the chunk store", moved)
+		}
+	}
+
 	// Initialize metrics service
-	metricsService := services.NewMetricsService(dockerService, config)
+	metricsService := services.NewMetricsService(dockerService, store, config)
+
+	// Initialize notifications
+	notifier, err := notify.Open(config)
+	if err != nil {
+		log.Fatalf("Failed to configure notifications: %v", err)
+	}
+	notifier.SetLogSource(dockerService.GetContainerLogs)
+	notifier.Start()
+	if err := metricsService.SetNotifier(notifier); err != nil {
+		log.Fatalf("Failed to configure alert notifications: %v", err)
+	}
+
+	// Load alert rules
+	ruleService := services.NewRuleService(metricsService, config)
+	if err := ruleService.LoadRules(); err != nil {
+		log.Fatalf("Failed to load alert rules: %v", err)
+	}
+
+	// Validate log alert rules
+	logService, err := services.NewLogService(dockerService, metricsService, config)
+	if err != nil {
+		log.Fatalf("Failed to load log rules: %v", err)
+	}
+
+	// Load silences
+	silenceService := services.NewSilenceService(metricsService, config)
+	if err := silenceService.LoadSilences(); err != nil {
+		log.Fatalf("Failed to load silences: %v", err)
+	}
+
+	// Initialize alert lifecycle service
+	alertService := services.NewAlertService(metricsService, config)
 
 	// Initialize auto-heal service
 	autoHealService := services.NewAutoHealService(dockerService, metricsService, config)
 
+	// Initialize host metrics service
+	hostService := services.NewHostService(dockerService, metricsService, config)
+
+	// Initialize memory leak detection service
+	leakService := services.NewLeakService(metricsService, config)
+
+	// Initialize baseline anomaly detection service
+	baselineService := services.NewBaselineService(metricsService, config)
+
+	// Initialize disk usage service
+	diskService := services.NewDiskService(dockerService, metricsService, config)
+
+	// Initialize Prometheus scraping service
+	scrapeService := services.NewScrapeService(dockerService, metricsService, config)
+
+	// Initialize idle container detection service
+	idleService := services.NewIdleService(dockerService, metricsService, autoHealService, config)
+
+	// Initialize resource recommendation service
+	recommendationService := services.NewRecommendationService(dockerService, metricsService, autoHealService, config)
+
 	// Start background services
 	autoHealService.StartAutoHealing()
+	dockerService.StartEventWatch()
 
 	// Start metrics collection
-	go func() {
-		ticker := time.NewTicker(15 * time.Second) // Collect metrics every 15 seconds
-		for range ticker.C {
-			if err := metricsService.CollectAndStoreMetrics(); err != nil {
-				log.Printf("Error collecting metrics: %v", err)
-			}
-		}
-	}()
+	baselineService.StartBaselineLearning()
+	metricsService.StartMetricsCollection()
+	hostService.StartHostCollection()
+	diskService.StartDiskMonitoring()
+	leakService.StartLeakDetection()
+	scrapeService.StartScraping()
+	silenceService.StartExpiry()
+	alertService.StartEscalation()
+	logService.StartTailing()
 
 	// Initialize controllers
-	containerController := controllers.NewContainerController(dockerService, metricsService)
+	containerController := controllers.NewContainerController(dockerService, metricsService, leakService)
 	autoHealController := controllers.NewAutoHealController(autoHealService)
-	alertController := controllers.NewAlertController(metricsService)
+	alertController := controllers.NewAlertController(metricsService, alertService)
 	authController := controllers.NewAuthController(config)
+	hostController := controllers.NewHostController(hostService)
+	diskController := controllers.NewDiskController(diskService)
+	baselineController := controllers.NewBaselineController(baselineService)
+	scrapeController := controllers.NewScrapeController(scrapeService)
+	idleController := controllers.NewIdleController(idleService)
+	recommendationController := controllers.NewRecommendationController(recommendationService)
+	ruleController := controllers.NewRuleController(ruleService)
+	notificationController := controllers.NewNotificationController(notifier, alertService)
+	silenceController := controllers.NewSilenceController(silenceService)
 
 	// Setup routes
 	router := routes.SetupRoutes(
@@ -60,6 +140,15 @@ func main() {
 		autoHealController,
 		alertController,
 		authController,
+		hostController,
+		diskController,
+		baselineController,
+		scrapeController,
+		idleController,
+		recommendationController,
+		ruleController,
+		notificationController,
+		silenceController,
 		config,
 	)
 
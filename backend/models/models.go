@@ -7,18 +7,35 @@ import (
 )
 
 type ContainerMetric struct {
-	ID          int       `json:"id" db:"id"`
-	ContainerID string    `json:"container_id" db:"container_id"`
-	Name        string    `json:"name" db:"name"`
-	CPUPercent  float64   `json:"cpu_percent" db:"cpu_percent"`
-	MemoryUsage int64     `json:"memory_usage" db:"memory_usage"`
-	MemoryLimit int64     `json:"memory_limit" db:"memory_limit"`
-	NetworkRx   int64     `json:"network_rx" db:"network_rx"`
-	NetworkTx   int64     `json:"network_tx" db:"network_tx"`
-	Status      string    `json:"status" db:"status"`
-	Timestamp   time.Time `json:"timestamp" db:"timestamp"`
+	ID            int       `json:"id" db:"id"`
+	ContainerID   string    `json:"container_id" db:"container_id"`
+	Name          string    `json:"name" db:"name"`
+	CPUPercent    float64   `json:"cpu_percent" db:"cpu_percent"`
+	MemoryUsage   int64     `json:"memory_usage" db:"memory_usage"`
+	MemoryLimit   int64     `json:"memory_limit" db:"memory_limit"`
+	NetworkRx     int64     `json:"network_rx" db:"network_rx"`
+	NetworkTx     int64     `json:"network_tx" db:"network_tx"`
+	BlockRead     int64     `json:"block_read" db:"block_read"`
+	BlockWrite    int64     `json:"block_write" db:"block_write"`
+	Pids          int64     `json:"pids" db:"pids"`
+	RestartCount  int       `json:"restart_count" db:"restart_count"`
+	UptimeSeconds int64     `json:"uptime_seconds" db:"uptime_seconds"`
+	Health        float64   `json:"health" db:"health"`
+	Status        string    `json:"status" db:"status"`
+	Timestamp     time.Time `json:"timestamp" db:"timestamp"`
+	// Image and Labels are set on collected samples for rule selectors; they are not stored
+	Image  string            `json:"-" db:"-"`
+	Labels map[string]string `json:"-" db:"-"`
 }
 
+// Numeric health values stored in ContainerMetric.Health
+const (
+	HealthNone      = -1.0 // no health check configured
+	HealthUnhealthy = 0.0
+	HealthStarting  = 0.5
+	HealthHealthy   = 1.0
+)
+
 type AutoHealEvent struct {
 	ID          int       `json:"id" db:"id"`
 	ContainerID string    `json:"container_id" db:"container_id"`
@@ -50,6 +67,529 @@ type Alert struct {
 	Severity    string    `json:"severity" db:"severity"`
 	Active      bool      `json:"active" db:"active"`
 	Timestamp   time.Time `json:"timestamp" db:"timestamp"`
+
+	ResolvedAt     *time.Time  `json:"resolved_at,omitempty" db:"resolved_at"`
+	AcknowledgedBy string      `json:"acknowledged_by,omitempty" db:"acknowledged_by"`
+	AcknowledgedAt *time.Time  `json:"acknowledged_at,omitempty" db:"acknowledged_at"`
+	Duration       int64       `json:"duration_seconds" db:"-"` // until resolution, or until now while active
+	Notes          []AlertNote `json:"notes,omitempty" db:"-"`
+
+	// Silenced alerts fired while a silence matched them and were not notified. Active
+	// alerts are flagged by the silences matching them now instead.
+	Silenced  bool `json:"silenced" db:"silenced"`
+	SilenceID int  `json:"silence_id,omitempty" db:"-"` // the silence currently matching the alert
+
+	// Fingerprint identifies the alert type on a container across alerts; there is at
+	// most one active alert per fingerprint
+	Fingerprint string `json:"fingerprint" db:"fingerprint"`
+	// Inhibited alerts fired while an inhibiting alert was active and were not notified
+	Inhibited bool `json:"inhibited" db:"inhibited"`
+
+	EscalationLevel int               `json:"escalation_level" db:"escalation_level"` // escalation tiers reached
+	EscalatedAt     *time.Time        `json:"escalated_at,omitempty" db:"escalated_at"`
+	Escalations     []AlertEscalation `json:"escalations,omitempty" db:"-"`
+
+	Team       string `json:"team,omitempty" db:"team"`     // owning team when the alert fired
+	PolicyStep int    `json:"policy_step" db:"policy_step"` // escalation policy steps notified
+
+	// Value and Threshold are the rule's value and threshold when a rule alert fired
+	Value     float64 `json:"value,omitempty" db:"value"`
+	Threshold float64 `json:"threshold,omitempty" db:"threshold"`
+}
+
+// AlertEscalation records an alert reaching an escalation tier
+type AlertEscalation struct {
+	ID           int       `json:"id" db:"id"`
+	AlertID      int       `json:"alert_id" db:"alert_id"`
+	Level        int       `json:"level" db:"level"`
+	FromSeverity string    `json:"from_severity" db:"from_severity"`
+	ToSeverity   string    `json:"to_severity" db:"to_severity"`
+	Timestamp    time.Time `json:"timestamp" db:"timestamp"`
+}
+
+// OwnershipRule assigns containers whose name matches the Container glob to a team
+type OwnershipRule struct {
+	Container string `yaml:"container"`
+	Team      string `yaml:"team"`
+}
+
+// Route sends the notifications of a team's alerts, optionally narrowed by matchers, to
+// Channels and to the steps of an escalation policy
+type Route struct {
+	Team     string           `yaml:"team"` // empty matches every team
+	Matchers []SilenceMatcher `yaml:"matchers"`
+	Channels []string         `yaml:"channels"`
+	Policy   string           `yaml:"policy"`
+}
+
+// EscalationPolicy notifies further channels while an alert stays unacknowledged
+type EscalationPolicy struct {
+	Name  string       `yaml:"name"`
+	Steps []PolicyStep `yaml:"steps"`
+}
+
+// PolicyStep is notified once an alert has been active for After seconds without being
+// acknowledged; steps with After 0 are notified when the alert fires
+type PolicyStep struct {
+	After    int      `yaml:"after"`
+	Channels []string `yaml:"channels"`
+}
+
+// EscalationTier raises the severity of alerts active for After seconds. When Channels
+// are set the escalation is notified to those channels only.
+type EscalationTier struct {
+	After    int      `yaml:"after"`
+	Severity string   `yaml:"severity"`
+	Channels []string `yaml:"channels"`
+}
+
+// AlertNote is a comment left on an alert
+type AlertNote struct {
+	ID        int       `json:"id" db:"id"`
+	AlertID   int       `json:"alert_id" db:"alert_id"`
+	Author    string    `json:"author" db:"author"`
+	Text      string    `json:"text" db:"text"`
+	Timestamp time.Time `json:"timestamp" db:"timestamp"`
+}
+
+// Silence matcher operators
+const (
+	MatchEqual    = "="
+	MatchNotEqual = "!="
+	MatchRegex    = "=~"
+	MatchNotRegex = "!~"
+)
+
+// SilenceMatcher matches one property of an alert. Regular expressions must match the
+// whole value.
+type SilenceMatcher struct {
+	Field    string `json:"field" yaml:"field"`           // container, image, type, severity, host, compose_project, compose_service or label
+	Label    string `json:"label,omitempty" yaml:"label"` // label key when Field is label
+	Operator string `json:"op" yaml:"op"`                 // =, !=, =~ or !~; defaults to =
+	Value    string `json:"value" yaml:"value"`
+}
+
+// InhibitRule suppresses the notifications of alerts matching TargetMatchers (all alerts
+// when empty) while an alert matching SourceMatchers is active and has the same values
+// for the Equal keys
+type InhibitRule struct {
+	SourceMatchers []SilenceMatcher `yaml:"source_matchers"`
+	TargetMatchers []SilenceMatcher `yaml:"target_matchers"`
+	Equal          []string         `yaml:"equal"`
+}
+
+// Silence statuses
+const (
+	SilencePending = "pending"
+	SilenceActive  = "active"
+	SilenceExpired = "expired"
+)
+
+// Silence mutes the notifications of alerts matching all its matchers between StartsAt
+// and EndsAt
+type Silence struct {
+	ID        int              `json:"id" db:"id"`
+	Matchers  []SilenceMatcher `json:"matchers" db:"matchers"`
+	StartsAt  time.Time        `json:"starts_at" db:"starts_at"`
+	EndsAt    time.Time        `json:"ends_at" db:"ends_at"`
+	CreatedBy string           `json:"created_by" db:"created_by"`
+	Comment   string           `json:"comment" db:"comment"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+	Status    string           `json:"status" db:"-"`
+}
+
+// AlertHistoryFilter selects alerts from the alert history. Empty fields match everything.
+type AlertHistoryFilter struct {
+	Container string // container ID or name
+	Type      string
+	Severity  string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// CollectionError records a failed stats collection for a single container
+type CollectionError struct {
+	ContainerID string    `json:"container_id"`
+	Name        string    `json:"name"`
+	Error       string    `json:"error"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// CollectionCycle summarizes one metrics collection run
+type CollectionCycle struct {
+	StartedAt  time.Time         `json:"started_at"`
+	DurationMs int64             `json:"duration_ms"`
+	Containers int               `json:"containers"`
+	Collected  int               `json:"collected"`
+	Errors     []CollectionError `json:"errors"`
+}
+
+// ContainerCollectionStatus tracks collection health for a single container
+type ContainerCollectionStatus struct {
+	ContainerID         string    `json:"container_id"`
+	Name                string    `json:"name"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorAt         time.Time `json:"last_error_at"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	TotalFailures       int       `json:"total_failures"`
+}
+
+// HostMetric is a sample of the machine running the Docker daemon
+type HostMetric struct {
+	ID          int             `json:"id" db:"id"`
+	Hostname    string          `json:"hostname" db:"hostname"`
+	CPUPercent  float64         `json:"cpu_percent" db:"cpu_percent"`
+	CPUCount    int             `json:"cpu_count" db:"cpu_count"`
+	MemoryUsed  int64           `json:"memory_used" db:"memory_used"`
+	MemoryTotal int64           `json:"memory_total" db:"memory_total"`
+	Load1       float64         `json:"load1" db:"load1"`
+	Load5       float64         `json:"load5" db:"load5"`
+	Load15      float64         `json:"load15" db:"load15"`
+	DiskPath    string          `json:"disk_path" db:"disk_path"`
+	DiskUsed    int64           `json:"disk_used" db:"disk_used"`
+	DiskTotal   int64           `json:"disk_total" db:"disk_total"`
+	NetworkRx   int64           `json:"network_rx" db:"network_rx"`
+	NetworkTx   int64           `json:"network_tx" db:"network_tx"`
+	Interfaces  []HostInterface `json:"interfaces,omitempty"`
+	Timestamp   time.Time       `json:"timestamp" db:"timestamp"`
+}
+
+// HostInterface holds the counters of one host network interface
+type HostInterface struct {
+	Name      string `json:"name"`
+	NetworkRx int64  `json:"network_rx"`
+	NetworkTx int64  `json:"network_tx"`
+}
+
+// DiskUsageReport is a summary of Docker's disk usage ("docker system df") and
+// per-container writable layer and log file sizes
+type DiskUsageReport struct {
+	Images       DiskUsageSummary     `json:"images"`
+	Dangling     DiskUsageSummary     `json:"dangling_images"`
+	Containers   DiskUsageSummary     `json:"containers"`
+	Volumes      DiskUsageSummary     `json:"volumes"`
+	BuildCache   DiskUsageSummary     `json:"build_cache"`
+	LayersSize   int64                `json:"layers_size"`
+	PerContainer []ContainerDiskUsage `json:"per_container"`
+	Timestamp    time.Time            `json:"timestamp"`
+}
+
+// DiskUsageSummary holds the totals of one category of Docker objects
+type DiskUsageSummary struct {
+	Count       int   `json:"count"`
+	Size        int64 `json:"size"`
+	Reclaimable int64 `json:"reclaimable"`
+}
+
+// ContainerDiskUsage holds the disk footprint of a single container
+type ContainerDiskUsage struct {
+	ContainerID      string `json:"container_id"`
+	Name             string `json:"name"`
+	Image            string `json:"image"`
+	State            string `json:"state"`
+	SizeRw           int64  `json:"size_rw"`
+	SizeRootFs       int64  `json:"size_root_fs"`
+	LogDriver        string `json:"log_driver"`
+	LogMaxSize       string `json:"log_max_size,omitempty"`
+	LogPath          string `json:"log_path,omitempty"`
+	LogSize          int64  `json:"log_size"`
+	LogGrowthPerHour int64  `json:"log_growth_per_hour"`
+	LogUnbounded     bool   `json:"log_unbounded"`
+}
+
+// MemoryForecast is the memory trend of a container and its projected time to reach its limit
+type MemoryForecast struct {
+	ContainerID        string     `json:"container_id"`
+	Name               string     `json:"name"`
+	Samples            int        `json:"samples"`
+	WindowHours        float64    `json:"window_hours"`
+	CurrentUsage       int64      `json:"current_usage"`
+	MemoryLimit        int64      `json:"memory_limit"`
+	GrowthBytesPerHour float64    `json:"growth_bytes_per_hour"`
+	R2                 float64    `json:"r2"`
+	HoursToLimit       *float64   `json:"hours_to_limit,omitempty"`
+	ProjectedOOMAt     *time.Time `json:"projected_oom_at,omitempty"`
+	LeakSuspected      bool       `json:"leak_suspected"`
+}
+
+// MetricBaseline is the learned normal behaviour of one metric of a container
+type MetricBaseline struct {
+	Name      string           `json:"name"`
+	Metric    string           `json:"metric"`
+	Mean      float64          `json:"mean"`
+	StdDev    float64          `json:"stddev"`
+	Samples   int              `json:"samples"`
+	Hourly    []BaselineBucket `json:"hourly"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// BaselineBucket is the baseline of one hour of the day
+type BaselineBucket struct {
+	Hour    int     `json:"hour"`
+	Mean    float64 `json:"mean"`
+	StdDev  float64 `json:"stddev"`
+	Samples int     `json:"samples"`
+}
+
+// MetricAnomaly is a sample that deviates from its baseline
+type MetricAnomaly struct {
+	Name       string    `json:"name"`
+	Metric     string    `json:"metric"`
+	Value      float64   `json:"value"`
+	Expected   float64   `json:"expected"`
+	StdDev     float64   `json:"stddev"`
+	Deviations float64   `json:"deviations"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ScrapeTarget is a container that opted in to Prometheus scraping through its labels
+type ScrapeTarget struct {
+	ContainerID string    `json:"container_id"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Metrics     []string  `json:"metrics"` // metric name patterns to keep; empty keeps the configured defaults
+	LastScrape  time.Time `json:"last_scrape"`
+	Series      int       `json:"series"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// ScrapedSample is one sample of a Prometheus text exposition
+type ScrapedSample struct {
+	Metric string            `json:"metric"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// ScrapedMetric is a stored sample of an application metric
+type ScrapedMetric struct {
+	ContainerID string    `json:"container_id" db:"container_id"`
+	Name        string    `json:"name" db:"name"`
+	Metric      string    `json:"metric" db:"metric"`
+	Series      string    `json:"series" db:"series"` // metric name with its labels, e.g. http_requests_total{code="500"}
+	Value       float64   `json:"value" db:"value"`
+	Timestamp   time.Time `json:"timestamp" db:"timestamp"`
+}
+
+// ScrapeRule alerts when a scraped metric crosses a threshold
+type ScrapeRule struct {
+	Metric    string   `yaml:"metric"`    // metric name or full series
+	Container string   `yaml:"container"` // optional container name; empty applies to all targets
+	Above     *float64 `yaml:"above"`
+	Below     *float64 `yaml:"below"`
+	Severity  string   `yaml:"severity"`
+}
+
+// NotificationChannel configures one outbound notification channel
+type NotificationChannel struct {
+	Name        string            `yaml:"name"`
+	Type        string            `yaml:"type"` // webhook, slack, discord, teams or email
+	URL         string            `yaml:"url"`
+	Headers     map[string]string `yaml:"headers"`      // webhook only
+	Events      []string          `yaml:"events"`       // alert_firing, alert_resolved, alert_escalated, autoheal; empty sends all
+	MinSeverity string            `yaml:"min_severity"` // info, warning or critical
+	SMTPHost    string            `yaml:"smtp_host"`
+	SMTPPort    int               `yaml:"smtp_port"`
+	Username    string            `yaml:"username"`
+	Password    string            `yaml:"password"`
+	From        string            `yaml:"from"`
+	To          []string          `yaml:"to"`
+}
+
+// NotificationTemplate renders the title and text of notifications with text/template.
+// Channel and Type (an alert type or auto-heal action) narrow the notifications it
+// applies to; the most specific template wins. An empty Title or Text keeps the default.
+type NotificationTemplate struct {
+	Channel string `json:"channel,omitempty" yaml:"channel"`
+	Type    string `json:"type,omitempty" yaml:"type"`
+	Title   string `json:"title,omitempty" yaml:"title"`
+	Text    string `json:"text,omitempty" yaml:"text"`
+}
+
+// NotificationDelivery records the outcome of delivering a notification to a channel
+type NotificationDelivery struct {
+	ID          int       `json:"id"`
+	Channel     string    `json:"channel"`
+	Event       string    `json:"event"`
+	Title       string    `json:"title"`
+	ContainerID string    `json:"container_id"`
+	Success     bool      `json:"success"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// Alert rule sources
+const (
+	RuleSourceBuiltin = "builtin" // derived from the alert thresholds
+	RuleSourceConfig  = "config"
+	RuleSourceAPI     = "api"
+)
+
+// AlertRule is an alert condition evaluated on every container sample. The alert fires
+// once the condition has held for For seconds and resolves once the value no longer
+// satisfies the comparator against ResolveThreshold (Threshold when not set).
+type AlertRule struct {
+	Name             string       `json:"name" yaml:"name"` // also the type of the alerts it raises
+	Metric           string       `json:"metric" yaml:"metric"`
+	Comparator       string       `json:"comparator" yaml:"comparator"`
+	Threshold        float64      `json:"threshold" yaml:"threshold"`
+	For              int          `json:"for" yaml:"for"` // seconds
+	ResolveThreshold *float64     `json:"resolve_threshold,omitempty" yaml:"resolve_threshold"`
+	Severity         string       `json:"severity" yaml:"severity"`
+	Selector         RuleSelector `json:"selector" yaml:"selector"`
+	Message          string       `json:"message" yaml:"message"` // text/template
+	Source           string       `json:"source" yaml:"-"`
+}
+
+// LogRule raises an alert when Count lines of a container's log match Pattern within
+// Window seconds. The alert resolves once fewer matches remain in the window.
+type LogRule struct {
+	Name     string       `json:"name" yaml:"name"` // also the type of the alerts it raises
+	Selector RuleSelector `json:"selector" yaml:"selector"`
+	Pattern  string       `json:"pattern" yaml:"pattern"` // regular expression
+	Count    int          `json:"count" yaml:"count"`
+	Window   int          `json:"window" yaml:"window"` // seconds
+	Severity string       `json:"severity" yaml:"severity"`
+}
+
+// RuleSelector limits a rule to matching containers. Name and Image are glob patterns;
+// every label must be present with the given value. An empty selector matches all.
+type RuleSelector struct {
+	Name   string            `json:"name,omitempty" yaml:"name"`
+	Image  string            `json:"image,omitempty" yaml:"image"`
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels"`
+}
+
+// BacktestRequest replays a rule over the stored samples between Start and End
+type BacktestRequest struct {
+	Rule       AlertRule `json:"rule"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`         // defaults to now
+	FlapWindow int       `json:"flap_window"` // seconds; defaults to 600
+}
+
+// BacktestResult is what a rule would have done over a time range
+type BacktestResult struct {
+	Rule       AlertRule           `json:"rule"`
+	Start      time.Time           `json:"start"`
+	End        time.Time           `json:"end"`
+	Samples    int                 `json:"samples"`
+	Alerts     []BacktestAlert     `json:"alerts"`
+	Containers []BacktestContainer `json:"containers"`
+}
+
+// BacktestAlert is an alert a rule would have raised
+type BacktestAlert struct {
+	ContainerID string     `json:"container_id"`
+	Name        string     `json:"name"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end,omitempty"` // nil when still firing at the last sample
+	Duration    float64    `json:"duration"`      // seconds
+	Message     string     `json:"message"`
+}
+
+// BacktestContainer summarizes the alerts a rule would have raised for one container. A
+// flap is an alert firing again within the flap window after the previous one resolved.
+type BacktestContainer struct {
+	ContainerID   string  `json:"container_id"`
+	Name          string  `json:"name"`
+	Samples       int     `json:"samples"`
+	Alerts        int     `json:"alerts"`
+	Flaps         int     `json:"flaps"`
+	FiringSeconds float64 `json:"firing_seconds"`
+}
+
+// TopContainer is a container's rank for one metric over a time window. Gauges
+// (cpu, memory) are ranked by their average; counters (network, block I/O) by how
+// much they grew during the window.
+type TopContainer struct {
+	ContainerID string  `json:"container_id"`
+	Name        string  `json:"name"`
+	Value       float64 `json:"value"`
+	Peak        float64 `json:"peak,omitempty"` // gauges only
+	Rate        float64 `json:"rate,omitempty"` // counters only, per second
+	Samples     int     `json:"samples"`
+}
+
+// Overview summarizes the whole fleet for the dashboard
+type Overview struct {
+	Containers        int                  `json:"containers"`
+	ContainersByState map[string]int       `json:"containers_by_state"`
+	CPUPercent        float64              `json:"cpu_percent"`
+	MemoryUsage       int64                `json:"memory_usage"`
+	ActiveAlerts      int                  `json:"active_alerts"`
+	AlertsBySeverity  map[string]int       `json:"alerts_by_severity"`
+	Heals24h          int                  `json:"heals_24h"`
+	FailedHeals24h    int                  `json:"failed_heals_24h"`
+	Unhealthy         []UnhealthyContainer `json:"unhealthy"`
+	Timestamp         time.Time            `json:"timestamp"`
+}
+
+// UnhealthyContainer is a container ranked by how much attention it needs
+type UnhealthyContainer struct {
+	ContainerID string   `json:"container_id"`
+	Name        string   `json:"name"`
+	State       string   `json:"state"`
+	Score       int      `json:"score"`
+	Reasons     []string `json:"reasons"`
+}
+
+// IdleContainer is a running container that has had no CPU or network activity
+type IdleContainer struct {
+	ContainerID string    `json:"container_id"`
+	Name        string    `json:"name"`
+	Image       string    `json:"image"`
+	IdleSince   time.Time `json:"idle_since"`
+	IdleSeconds int64     `json:"idle_seconds"`
+	// WholeWindow is set when the container was idle for the entire lookback window,
+	// so it has been idle for at least IdleSeconds
+	WholeWindow bool    `json:"whole_window"`
+	CPUPercent  float64 `json:"cpu_percent"`
+	MemoryUsage int64   `json:"memory_usage"`
+	MemoryLimit int64   `json:"memory_limit"`
+	Pids        int64   `json:"pids"`
+}
+
+// IdleReport lists idle containers and the resources they hold
+type IdleReport struct {
+	Containers   []IdleContainer `json:"containers"`
+	TotalMemory  int64           `json:"total_memory"`
+	MinIdleDays  int             `json:"min_idle_days"`
+	LookbackDays int             `json:"lookback_days"`
+	StopAllowed  bool            `json:"stop_allowed"`
+	Timestamp    time.Time       `json:"timestamp"`
+}
+
+// Recommendation actions
+const (
+	RecommendSetLimit = "set_limit" // no limit is configured
+	RecommendIncrease = "increase"
+	RecommendDecrease = "decrease"
+	RecommendKeep     = "keep"
+)
+
+// ResourceRecommendation compares the usage of one resource with its limit. Memory
+// values are bytes and CPU values are cores.
+type ResourceRecommendation struct {
+	Limit     float64 `json:"limit"` // 0 when no limit is configured
+	P95       float64 `json:"p95"`
+	P99       float64 `json:"p99"`
+	Peak      float64 `json:"peak"`
+	Suggested float64 `json:"suggested"`
+	Action    string  `json:"action"`
+}
+
+// Recommendation suggests resource limits for a container from its usage history
+type Recommendation struct {
+	ContainerID string                 `json:"container_id"`
+	Name        string                 `json:"name"`
+	Samples     int                    `json:"samples"`
+	HistoryDays float64                `json:"history_days"`
+	Confidence  string                 `json:"confidence"`
+	Memory      ResourceRecommendation `json:"memory"`
+	CPU         ResourceRecommendation `json:"cpu"`
 }
 
 type ContainerInfo struct {
@@ -80,7 +620,121 @@ type Config struct {
 		CPUThreshold    float64 `yaml:"cpu_threshold"`
 		MemoryThreshold float64 `yaml:"memory_threshold"`
 		RestartLimit    int     `yaml:"restart_limit"`
+		PidsLimit       int64   `yaml:"pids_limit"`
+		MinUptime       int64   `yaml:"min_uptime"`
+		Host            struct {
+			CPUThreshold    float64 `yaml:"cpu_threshold"`
+			MemoryThreshold float64 `yaml:"memory_threshold"`
+			DiskThreshold   float64 `yaml:"disk_threshold"`
+			LoadThreshold   float64 `yaml:"load_threshold"`
+		} `yaml:"host"`
+		Disk struct {
+			WritableLayerMB  int64 `yaml:"writable_layer_mb"`
+			LogSizeMB        int64 `yaml:"log_size_mb"`
+			LogGrowthMBHour  int64 `yaml:"log_growth_mb_per_hour"`
+			DanglingImagesMB int64 `yaml:"dangling_images_mb"`
+			UnboundedLogs    bool  `yaml:"unbounded_logs"`
+		} `yaml:"disk"`
+		MemoryLeak struct {
+			Enabled      bool    `yaml:"enabled"`
+			Interval     int     `yaml:"interval"`
+			WindowHours  int     `yaml:"window_hours"`
+			MinSamples   int     `yaml:"min_samples"`
+			MinR2        float64 `yaml:"min_r2"`
+			HorizonHours int     `yaml:"horizon_hours"`
+		} `yaml:"memory_leak"`
+		Scraped  []ScrapeRule `yaml:"scraped"`
+		Rules    []AlertRule  `yaml:"rules"`
+		LogRules []LogRule    `yaml:"log_rules"`
+		Anomaly struct {
+			Enabled     bool    `yaml:"enabled"`
+			Deviations  float64 `yaml:"deviations"`
+			Alpha       float64 `yaml:"alpha"`
+			MinSamples  int     `yaml:"min_samples"`
+			Consecutive int     `yaml:"consecutive"`
+			LearnDays   int     `yaml:"learn_days"`
+		} `yaml:"anomaly"`
+		// Grouping batches the notifications of alerts sharing the values of the By keys
+		Grouping struct {
+			By       []string `yaml:"by"`
+			Wait     int      `yaml:"wait"`
+			Interval int      `yaml:"interval"`
+		} `yaml:"grouping"`
+		InhibitRules []InhibitRule `yaml:"inhibit_rules"`
+		Escalation   struct {
+			Interval int              `yaml:"interval"`
+			Tiers    []EscalationTier `yaml:"tiers"`
+		} `yaml:"escalation"`
 	} `yaml:"alerts"`
+	Metrics struct {
+		Interval     int            `yaml:"interval"`
+		Jitter       int            `yaml:"jitter"`
+		Overrides    map[string]int `yaml:"overrides"`
+		Workers      int            `yaml:"workers"`
+		StatsTimeout int            `yaml:"stats_timeout"`
+		Collector    string         `yaml:"collector"`
+		CgroupRoot   string         `yaml:"cgroup_root"`
+		ProcRoot     string         `yaml:"proc_root"`
+	} `yaml:"metrics"`
+	Host struct {
+		Enabled    bool   `yaml:"enabled"`
+		DockerRoot string `yaml:"docker_root"`
+	} `yaml:"host"`
+	Disk struct {
+		Enabled  bool   `yaml:"enabled"`
+		Interval int    `yaml:"interval"`
+		HostRoot string `yaml:"host_root"`
+	} `yaml:"disk"`
+	Idle struct {
+		MinDays      int     `yaml:"min_days"`
+		LookbackDays int     `yaml:"lookback_days"`
+		CPUPercent   float64 `yaml:"cpu_percent"`
+		NetworkRate  float64 `yaml:"network_rate"`
+		AllowStop    bool    `yaml:"allow_stop"`
+	} `yaml:"idle"`
+	Recommendations struct {
+		Days       int     `yaml:"days"`
+		Headroom   float64 `yaml:"headroom"`
+		AllowApply bool    `yaml:"allow_apply"`
+	} `yaml:"recommendations"`
+	Silences struct {
+		RetentionDays int `yaml:"retention_days"`
+	} `yaml:"silences"`
+	// Routing sends notifications to the channels of the owning team. Without routes and
+	// fallback channels every notification goes to every channel.
+	Routing struct {
+		Ownership []OwnershipRule    `yaml:"ownership"`
+		Routes    []Route            `yaml:"routes"`
+		Fallback  []string           `yaml:"fallback"`
+		Policies  []EscalationPolicy `yaml:"policies"`
+	} `yaml:"routing"`
+	Notifications struct {
+		Enabled     bool                  `yaml:"enabled"`
+		MaxAttempts int                   `yaml:"max_attempts"`
+		Backoff     int                   `yaml:"backoff"`
+		Timeout     int                   `yaml:"timeout"`
+		Channels    []NotificationChannel `yaml:"channels"`
+
+		Templates    []NotificationTemplate `yaml:"templates"`
+		DashboardURL string                 `yaml:"dashboard_url"` // base URL of the Nabd dashboard
+		LogLines     int                    `yaml:"log_lines"`     // recent log lines for templates using .Logs
+	} `yaml:"notifications"`
+	Storage struct {
+		Engine        string `yaml:"engine"`
+		Backend       string `yaml:"backend"`
+		Directory     string `yaml:"directory"`
+		ChunkHours    int    `yaml:"chunk_hours"`
+		RetentionDays int    `yaml:"retention_days"`
+		Migrate       bool   `yaml:"migrate"`
+	} `yaml:"storage"`
+	Scrape struct {
+		Enabled   bool     `yaml:"enabled"`
+		Interval  int      `yaml:"interval"`
+		Timeout   int      `yaml:"timeout"`
+		Network   string   `yaml:"network"`
+		Metrics   []string `yaml:"metrics"`
+		MaxSeries int      `yaml:"max_series"`
+	} `yaml:"scrape"`
 }
 
 // Database connection
@@ -0,0 +1,431 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"nabd/models"
+	"nabd/utils"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queueSize is the number of notifications buffered per channel
+const queueSize = 100
+
+// maxBackoff caps the delay between delivery attempts
+const maxBackoff = 5 * time.Minute
+
+// LogSource returns the last lines of a container's log
+type LogSource func(containerName string, lines int) ([]string, error)
+
+// subscription is a channel with the notifications it receives and its queue
+type subscription struct {
+	name        string
+	channel     Channel
+	events      map[string]bool
+	minSeverity int
+	queue       chan Notification
+}
+
+// Dispatcher delivers notifications to channels in the background, retrying failed
+// deliveries with exponential backoff and recording every outcome in the database.
+// Each channel has its own queue, so a slow or failing channel does not delay others.
+type Dispatcher struct {
+	maxAttempts int
+	backoff     time.Duration
+	timeout     time.Duration
+
+	subscriptions []*subscription
+	wg            sync.WaitGroup
+
+	// templates render notifications per channel; they can be replaced while running
+	templatesMu sync.RWMutex
+	templates   *Templates
+
+	dashboardURL string
+	logs         LogSource
+	logLines     int
+}
+
+// NewDispatcher creates a dispatcher making up to maxAttempts delivery attempts, waiting
+// backoff after the first failure and doubling the wait after each further one
+func NewDispatcher(maxAttempts int, backoff, timeout time.Duration) *Dispatcher {
+	if maxAttempts <= 0 {
+		maxAttempts = 5 // Default to 5 attempts
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second // Default to 10 seconds
+	}
+	return &Dispatcher{maxAttempts: maxAttempts, backoff: backoff, timeout: timeout, templates: &Templates{}}
+}
+
+// Open creates a dispatcher with the channels in the notification configuration
+func Open(config *models.Config) (*Dispatcher, error) {
+	settings := config.Notifications
+	timeout := time.Duration(settings.Timeout) * time.Second
+	d := NewDispatcher(settings.MaxAttempts, time.Duration(settings.Backoff)*time.Second, timeout)
+	if err := d.SetTemplates(settings.Templates); err != nil {
+		return nil, err
+	}
+	d.SetDashboardURL(settings.DashboardURL)
+	d.logLines = settings.LogLines
+	if !settings.Enabled {
+		return d, nil
+	}
+
+	client := &http.Client{Timeout: d.timeout}
+	for _, channelConfig := range settings.Channels {
+		channel, err := NewChannel(channelConfig, client)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.AddChannel(channelConfig.Name, channel, channelConfig.Events, channelConfig.MinSeverity); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// NewChannel creates the channel described by a channel configuration
+func NewChannel(config models.NotificationChannel, client *http.Client) (Channel, error) {
+	if config.Type != "email" && config.URL == "" {
+		return nil, fmt.Errorf("notification channel %s: url is required", config.Name)
+	}
+
+	switch config.Type {
+	case "webhook":
+		return NewWebhookChannel(config.URL, config.Headers, client), nil
+	case "slack":
+		return NewSlackChannel(config.URL, client), nil
+	case "discord":
+		return NewDiscordChannel(config.URL, client), nil
+	case "teams":
+		return NewTeamsChannel(config.URL, client), nil
+	case "email":
+		channel, err := NewEmailChannel(config.SMTPHost, config.SMTPPort, config.Username, config.Password, config.From, config.To)
+		if err != nil {
+			return nil, fmt.Errorf("notification channel %s: %v", config.Name, err)
+		}
+		return channel, nil
+	default:
+		return nil, fmt.Errorf("notification channel %s: unknown type %q; use webhook, slack, discord, teams or email", config.Name, config.Type)
+	}
+}
+
+// AddChannel subscribes a channel to the given events (all when empty) at or above
+// minSeverity. Channels must be added before Start.
+func (d *Dispatcher) AddChannel(name string, channel Channel, events []string, minSeverity string) error {
+	if name == "" {
+		return fmt.Errorf("notification channel name is required")
+	}
+	for _, sub := range d.subscriptions {
+		if sub.name == name {
+			return fmt.Errorf("duplicate notification channel name %q", name)
+		}
+	}
+
+	sub := &subscription{
+		name:        name,
+		channel:     channel,
+		minSeverity: SeverityRank(minSeverity),
+		queue:       make(chan Notification, queueSize),
+	}
+	if len(events) > 0 {
+		sub.events = make(map[string]bool)
+		for _, event := range events {
+			switch event {
+			case EventAlertFiring, EventAlertResolved, EventAlertEscalated, EventAutoHeal:
+			default:
+				return fmt.Errorf("notification channel %s: unknown event %q", name, event)
+			}
+			sub.events[event] = true
+		}
+	}
+	d.subscriptions = append(d.subscriptions, sub)
+	return nil
+}
+
+// SetTemplates validates and replaces the notification templates. Notifications already
+// queued are rendered with the new templates.
+func (d *Dispatcher) SetTemplates(templates []models.NotificationTemplate) error {
+	compiled, err := NewTemplates(templates)
+	if err != nil {
+		return err
+	}
+	d.templatesMu.Lock()
+	d.templates = compiled
+	d.templatesMu.Unlock()
+	return nil
+}
+
+// ReloadTemplates replaces the notification templates with those in the configuration
+// file, so templates can be changed without a restart
+func (d *Dispatcher) ReloadTemplates() error {
+	config, err := utils.LoadConfig()
+	if err != nil {
+		return err
+	}
+	return d.SetTemplates(config.Notifications.Templates)
+}
+
+// Templates returns the notification templates in use
+func (d *Dispatcher) Templates() []models.NotificationTemplate {
+	d.templatesMu.RLock()
+	defer d.templatesMu.RUnlock()
+	return d.templates.Templates()
+}
+
+// SetDashboardURL sets the base URL of the dashboard linked from notifications
+func (d *Dispatcher) SetDashboardURL(baseURL string) {
+	if baseURL == "" {
+		d.dashboardURL = ""
+		return
+	}
+	d.dashboardURL = strings.TrimRight(baseURL, "/") + "/dashboard"
+}
+
+// SetLogSource sets where templates using .Logs get the recent log lines of a container.
+// It must be set before Start.
+func (d *Dispatcher) SetLogSource(logs LogSource) {
+	d.logs = logs
+}
+
+// Preview renders a notification for a channel with tmpl, or with the template that
+// applies to the channel and notification type when tmpl is nil
+func (d *Dispatcher) Preview(channel string, tmpl *models.NotificationTemplate, notification Notification) (Notification, error) {
+	var ct *compiledTemplate
+	if tmpl != nil {
+		var err error
+		if ct, err = compileTemplate(*tmpl); err != nil {
+			return notification, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+	} else {
+		d.templatesMu.RLock()
+		ct = d.templates.find(channel, notification.Type)
+		d.templatesMu.RUnlock()
+	}
+	return d.renderWith(ct, notification)
+}
+
+// render applies the template for a channel to a notification. Notifications whose
+// template fails are sent with the default title and text.
+func (d *Dispatcher) render(channel string, notification Notification) Notification {
+	d.templatesMu.RLock()
+	ct := d.templates.find(channel, notification.Type)
+	d.templatesMu.RUnlock()
+
+	rendered, err := d.renderWith(ct, notification)
+	if err != nil {
+		log.Printf("Notification template for %s failed, sending the default message: %v", channel, err)
+		notification.DashboardURL = rendered.DashboardURL
+		return notification
+	}
+	return rendered
+}
+
+// renderWith adds the dashboard link to a notification and executes ct, if any, fetching
+// the container's recent log lines when the template uses them
+func (d *Dispatcher) renderWith(ct *compiledTemplate, notification Notification) (Notification, error) {
+	if notification.DashboardURL == "" {
+		notification.DashboardURL = d.dashboardURL
+	}
+	if ct == nil {
+		return notification, nil
+	}
+
+	if ct.usesLogs() && notification.Logs == nil && notification.Name != "" && d.logs != nil {
+		lines := d.logLines
+		if lines <= 0 {
+			lines = 10 // Default to 10 lines
+		}
+		logs, err := d.logs(notification.Name, lines)
+		if err != nil {
+			log.Printf("Error reading logs of %s for a notification: %v", notification.Name, err)
+		}
+		notification.Logs = logs
+	}
+	return ct.render(notification)
+}
+
+// Start starts a delivery worker per channel
+func (d *Dispatcher) Start() {
+	for _, sub := range d.subscriptions {
+		d.wg.Add(1)
+		go func(sub *subscription) {
+			defer d.wg.Done()
+			for notification := range sub.queue {
+				d.deliver(sub, notification)
+			}
+		}(sub)
+	}
+	if len(d.subscriptions) > 0 {
+		log.Printf("Notifications enabled for %d channel(s)", len(d.subscriptions))
+	}
+}
+
+// Close stops accepting notifications and waits for queued ones to be delivered
+func (d *Dispatcher) Close() {
+	for _, sub := range d.subscriptions {
+		close(sub.queue)
+	}
+	d.wg.Wait()
+}
+
+// Notify queues a notification for every subscribed channel without blocking. Notify
+// must not be called after Close.
+func (d *Dispatcher) Notify(notification Notification) {
+	if d == nil {
+		return
+	}
+
+	for _, sub := range d.subscriptions {
+		if notification.Event != EventTest {
+			if sub.events != nil && !sub.events[notification.Event] {
+				continue
+			}
+			if SeverityRank(notification.Severity) < sub.minSeverity {
+				continue
+			}
+		}
+
+		d.enqueue(sub, notification)
+	}
+}
+
+// NotifyChannels queues a notification for the named channels only, regardless of their
+// event and severity filters
+func (d *Dispatcher) NotifyChannels(names []string, notification Notification) {
+	if d == nil {
+		return
+	}
+
+	for _, sub := range d.subscriptions {
+		for _, name := range names {
+			if sub.name == name {
+				d.enqueue(sub, notification)
+				break
+			}
+		}
+	}
+}
+
+// HasChannel reports whether a channel with the given name was added
+func (d *Dispatcher) HasChannel(name string) bool {
+	if d == nil {
+		return false
+	}
+	for _, sub := range d.subscriptions {
+		if sub.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue queues a notification for a channel without blocking. When the channel's
+// queue is full the notification is dropped and recorded as failed.
+func (d *Dispatcher) enqueue(sub *subscription, notification Notification) {
+	select {
+	case sub.queue <- notification:
+	default:
+		log.Printf("Notification queue of channel %s is full, dropping %q", sub.name, notification.Title)
+		go d.record(sub.name, notification, 0, fmt.Errorf("queue full"))
+	}
+}
+
+// deliver sends a notification, retrying with backoff, and records the outcome
+func (d *Dispatcher) deliver(sub *subscription, notification Notification) {
+	notification = d.render(sub.name, notification)
+
+	var (
+		err     error
+		attempt int
+		wait    = d.backoff
+	)
+	for attempt = 1; attempt <= d.maxAttempts; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+		err = sub.channel.Send(ctx, notification)
+		cancel()
+		if err == nil {
+			break
+		}
+
+		log.Printf("Notification to %s failed (attempt %d/%d): %v", sub.name, attempt, d.maxAttempts, err)
+		if attempt < d.maxAttempts {
+			time.Sleep(wait)
+			wait *= 2
+			if wait > maxBackoff {
+				wait = maxBackoff
+			}
+		}
+	}
+	if attempt > d.maxAttempts {
+		attempt = d.maxAttempts
+	}
+
+	d.record(sub.name, notification, attempt, err)
+}
+
+// record stores the outcome of a delivery
+func (d *Dispatcher) record(channel string, notification Notification, attempts int, deliveryErr error) {
+	errorText := ""
+	if deliveryErr != nil {
+		errorText = deliveryErr.Error()
+	}
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO notification_deliveries
+			(channel, event, title, container_id, success, attempts, error, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			channel,
+			notification.Event,
+			notification.Title,
+			notification.ContainerID,
+			deliveryErr == nil,
+			attempts,
+			errorText,
+			time.Now(),
+		)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error recording notification delivery: %v", err)
+	}
+}
+
+// GetDeliveries returns the most recent delivery outcomes
+func GetDeliveries(limit int) ([]models.NotificationDelivery, error) {
+	rows, err := models.DB.Query(`SELECT id, channel, event, title, container_id, success, attempts, error, timestamp
+		FROM notification_deliveries
+		ORDER BY id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.NotificationDelivery{}
+	for rows.Next() {
+		var delivery models.NotificationDelivery
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.Channel,
+			&delivery.Event,
+			&delivery.Title,
+			&delivery.ContainerID,
+			&delivery.Success,
+			&delivery.Attempts,
+			&delivery.Error,
+			&delivery.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,84 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailChannel sends notifications by SMTP. STARTTLS is used when the server offers it.
+type EmailChannel struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+// NewEmailChannel creates a channel sending mail through host:port. Authentication is
+// only attempted when a username is set.
+func NewEmailChannel(host string, port int, username, password, from string, to []string) (*EmailChannel, error) {
+	if host == "" || from == "" || len(to) == 0 {
+		return nil, fmt.Errorf("email channel requires smtp_host, from and to")
+	}
+	if port <= 0 {
+		port = 587 // Default to the submission port
+	}
+
+	return &EmailChannel{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+		to:       to,
+	}, nil
+}
+
+// Send sends the notification as a plain text message
+func (ec *EmailChannel) Send(ctx context.Context, notification Notification) error {
+	var auth smtp.Auth
+	if ec.username != "" {
+		auth = smtp.PlainAuth("", ec.username, ec.password, ec.host)
+	}
+
+	// smtp.SendMail takes no context, so run it aside and give up when ctx is done
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(ec.addr, auth, ec.from, ec.to, ec.message(notification))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// message formats the notification as an RFC 5322 message
+func (ec *EmailChannel) message(notification Notification) []byte {
+	// Header values must not contain line breaks
+	header := strings.NewReplacer("\r", " ", "\n", " ")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", header.Replace(ec.from))
+	fmt.Fprintf(&msg, "To: %s\r\n", header.Replace(strings.Join(ec.to, ", ")))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", header.Replace(notification.Title))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+
+	fmt.Fprintf(&msg, "%s\r\n\r\n", notification.Text)
+	if notification.Name != "" {
+		fmt.Fprintf(&msg, "Container: %s (%s)\r\n", notification.Name, notification.ContainerID)
+	}
+	fmt.Fprintf(&msg, "Severity: %s\r\n", notification.Severity)
+	fmt.Fprintf(&msg, "Time: %s\r\n", notification.Timestamp.Format(time.RFC3339))
+	return msg.Bytes()
+}
@@ -0,0 +1,186 @@
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Grouper batches alert notifications that share group labels into group notifications.
+// The first notification of a group is held for wait so that related alerts arrive in the
+// same message; after that a group is sent at most once per interval.
+type Grouper struct {
+	dispatcher *Dispatcher
+	wait       time.Duration
+	interval   time.Duration
+
+	mu     sync.Mutex
+	groups map[string]*group
+}
+
+// group is the pending notifications of one group
+type group struct {
+	labels   map[string]string
+	channels []string // nil sends to every channel
+	pending  []Notification
+	timer    *time.Timer
+	lastSent time.Time
+}
+
+// NewGrouper creates a grouper sending group notifications through dispatcher
+func NewGrouper(dispatcher *Dispatcher, wait, interval time.Duration) *Grouper {
+	return &Grouper{
+		dispatcher: dispatcher,
+		wait:       wait,
+		interval:   interval,
+		groups:     make(map[string]*group),
+	}
+}
+
+// Add queues a notification in the group identified by labels. Notifications routed to
+// channels are grouped separately from those routed elsewhere; nil channels sends the
+// group to every channel.
+func (g *Grouper) Add(labels map[string]string, channels []string, notification Notification) {
+	key := groupKey(labels)
+	if channels != nil {
+		key += "\x00" + strings.Join(channels, ",")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	grp := g.groups[key]
+	if grp == nil {
+		grp = &group{labels: labels, channels: channels}
+		g.groups[key] = grp
+	}
+	grp.pending = append(grp.pending, notification)
+	if grp.timer != nil {
+		return
+	}
+
+	delay := g.wait
+	if !grp.lastSent.IsZero() {
+		delay = time.Until(grp.lastSent.Add(g.interval))
+		if delay < 0 {
+			delay = 0
+		}
+	}
+	grp.timer = time.AfterFunc(delay, func() { g.flush(key) })
+}
+
+// Flush sends every pending group notification immediately
+func (g *Grouper) Flush() {
+	g.mu.Lock()
+	var keys []string
+	for key, grp := range g.groups {
+		if grp.timer != nil && grp.timer.Stop() {
+			keys = append(keys, key)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, key := range keys {
+		g.flush(key)
+	}
+}
+
+// flush sends the pending notifications of a group and forgets groups that have been
+// quiet for an interval
+func (g *Grouper) flush(key string) {
+	g.mu.Lock()
+	grp := g.groups[key]
+	if grp == nil {
+		g.mu.Unlock()
+		return
+	}
+	pending := grp.pending
+	grp.pending = nil
+	grp.timer = nil
+	grp.lastSent = time.Now()
+
+	for other, quiet := range g.groups {
+		if quiet.timer == nil && time.Since(quiet.lastSent) > g.interval {
+			delete(g.groups, other)
+		}
+	}
+	g.mu.Unlock()
+
+	for _, notification := range GroupNotifications(grp.labels, pending) {
+		if grp.channels == nil {
+			g.dispatcher.Notify(notification)
+		} else {
+			g.dispatcher.NotifyChannels(grp.channels, notification)
+		}
+	}
+}
+
+// GroupNotifications combines the notifications of a group into one notification per
+// event: firing, escalated and resolved alerts. A lone notification is passed on as is.
+func GroupNotifications(labels map[string]string, notifications []Notification) []Notification {
+	events := []string{EventAlertFiring, EventAlertEscalated, EventAlertResolved}
+	batches := make(map[string][]Notification)
+	for _, notification := range notifications {
+		batches[notification.Event] = append(batches[notification.Event], notification)
+	}
+
+	var grouped []Notification
+	for _, event := range events {
+		batch := batches[event]
+		switch len(batch) {
+		case 0:
+		case 1:
+			grouped = append(grouped, batch[0])
+		default:
+			grouped = append(grouped, groupNotification(labels, batch))
+		}
+	}
+	return grouped
+}
+
+// groupNotification builds the notification of a batch of same-event notifications
+func groupNotification(labels map[string]string, batch []Notification) Notification {
+	event, status := batch[0].Event, "FIRING"
+	switch event {
+	case EventAlertEscalated:
+		status = "ESCALATED"
+	case EventAlertResolved:
+		status = "RESOLVED"
+	}
+
+	severity := "info"
+	lines := make([]string, 0, len(batch))
+	for _, notification := range batch {
+		if SeverityRank(notification.Severity) > SeverityRank(severity) {
+			severity = notification.Severity
+		}
+		lines = append(lines, fmt.Sprintf("- %s: %s", notification.Title, notification.Text))
+	}
+
+	key := groupKey(labels)
+	if key == "" {
+		key = "all alerts"
+	}
+	return Notification{
+		Event:     event,
+		Title:     fmt.Sprintf("[%s:%d] %s", status, len(batch), key),
+		Text:      strings.Join(lines, "\n"),
+		Severity:  severity,
+		Type:      "group",
+		Timestamp: time.Now(),
+		Group:     labels,
+		Alerts:    batch,
+	}
+}
+
+// groupKey formats group labels as sorted key=value pairs
+func groupKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"nabd/models"
+	"strings"
+	"time"
+)
+
+// Notification events
+const (
+	EventAlertFiring    = "alert_firing"
+	EventAlertResolved  = "alert_resolved"
+	EventAlertEscalated = "alert_escalated"
+	EventAutoHeal       = "autoheal"
+	EventTest           = "test" // sent to every channel regardless of its filters
+)
+
+// Notification is a message about an alert or auto-heal action
+type Notification struct {
+	Event       string    `json:"event"`
+	Title       string    `json:"title"`
+	Text        string    `json:"text"`
+	Severity    string    `json:"severity"`
+	ContainerID string    `json:"container_id"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"` // alert type or auto-heal action
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+
+	// Context for notification templates
+	Message      string            `json:"message,omitempty"` // alert message or auto-heal reason
+	Image        string            `json:"image,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Team         string            `json:"team,omitempty"`
+	Value        float64           `json:"value,omitempty"`
+	Threshold    float64           `json:"threshold,omitempty"`
+	Duration     time.Duration     `json:"-"` // how long the alert has been active
+	Logs         []string          `json:"logs,omitempty"`
+	DashboardURL string            `json:"dashboard_url,omitempty"`
+
+	// Group notifications carry the grouping key values and the grouped notifications
+	Group  map[string]string `json:"group,omitempty"`
+	Alerts []Notification    `json:"alerts,omitempty"`
+}
+
+// Channel delivers notifications to one destination
+type Channel interface {
+	Send(ctx context.Context, notification Notification) error
+}
+
+// AlertFiring builds the notification for a new alert
+func AlertFiring(alert models.Alert) Notification {
+	return Notification{
+		Event:       EventAlertFiring,
+		Title:       fmt.Sprintf("[%s] %s on %s", strings.ToUpper(alert.Severity), alert.Type, alert.Name),
+		Text:        alert.Message,
+		Severity:    alert.Severity,
+		ContainerID: alert.ContainerID,
+		Name:        alert.Name,
+		Type:        alert.Type,
+		Fingerprint: alert.Fingerprint,
+		Message:     alert.Message,
+		Value:       alert.Value,
+		Threshold:   alert.Threshold,
+		Duration:    time.Since(alert.Timestamp),
+		Timestamp:   alert.Timestamp,
+	}
+}
+
+// AlertResolved builds the notification for a resolved alert
+func AlertResolved(alert models.Alert, resolvedAt time.Time) Notification {
+	return Notification{
+		Event:       EventAlertResolved,
+		Title:       fmt.Sprintf("[RESOLVED] %s on %s", alert.Type, alert.Name),
+		Text:        alert.Message,
+		Severity:    alert.Severity,
+		ContainerID: alert.ContainerID,
+		Name:        alert.Name,
+		Type:        alert.Type,
+		Fingerprint: alert.Fingerprint,
+		Message:     alert.Message,
+		Value:       alert.Value,
+		Threshold:   alert.Threshold,
+		Duration:    resolvedAt.Sub(alert.Timestamp),
+		Timestamp:   resolvedAt,
+	}
+}
+
+// AlertEscalated builds the notification for an alert escalated after staying active
+func AlertEscalated(alert models.Alert, activeFor time.Duration) Notification {
+	return Notification{
+		Event:       EventAlertEscalated,
+		Title:       fmt.Sprintf("[ESCALATED:%s] %s on %s", strings.ToUpper(alert.Severity), alert.Type, alert.Name),
+		Text:        fmt.Sprintf("%s (active for %s)", alert.Message, activeFor.Round(time.Second)),
+		Severity:    alert.Severity,
+		ContainerID: alert.ContainerID,
+		Name:        alert.Name,
+		Type:        alert.Type,
+		Fingerprint: alert.Fingerprint,
+		Message:     alert.Message,
+		Value:       alert.Value,
+		Threshold:   alert.Threshold,
+		Duration:    activeFor,
+		Timestamp:   time.Now(),
+	}
+}
+
+// AlertUnacknowledged builds the notification sent to the next step of an escalation
+// policy when an alert has not been acknowledged
+func AlertUnacknowledged(alert models.Alert, activeFor time.Duration) Notification {
+	return Notification{
+		Event:       EventAlertEscalated,
+		Title:       fmt.Sprintf("[UNACKNOWLEDGED:%s] %s on %s", strings.ToUpper(alert.Severity), alert.Type, alert.Name),
+		Text:        fmt.Sprintf("%s (not acknowledged for %s)", alert.Message, activeFor.Round(time.Second)),
+		Severity:    alert.Severity,
+		ContainerID: alert.ContainerID,
+		Name:        alert.Name,
+		Type:        alert.Type,
+		Fingerprint: alert.Fingerprint,
+		Message:     alert.Message,
+		Value:       alert.Value,
+		Threshold:   alert.Threshold,
+		Duration:    activeFor,
+		Timestamp:   time.Now(),
+	}
+}
+
+// AutoHeal builds the notification for an auto-heal action. Failed actions are critical
+// since the container is most likely still down.
+func AutoHeal(event models.AutoHealEvent) Notification {
+	outcome, severity := "succeeded", "info"
+	if !event.Success {
+		outcome, severity = "failed", "critical"
+	}
+	return Notification{
+		Event:       EventAutoHeal,
+		Title:       fmt.Sprintf("Auto-heal %s of %s %s", event.Action, event.Name, outcome),
+		Text:        event.Reason,
+		Severity:    severity,
+		ContainerID: event.ContainerID,
+		Name:        event.Name,
+		Type:        event.Action,
+		Timestamp:   event.Timestamp,
+		Message:     event.Reason,
+	}
+}
+
+// Test builds a notification for checking channel configuration
+func Test() Notification {
+	return Notification{
+		Event:     EventTest,
+		Title:     "Nabd test notification",
+		Text:      "Notifications from Nabd reach this channel.",
+		Severity:  "info",
+		Timestamp: time.Now(),
+	}
+}
+
+// SeverityRank orders severities: info (and unknown severities), warning, critical
+func SeverityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 2
+	case "warning":
+		return 1
+	default:
+		return 0
+	}
+}
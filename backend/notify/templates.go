@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"nabd/models"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ErrInvalidTemplate is returned for notification templates that fail to parse or render
+var ErrInvalidTemplate = errors.New("invalid notification template")
+
+// templateFuncs are the functions available to notification templates besides the
+// text/template builtins
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"round": func(d time.Duration) time.Duration { return d.Round(time.Second) },
+}
+
+// Templates renders the title and text of notifications per channel and notification
+// type. Templates are executed with the Notification as data.
+type Templates struct {
+	templates []*compiledTemplate
+}
+
+// compiledTemplate is a notification template with its title and text parsed
+type compiledTemplate struct {
+	models.NotificationTemplate
+	title *template.Template // nil keeps the default title
+	text  *template.Template // nil keeps the default text
+}
+
+// NewTemplates validates and parses notification templates. Two templates may not target
+// the same channel and type.
+func NewTemplates(templates []models.NotificationTemplate) (*Templates, error) {
+	compiled := &Templates{}
+	seen := make(map[string]bool)
+	for i, tmpl := range templates {
+		key := tmpl.Channel + "\x00" + tmpl.Type
+		if seen[key] {
+			return nil, fmt.Errorf("%w %d: another template has channel %q and type %q", ErrInvalidTemplate, i+1, tmpl.Channel, tmpl.Type)
+		}
+		seen[key] = true
+
+		ct, err := compileTemplate(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("%w %d: %v", ErrInvalidTemplate, i+1, err)
+		}
+		compiled.templates = append(compiled.templates, ct)
+	}
+	return compiled, nil
+}
+
+// compileTemplate parses the title and text of a template
+func compileTemplate(tmpl models.NotificationTemplate) (*compiledTemplate, error) {
+	if tmpl.Title == "" && tmpl.Text == "" {
+		return nil, fmt.Errorf("title or text is required")
+	}
+
+	ct := &compiledTemplate{NotificationTemplate: tmpl}
+	var err error
+	if tmpl.Title != "" {
+		if ct.title, err = template.New("title").Funcs(templateFuncs).Parse(tmpl.Title); err != nil {
+			return nil, err
+		}
+	}
+	if tmpl.Text != "" {
+		if ct.text, err = template.New("text").Funcs(templateFuncs).Parse(tmpl.Text); err != nil {
+			return nil, err
+		}
+	}
+	return ct, nil
+}
+
+// Templates returns the template definitions
+func (t *Templates) Templates() []models.NotificationTemplate {
+	templates := make([]models.NotificationTemplate, len(t.templates))
+	for i, tmpl := range t.templates {
+		templates[i] = tmpl.NotificationTemplate
+	}
+	return templates
+}
+
+// find returns the template most specific to a channel and notification type: one for
+// both, then one for the type, then one for the channel, then one for everything
+func (t *Templates) find(channel, notificationType string) *compiledTemplate {
+	var (
+		best      *compiledTemplate
+		bestScore = -1
+	)
+	for _, tmpl := range t.templates {
+		if (tmpl.Channel != "" && tmpl.Channel != channel) || (tmpl.Type != "" && tmpl.Type != notificationType) {
+			continue
+		}
+		score := 0
+		if tmpl.Type != "" {
+			score += 2
+		}
+		if tmpl.Channel != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = tmpl, score
+		}
+	}
+	return best
+}
+
+// usesLogs reports whether the template refers to the recent log lines
+func (ct *compiledTemplate) usesLogs() bool {
+	return strings.Contains(ct.Title, ".Logs") || strings.Contains(ct.Text, ".Logs")
+}
+
+// render executes the template for a notification, replacing its title and text
+func (ct *compiledTemplate) render(notification Notification) (Notification, error) {
+	title, text := notification.Title, notification.Text
+	var buf bytes.Buffer
+	if ct.title != nil {
+		if err := ct.title.Execute(&buf, notification); err != nil {
+			return notification, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+		title = strings.TrimSpace(buf.String())
+		buf.Reset()
+	}
+	if ct.text != nil {
+		if err := ct.text.Execute(&buf, notification); err != nil {
+			return notification, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+		text = strings.TrimSpace(buf.String())
+	}
+	notification.Title, notification.Text = title, text
+	return notification, nil
+}
+
+// Sample builds an example alert notification for previewing templates
+func Sample() Notification {
+	now := time.Now()
+	return Notification{
+		Event:       EventAlertFiring,
+		Title:       "[WARNING] high_cpu on web",
+		Text:        "High CPU usage detected: 97.3%",
+		Severity:    "warning",
+		ContainerID: "0123456789ab",
+		Name:        "web",
+		Type:        "high_cpu",
+		Fingerprint: "5f2b7c9e1a3d4b60",
+		Timestamp:   now.Add(-5 * time.Minute),
+		Message:     "High CPU usage detected: 97.3%",
+		Image:       "nginx:1.25",
+		Labels:      map[string]string{"com.docker.compose.project": "shop"},
+		Team:        "payments",
+		Value:       97.3,
+		Threshold:   90,
+		Duration:    5 * time.Minute,
+		Logs: []string{
+			now.Add(-time.Minute).UTC().Format(time.RFC3339Nano) + " upstream timed out while reading response header",
+			now.UTC().Format(time.RFC3339Nano) + " worker process exited on signal 9",
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"unicode/utf8"
+)
+
+// discordMaxContent is the maximum length of a Discord message
+const discordMaxContent = 2000
+
+// WebhookChannel posts notifications as JSON to an HTTP endpoint. The payload is built
+// by format, so the same channel serves generic webhooks and chat services.
+type WebhookChannel struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	format  func(notification Notification) interface{}
+}
+
+// NewWebhookChannel creates a channel posting the notification itself as JSON
+func NewWebhookChannel(url string, headers map[string]string, client *http.Client) *WebhookChannel {
+	return &WebhookChannel{url: url, headers: headers, client: client, format: func(n Notification) interface{} { return n }}
+}
+
+// NewSlackChannel creates a channel for Slack-compatible incoming webhooks
+func NewSlackChannel(url string, client *http.Client) *WebhookChannel {
+	return &WebhookChannel{url: url, client: client, format: func(n Notification) interface{} {
+		return map[string]interface{}{
+			"text": fmt.Sprintf("*%s*\n%s", n.Title, n.Text),
+			"attachments": []map[string]interface{}{
+				{"color": severityColor(n), "fields": []map[string]interface{}{
+					{"title": "Container", "value": n.Name, "short": true},
+					{"title": "Severity", "value": n.Severity, "short": true},
+				}},
+			},
+		}
+	}}
+}
+
+// NewDiscordChannel creates a channel for Discord webhooks
+func NewDiscordChannel(url string, client *http.Client) *WebhookChannel {
+	return &WebhookChannel{url: url, client: client, format: func(n Notification) interface{} {
+		content := fmt.Sprintf("**%s**\n%s", n.Title, n.Text)
+		if len(content) > discordMaxContent {
+			content = content[:discordMaxContent-3]
+			for !utf8.ValidString(content) {
+				content = content[:len(content)-1]
+			}
+			content += "..."
+		}
+		return map[string]interface{}{"content": content}
+	}}
+}
+
+// NewTeamsChannel creates a channel for Microsoft Teams incoming webhooks
+func NewTeamsChannel(url string, client *http.Client) *WebhookChannel {
+	return &WebhookChannel{url: url, client: client, format: func(n Notification) interface{} {
+		return map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    n.Title,
+			"themeColor": severityColor(n)[1:],
+			"title":      n.Title,
+			"text":       n.Text,
+		}
+	}}
+}
+
+// Send posts the notification and fails on any non-2xx response
+func (wc *WebhookChannel) Send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(wc.format(notification))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wc.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range wc.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := wc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+// severityColor returns the chat color of a notification
+func severityColor(notification Notification) string {
+	switch {
+	case notification.Event == EventAlertResolved:
+		return "#2eb886"
+	case notification.Severity == "critical":
+		return "#d00000"
+	case notification.Severity == "warning":
+		return "#f2c744"
+	default:
+		return "#439fe0"
+	}
+}
@@ -15,6 +15,15 @@ func SetupRoutes(
 	autoHealController *controllers.AutoHealController,
 	alertController *controllers.AlertController,
 	authController *controllers.AuthController,
+	hostController *controllers.HostController,
+	diskController *controllers.DiskController,
+	baselineController *controllers.BaselineController,
+	scrapeController *controllers.ScrapeController,
+	idleController *controllers.IdleController,
+	recommendationController *controllers.RecommendationController,
+	ruleController *controllers.RuleController,
+	notificationController *controllers.NotificationController,
+	silenceController *controllers.SilenceController,
 	config *models.Config,
 ) *gin.Engine {
 	
@@ -72,9 +81,15 @@ func SetupRoutes(
 		// Container routes
 		api.GET("/containers", containerController.GetContainers)
 		api.GET("/metrics", containerController.GetMetrics)
+		api.GET("/metrics/collection", containerController.GetCollectionStatus)
+		api.GET("/metrics/forecasts", containerController.GetMemoryForecasts)
+		api.GET("/metrics/top", containerController.GetTopContainers)
+		api.GET("/overview", containerController.GetOverview)
 		api.GET("/metrics/:id/history", containerController.GetMetricsHistory)
+		api.GET("/metrics/:id/scraped", scrapeController.GetScrapedMetrics)
 		api.GET("/logs", containerController.GetLogs)
 		api.POST("/containers/:name/restart", containerController.RestartContainer)
+		api.GET("/containers/:name/stats/stream", containerController.StreamStats)
 
 		// Auto-heal routes
 		api.GET("/autoheal/history", autoHealController.GetAutoHealHistory)
@@ -82,6 +97,51 @@ func SetupRoutes(
 
 		// Alert routes
 		api.GET("/alerts", alertController.GetAlerts)
+		api.GET("/alerts/history", alertController.GetAlertHistory)
+		api.GET("/alerts/:id", alertController.GetAlert)
+		api.POST("/alerts/:id/ack", alertController.AcknowledgeAlert)
+		api.POST("/alerts/:id/resolve", alertController.ResolveAlert)
+		api.POST("/alerts/:id/notes", alertController.AddAlertNote)
+		api.GET("/alerts/rules", ruleController.GetRules)
+		api.POST("/alerts/rules", ruleController.CreateRule)
+		api.POST("/alerts/rules/backtest", ruleController.BacktestRule)
+		api.PUT("/alerts/rules/:name", ruleController.UpdateRule)
+		api.DELETE("/alerts/rules/:name", ruleController.DeleteRule)
+
+		// Notification routes
+		api.GET("/notifications/deliveries", notificationController.GetDeliveries)
+		api.POST("/notifications/test", notificationController.SendTest)
+		api.POST("/notifications/preview", notificationController.Preview)
+		api.GET("/notifications/templates", notificationController.GetTemplates)
+		api.POST("/notifications/templates/reload", notificationController.ReloadTemplates)
+
+		// Silence routes
+		api.GET("/silences", silenceController.GetSilences)
+		api.POST("/silences", silenceController.CreateSilence)
+		api.GET("/silences/:id", silenceController.GetSilence)
+		api.PUT("/silences/:id", silenceController.UpdateSilence)
+		api.DELETE("/silences/:id", silenceController.DeleteSilence)
+
+		// Host routes
+		api.GET("/host/metrics", hostController.GetHostMetrics)
+
+		// Disk routes
+		api.GET("/disk", diskController.GetDiskUsage)
+
+		// Baseline routes
+		api.GET("/baselines", baselineController.GetBaselines)
+		api.GET("/baselines/:name", baselineController.GetContainerBaselines)
+
+		// Scrape routes
+		api.GET("/scrape/targets", scrapeController.GetTargets)
+
+		// Idle container routes
+		api.GET("/idle", idleController.GetIdleReport)
+		api.POST("/idle/:name/stop", idleController.StopIdleContainer)
+
+		// Recommendation routes
+		api.GET("/recommendations", recommendationController.GetRecommendations)
+		api.POST("/recommendations/:name/apply", recommendationController.ApplyRecommendation)
 	}
 
 	return router
@@ -0,0 +1,473 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"nabd/models"
+	"nabd/notify"
+	"nabd/utils"
+	"strings"
+	"time"
+)
+
+// ErrAlertNotFound is returned when no alert has the requested ID
+var ErrAlertNotFound = errors.New("alert not found")
+
+// ErrAlertResolved is returned when acknowledging or resolving an alert that is already resolved
+var ErrAlertResolved = errors.New("alert is already resolved")
+
+// ErrAlertAcknowledged is returned when acknowledging an alert a second time
+var ErrAlertAcknowledged = errors.New("alert is already acknowledged")
+
+// ErrActorRequired is returned when acknowledging or resolving without saying who did it
+var ErrActorRequired = errors.New("the person acknowledging or resolving the alert is required")
+
+// ErrInvalidNote is returned for notes without an author or text
+var ErrInvalidNote = errors.New("a note requires an author and text")
+
+// AlertService manages the lifecycle of alerts: acknowledgement, manual resolution,
+// notes, escalation and history
+type AlertService struct {
+	metricsService *MetricsService
+	config         *models.Config
+}
+
+// NewAlertService creates a new alert service
+func NewAlertService(metricsService *MetricsService, config *models.Config) *AlertService {
+	return &AlertService{
+		metricsService: metricsService,
+		config:         config,
+	}
+}
+
+// GetAlert returns an alert with its notes
+func (as *AlertService) GetAlert(id int) (models.Alert, error) {
+	rows, err := models.DB.Query(`SELECT `+alertColumns+` FROM alerts WHERE id = ?`, id)
+	if err != nil {
+		return models.Alert{}, err
+	}
+	alerts, err := scanAlerts(rows)
+	rows.Close()
+	if err != nil {
+		return models.Alert{}, err
+	}
+	if len(alerts) == 0 {
+		return models.Alert{}, ErrAlertNotFound
+	}
+
+	alert := alerts[0]
+	if alert.Notes, err = as.getNotes(id); err != nil {
+		return alert, err
+	}
+	alert.Escalations, err = as.getEscalations(id)
+	return alert, err
+}
+
+// Acknowledge records who is looking at an active alert, optionally with a note
+func (as *AlertService) Acknowledge(id int, by, note string) (models.Alert, error) {
+	if strings.TrimSpace(by) == "" {
+		return models.Alert{}, ErrActorRequired
+	}
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		alert, err := alertStateTx(tx, id)
+		if err != nil {
+			return err
+		}
+		if !alert.Active {
+			return ErrAlertResolved
+		}
+		if alert.AcknowledgedBy != "" {
+			return ErrAlertAcknowledged
+		}
+
+		if _, err := tx.Exec(`UPDATE alerts SET acknowledged_by = ?, acknowledged_at = ? WHERE id = ?`,
+			by, time.Now(), id); err != nil {
+			return err
+		}
+		return addNoteTx(tx, id, by, note)
+	})
+	if err != nil {
+		return models.Alert{}, err
+	}
+	return as.GetAlert(id)
+}
+
+// Resolve resolves an active alert by hand, optionally with a note. If its condition
+// still holds, the alert fires again at the next check.
+func (as *AlertService) Resolve(id int, by, note string) (models.Alert, error) {
+	if strings.TrimSpace(by) == "" {
+		return models.Alert{}, ErrActorRequired
+	}
+
+	var alert models.Alert
+	err := as.metricsService.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		var err error
+		alert, err = alertStateTx(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !alert.Active {
+			return nil, ErrAlertResolved
+		}
+
+		pending, err := as.metricsService.resolveAlertsTx(tx, "id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		return pending, addNoteTx(tx, id, by, note)
+	})
+	if err != nil {
+		return models.Alert{}, err
+	}
+
+	// Rules only store alerts when their state changes
+	as.metricsService.rules.Forget(alert.ContainerID, alert.Type)
+	return as.GetAlert(id)
+}
+
+// AddNote adds a note to an alert's thread
+func (as *AlertService) AddNote(id int, author, text string) (models.AlertNote, error) {
+	if strings.TrimSpace(author) == "" || strings.TrimSpace(text) == "" {
+		return models.AlertNote{}, ErrInvalidNote
+	}
+
+	note := models.AlertNote{AlertID: id, Author: author, Text: text, Timestamp: time.Now()}
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		if _, err := alertStateTx(tx, id); err != nil {
+			return err
+		}
+		return insertNoteTx(tx, &note)
+	})
+	return note, err
+}
+
+// GetAlertHistory returns active and resolved alerts matching filter, newest first
+func (as *AlertService) GetAlertHistory(filter models.AlertHistoryFilter) ([]models.Alert, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if filter.Container != "" {
+		conditions = append(conditions, "(container_id = ? OR name = ?)")
+		args = append(args, filter.Container, filter.Container)
+	}
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.Severity != "" {
+		conditions = append(conditions, "severity = ?")
+		args = append(args, filter.Severity)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "timestamp <= ?")
+		args = append(args, filter.Until)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100 // Default to 100 alerts
+	}
+
+	query := `SELECT ` + alertColumns + ` FROM alerts`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY timestamp DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := models.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts, err := scanAlerts(rows)
+	if alerts == nil {
+		alerts = []models.Alert{}
+	}
+	return alerts, err
+}
+
+// Notification returns the notification an alert sends, for previewing templates
+func (as *AlertService) Notification(id int) (notify.Notification, error) {
+	alert, err := as.GetAlert(id)
+	if err != nil {
+		return notify.Notification{}, err
+	}
+	return as.metricsService.AlertNotification(alert), nil
+}
+
+// StartEscalation periodically escalates alerts that stay active past the escalation
+// tiers and notifies the escalation policy steps of unacknowledged alerts
+func (as *AlertService) StartEscalation() {
+	escalation := as.config.Alerts.Escalation
+	if len(escalation.Tiers) == 0 && len(as.config.Routing.Policies) == 0 {
+		return
+	}
+	interval := time.Duration(escalation.Interval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second // Default to 30 seconds
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			now := time.Now()
+			if err := as.Escalate(now); err != nil {
+				log.Printf("Error escalating alerts: %v", err)
+			}
+			if err := as.NotifyUnacknowledged(now); err != nil {
+				log.Printf("Error notifying unacknowledged alerts: %v", err)
+			}
+		}
+	}()
+	log.Printf("Alert escalation started with %d tiers and %d policies", len(escalation.Tiers), len(as.config.Routing.Policies))
+}
+
+// Escalate moves every active alert to the highest escalation tier its age has reached,
+// raising its severity and recording the escalation. Escalations are notified unless
+// the alert is acknowledged, silenced, or was or is inhibited.
+func (as *AlertService) Escalate(now time.Time) error {
+	tiers := as.config.Alerts.Escalation.Tiers
+	if len(tiers) == 0 {
+		return nil
+	}
+
+	type escalation struct {
+		alert models.Alert
+		tier  models.EscalationTier
+	}
+	var escalated []escalation
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT ` + alertColumns + ` FROM alerts WHERE active = 1`)
+		if err != nil {
+			return err
+		}
+		alerts, err := scanAlerts(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		for _, alert := range alerts {
+			level := 0
+			for i, tier := range tiers {
+				if now.Sub(alert.Timestamp) >= time.Duration(tier.After)*time.Second {
+					level = i + 1
+				}
+			}
+			if level <= alert.EscalationLevel {
+				continue
+			}
+
+			tier := tiers[level-1]
+			from := alert.Severity
+			if notify.SeverityRank(tier.Severity) > notify.SeverityRank(alert.Severity) {
+				alert.Severity = tier.Severity
+			}
+			alert.EscalationLevel = level
+			alert.EscalatedAt = &now
+
+			_, err := tx.Exec(`UPDATE alerts SET severity = ?, escalation_level = ?, escalated_at = ? WHERE id = ?`,
+				alert.Severity, level, now, alert.ID)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO alert_escalations (alert_id, level, from_severity, to_severity, timestamp)
+				VALUES (?, ?, ?, ?, ?)`, alert.ID, level, from, alert.Severity, now)
+			if err != nil {
+				return err
+			}
+			escalated = append(escalated, escalation{alert: alert, tier: tier})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ms := as.metricsService
+	sources, err := ms.inhibitionSources(models.DB.Query)
+	if err != nil {
+		return err
+	}
+	for _, e := range escalated {
+		alert := e.alert
+		if _, silenced := ms.silencedBy(alert); alert.AcknowledgedBy != "" || alert.Inhibited || silenced {
+			continue
+		}
+		if ms.inhibited(alert, sources) {
+			continue
+		}
+
+		notification := notify.AlertEscalated(alert, now.Sub(alert.Timestamp))
+		if len(e.tier.Channels) > 0 {
+			ms.notifier.NotifyChannels(e.tier.Channels, describe(notification, ms.alertTarget(alert)))
+		} else {
+			ms.notifyAlert(alert, notification)
+		}
+	}
+	return nil
+}
+
+// NotifyUnacknowledged notifies the escalation policy steps that unacknowledged alerts
+// have become due for since they fired. Alerts are skipped while a silence matches them
+// and notified once it ends; inhibited alerts are skipped until they are notified again,
+// and alerts inhibited by an alert active now are notified once it resolves.
+func (as *AlertService) NotifyUnacknowledged(now time.Time) error {
+	ms := as.metricsService
+	if !ms.router.Enabled() || len(ms.router.policies) == 0 {
+		return nil
+	}
+
+	type due struct {
+		alert    models.Alert
+		channels []string
+	}
+	var notified []due
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT ` + alertColumns + ` FROM alerts
+			WHERE active = 1 AND acknowledged_by = '' AND inhibited = 0`)
+		if err != nil {
+			return err
+		}
+		alerts, err := scanAlerts(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		sources, err := ms.inhibitionSources(tx.Query)
+		if err != nil {
+			return err
+		}
+
+		for _, alert := range alerts {
+			if _, silenced := ms.silencedBy(alert); silenced || ms.inhibited(alert, sources) {
+				continue
+			}
+			policy, ok := ms.router.Policy(ms.router.Route(ms.alertTarget(alert)))
+			if !ok {
+				continue
+			}
+			steps := PolicySteps(policy, int(now.Sub(alert.Timestamp)/time.Second))
+			if steps <= alert.PolicyStep {
+				continue
+			}
+
+			var channels []string
+			for _, step := range policy.Steps[alert.PolicyStep:steps] {
+				channels = append(channels, step.Channels...)
+			}
+			if _, err := tx.Exec(`UPDATE alerts SET policy_step = ? WHERE id = ?`, steps, alert.ID); err != nil {
+				return err
+			}
+			alert.PolicyStep = steps
+			notified = append(notified, due{alert: alert, channels: uniqueStrings(channels)})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range notified {
+		notification := notify.AlertUnacknowledged(d.alert, now.Sub(d.alert.Timestamp))
+		ms.notifier.NotifyChannels(d.channels, describe(notification, ms.alertTarget(d.alert)))
+	}
+	return nil
+}
+
+// getEscalations returns the escalations of an alert, oldest first
+func (as *AlertService) getEscalations(id int) ([]models.AlertEscalation, error) {
+	rows, err := models.DB.Query(`SELECT id, alert_id, level, from_severity, to_severity, timestamp
+		FROM alert_escalations
+		WHERE alert_id = ?
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var escalations []models.AlertEscalation
+	for rows.Next() {
+		var escalation models.AlertEscalation
+		err := rows.Scan(
+			&escalation.ID,
+			&escalation.AlertID,
+			&escalation.Level,
+			&escalation.FromSeverity,
+			&escalation.ToSeverity,
+			&escalation.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		escalations = append(escalations, escalation)
+	}
+	return escalations, rows.Err()
+}
+
+// getNotes returns the notes of an alert, oldest first
+func (as *AlertService) getNotes(id int) ([]models.AlertNote, error) {
+	rows, err := models.DB.Query(`SELECT id, alert_id, author, text, timestamp
+		FROM alert_notes
+		WHERE alert_id = ?
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []models.AlertNote
+	for rows.Next() {
+		var note models.AlertNote
+		if err := rows.Scan(&note.ID, &note.AlertID, &note.Author, &note.Text, &note.Timestamp); err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+// alertStateTx reads an alert's container and type, whether it is active and who
+// acknowledged it
+func alertStateTx(tx *sql.Tx, id int) (models.Alert, error) {
+	alert := models.Alert{ID: id}
+	err := tx.QueryRow(`SELECT container_id, type, active, acknowledged_by FROM alerts WHERE id = ?`, id).
+		Scan(&alert.ContainerID, &alert.Type, &alert.Active, &alert.AcknowledgedBy)
+	if err == sql.ErrNoRows {
+		return alert, ErrAlertNotFound
+	}
+	return alert, err
+}
+
+// addNoteTx adds a note within a write transaction; empty notes are skipped
+func addNoteTx(tx *sql.Tx, id int, author, text string) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	return insertNoteTx(tx, &models.AlertNote{AlertID: id, Author: author, Text: text, Timestamp: time.Now()})
+}
+
+// insertNoteTx stores a note and sets its ID
+func insertNoteTx(tx *sql.Tx, note *models.AlertNote) error {
+	result, err := tx.Exec(`INSERT INTO alert_notes (alert_id, author, text, timestamp) VALUES (?, ?, ?, ?)`,
+		note.AlertID, note.Author, note.Text, note.Timestamp)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	note.ID = int(id)
+	return err
+}
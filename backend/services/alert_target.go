@@ -0,0 +1,136 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"nabd/models"
+	"regexp"
+	"strings"
+)
+
+// Docker Compose labels identifying a container's project and service
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+)
+
+// AlertTarget describes an alert for silence and inhibition matchers and grouping keys
+type AlertTarget struct {
+	Name     string
+	Image    string
+	Type     string
+	Severity string
+	Host     string
+	Team     string
+	Labels   map[string]string
+}
+
+// Key returns the value of a grouping key: container, image, type, severity, host, team,
+// compose_project, compose_service or label:<name>
+func (t AlertTarget) Key(key string) string {
+	switch key {
+	case "container":
+		return t.Name
+	case "image":
+		return t.Image
+	case "type":
+		return t.Type
+	case "severity":
+		return t.Severity
+	case "host":
+		return t.Host
+	case "team":
+		return t.Team
+	case "compose_project":
+		return t.Labels[composeProjectLabel]
+	case "compose_service":
+		return t.Labels[composeServiceLabel]
+	}
+	return t.Labels[strings.TrimPrefix(key, "label:")]
+}
+
+// validateKey checks that key is a grouping key known to Key
+func validateKey(key string) error {
+	switch key {
+	case "container", "image", "type", "severity", "host", "team", "compose_project", "compose_service":
+		return nil
+	}
+	if strings.HasPrefix(key, "label:") && len(key) > len("label:") {
+		return nil
+	}
+	return fmt.Errorf("unknown key %q; use container, image, type, severity, host, team, compose_project, compose_service or label:<name>", key)
+}
+
+// AlertFingerprint returns a stable identifier of an alert: the same alert type on the
+// same container (by name, so it survives the container being recreated) always has the
+// same fingerprint
+func AlertFingerprint(alert models.Alert) string {
+	sum := sha256.Sum256([]byte(alert.Name + "\x00" + alert.Type))
+	return hex.EncodeToString(sum[:8])
+}
+
+// compiledMatcher is a matcher with its regular expression compiled
+type compiledMatcher struct {
+	models.SilenceMatcher
+	regex *regexp.Regexp // nil for equality matchers
+}
+
+// compileMatchers validates matchers, filling in the default operator, and compiles them
+func compileMatchers(matchers []models.SilenceMatcher) ([]compiledMatcher, error) {
+	compiled := make([]compiledMatcher, len(matchers))
+	for i := range matchers {
+		matcher := &matchers[i]
+		if matcher.Field == "label" {
+			if matcher.Label == "" {
+				return nil, fmt.Errorf("matcher %d: label is required for label matchers", i+1)
+			}
+		} else if err := validateKey(matcher.Field); err != nil {
+			return nil, fmt.Errorf("matcher %d: %v", i+1, err)
+		}
+
+		switch matcher.Operator {
+		case "":
+			matcher.Operator = models.MatchEqual
+		case models.MatchEqual, models.MatchNotEqual:
+		case models.MatchRegex, models.MatchNotRegex:
+			regex, err := regexp.Compile("^(?:" + matcher.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("matcher %d: invalid regular expression: %v", i+1, err)
+			}
+			compiled[i].regex = regex
+		default:
+			return nil, fmt.Errorf("matcher %d: unknown operator %q; use =, !=, =~ or !~", i+1, matcher.Operator)
+		}
+		compiled[i].SilenceMatcher = *matcher
+	}
+	return compiled, nil
+}
+
+// matchAll reports whether every matcher matches target
+func matchAll(matchers []compiledMatcher, target AlertTarget) bool {
+	for _, matcher := range matchers {
+		var value string
+		if matcher.Field == "label" {
+			value = target.Labels[matcher.Label]
+		} else {
+			value = target.Key(matcher.Field)
+		}
+
+		var matched bool
+		switch matcher.Operator {
+		case models.MatchEqual:
+			matched = value == matcher.Value
+		case models.MatchNotEqual:
+			matched = value != matcher.Value
+		case models.MatchRegex:
+			matched = matcher.regex.MatchString(value)
+		case models.MatchNotRegex:
+			matched = !matcher.regex.MatchString(value)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -1,8 +1,10 @@
 package services
 
 import (
+	"database/sql"
 	"log"
 	"nabd/models"
+	"nabd/utils"
 	"time"
 )
 
@@ -61,16 +63,23 @@ func (ahs *AutoHealService) storeAutoHealEvent(event models.AutoHealEvent) error
 		(container_id, name, action, reason, success, timestamp)
 		VALUES (?, ?, ?, ?, ?, ?)`
 
-	_, err := models.DB.Exec(query,
-		event.ContainerID,
-		event.Name,
-		event.Action,
-		event.Reason,
-		event.Success,
-		event.Timestamp,
-	)
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(query,
+			event.ContainerID,
+			event.Name,
+			event.Action,
+			event.Reason,
+			event.Success,
+			event.Timestamp,
+		)
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	ahs.metricsService.notifyAutoHeal(event)
+	return nil
 }
 
 // GetAutoHealHistory returns recent auto-heal events
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"nabd/models"
+	"nabd/storage"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrInvalidBacktest is returned for backtests with an invalid time range
+var ErrInvalidBacktest = errors.New("invalid backtest")
+
+const (
+	// backtestRuleName is used for backtested rules without a name
+	backtestRuleName = "backtest"
+	// maxBacktestRange bounds the time range a backtest replays
+	maxBacktestRange = 30 * 24 * time.Hour
+)
+
+// Backtest replays a rule over the stored samples of every container in a time range
+// of at most 30 days with the same state machine as live evaluation, so the rule's for
+// duration and resolve threshold apply. Rules on scraped series replay the stored
+// scrapes, which only hold the selected series. Containers are read and replayed one
+// at a time. Stored samples carry no image or labels; the container's latest sample
+// provides them for selectors.
+func (rs *RuleService) Backtest(req models.BacktestRequest) (models.BacktestResult, error) {
+	rule := req.Rule
+	if rule.Name == "" {
+		rule.Name = backtestRuleName
+	}
+	if err := ValidateRule(&rule); err != nil {
+		return models.BacktestResult{}, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Start.IsZero() || !req.Start.Before(req.End) {
+		return models.BacktestResult{}, fmt.Errorf("%w: start must be before end", ErrInvalidBacktest)
+	}
+	if req.End.Sub(req.Start) > maxBacktestRange {
+		return models.BacktestResult{}, fmt.Errorf("%w: the range is longer than %d days", ErrInvalidBacktest, int(maxBacktestRange.Hours()/24))
+	}
+	flapWindow := time.Duration(req.FlapWindow) * time.Second
+	if flapWindow <= 0 {
+		flapWindow = 10 * time.Minute // Default to 10 minutes
+	}
+
+	engine := NewRuleEngine()
+	if _, err := engine.SetRules([]models.AlertRule{rule}); err != nil {
+		return models.BacktestResult{}, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+
+	ms := rs.metricsService
+	scraped := strings.HasPrefix(rule.Metric, ScrapedMetricPrefix)
+	series := strings.TrimPrefix(rule.Metric, ScrapedMetricPrefix)
+	var containerIDs []string
+	var err error
+	if scraped {
+		containerIDs, err = scrapedContainers(series, req.Start, req.End)
+	} else {
+		containerIDs, err = ms.store.Containers(req.Start, req.End)
+	}
+	if err != nil {
+		return models.BacktestResult{}, err
+	}
+
+	result := models.BacktestResult{
+		Rule:       rule,
+		Start:      req.Start,
+		End:        req.End,
+		Alerts:     []models.BacktestAlert{},
+		Containers: []models.BacktestContainer{},
+	}
+	for _, containerID := range containerIDs {
+		var samples []backtestSample
+		if scraped {
+			samples, err = backtestScrapes(containerID, series, req.Start, req.End)
+		} else {
+			samples, err = backtestMetrics(ms.store, containerID, req.Start, req.End)
+		}
+		if err != nil {
+			return models.BacktestResult{}, err
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		latest, hasLatest := ms.latest.Get(containerID)
+
+		last := samples[len(samples)-1].metric
+		summary := models.BacktestContainer{ContainerID: containerID, Name: last.Name}
+		var (
+			firing   *models.BacktestAlert
+			resolved time.Time
+		)
+		for _, sample := range samples {
+			metric := sample.metric
+			if hasLatest {
+				metric.Image = latest.Image
+				metric.Labels = latest.Labels
+			}
+			summary.Samples++
+
+			var ruleResults []RuleResult
+			if scraped {
+				ruleResults = engine.evaluateScrape(metric, sample.scraped)
+			} else {
+				ruleResults = engine.Evaluate(metric)
+			}
+			for _, ruleResult := range ruleResults {
+				if !ruleResult.Changed {
+					continue
+				}
+				if ruleResult.Firing {
+					if !resolved.IsZero() && metric.Timestamp.Sub(resolved) <= flapWindow {
+						summary.Flaps++
+					}
+					firing = &models.BacktestAlert{
+						ContainerID: containerID,
+						Name:        metric.Name,
+						Start:       metric.Timestamp,
+						Message:     ruleResult.Message,
+					}
+					continue
+				}
+				if firing != nil {
+					end := metric.Timestamp
+					firing.End = &end
+					firing.Duration = end.Sub(firing.Start).Seconds()
+					summary.Alerts++
+					summary.FiringSeconds += firing.Duration
+					result.Alerts = append(result.Alerts, *firing)
+					firing, resolved = nil, end
+				}
+			}
+		}
+
+		// An alert still firing lasts until the last sample
+		if firing != nil {
+			firing.Duration = last.Timestamp.Sub(firing.Start).Seconds()
+			summary.Alerts++
+			summary.FiringSeconds += firing.Duration
+			result.Alerts = append(result.Alerts, *firing)
+		}
+
+		result.Samples += summary.Samples
+		result.Containers = append(result.Containers, summary)
+	}
+
+	sort.Slice(result.Alerts, func(i, j int) bool {
+		return result.Alerts[i].Start.Before(result.Alerts[j].Start)
+	})
+	sort.Slice(result.Containers, func(i, j int) bool {
+		a, b := result.Containers[i], result.Containers[j]
+		if a.FiringSeconds != b.FiringSeconds {
+			return a.FiringSeconds > b.FiringSeconds
+		}
+		return a.Name < b.Name
+	})
+	return result, nil
+}
+
+// backtestSample is a stored container sample, or a stored scrape with its series
+type backtestSample struct {
+	metric  models.ContainerMetric
+	scraped []scrapedSeries
+}
+
+// backtestMetrics returns the stored samples of a container in [from, to], oldest first
+func backtestMetrics(store storage.MetricsStore, containerID string, from, to time.Time) ([]backtestSample, error) {
+	metrics, err := store.Range(containerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]backtestSample, len(metrics))
+	for i, metric := range metrics {
+		samples[i] = backtestSample{metric: metric}
+	}
+	return samples, nil
+}
+
+// backtestScrapes returns the stored scrapes of a container in [from, to] holding a
+// scraped series, oldest first
+func backtestScrapes(containerID, series string, from, to time.Time) ([]backtestSample, error) {
+	scrapes, err := scrapedRange(containerID, series, from, to)
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]backtestSample, len(scrapes))
+	for i, scrape := range scrapes {
+		samples[i] = backtestSample{
+			metric:  models.ContainerMetric{ContainerID: containerID, Name: scrape.name, Timestamp: scrape.at},
+			scraped: scrape.series,
+		}
+	}
+	return samples, nil
+}
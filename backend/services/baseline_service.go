@@ -0,0 +1,414 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"nabd/models"
+	"nabd/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// baselineMetrics lists the metrics that get a learned baseline, with the smallest
+// standard deviation used when scoring. The floor keeps containers with a perfectly
+// steady history (for example 0% CPU) from alerting on tiny changes.
+var baselineMetrics = []struct {
+	name        string
+	stdDevFloor float64
+}{
+	{"cpu_percent", 1.0},              // percentage points
+	{"memory_usage", 8 * 1024 * 1024}, // bytes
+	{"network_rx_rate", 1024},         // bytes per second
+	{"network_tx_rate", 1024},         // bytes per second
+}
+
+// metricBaseline is the learned state of one metric of a container
+type metricBaseline struct {
+	Overall   utils.EWMA
+	Hourly    [24]utils.EWMA
+	UpdatedAt time.Time
+}
+
+// networkCounters is a previous network reading used to compute rates
+type networkCounters struct {
+	rx int64
+	tx int64
+	at time.Time
+}
+
+type BaselineService struct {
+	metricsService *MetricsService
+	config         *models.Config
+
+	mu          sync.Mutex
+	baselines   map[string]map[string]*metricBaseline // container name -> metric -> baseline
+	prevNetwork map[string]networkCounters
+	streaks     map[string]int
+}
+
+// NewBaselineService creates a new baseline anomaly detection service
+func NewBaselineService(metricsService *MetricsService, config *models.Config) *BaselineService {
+	return &BaselineService{
+		metricsService: metricsService,
+		config:         config,
+		baselines:      make(map[string]map[string]*metricBaseline),
+		prevNetwork:    make(map[string]networkCounters),
+		streaks:        make(map[string]int),
+	}
+}
+
+// StartBaselineLearning loads stored baselines (learning them from history on first
+// run), subscribes to collected metrics and periodically persists the baselines
+func (bs *BaselineService) StartBaselineLearning() {
+	if !bs.config.Alerts.Anomaly.Enabled {
+		log.Println("Anomaly detection is disabled in configuration")
+		return
+	}
+
+	if err := bs.loadBaselines(); err != nil {
+		log.Printf("Error loading metric baselines: %v", err)
+	}
+
+	bs.mu.Lock()
+	empty := len(bs.baselines) == 0
+	bs.mu.Unlock()
+	if empty {
+		if err := bs.learnFromHistory(); err != nil {
+			log.Printf("Error learning metric baselines from history: %v", err)
+		}
+	}
+
+	bs.metricsService.AddObserver(bs)
+
+	ticker := time.NewTicker(5 * time.Minute)
+	go func() {
+		for range ticker.C {
+			if err := bs.saveBaselines(); err != nil {
+				log.Printf("Error saving metric baselines: %v", err)
+			}
+		}
+	}()
+	log.Println("Anomaly detection started")
+}
+
+// ObserveMetrics updates baselines with a collection cycle and raises or clears anomaly
+// alerts in the cycle's transaction
+func (bs *BaselineService) ObserveMetrics(tx *sql.Tx, metrics []models.ContainerMetric) ([]alertNotification, error) {
+	consecutive := bs.config.Alerts.Anomaly.Consecutive
+	if consecutive <= 0 {
+		consecutive = 1
+	}
+
+	var pending []alertNotification
+	for _, metric := range metrics {
+		anomalies := bs.Learn(metric)
+
+		bs.mu.Lock()
+		if len(anomalies) > 0 {
+			bs.streaks[metric.Name]++
+		} else {
+			bs.streaks[metric.Name] = 0
+		}
+		streak := bs.streaks[metric.Name]
+		bs.mu.Unlock()
+
+		var notifications []alertNotification
+		var err error
+		if streak >= consecutive {
+			notifications, err = bs.metricsService.storeAlertTx(tx, models.Alert{
+				ContainerID: metric.ContainerID,
+				Name:        metric.Name,
+				Type:        "anomaly",
+				Message:     describeAnomalies(anomalies),
+				Severity:    "warning",
+				Active:      true,
+				Timestamp:   time.Now(),
+			})
+		} else if streak == 0 {
+			notifications, err = bs.metricsService.deactivateAlertTx(tx, metric.ContainerID, "anomaly")
+		}
+		pending = append(pending, notifications...)
+		if err != nil {
+			log.Printf("Error updating anomaly alert for container %s: %v", metric.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// Learn scores a sample against its container's baselines, then folds it into them.
+// It returns the metrics that deviate by more than the configured number of standard
+// deviations once enough samples have been learned.
+func (bs *BaselineService) Learn(metric models.ContainerMetric) []models.MetricAnomaly {
+	settings := bs.config.Alerts.Anomaly
+	alpha := settings.Alpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.01
+	}
+	deviations := settings.Deviations
+	if deviations <= 0 {
+		deviations = 3.0
+	}
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	values := bs.baselineValues(metric)
+	containerBaselines, ok := bs.baselines[metric.Name]
+	if !ok {
+		containerBaselines = make(map[string]*metricBaseline)
+		bs.baselines[metric.Name] = containerBaselines
+	}
+
+	hour := metric.Timestamp.Hour()
+	var anomalies []models.MetricAnomaly
+	for _, spec := range baselineMetrics {
+		value, ok := values[spec.name]
+		if !ok {
+			continue
+		}
+		baseline, ok := containerBaselines[spec.name]
+		if !ok {
+			baseline = &metricBaseline{}
+			containerBaselines[spec.name] = baseline
+		}
+
+		if baseline.Overall.Count >= settings.MinSamples {
+			expected, stdDev := baseline.expected(hour, settings.MinSamples/24)
+			stdDev = math.Max(stdDev, spec.stdDevFloor)
+			if score := math.Abs(value-expected) / stdDev; score > deviations {
+				anomalies = append(anomalies, models.MetricAnomaly{
+					Name:       metric.Name,
+					Metric:     spec.name,
+					Value:      value,
+					Expected:   expected,
+					StdDev:     stdDev,
+					Deviations: score,
+					Timestamp:  metric.Timestamp,
+				})
+			}
+		}
+
+		baseline.Overall.Update(value, alpha)
+		baseline.Hourly[hour].Update(value, alpha)
+		baseline.UpdatedAt = metric.Timestamp
+	}
+
+	return anomalies
+}
+
+// expected returns the expected value and spread for an hour of the day, using the
+// seasonal bucket once it has enough samples and the overall baseline until then
+func (mb *metricBaseline) expected(hour, minBucketSamples int) (float64, float64) {
+	bucket := mb.Hourly[hour]
+	if minBucketSamples < 1 {
+		minBucketSamples = 1
+	}
+	if bucket.Count >= minBucketSamples {
+		return bucket.Mean, bucket.StdDev()
+	}
+	return mb.Overall.Mean, mb.Overall.StdDev()
+}
+
+// baselineValues derives the tracked values of a sample. Network counters are
+// converted to rates, so the first sample of a container has no network values.
+// The caller must hold mu.
+func (bs *BaselineService) baselineValues(metric models.ContainerMetric) map[string]float64 {
+	values := map[string]float64{
+		"cpu_percent":  metric.CPUPercent,
+		"memory_usage": float64(metric.MemoryUsage),
+	}
+
+	prev, ok := bs.prevNetwork[metric.Name]
+	bs.prevNetwork[metric.Name] = networkCounters{rx: metric.NetworkRx, tx: metric.NetworkTx, at: metric.Timestamp}
+	elapsed := metric.Timestamp.Sub(prev.at).Seconds()
+	// Counters reset when a container restarts
+	if ok && elapsed > 0 && metric.NetworkRx >= prev.rx && metric.NetworkTx >= prev.tx {
+		values["network_rx_rate"] = float64(metric.NetworkRx-prev.rx) / elapsed
+		values["network_tx_rate"] = float64(metric.NetworkTx-prev.tx) / elapsed
+	}
+
+	return values
+}
+
+// describeAnomalies builds an alert message for the anomalous metrics of a sample
+func describeAnomalies(anomalies []models.MetricAnomaly) string {
+	parts := make([]string, 0, len(anomalies))
+	for _, anomaly := range anomalies {
+		direction := "above"
+		if anomaly.Value < anomaly.Expected {
+			direction = "below"
+		}
+		parts = append(parts, fmt.Sprintf("%s at %.2f is %.1f deviations %s its baseline of %.2f",
+			anomaly.Metric, anomaly.Value, anomaly.Deviations, direction, anomaly.Expected))
+	}
+	return "Unusual behaviour: " + strings.Join(parts, "; ")
+}
+
+// GetBaselines returns the learned baselines, optionally only those of one container
+func (bs *BaselineService) GetBaselines(name string) []models.MetricBaseline {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	var result []models.MetricBaseline
+	for containerName, containerBaselines := range bs.baselines {
+		if name != "" && containerName != name {
+			continue
+		}
+		for metricName, baseline := range containerBaselines {
+			entry := models.MetricBaseline{
+				Name:      containerName,
+				Metric:    metricName,
+				Mean:      baseline.Overall.Mean,
+				StdDev:    baseline.Overall.StdDev(),
+				Samples:   baseline.Overall.Count,
+				UpdatedAt: baseline.UpdatedAt,
+			}
+			for hour, bucket := range baseline.Hourly {
+				if bucket.Count == 0 {
+					continue
+				}
+				entry.Hourly = append(entry.Hourly, models.BaselineBucket{
+					Hour:    hour,
+					Mean:    bucket.Mean,
+					StdDev:  bucket.StdDev(),
+					Samples: bucket.Count,
+				})
+			}
+			result = append(result, entry)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Metric < result[j].Metric
+	})
+	return result
+}
+
+// learnFromHistory replays stored metrics to build initial baselines, reading one
+// container at a time
+func (bs *BaselineService) learnFromHistory() error {
+	days := bs.config.Alerts.Anomaly.LearnDays
+	if days <= 0 {
+		days = 7
+	}
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+	store := bs.metricsService.store
+	containerIDs, err := store.Containers(since, now)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, containerID := range containerIDs {
+		samples, err := store.Range(containerID, since, now)
+		if err != nil {
+			return err
+		}
+		for _, metric := range samples {
+			bs.Learn(metric)
+			count++
+		}
+	}
+
+	if count > 0 {
+		log.Printf("Learned metric baselines from %d historical samples", count)
+		return bs.saveBaselines()
+	}
+	return nil
+}
+
+// loadBaselines reads persisted baselines from the database
+func (bs *BaselineService) loadBaselines() error {
+	rows, err := models.DB.Query(`SELECT name, metric, overall, hourly, updated_at FROM metric_baselines`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	for rows.Next() {
+		var name, metric, overall, hourly string
+		baseline := &metricBaseline{}
+		if err := rows.Scan(&name, &metric, &overall, &hourly, &baseline.UpdatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(overall), &baseline.Overall); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(hourly), &baseline.Hourly); err != nil {
+			return err
+		}
+
+		if bs.baselines[name] == nil {
+			bs.baselines[name] = make(map[string]*metricBaseline)
+		}
+		bs.baselines[name][metric] = baseline
+	}
+
+	return rows.Err()
+}
+
+// saveBaselines persists all baselines and forgets those of containers that have not
+// reported for longer than the learning period
+func (bs *BaselineService) saveBaselines() error {
+	days := bs.config.Alerts.Anomaly.LearnDays
+	if days <= 0 {
+		days = 7
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	type row struct {
+		name, metric, overall, hourly string
+		updatedAt                     time.Time
+	}
+	var rowsToSave []row
+
+	bs.mu.Lock()
+	for name, containerBaselines := range bs.baselines {
+		for metric, baseline := range containerBaselines {
+			if baseline.UpdatedAt.Before(cutoff) {
+				delete(containerBaselines, metric)
+				continue
+			}
+			overall, _ := json.Marshal(baseline.Overall)
+			hourly, _ := json.Marshal(baseline.Hourly)
+			rowsToSave = append(rowsToSave, row{name, metric, string(overall), string(hourly), baseline.UpdatedAt})
+		}
+		if len(containerBaselines) == 0 {
+			delete(bs.baselines, name)
+			delete(bs.prevNetwork, name)
+			delete(bs.streaks, name)
+		}
+	}
+	bs.mu.Unlock()
+
+	return utils.WriteTx(func(tx *sql.Tx) error {
+		stmt, err := tx.Prepare(`INSERT OR REPLACE INTO metric_baselines
+			(name, metric, overall, hourly, updated_at) VALUES (?, ?, ?, ?, ?)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, r := range rowsToSave {
+			if _, err := stmt.Exec(r.name, r.metric, r.overall, r.hourly, r.updatedAt); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`DELETE FROM metric_baselines WHERE updated_at < ?`, cutoff)
+		return err
+	})
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"nabd/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// unlimitedMemoryThreshold is the value above which a cgroup v1 memory limit means "no limit"
+const unlimitedMemoryThreshold = int64(1) << 62
+
+// CgroupStats is a raw snapshot of a container's cgroup counters
+type CgroupStats struct {
+	CPUUsageNanos uint64
+	MemoryUsage   int64
+	MemoryLimit   int64
+	BlockRead     int64
+	BlockWrite    int64
+	Pids          int64
+}
+
+// NetDevCounters holds the byte counters of a single network interface
+type NetDevCounters struct {
+	RxBytes int64
+	TxBytes int64
+}
+
+// cpuSample is a previous CPU usage reading used to compute a usage rate
+type cpuSample struct {
+	usage uint64
+	at    time.Time
+}
+
+// CgroupCollector reads container metrics directly from the cgroup filesystem and
+// procfs. It avoids the Docker stats API, which takes about a second per call.
+type CgroupCollector struct {
+	client     *client.Client
+	cgroupRoot string
+	procRoot   string
+
+	mu      sync.Mutex
+	prevCPU map[string]cpuSample
+	pids    map[string]int
+}
+
+// NewCgroupCollector creates a collector reading from the given cgroup and proc roots
+func NewCgroupCollector(cli *client.Client, cgroupRoot, procRoot string) *CgroupCollector {
+	if cgroupRoot == "" {
+		cgroupRoot = "/sys/fs/cgroup"
+	}
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+
+	return &CgroupCollector{
+		client:     cli,
+		cgroupRoot: cgroupRoot,
+		procRoot:   procRoot,
+		prevCPU:    make(map[string]cpuSample),
+		pids:       make(map[string]int),
+	}
+}
+
+func (cc *CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+// Collect reads a container's counters from the cgroup filesystem and its network
+// counters from the network namespace of its init process
+func (cc *CgroupCollector) Collect(ctx context.Context, container types.Container) (models.ContainerMetric, error) {
+	stats, err := cc.ReadCgroupStats(container.ID)
+	if err != nil {
+		return models.ContainerMetric{}, err
+	}
+
+	networkRx, networkTx, err := cc.readNetwork(ctx, container.ID)
+	if err != nil {
+		return models.ContainerMetric{}, err
+	}
+
+	now := time.Now()
+	return models.ContainerMetric{
+		ContainerID: container.ID[:12],
+		Name:        strings.TrimPrefix(container.Names[0], "/"),
+		CPUPercent:  cc.cpuPercent(container.ID, stats.CPUUsageNanos, now),
+		MemoryUsage: stats.MemoryUsage,
+		MemoryLimit: stats.MemoryLimit,
+		NetworkRx:   networkRx,
+		NetworkTx:   networkTx,
+		BlockRead:   stats.BlockRead,
+		BlockWrite:  stats.BlockWrite,
+		Pids:        stats.Pids,
+		Status:      container.Status,
+		Timestamp:   now,
+	}, nil
+}
+
+// Retain drops the previous CPU readings and cached PIDs of containers that are no
+// longer running, so a PID reused by another process is never read as theirs
+func (cc *CgroupCollector) Retain(ids map[string]bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	for id := range cc.prevCPU {
+		if !ids[id] {
+			delete(cc.prevCPU, id)
+		}
+	}
+	for id := range cc.pids {
+		if !ids[id] {
+			delete(cc.pids, id)
+		}
+	}
+}
+
+// cpuPercent converts a cumulative CPU usage counter into a percentage of one core
+// since the previous reading. The first reading of a container returns 0.
+func (cc *CgroupCollector) cpuPercent(containerID string, usage uint64, now time.Time) float64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	prev, ok := cc.prevCPU[containerID]
+	cc.prevCPU[containerID] = cpuSample{usage: usage, at: now}
+
+	if !ok || usage < prev.usage {
+		return 0.0
+	}
+	elapsed := now.Sub(prev.at)
+	if elapsed <= 0 {
+		return 0.0
+	}
+	return float64(usage-prev.usage) / float64(elapsed.Nanoseconds()) * 100.0
+}
+
+// ReadCgroupStats reads the raw counters of a container from the cgroup filesystem.
+// Both the unified (v2) hierarchy and the per-controller (v1) hierarchies are supported.
+func (cc *CgroupCollector) ReadCgroupStats(containerID string) (CgroupStats, error) {
+	if _, err := os.Stat(filepath.Join(cc.cgroupRoot, "cgroup.controllers")); err == nil {
+		return cc.readCgroupV2Stats(containerID)
+	}
+	return cc.readCgroupV1Stats(containerID)
+}
+
+// readCgroupV2Stats reads counters from the unified hierarchy
+func (cc *CgroupCollector) readCgroupV2Stats(containerID string) (CgroupStats, error) {
+	var stats CgroupStats
+
+	dir, err := findContainerCgroup(cc.cgroupRoot, containerID)
+	if err != nil {
+		return stats, err
+	}
+
+	cpuStat, err := readKeyValueFile(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return stats, err
+	}
+	stats.CPUUsageNanos = uint64(cpuStat["usage_usec"]) * 1000
+
+	if stats.MemoryUsage, err = readIntFile(filepath.Join(dir, "memory.current")); err != nil {
+		return stats, err
+	}
+	stats.MemoryLimit, err = readIntFile(filepath.Join(dir, "memory.max"))
+	if err != nil && !os.IsNotExist(err) {
+		return stats, err
+	}
+	if stats.MemoryLimit <= 0 {
+		stats.MemoryLimit = cc.hostMemoryTotal()
+	}
+
+	// io.stat lines look like "8:0 rbytes=1024 wbytes=2048 rios=1 wios=2 ..."
+	if err := scanLines(filepath.Join(dir, "io.stat"), func(line string) {
+		for _, field := range strings.Fields(line) {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				continue
+			}
+			n, _ := strconv.ParseInt(value, 10, 64)
+			switch key {
+			case "rbytes":
+				stats.BlockRead += n
+			case "wbytes":
+				stats.BlockWrite += n
+			}
+		}
+	}); err != nil && !os.IsNotExist(err) {
+		return stats, err
+	}
+
+	stats.Pids, err = readIntFile(filepath.Join(dir, "pids.current"))
+	if err != nil && !os.IsNotExist(err) {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// readCgroupV1Stats reads counters from the per-controller hierarchies
+func (cc *CgroupCollector) readCgroupV1Stats(containerID string) (CgroupStats, error) {
+	var stats CgroupStats
+
+	cpuDir, err := cc.v1ControllerDir(containerID, "cpuacct", "cpu,cpuacct")
+	if err != nil {
+		return stats, err
+	}
+	usage, err := readIntFile(filepath.Join(cpuDir, "cpuacct.usage"))
+	if err != nil {
+		return stats, err
+	}
+	stats.CPUUsageNanos = uint64(usage)
+
+	memoryDir, err := cc.v1ControllerDir(containerID, "memory")
+	if err != nil {
+		return stats, err
+	}
+	if stats.MemoryUsage, err = readIntFile(filepath.Join(memoryDir, "memory.usage_in_bytes")); err != nil {
+		return stats, err
+	}
+	if stats.MemoryLimit, err = readIntFile(filepath.Join(memoryDir, "memory.limit_in_bytes")); err != nil {
+		return stats, err
+	}
+	if stats.MemoryLimit <= 0 || stats.MemoryLimit >= unlimitedMemoryThreshold {
+		stats.MemoryLimit = cc.hostMemoryTotal()
+	}
+
+	// blkio lines look like "8:0 Read 1024"; the trailing "Total" line is skipped
+	if blkioDir, err := cc.v1ControllerDir(containerID, "blkio"); err == nil {
+		if err := scanLines(filepath.Join(blkioDir, "blkio.throttle.io_service_bytes"), func(line string) {
+			fields := strings.Fields(line)
+			if len(fields) != 3 {
+				return
+			}
+			n, _ := strconv.ParseInt(fields[2], 10, 64)
+			switch fields[1] {
+			case "Read":
+				stats.BlockRead += n
+			case "Write":
+				stats.BlockWrite += n
+			}
+		}); err != nil && !os.IsNotExist(err) {
+			return stats, err
+		}
+	}
+
+	if pidsDir, err := cc.v1ControllerDir(containerID, "pids"); err == nil {
+		stats.Pids, err = readIntFile(filepath.Join(pidsDir, "pids.current"))
+		if err != nil && !os.IsNotExist(err) {
+			return stats, err
+		}
+	}
+
+	return stats, nil
+}
+
+// v1ControllerDir finds a container's cgroup directory under the first matching controller
+func (cc *CgroupCollector) v1ControllerDir(containerID string, controllers ...string) (string, error) {
+	var lastErr error
+	for _, controller := range controllers {
+		dir, err := findContainerCgroup(filepath.Join(cc.cgroupRoot, controller), containerID)
+		if err == nil {
+			return dir, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// findContainerCgroup locates a container's cgroup directory for both the systemd
+// and the cgroupfs cgroup drivers
+func findContainerCgroup(base, containerID string) (string, error) {
+	candidates := []string{
+		filepath.Join(base, "system.slice", "docker-"+containerID+".scope"),
+		filepath.Join(base, "docker", containerID),
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("cgroup not found for container %s under %s", shortID(containerID), base)
+}
+
+// hostMemoryTotal returns the host's total memory, used as the limit of unlimited containers
+func (cc *CgroupCollector) hostMemoryTotal() int64 {
+	meminfo, err := readMeminfo(filepath.Join(cc.procRoot, "meminfo"))
+	if err != nil {
+		return 0
+	}
+	return meminfo["MemTotal"]
+}
+
+// readNetwork sums the interface counters of a container's network namespace
+func (cc *CgroupCollector) readNetwork(ctx context.Context, containerID string) (int64, int64, error) {
+	pid, err := cc.containerPid(ctx, containerID, false)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	counters, err := readNetDevFile(filepath.Join(cc.procRoot, strconv.Itoa(pid), "net", "dev"))
+	if err != nil {
+		// The container may have been restarted with a new init process
+		if pid, err = cc.containerPid(ctx, containerID, true); err != nil {
+			return 0, 0, err
+		}
+		if counters, err = readNetDevFile(filepath.Join(cc.procRoot, strconv.Itoa(pid), "net", "dev")); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var rx, tx int64
+	for iface, counter := range counters {
+		if iface == "lo" {
+			continue
+		}
+		rx += counter.RxBytes
+		tx += counter.TxBytes
+	}
+	return rx, tx, nil
+}
+
+// containerPid returns the host PID of a container's init process, cached between calls
+func (cc *CgroupCollector) containerPid(ctx context.Context, containerID string, refresh bool) (int, error) {
+	cc.mu.Lock()
+	pid, ok := cc.pids[containerID]
+	cc.mu.Unlock()
+	if ok && !refresh {
+		return pid, nil
+	}
+
+	if cc.client == nil {
+		return 0, fmt.Errorf("no Docker client to resolve PID of container %s", shortID(containerID))
+	}
+	info, err := cc.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return 0, err
+	}
+	if info.State == nil || info.State.Pid == 0 {
+		return 0, fmt.Errorf("container %s has no running process", shortID(containerID))
+	}
+
+	cc.mu.Lock()
+	cc.pids[containerID] = info.State.Pid
+	cc.mu.Unlock()
+	return info.State.Pid, nil
+}
+
+// ParseNetDev parses the contents of a /proc/<pid>/net/dev file into per-interface counters
+func ParseNetDev(r io.Reader) (map[string]NetDevCounters, error) {
+	counters := make(map[string]NetDevCounters)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		iface, data, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			// Header lines have no interface separator
+			continue
+		}
+		fields := strings.Fields(data)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := strconv.ParseInt(fields[8], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		counters[strings.TrimSpace(iface)] = NetDevCounters{RxBytes: rx, TxBytes: tx}
+	}
+	return counters, scanner.Err()
+}
+
+// readNetDevFile parses a net/dev file from disk
+func readNetDevFile(path string) (map[string]NetDevCounters, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseNetDev(file)
+}
+
+// readMeminfo parses a meminfo file into byte values keyed by field name
+func readMeminfo(path string) (map[string]int64, error) {
+	values := make(map[string]int64)
+	err := scanLines(path, func(line string) {
+		key, rest, found := strings.Cut(line, ":")
+		if !found {
+			return
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return
+		}
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		values[key] = n
+	})
+	return values, err
+}
+
+// readIntFile reads a file holding a single integer. The value "max" is returned as 0.
+func readIntFile(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// readKeyValueFile reads a file of "key value" lines such as cpu.stat
+func readKeyValueFile(path string) (map[string]int64, error) {
+	values := make(map[string]int64)
+	err := scanLines(path, func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return
+		}
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	})
+	return values, err
+}
+
+// scanLines calls fn for every line of a file
+func scanLines(path string, fn func(line string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// shortID returns the 12 character form of a container ID
+func shortID(containerID string) string {
+	if len(containerID) > 12 {
+		return containerID[:12]
+	}
+	return containerID
+}
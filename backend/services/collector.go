@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"nabd/models"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// StatsCollector produces a metric sample for a single running container
+type StatsCollector interface {
+	// Name identifies the collector in logs and configuration
+	Name() string
+	// Collect reads the current resource usage of a container
+	Collect(ctx context.Context, container types.Container) (models.ContainerMetric, error)
+	// Retain drops any state kept for containers not in ids, keyed by full container ID.
+	// It is called once per collection with the running containers.
+	Retain(ids map[string]bool)
+}
+
+// dockerStatsCollector reads container metrics from the Docker stats API
+type dockerStatsCollector struct {
+	client *client.Client
+}
+
+func newDockerStatsCollector(cli *client.Client) *dockerStatsCollector {
+	return &dockerStatsCollector{client: cli}
+}
+
+func (dc *dockerStatsCollector) Name() string {
+	return "docker"
+}
+
+// Retain does nothing; the Docker stats API keeps no state between calls
+func (dc *dockerStatsCollector) Retain(ids map[string]bool) {}
+
+// Collect gets a one-shot stats sample for a container from the Docker API
+func (dc *dockerStatsCollector) Collect(ctx context.Context, container types.Container) (models.ContainerMetric, error) {
+	name := strings.TrimPrefix(container.Names[0], "/")
+
+	// Get container stats
+	stats, err := dc.client.ContainerStats(ctx, container.ID, false)
+	if err != nil {
+		return models.ContainerMetric{}, err
+	}
+	defer stats.Body.Close()
+
+	var statsData types.StatsJSON
+	if err := json.NewDecoder(stats.Body).Decode(&statsData); err != nil {
+		return models.ContainerMetric{}, err
+	}
+
+	metric := metricFromStats(&statsData)
+	metric.ContainerID = container.ID[:12]
+	metric.Name = name
+	metric.Status = container.Status
+	metric.Timestamp = time.Now()
+	return metric, nil
+}
+
+// metricFromStats converts a Docker stats payload into a metric without container identity fields
+func metricFromStats(statsData *types.StatsJSON) models.ContainerMetric {
+	// Get network stats
+	var networkRx, networkTx int64
+	for _, network := range statsData.Networks {
+		networkRx += int64(network.RxBytes)
+		networkTx += int64(network.TxBytes)
+	}
+
+	// Get block I/O stats (cgroup v1 reports "Read", cgroup v2 reports "read")
+	var blockRead, blockWrite int64
+	for _, entry := range statsData.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			blockRead += int64(entry.Value)
+		case "write":
+			blockWrite += int64(entry.Value)
+		}
+	}
+
+	return models.ContainerMetric{
+		CPUPercent:  calculateCPUPercent(statsData),
+		MemoryUsage: int64(statsData.MemoryStats.Usage),
+		MemoryLimit: int64(statsData.MemoryStats.Limit),
+		NetworkRx:   networkRx,
+		NetworkTx:   networkTx,
+		BlockRead:   blockRead,
+		BlockWrite:  blockWrite,
+		Pids:        int64(statsData.PidsStats.Current),
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"nabd/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// logSizeSample is a previous log file size used to compute a growth rate
+type logSizeSample struct {
+	size int64
+	at   time.Time
+}
+
+type DiskService struct {
+	dockerService  *DockerService
+	metricsService *MetricsService
+	config         *models.Config
+
+	mu       sync.Mutex
+	latest   *models.DiskUsageReport
+	logSizes map[string]logSizeSample
+}
+
+// NewDiskService creates a new disk usage service
+func NewDiskService(dockerService *DockerService, metricsService *MetricsService, config *models.Config) *DiskService {
+	return &DiskService{
+		dockerService:  dockerService,
+		metricsService: metricsService,
+		config:         config,
+		logSizes:       make(map[string]logSizeSample),
+	}
+}
+
+// StartDiskMonitoring starts the periodic disk usage check
+func (dks *DiskService) StartDiskMonitoring() {
+	if !dks.config.Disk.Enabled {
+		log.Println("Disk usage monitoring is disabled in configuration")
+		return
+	}
+
+	interval := time.Duration(dks.config.Disk.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute // Default to 5 minutes
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if _, err := dks.CheckDiskUsage(); err != nil {
+				log.Printf("Error checking disk usage: %v", err)
+			}
+		}
+	}()
+	log.Printf("Disk usage monitoring started with %v interval", interval)
+}
+
+// GetDiskUsage returns the latest disk usage report, collecting one if none exists yet
+// or refresh is set. It never raises or clears alerts; only the periodic check does.
+func (dks *DiskService) GetDiskUsage(refresh bool) (*models.DiskUsageReport, error) {
+	dks.mu.Lock()
+	latest := dks.latest
+	dks.mu.Unlock()
+
+	if latest != nil && !refresh {
+		return latest, nil
+	}
+	return dks.collectDiskUsage(false)
+}
+
+// CheckDiskUsage collects a disk usage report and raises or clears disk alerts
+func (dks *DiskService) CheckDiskUsage() (*models.DiskUsageReport, error) {
+	report, err := dks.collectDiskUsage(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := dks.checkDiskAlerts(*report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// collectDiskUsage collects a disk usage report and keeps it as the latest one. Only
+// periodic collections record the log sizes growth rates are measured against, so
+// reads in between cannot shorten the interval of the next periodic check.
+func (dks *DiskService) collectDiskUsage(periodic bool) (*models.DiskUsageReport, error) {
+	// "docker system df" walks every layer and can take a while on busy hosts
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	usage, err := dks.dockerService.GetDiskUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := SummarizeDiskUsage(usage)
+	for i := range report.PerContainer {
+		dks.inspectLogs(ctx, &report.PerContainer[i], periodic)
+	}
+
+	dks.mu.Lock()
+	dks.latest = &report
+	// Forget the log sizes of removed containers
+	current := make(map[string]bool, len(report.PerContainer))
+	for _, usage := range report.PerContainer {
+		current[usage.ContainerID] = true
+	}
+	for id := range dks.logSizes {
+		if !current[id] {
+			delete(dks.logSizes, id)
+		}
+	}
+	dks.mu.Unlock()
+
+	return &report, nil
+}
+
+// SummarizeDiskUsage converts a "docker system df" response into a report. Log file
+// details are left empty since they require inspecting each container.
+func SummarizeDiskUsage(usage types.DiskUsage) models.DiskUsageReport {
+	report := models.DiskUsageReport{
+		LayersSize: usage.LayersSize,
+		Timestamp:  time.Now(),
+	}
+
+	for _, image := range usage.Images {
+		report.Images.Count++
+		report.Images.Size += image.Size
+		if image.Containers == 0 {
+			report.Images.Reclaimable += image.Size - image.SharedSize
+		}
+		if isDanglingImage(image) {
+			report.Dangling.Count++
+			report.Dangling.Size += image.Size
+			report.Dangling.Reclaimable += image.Size - image.SharedSize
+		}
+	}
+
+	for _, container := range usage.Containers {
+		report.Containers.Count++
+		report.Containers.Size += container.SizeRw
+		if container.State != "running" {
+			report.Containers.Reclaimable += container.SizeRw
+		}
+
+		name := ""
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		report.PerContainer = append(report.PerContainer, models.ContainerDiskUsage{
+			ContainerID: shortID(container.ID),
+			Name:        name,
+			Image:       container.Image,
+			State:       container.State,
+			SizeRw:      container.SizeRw,
+			SizeRootFs:  container.SizeRootFs,
+		})
+	}
+	sort.Slice(report.PerContainer, func(i, j int) bool {
+		return report.PerContainer[i].SizeRw > report.PerContainer[j].SizeRw
+	})
+
+	for _, volume := range usage.Volumes {
+		report.Volumes.Count++
+		if volume.UsageData == nil || volume.UsageData.Size < 0 {
+			continue
+		}
+		report.Volumes.Size += volume.UsageData.Size
+		if volume.UsageData.RefCount == 0 {
+			report.Volumes.Reclaimable += volume.UsageData.Size
+		}
+	}
+
+	for _, cache := range usage.BuildCache {
+		report.BuildCache.Count++
+		report.BuildCache.Size += cache.Size
+		if !cache.InUse && !cache.Shared {
+			report.BuildCache.Reclaimable += cache.Size
+		}
+	}
+
+	return report
+}
+
+// isDanglingImage reports whether an image has no tags
+func isDanglingImage(image *types.ImageSummary) bool {
+	for _, tag := range image.RepoTags {
+		if tag != "<none>:<none>" {
+			return false
+		}
+	}
+	return true
+}
+
+// inspectLogs fills in the log driver configuration, log file size and growth rate of a
+// container. The growth rate is measured since the last periodic collection, and
+// record keeps the size as the new baseline.
+func (dks *DiskService) inspectLogs(ctx context.Context, usage *models.ContainerDiskUsage, record bool) {
+	info, err := dks.dockerService.InspectContainer(ctx, usage.ContainerID)
+	if err != nil {
+		log.Printf("Error inspecting container %s: %v", usage.Name, err)
+		return
+	}
+
+	if info.HostConfig != nil {
+		usage.LogDriver = info.HostConfig.LogConfig.Type
+		usage.LogMaxSize = info.HostConfig.LogConfig.Config["max-size"]
+	}
+	usage.LogUnbounded = usage.LogDriver == "json-file" && usage.LogMaxSize == ""
+	usage.LogPath = info.LogPath
+	if usage.LogPath == "" {
+		return
+	}
+
+	// When Nabd runs in a container the host filesystem is mounted under host_root
+	stat, err := os.Stat(filepath.Join(dks.config.Disk.HostRoot, usage.LogPath))
+	if err != nil {
+		return
+	}
+	usage.LogSize = stat.Size()
+
+	now := time.Now()
+	dks.mu.Lock()
+	prev, ok := dks.logSizes[usage.ContainerID]
+	if record {
+		dks.logSizes[usage.ContainerID] = logSizeSample{size: usage.LogSize, at: now}
+	}
+	dks.mu.Unlock()
+
+	// A shrinking file has been rotated or truncated; wait for the next sample
+	if ok && usage.LogSize >= prev.size {
+		if elapsed := now.Sub(prev.at); elapsed > 0 {
+			usage.LogGrowthPerHour = int64(float64(usage.LogSize-prev.size) / elapsed.Hours())
+		}
+	}
+}
+
+// checkDiskAlerts raises or clears disk alerts for a report
+func (dks *DiskService) checkDiskAlerts(report models.DiskUsageReport) error {
+	thresholds := dks.config.Alerts.Disk
+	const mb = 1024 * 1024
+
+	hostname := HostAlertID
+	if name, err := os.Hostname(); err == nil {
+		hostname = name
+	}
+	// Write every alert change of the report in one transaction
+	return dks.metricsService.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		danglingMB := report.Dangling.Size / mb
+		pending, err := dks.metricsService.updateAlertTx(tx, HostAlertID, hostname, "dangling_images",
+			thresholds.DanglingImagesMB > 0 && danglingMB > thresholds.DanglingImagesMB,
+			fmt.Sprintf("%d dangling images use %d MB", report.Dangling.Count, danglingMB))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, usage := range report.PerContainer {
+			// Stopped containers do not take part in the metrics cycle, which clears their alerts
+			if usage.State != "running" {
+				continue
+			}
+
+			checks := []struct {
+				alertType string
+				firing    bool
+				message   string
+			}{
+				{"large_writable_layer", thresholds.WritableLayerMB > 0 && usage.SizeRw/mb > thresholds.WritableLayerMB,
+					fmt.Sprintf("Writable layer is %d MB", usage.SizeRw/mb)},
+				{"large_log_file", thresholds.LogSizeMB > 0 && usage.LogSize/mb > thresholds.LogSizeMB,
+					fmt.Sprintf("Log file is %d MB", usage.LogSize/mb)},
+				{"fast_log_growth", thresholds.LogGrowthMBHour > 0 && usage.LogGrowthPerHour/mb > thresholds.LogGrowthMBHour,
+					fmt.Sprintf("Log file is growing by %d MB per hour", usage.LogGrowthPerHour/mb)},
+				{"unbounded_log", thresholds.UnboundedLogs && usage.LogUnbounded,
+					"json-file log has no max-size and will grow without limit"},
+			}
+
+			for _, check := range checks {
+				notifications, err := dks.metricsService.updateAlertTx(tx, usage.ContainerID, usage.Name, check.alertType, check.firing, check.message)
+				if err != nil {
+					return nil, err
+				}
+				pending = append(pending, notifications...)
+			}
+		}
+
+		return pending, nil
+	})
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package services
+
+import "syscall"
+
+// diskUsage returns the used and total bytes of the filesystem holding path
+func diskUsage(path string) (int64, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, 0, err
+	}
+
+	total := int64(stat.Blocks) * int64(stat.Bsize)
+	free := int64(stat.Bfree) * int64(stat.Bsize)
+	return total - free, total, nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package services
+
+import "errors"
+
+// diskUsage is not supported on Windows hosts
+func diskUsage(path string) (int64, int64, error) {
+	return 0, 0, errors.New("disk usage is not supported on windows")
+}
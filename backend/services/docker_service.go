@@ -7,17 +7,43 @@ import (
 	"io"
 	"log"
 	"nabd/models"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 )
 
+const (
+	// stateRefreshInterval is how long the inspected state of a container is reused
+	// before it is inspected again, in case a Docker event was missed
+	stateRefreshInterval = 5 * time.Minute
+	// eventRetryDelay is the wait before following the Docker event stream again
+	eventRetryDelay = 5 * time.Second
+)
+
+// containerState is the part of a container inspect response that collection needs
+// and ContainerList does not report
+type containerState struct {
+	info        types.ContainerJSON
+	inspectedAt time.Time
+}
+
 type DockerService struct {
-	client *client.Client
-	config *models.Config
+	client    *client.Client
+	config    *models.Config
+	collector StatsCollector
+
+	stateMu sync.Mutex
+	// states caches the inspected state of running containers by short ID
+	states map[string]containerState
 }
 
 // NewDockerService creates a new Docker service instance
@@ -27,9 +53,22 @@ func NewDockerService(config *models.Config) (*DockerService, error) {
 		return nil, err
 	}
 
+	var collector StatsCollector
+	switch config.Metrics.Collector {
+	case "", "docker":
+		collector = newDockerStatsCollector(cli)
+	case "cgroup":
+		collector = NewCgroupCollector(cli, config.Metrics.CgroupRoot, config.Metrics.ProcRoot)
+	default:
+		return nil, fmt.Errorf("unknown metrics collector: %s", config.Metrics.Collector)
+	}
+	log.Printf("Using %s metrics collector", collector.Name())
+
 	return &DockerService{
-		client: cli,
-		config: config,
+		client:    cli,
+		config:    config,
+		collector: collector,
+		states:    make(map[string]containerState),
 	}, nil
 }
 
@@ -43,17 +82,7 @@ func (ds *DockerService) GetContainers() ([]models.ContainerInfo, error) {
 	var result []models.ContainerInfo
 	for _, container := range containers {
 		name := strings.TrimPrefix(container.Names[0], "/")
-		
-		// Check if container is in exclusion list
-		excluded := false
-		for _, excludedName := range ds.config.AutoHeal.ExcludeContainers {
-			if name == excludedName {
-				excluded = true
-				break
-			}
-		}
-		
-		if excluded {
+		if ds.isExcluded(name) {
 			continue
 		}
 		
@@ -70,82 +99,493 @@ func (ds *DockerService) GetContainers() ([]models.ContainerInfo, error) {
 	return result, nil
 }
 
+// CollectionResult is the outcome of one collection run over the running containers
+type CollectionResult struct {
+	Metrics []models.ContainerMetric
+	Errors  []models.CollectionError
+	// Running holds the IDs of all running containers, including those not sampled this run
+	Running []string
+}
+
 // GetContainerMetrics collects metrics for all running containers (excluding those in the exclusion list)
 func (ds *DockerService) GetContainerMetrics() ([]models.ContainerMetric, error) {
-	containers, err := ds.client.ContainerList(context.Background(), types.ContainerListOptions{})
+	result, err := ds.CollectContainerMetrics(context.Background(), nil)
+	return result.Metrics, err
+}
+
+// CollectContainerMetrics collects metrics for the running containers selected by due
+// (all of them when due is nil) using a bounded worker pool. Each stats call gets its
+// own timeout so a single slow container cannot stall the whole cycle; failures are
+// returned per container instead of aborting.
+func (ds *DockerService) CollectContainerMetrics(ctx context.Context, due func(name string) bool) (CollectionResult, error) {
+	var collection CollectionResult
+
+	containers, err := ds.client.ContainerList(ctx, types.ContainerListOptions{})
 	if err != nil {
-		return nil, err
+		return collection, err
 	}
 
-	var metrics []models.ContainerMetric
+	var targets []types.Container
+	running := make(map[string]bool, len(containers))
 	for _, container := range containers {
 		name := strings.TrimPrefix(container.Names[0], "/")
-		
-		// Check if container is in exclusion list
-		excluded := false
-		for _, excludedName := range ds.config.AutoHeal.ExcludeContainers {
-			if name == excludedName {
-				excluded = true
-				break
-			}
+		if ds.isExcluded(name) {
+			continue
 		}
 		
-		if excluded {
+		collection.Running = append(collection.Running, container.ID[:12])
+		running[container.ID] = true
+		if due != nil && !due(name) {
 			continue
 		}
-		
-		metric, err := ds.getContainerMetric(container)
-		if err != nil {
-			log.Printf("Error getting metrics for container %s: %v", container.ID[:12], err)
+		targets = append(targets, container)
+	}
+	ds.retainStates(collection.Running)
+	ds.collector.Retain(running)
+
+	type result struct {
+		metric models.ContainerMetric
+		err    error
+	}
+	results := make([]result, len(targets))
+
+	workers := ds.config.Metrics.Workers
+	if workers <= 0 {
+		workers = 8 // Default to 8 workers
+	}
+	if workers > len(targets) {
+		workers = len(targets)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				metric, err := ds.getContainerMetric(ctx, targets[i])
+				results[i] = result{metric: metric, err: err}
+			}
+		}()
+	}
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, res := range results {
+		if res.err != nil {
+			log.Printf("Error getting metrics for container %s: %v", targets[i].ID[:12], res.err)
+			collection.Errors = append(collection.Errors, models.CollectionError{
+				ContainerID: targets[i].ID[:12],
+				Name:        strings.TrimPrefix(targets[i].Names[0], "/"),
+				Error:       res.err.Error(),
+				Timestamp:   time.Now(),
+			})
 			continue
 		}
-		metrics = append(metrics, metric)
+		collection.Metrics = append(collection.Metrics, res.metric)
+	}
+
+	return collection, nil
+}
+
+// statsTimeout returns the per-container timeout for a stats call
+func (ds *DockerService) statsTimeout() time.Duration {
+	timeout := time.Duration(ds.config.Metrics.StatsTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second // Default to 5 seconds
+	}
+	return timeout
+}
+
+// getContainerMetric gets metrics for a single container from the configured collector
+func (ds *DockerService) getContainerMetric(ctx context.Context, container types.Container) (models.ContainerMetric, error) {
+	ctx, cancel := context.WithTimeout(ctx, ds.statsTimeout())
+	defer cancel()
+
+	metric, err := ds.collector.Collect(ctx, container)
+	if err != nil {
+		return metric, err
+	}
+	metric.Image = container.Image
+	metric.Labels = container.Labels
+
+	// Restart count and uptime are only available from inspect, which is cached
+	metric.Health = ContainerHealth(container.Status)
+	info, err := ds.inspectState(ctx, container.ID)
+	if err != nil {
+		log.Printf("Error inspecting container %s: %v", metric.Name, err)
+		return metric, nil
+	}
+	health := metric.Health
+	ApplyContainerState(&metric, info, time.Now())
+	metric.Health = health
+
+	return metric, nil
+}
+
+// inspectState returns the inspected state of a running container, inspecting it
+// only when it is not cached or was cached more than stateRefreshInterval ago
+func (ds *DockerService) inspectState(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	id := shortID(containerID)
+	ds.stateMu.Lock()
+	state, ok := ds.states[id]
+	ds.stateMu.Unlock()
+	if ok && time.Since(state.inspectedAt) < stateRefreshInterval {
+		return state.info, nil
+	}
+
+	info, err := ds.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return info, err
+	}
+
+	// Keep only what ApplyContainerState reads; health comes from ContainerList
+	state = containerState{inspectedAt: time.Now()}
+	if info.ContainerJSONBase != nil {
+		state.info.ContainerJSONBase = &types.ContainerJSONBase{RestartCount: info.RestartCount}
+		if info.State != nil {
+			state.info.State = &types.ContainerState{Running: info.State.Running, StartedAt: info.State.StartedAt}
+		}
 	}
+	ds.stateMu.Lock()
+	ds.states[id] = state
+	ds.stateMu.Unlock()
+	return state.info, nil
+}
 
-	return metrics, nil
+// forgetState drops the cached state of a container, or of every container when
+// containerID is empty
+func (ds *DockerService) forgetState(containerID string) {
+	ds.stateMu.Lock()
+	defer ds.stateMu.Unlock()
+	if containerID == "" {
+		ds.states = make(map[string]containerState)
+		return
+	}
+	delete(ds.states, shortID(containerID))
 }
 
-// getContainerMetric gets metrics for a single container
-func (ds *DockerService) getContainerMetric(container types.Container) (models.ContainerMetric, error) {
-	name := strings.TrimPrefix(container.Names[0], "/")
-	
-	// Get container stats
-	stats, err := ds.client.ContainerStats(context.Background(), container.ID, false)
+// retainStates drops the cached state of containers that are no longer running
+func (ds *DockerService) retainStates(running []string) {
+	ids := make(map[string]bool, len(running))
+	for _, id := range running {
+		ids[id] = true
+	}
+
+	ds.stateMu.Lock()
+	defer ds.stateMu.Unlock()
+	for id := range ds.states {
+		if !ids[id] {
+			delete(ds.states, id)
+		}
+	}
+}
+
+// StartEventWatch follows the Docker event stream and drops the cached state of
+// containers that start or die, so a restart shows on the next collection
+func (ds *DockerService) StartEventWatch() {
+	go func() {
+		for {
+			ds.watchEvents()
+			// Events may have been missed while the stream was down
+			ds.forgetState("")
+			time.Sleep(eventRetryDelay)
+		}
+	}()
+}
+
+// watchEvents handles container start and die events until the stream fails
+func (ds *DockerService) watchEvents() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages, errs := ds.client.Events(ctx, types.EventsOptions{Filters: filters.NewArgs(
+		filters.Arg("type", "container"),
+		filters.Arg("event", "start"),
+		filters.Arg("event", "die"),
+	)})
+	for {
+		select {
+		case message := <-messages:
+			ds.forgetState(message.Actor.ID)
+		case err := <-errs:
+			log.Printf("Error following Docker events: %v", err)
+			return
+		}
+	}
+}
+
+// ContainerHealth reads a container's health from its ContainerList status, such as
+// "Up 5 minutes (healthy)"
+func ContainerHealth(status string) float64 {
+	switch {
+	case strings.HasSuffix(status, "(healthy)"):
+		return models.HealthHealthy
+	case strings.HasSuffix(status, "(unhealthy)"):
+		return models.HealthUnhealthy
+	case strings.HasSuffix(status, "(health: starting)"):
+		return models.HealthStarting
+	}
+	return models.HealthNone
+}
+
+// ApplyContainerState fills in the restart count, uptime and health of a metric
+// from a container inspect response
+func ApplyContainerState(metric *models.ContainerMetric, info types.ContainerJSON, now time.Time) {
+	metric.Health = models.HealthNone
+	if info.ContainerJSONBase == nil {
+		return
+	}
+	metric.RestartCount = info.RestartCount
+
+	state := info.State
+	if state == nil {
+		return
+	}
+	if startedAt, err := time.Parse(time.RFC3339Nano, state.StartedAt); err == nil && state.Running {
+		metric.UptimeSeconds = int64(now.Sub(startedAt).Seconds())
+	}
+	if state.Health != nil {
+		switch state.Health.Status {
+		case types.Healthy:
+			metric.Health = models.HealthHealthy
+		case types.Unhealthy:
+			metric.Health = models.HealthUnhealthy
+		case types.Starting:
+			metric.Health = models.HealthStarting
+		}
+	}
+}
+
+// StreamContainerStats opens a live Docker stats stream for a container and delivers
+// roughly one sample per second on the returned channel. The channel is closed when
+// ctx is cancelled or the stream ends.
+func (ds *DockerService) StreamContainerStats(ctx context.Context, containerName string) (<-chan models.ContainerMetric, error) {
+	container, err := ds.findContainer(ctx, containerName)
 	if err != nil {
-		return models.ContainerMetric{}, err
+		return nil, err
 	}
-	defer stats.Body.Close()
 
-	var statsData types.StatsJSON
-	if err := json.NewDecoder(stats.Body).Decode(&statsData); err != nil {
-		return models.ContainerMetric{}, err
+	stats, err := ds.client.ContainerStats(ctx, container.ID, true)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate CPU percentage
-	cpuPercent := calculateCPUPercent(&statsData)
+	samples := make(chan models.ContainerMetric)
+	go func() {
+		defer close(samples)
+		defer stats.Body.Close()
+
+		decoder := json.NewDecoder(stats.Body)
+		for {
+			var statsData types.StatsJSON
+			if err := decoder.Decode(&statsData); err != nil {
+				if ctx.Err() == nil && err != io.EOF {
+					log.Printf("Error reading stats stream for container %s: %v", containerName, err)
+				}
+				return
+			}
+
+			metric := metricFromStats(&statsData)
+			metric.ContainerID = container.ID[:12]
+			metric.Name = containerName
+			metric.Status = container.Status
+			metric.Timestamp = time.Now()
 
-	// Get memory usage
-	memoryUsage := int64(statsData.MemoryStats.Usage)
-	memoryLimit := int64(statsData.MemoryStats.Limit)
+			select {
+			case samples <- metric:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return samples, nil
+}
 
-	// Get network stats
-	var networkRx, networkTx int64
-	for _, network := range statsData.Networks {
-		networkRx += int64(network.RxBytes)
-		networkTx += int64(network.TxBytes)
+// GetDockerRootDir returns the Docker daemon's data directory
+func (ds *DockerService) GetDockerRootDir(ctx context.Context) (string, error) {
+	info, err := ds.client.Info(ctx)
+	if err != nil {
+		return "", err
 	}
+	return info.DockerRootDir, nil
+}
+
+// GetDiskUsage returns the daemon's disk usage, equivalent to "docker system df -v"
+func (ds *DockerService) GetDiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	return ds.client.DiskUsage(ctx)
+}
+
+// InspectContainer returns the full configuration and state of a container
+func (ds *DockerService) InspectContainer(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	return ds.client.ContainerInspect(ctx, containerID)
+}
+
+// Labels a container sets to opt in to Prometheus scraping
+const (
+	ScrapePortLabel    = "nabd.scrape.port"
+	ScrapePathLabel    = "nabd.scrape.path"
+	ScrapeMetricsLabel = "nabd.scrape.metrics"
+)
 
-	return models.ContainerMetric{
+// GetScrapeTargets returns the running containers that opted in to Prometheus
+// scraping through the nabd.scrape.port label (excluding those in the exclusion list)
+func (ds *DockerService) GetScrapeTargets(ctx context.Context) ([]models.ScrapeTarget, error) {
+	containers, err := ds.client.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []models.ScrapeTarget
+	for _, container := range containers {
+		name := strings.TrimPrefix(container.Names[0], "/")
+		if ds.isExcluded(name) {
+			continue
+		}
+
+		target, ok := ScrapeTargetFromContainer(container, ds.config.Scrape.Network)
+		if ok {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets, nil
+}
+
+// ScrapeTargetFromContainer builds a scrape target from a container's labels. The
+// container is reached on its IP in network, or in the first network with an IP when
+// network is empty; containers using the host network are reached on localhost.
+func ScrapeTargetFromContainer(container types.Container, network string) (models.ScrapeTarget, bool) {
+	port, err := strconv.Atoi(container.Labels[ScrapePortLabel])
+	if err != nil || port <= 0 || port > 65535 {
+		return models.ScrapeTarget{}, false
+	}
+
+	path := container.Labels[ScrapePathLabel]
+	if path == "" {
+		path = "/metrics"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var ip string
+	if container.HostConfig.NetworkMode == "host" {
+		ip = "127.0.0.1"
+	} else if container.NetworkSettings != nil {
+		if endpoint, ok := container.NetworkSettings.Networks[network]; ok && network != "" {
+			ip = endpoint.IPAddress
+		} else {
+			names := make([]string, 0, len(container.NetworkSettings.Networks))
+			for name := range container.NetworkSettings.Networks {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if endpoint := container.NetworkSettings.Networks[name]; endpoint != nil && endpoint.IPAddress != "" {
+					ip = endpoint.IPAddress
+					break
+				}
+			}
+		}
+	}
+	if ip == "" {
+		return models.ScrapeTarget{}, false
+	}
+
+	var metrics []string
+	for _, metric := range strings.Split(container.Labels[ScrapeMetricsLabel], ",") {
+		if metric = strings.TrimSpace(metric); metric != "" {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return models.ScrapeTarget{
 		ContainerID: container.ID[:12],
-		Name:        name,
-		CPUPercent:  cpuPercent,
-		MemoryUsage: memoryUsage,
-		MemoryLimit: memoryLimit,
-		NetworkRx:   networkRx,
-		NetworkTx:   networkTx,
-		Status:      container.Status,
-		Timestamp:   time.Now(),
-	}, nil
+		Name:        strings.TrimPrefix(container.Names[0], "/"),
+		URL:         fmt.Sprintf("http://%s%s", net.JoinHostPort(ip, strconv.Itoa(port)), path),
+		Metrics:     metrics,
+	}, true
+}
+
+// GetRunningContainers returns the running containers (excluding those in the exclusion list)
+func (ds *DockerService) GetRunningContainers(ctx context.Context) ([]types.Container, error) {
+	containers, err := ds.client.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var running []types.Container
+	for _, container := range containers {
+		if !ds.isExcluded(strings.TrimPrefix(container.Names[0], "/")) {
+			running = append(running, container)
+		}
+	}
+	return running, nil
+}
+
+// FollowContainerLogs streams the log output of a container from since on until ctx is
+// cancelled or the container stops. The stream must be closed by the caller.
+func (ds *DockerService) FollowContainerLogs(ctx context.Context, containerID string, since time.Time) (io.ReadCloser, error) {
+	info, err := ds.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	options := types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Since:      strconv.FormatInt(since.Unix(), 10),
+	}
+	logs, err := ds.client.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config != nil && info.Config.Tty {
+		return logs, nil
+	}
+
+	// Without a TTY, stdout and stderr are multiplexed in frames with 8-byte headers
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(writer, writer, logs)
+		logs.Close()
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+// isExcluded reports whether a container is in the exclusion list
+func (ds *DockerService) isExcluded(name string) bool {
+	for _, excludedName := range ds.config.AutoHeal.ExcludeContainers {
+		if name == excludedName {
+			return true
+		}
+	}
+	return false
+}
+
+// findContainer looks up a container by name, including stopped containers
+func (ds *DockerService) findContainer(ctx context.Context, containerName string) (types.Container, error) {
+	containers, err := ds.client.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return types.Container{}, err
+	}
+
+	for _, container := range containers {
+		name := strings.TrimPrefix(container.Names[0], "/")
+		if name == containerName {
+			return container, nil
+		}
+	}
+
+	return types.Container{}, fmt.Errorf("container not found: %s", containerName)
 }
 
 // calculateCPUPercent calculates CPU usage percentage
@@ -240,6 +680,81 @@ func (ds *DockerService) RestartContainer(containerName string) error {
 	return ds.client.ContainerRestart(context.Background(), containerID, &timeout)
 }
 
+// StopContainer stops a container
+func (ds *DockerService) StopContainer(containerName string) error {
+	ctx := context.Background()
+	container, err := ds.findContainer(ctx, containerName)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Second * 10
+	return ds.client.ContainerStop(ctx, container.ID, &timeout)
+}
+
+// ContainerLimits returns the memory limit in bytes and CPU limit in cores configured
+// for a container, or 0 for a resource without a limit
+func ContainerLimits(info types.ContainerJSON) (memory int64, cpus float64) {
+	if info.HostConfig == nil {
+		return 0, 0
+	}
+
+	memory = info.HostConfig.Memory
+	switch {
+	case info.HostConfig.NanoCPUs > 0:
+		cpus = float64(info.HostConfig.NanoCPUs) / 1e9
+	case info.HostConfig.CPUQuota > 0:
+		period := info.HostConfig.CPUPeriod
+		if period <= 0 {
+			period = 100000 // Default CFS period
+		}
+		cpus = float64(info.HostConfig.CPUQuota) / float64(period)
+	}
+	return memory, cpus
+}
+
+// UpdateContainerResources changes the memory limit in bytes and the CPU limit in cores
+// of a container like docker update. A zero value leaves that limit unchanged.
+func (ds *DockerService) UpdateContainerResources(ctx context.Context, containerID string, memory int64, cpus float64) error {
+	info, err := ds.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	var resources containertypes.Resources
+	if memory > 0 {
+		resources.Memory = memory
+
+		// The swap limit includes memory, so keep the same amount of swap on top of the
+		// new limit, or Docker's default of twice the memory when none was set
+		oldMemory, oldSwap := info.HostConfig.Memory, info.HostConfig.MemorySwap
+		switch {
+		case oldSwap == -1:
+			resources.MemorySwap = -1
+		case oldSwap > 0 && oldMemory > 0:
+			resources.MemorySwap = memory + (oldSwap - oldMemory)
+		default:
+			resources.MemorySwap = 2 * memory
+		}
+	}
+	if cpus > 0 {
+		// NanoCPUs cannot be combined with a CFS quota, so update the quota if one is set
+		if info.HostConfig.CPUQuota > 0 || info.HostConfig.CPUPeriod > 0 {
+			period := info.HostConfig.CPUPeriod
+			if period <= 0 {
+				period = 100000 // Default CFS period
+			}
+			resources.CPUPeriod = period
+			resources.CPUQuota = int64(cpus * float64(period))
+		} else {
+			resources.NanoCPUs = int64(cpus * 1e9)
+		}
+	}
+
+	_, err = ds.client.ContainerUpdate(ctx, containerID, containertypes.UpdateConfig{Resources: resources})
+	return err
+}
+
 // CheckUnhealthyContainers checks for unhealthy containers and performs auto-healing
 func (ds *DockerService) CheckUnhealthyContainers() []models.AutoHealEvent {
 	var events []models.AutoHealEvent
@@ -257,17 +772,7 @@ func (ds *DockerService) CheckUnhealthyContainers() []models.AutoHealEvent {
 
 	for _, container := range containers {
 		name := strings.TrimPrefix(container.Names[0], "/")
-		
-		// Check if container is in exclusion list
-		excluded := false
-		for _, excludedName := range ds.config.AutoHeal.ExcludeContainers {
-			if name == excludedName {
-				excluded = true
-				break
-			}
-		}
-		
-		if excluded {
+		if ds.isExcluded(name) {
 			continue
 		}
 		
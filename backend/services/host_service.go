@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"nabd/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostAlertID is the container ID recorded on host-level alerts
+const HostAlertID = "host"
+
+// DaemonUnreachableAlert is the type of the host alert raised while the Docker daemon
+// cannot be reached
+const DaemonUnreachableAlert = "docker_daemon_unreachable"
+
+// hostAlertTypes are the types of the host alerts raised by host rules
+var hostAlertTypes = []string{"host_high_cpu", "host_high_memory", "host_high_disk", "host_high_load"}
+
+// hostRuleMetrics maps the metrics of host rules to their values. A metric without a
+// value for a sample (such as disk usage that could not be read) leaves the rule's
+// state unchanged.
+var hostRuleMetrics = map[string]func(sample ruleSample) (float64, bool){
+	"host_cpu_percent": func(s ruleSample) (float64, bool) { return s.host.CPUPercent, true },
+	"host_memory_percent": func(s ruleSample) (float64, bool) {
+		if s.host.MemoryTotal <= 0 {
+			return 0, false
+		}
+		return float64(s.host.MemoryUsed) / float64(s.host.MemoryTotal) * 100, true
+	},
+	"host_disk_percent": func(s ruleSample) (float64, bool) {
+		if s.host.DiskTotal <= 0 {
+			return 0, false
+		}
+		return float64(s.host.DiskUsed) / float64(s.host.DiskTotal) * 100, true
+	},
+	"host_load_per_cpu": func(s ruleSample) (float64, bool) {
+		if s.host.CPUCount <= 0 {
+			return s.host.Load1, true
+		}
+		return s.host.Load1 / float64(s.host.CPUCount), true
+	},
+}
+
+// hostRules returns the rules derived from the host alert thresholds in the
+// configuration; a threshold of 0 disables its rule. Usage alerts resolve 10 points
+// below their threshold and load alerts at 80% of theirs.
+func hostRules(config *models.Config, diskPath string) []models.AlertRule {
+	thresholds := config.Alerts.Host
+	percent := func(threshold float64) *float64 {
+		resolve := math.Max(0, threshold-10)
+		return &resolve
+	}
+	load := func(threshold float64) *float64 {
+		resolve := threshold * 0.8
+		return &resolve
+	}
+
+	candidates := []struct {
+		name      string
+		metric    string
+		threshold float64
+		resolve   func(threshold float64) *float64
+		message   string
+	}{
+		{"host_high_cpu", "host_cpu_percent", thresholds.CPUThreshold, percent, `High host CPU usage detected: {{printf "%.1f" .Value}}%`},
+		{"host_high_memory", "host_memory_percent", thresholds.MemoryThreshold, percent, `High host memory usage detected: {{printf "%.1f" .Value}}%`},
+		// The path is quoted as a template string so its characters are not parsed
+		{"host_high_disk", "host_disk_percent", thresholds.DiskThreshold, percent, `Docker data filesystem {{` + strconv.Quote(diskPath) + `}} is {{printf "%.1f" .Value}}% full`},
+		{"host_high_load", "host_load_per_cpu", thresholds.LoadThreshold, load, `High host load average detected ({{printf "%.2f" .Value}} per CPU)`},
+	}
+
+	var rules []models.AlertRule
+	for _, candidate := range candidates {
+		if candidate.threshold <= 0 {
+			continue
+		}
+		rules = append(rules, models.AlertRule{
+			Name:             candidate.name,
+			Metric:           candidate.metric,
+			Comparator:       ">",
+			Threshold:        candidate.threshold,
+			For:              60,
+			ResolveThreshold: candidate.resolve(candidate.threshold),
+			Severity:         "warning",
+			Message:          candidate.message,
+			Source:           models.RuleSourceBuiltin,
+		})
+	}
+	return rules
+}
+
+// procCPUSample is a reading of the aggregate CPU line of /proc/stat
+type procCPUSample struct {
+	total uint64
+	idle  uint64
+}
+
+type HostService struct {
+	dockerService  *DockerService
+	metricsService *MetricsService
+	config         *models.Config
+
+	mu         sync.Mutex
+	prevCPU    *procCPUSample
+	dockerRoot string
+	latest     *models.HostMetric
+	rules      *RuleEngine // created with the first sample, once the disk path is known
+}
+
+// NewHostService creates a new host metrics service
+func NewHostService(dockerService *DockerService, metricsService *MetricsService, config *models.Config) *HostService {
+	return &HostService{
+		dockerService:  dockerService,
+		metricsService: metricsService,
+		config:         config,
+	}
+}
+
+// StartHostCollection starts collecting host metrics at the metrics collection interval
+func (hs *HostService) StartHostCollection() {
+	if !hs.config.Host.Enabled {
+		log.Println("Host metrics collection is disabled in configuration")
+		return
+	}
+
+	interval := time.Duration(hs.config.Metrics.Interval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second // Default to 15 seconds
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := hs.CollectAndStoreHostMetrics(); err != nil {
+				log.Printf("Error collecting host metrics: %v", err)
+			}
+		}
+	}()
+	log.Printf("Host metrics collection started with %v interval", interval)
+}
+
+// CollectAndStoreHostMetrics samples the host, and stores the sample and the host
+// alert changes it causes in one transaction
+func (hs *HostService) CollectAndStoreHostMetrics() error {
+	metric, err := hs.ReadHostMetric()
+	if err != nil {
+		return err
+	}
+
+	hs.mu.Lock()
+	hs.latest = &metric
+	if hs.rules == nil {
+		hs.rules = NewHostRuleEngine(hs.config, metric.DiskPath)
+	}
+	rules := hs.rules
+	hs.mu.Unlock()
+
+	results := rules.EvaluateHost(metric)
+	enabled := make(map[string]bool)
+	for _, rule := range rules.Rules() {
+		enabled[rule.Name] = true
+	}
+
+	ms := hs.metricsService
+	err = ms.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		if err := storeHostMetricTx(tx, metric); err != nil {
+			return nil, err
+		}
+		pending, err := ms.applyRuleResults(tx, models.ContainerMetric{ContainerID: HostAlertID, Name: metric.Hostname}, results)
+		if err != nil {
+			return pending, err
+		}
+		// Clear the alerts of host checks disabled since they fired
+		for _, alertType := range hostAlertTypes {
+			if enabled[alertType] {
+				continue
+			}
+			notifications, err := ms.deactivateAlertTx(tx, HostAlertID, alertType)
+			pending = append(pending, notifications...)
+			if err != nil {
+				return pending, err
+			}
+		}
+		return pending, nil
+	})
+	if err != nil {
+		// The alert changes were rolled back; report them again with the next sample
+		for _, result := range results {
+			if result.Changed {
+				rules.Forget(HostAlertID, result.Rule.Name)
+			}
+		}
+	}
+	return err
+}
+
+// ReadHostMetric reads a host sample from procfs and the filesystem holding Docker's data.
+// CPU usage is measured since the previous call, so the first sample reports 0.
+func (hs *HostService) ReadHostMetric() (models.HostMetric, error) {
+	procRoot := hs.procRoot()
+	metric := models.HostMetric{
+		Hostname:  hs.hostname(),
+		Timestamp: time.Now(),
+	}
+
+	cpu, cpuCount, err := readProcStat(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return metric, err
+	}
+	metric.CPUCount = cpuCount
+	metric.CPUPercent = hs.cpuPercent(cpu)
+
+	meminfo, err := readMeminfo(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return metric, err
+	}
+	metric.MemoryTotal = meminfo["MemTotal"]
+	available, ok := meminfo["MemAvailable"]
+	if !ok {
+		// Kernels before 3.14 do not report MemAvailable
+		available = meminfo["MemFree"] + meminfo["Buffers"] + meminfo["Cached"]
+	}
+	metric.MemoryUsed = metric.MemoryTotal - available
+
+	loadavg, err := os.ReadFile(filepath.Join(procRoot, "loadavg"))
+	if err != nil {
+		return metric, err
+	}
+	fields := strings.Fields(string(loadavg))
+	if len(fields) < 3 {
+		return metric, fmt.Errorf("unexpected loadavg format: %q", string(loadavg))
+	}
+	metric.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	metric.Load5, _ = strconv.ParseFloat(fields[1], 64)
+	metric.Load15, _ = strconv.ParseFloat(fields[2], 64)
+
+	metric.DiskPath = hs.resolveDockerRoot()
+	if used, total, err := diskUsage(metric.DiskPath); err != nil {
+		log.Printf("Error reading disk usage of %s: %v", metric.DiskPath, err)
+	} else {
+		metric.DiskUsed = used
+		metric.DiskTotal = total
+	}
+
+	// Read the init process's namespace; procRoot/net follows the reading process
+	counters, err := readNetDevFile(filepath.Join(procRoot, "1", "net", "dev"))
+	if err != nil {
+		counters, err = readNetDevFile(filepath.Join(procRoot, "net", "dev"))
+		if err != nil {
+			return metric, err
+		}
+	}
+	for name, counter := range counters {
+		if isVirtualInterface(name) {
+			continue
+		}
+		metric.NetworkRx += counter.RxBytes
+		metric.NetworkTx += counter.TxBytes
+		metric.Interfaces = append(metric.Interfaces, models.HostInterface{
+			Name:      name,
+			NetworkRx: counter.RxBytes,
+			NetworkTx: counter.TxBytes,
+		})
+	}
+	sort.Slice(metric.Interfaces, func(i, j int) bool { return metric.Interfaces[i].Name < metric.Interfaces[j].Name })
+
+	return metric, nil
+}
+
+// cpuPercent returns the busy share of all CPUs since the previous sample
+func (hs *HostService) cpuPercent(sample procCPUSample) float64 {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	prev := hs.prevCPU
+	hs.prevCPU = &sample
+	if prev == nil || sample.total <= prev.total || sample.idle < prev.idle {
+		return 0.0
+	}
+
+	totalDelta := float64(sample.total - prev.total)
+	idleDelta := float64(sample.idle - prev.idle)
+	return (1 - idleDelta/totalDelta) * 100.0
+}
+
+// procRoot returns the configured procfs mount
+func (hs *HostService) procRoot() string {
+	if hs.config.Metrics.ProcRoot != "" {
+		return hs.config.Metrics.ProcRoot
+	}
+	return "/proc"
+}
+
+// hostname returns the host's name, preferring the one in the configured procfs
+func (hs *HostService) hostname() string {
+	if data, err := os.ReadFile(filepath.Join(hs.procRoot(), "sys", "kernel", "hostname")); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	name, _ := os.Hostname()
+	return name
+}
+
+// resolveDockerRoot returns the directory whose filesystem usage is reported
+func (hs *HostService) resolveDockerRoot() string {
+	if hs.config.Host.DockerRoot != "" {
+		return hs.config.Host.DockerRoot
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.dockerRoot != "" {
+		return hs.dockerRoot
+	}
+
+	hs.dockerRoot = "/var/lib/docker"
+	if hs.dockerService != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if root, err := hs.dockerService.GetDockerRootDir(ctx); err == nil && root != "" {
+			hs.dockerRoot = root
+		}
+	}
+	return hs.dockerRoot
+}
+
+// readProcStat reads the aggregate CPU counters and the number of CPUs from /proc/stat
+func readProcStat(path string) (procCPUSample, int, error) {
+	var sample procCPUSample
+	cpuCount := 0
+	found := false
+
+	err := scanLines(path, func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			return
+		}
+		if fields[0] != "cpu" {
+			cpuCount++
+			return
+		}
+
+		// cpu user nice system idle iowait irq softirq steal guest guest_nice;
+		// guest time is already included in user and nice
+		found = true
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			n, _ := strconv.ParseUint(field, 10, 64)
+			sample.total += n
+			if i == 3 || i == 4 {
+				sample.idle += n
+			}
+		}
+	})
+	if err != nil {
+		return sample, 0, err
+	}
+	if !found {
+		return sample, 0, fmt.Errorf("no aggregate cpu line in %s", path)
+	}
+	return sample, cpuCount, nil
+}
+
+// isVirtualInterface reports whether an interface is loopback or created by Docker
+func isVirtualInterface(name string) bool {
+	return name == "lo" ||
+		strings.HasPrefix(name, "veth") ||
+		strings.HasPrefix(name, "docker") ||
+		strings.HasPrefix(name, "br-")
+}
+
+// storeHostMetricTx stores a host sample in the database
+func storeHostMetricTx(tx *sql.Tx, metric models.HostMetric) error {
+	query := `INSERT INTO host_metrics
+		(hostname, cpu_percent, cpu_count, memory_used, memory_total, load1, load5, load15,
+		disk_path, disk_used, disk_total, network_rx, network_tx, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := tx.Exec(query,
+		metric.Hostname,
+		metric.CPUPercent,
+		metric.CPUCount,
+		metric.MemoryUsed,
+		metric.MemoryTotal,
+		metric.Load1,
+		metric.Load5,
+		metric.Load15,
+		metric.DiskPath,
+		metric.DiskUsed,
+		metric.DiskTotal,
+		metric.NetworkRx,
+		metric.NetworkTx,
+		metric.Timestamp,
+	)
+	return err
+}
+
+// GetLatestHostMetric returns the most recent host sample, including per-interface counters
+func (hs *HostService) GetLatestHostMetric() *models.HostMetric {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.latest
+}
+
+// GetHostMetricsHistory returns host samples from the last given hours, newest first
+func (hs *HostService) GetHostMetricsHistory(hours int) ([]models.HostMetric, error) {
+	query := `SELECT id, hostname, cpu_percent, cpu_count, memory_used, memory_total,
+		load1, load5, load15, disk_path, disk_used, disk_total, network_rx, network_tx, timestamp
+		FROM host_metrics
+		WHERE timestamp > ?
+		ORDER BY timestamp DESC`
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	rows, err := models.DB.Query(query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []models.HostMetric
+	for rows.Next() {
+		var metric models.HostMetric
+		err := rows.Scan(
+			&metric.ID,
+			&metric.Hostname,
+			&metric.CPUPercent,
+			&metric.CPUCount,
+			&metric.MemoryUsed,
+			&metric.MemoryTotal,
+			&metric.Load1,
+			&metric.Load5,
+			&metric.Load15,
+			&metric.DiskPath,
+			&metric.DiskUsed,
+			&metric.DiskTotal,
+			&metric.NetworkRx,
+			&metric.NetworkTx,
+			&metric.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"nabd/models"
+	"sort"
+	"time"
+)
+
+// ErrIdleStopDisabled is returned when the idle policy does not allow stopping containers
+var ErrIdleStopDisabled = errors.New("stopping idle containers is disabled in configuration")
+
+// ErrNotIdle is returned when asked to stop a container that is not in the idle report
+var ErrNotIdle = errors.New("container is not idle")
+
+type IdleService struct {
+	dockerService   *DockerService
+	metricsService  *MetricsService
+	autoHealService *AutoHealService
+	config          *models.Config
+}
+
+// NewIdleService creates a new idle container detection service
+func NewIdleService(dockerService *DockerService, metricsService *MetricsService, autoHealService *AutoHealService, config *models.Config) *IdleService {
+	return &IdleService{
+		dockerService:   dockerService,
+		metricsService:  metricsService,
+		autoHealService: autoHealService,
+		config:          config,
+	}
+}
+
+// GetIdleReport lists the running containers that have had no CPU or network
+// activity for at least the configured number of days, most idle first
+func (is *IdleService) GetIdleReport() (*models.IdleReport, error) {
+	minDays := is.config.Idle.MinDays
+	if minDays <= 0 {
+		minDays = 7 // Default to 7 days
+	}
+	lookbackDays := is.config.Idle.LookbackDays
+	if lookbackDays < minDays {
+		lookbackDays = minDays
+	}
+
+	containers, err := is.dockerService.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	since := now.AddDate(0, 0, -lookbackDays)
+	report := &models.IdleReport{
+		Containers:   []models.IdleContainer{},
+		MinIdleDays:  minDays,
+		LookbackDays: lookbackDays,
+		StopAllowed:  is.config.Idle.AllowStop,
+		Timestamp:    now,
+	}
+	minIdle := time.Duration(minDays) * 24 * time.Hour
+	for _, container := range containers {
+		if container.State != "running" {
+			continue
+		}
+
+		// Each container's history is read and released before the next one
+		samples, err := is.metricsService.store.Range(container.ID, since, now)
+		if err != nil {
+			return nil, err
+		}
+		idle, ok := DetectIdle(samples, is.config.Idle.CPUPercent, is.config.Idle.NetworkRate, now)
+		if !ok || time.Duration(idle.IdleSeconds)*time.Second < minIdle {
+			continue
+		}
+		idle.Image = container.Image
+		report.Containers = append(report.Containers, idle)
+		report.TotalMemory += idle.MemoryUsage
+	}
+
+	sort.Slice(report.Containers, func(i, j int) bool {
+		if report.Containers[i].IdleSeconds != report.Containers[j].IdleSeconds {
+			return report.Containers[i].IdleSeconds > report.Containers[j].IdleSeconds
+		}
+		return report.Containers[i].Name < report.Containers[j].Name
+	})
+	return report, nil
+}
+
+// DetectIdle finds how long a container has been idle from its samples, oldest first.
+// A sample is active when its CPU usage or its network rate since the previous sample
+// exceeds the thresholds, or when the container restarted in between. It returns
+// false when there are no samples or the newest sample is active.
+func DetectIdle(samples []models.ContainerMetric, cpuPercent, networkRate float64, now time.Time) (models.IdleContainer, bool) {
+	if len(samples) == 0 {
+		return models.IdleContainer{}, false
+	}
+
+	lastActive := -1
+	for i := len(samples) - 1; i >= 0; i-- {
+		if sampleActive(samples, i, cpuPercent, networkRate) {
+			lastActive = i
+			break
+		}
+	}
+	if lastActive == len(samples)-1 {
+		return models.IdleContainer{}, false
+	}
+
+	latest := samples[len(samples)-1]
+	idle := models.IdleContainer{
+		ContainerID: latest.ContainerID,
+		Name:        latest.Name,
+		IdleSince:   samples[0].Timestamp,
+		WholeWindow: lastActive < 0,
+		MemoryUsage: latest.MemoryUsage,
+		MemoryLimit: latest.MemoryLimit,
+		Pids:        latest.Pids,
+	}
+	if lastActive >= 0 {
+		idle.IdleSince = samples[lastActive].Timestamp
+	}
+	idle.IdleSeconds = int64(now.Sub(idle.IdleSince).Seconds())
+
+	idleSamples := samples[lastActive+1:]
+	for _, sample := range idleSamples {
+		idle.CPUPercent += sample.CPUPercent
+	}
+	idle.CPUPercent /= float64(len(idleSamples))
+
+	return idle, true
+}
+
+// sampleActive reports whether the container was doing work at sample i
+func sampleActive(samples []models.ContainerMetric, i int, cpuPercent, networkRate float64) bool {
+	sample := samples[i]
+	if sample.CPUPercent > cpuPercent {
+		return true
+	}
+	if i == 0 {
+		return false
+	}
+
+	previous := samples[i-1]
+	if sample.RestartCount > previous.RestartCount {
+		return true
+	}
+
+	// Network counters reset when the container restarts
+	delta := (sample.NetworkRx + sample.NetworkTx) - (previous.NetworkRx + previous.NetworkTx)
+	if delta < 0 {
+		return true
+	}
+	elapsed := sample.Timestamp.Sub(previous.Timestamp).Seconds()
+	return elapsed > 0 && float64(delta)/elapsed > networkRate
+}
+
+// StopIdleContainer stops a container from the idle report and records the stop as an
+// auto-heal event. The caller is responsible for getting confirmation first.
+func (is *IdleService) StopIdleContainer(name string) (models.AutoHealEvent, error) {
+	if !is.config.Idle.AllowStop {
+		return models.AutoHealEvent{}, ErrIdleStopDisabled
+	}
+
+	// Check again so a container that woke up since the report was viewed is left alone
+	report, err := is.GetIdleReport()
+	if err != nil {
+		return models.AutoHealEvent{}, err
+	}
+	var idle *models.IdleContainer
+	for i := range report.Containers {
+		if report.Containers[i].Name == name {
+			idle = &report.Containers[i]
+			break
+		}
+	}
+	if idle == nil {
+		return models.AutoHealEvent{}, ErrNotIdle
+	}
+
+	err = is.dockerService.StopContainer(name)
+	event := models.AutoHealEvent{
+		ContainerID: idle.ContainerID,
+		Name:        name,
+		Action:      "stop",
+		Reason:      fmt.Sprintf("Idle for %.1f days, stop confirmed by user", float64(idle.IdleSeconds)/86400),
+		Success:     err == nil,
+		Timestamp:   time.Now(),
+	}
+	if storeErr := is.autoHealService.storeAutoHealEvent(event); storeErr != nil {
+		log.Printf("Error storing auto-heal event: %v", storeErr)
+	}
+	if err != nil {
+		log.Printf("Failed to stop idle container %s: %v", name, err)
+		return event, err
+	}
+
+	log.Printf("Stopped idle container %s", name)
+	return event, nil
+}
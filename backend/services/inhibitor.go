@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"nabd/models"
+)
+
+// Inhibitor decides whether an alert is inhibited by other active alerts
+type Inhibitor struct {
+	rules []compiledInhibitRule
+}
+
+// compiledInhibitRule is an inhibit rule with its matchers compiled
+type compiledInhibitRule struct {
+	source []compiledMatcher
+	target []compiledMatcher
+	equal  []string
+}
+
+// NewInhibitor validates and compiles inhibit rules
+func NewInhibitor(rules []models.InhibitRule) (*Inhibitor, error) {
+	inhibitor := &Inhibitor{}
+	for i, rule := range rules {
+		if len(rule.SourceMatchers) == 0 {
+			return nil, fmt.Errorf("inhibit rule %d: source_matchers are required", i+1)
+		}
+		source, err := compileMatchers(rule.SourceMatchers)
+		if err != nil {
+			return nil, fmt.Errorf("inhibit rule %d: source %v", i+1, err)
+		}
+		target, err := compileMatchers(rule.TargetMatchers)
+		if err != nil {
+			return nil, fmt.Errorf("inhibit rule %d: target %v", i+1, err)
+		}
+		for _, key := range rule.Equal {
+			if err := validateKey(key); err != nil {
+				return nil, fmt.Errorf("inhibit rule %d: equal %v", i+1, err)
+			}
+		}
+		inhibitor.rules = append(inhibitor.rules, compiledInhibitRule{source: source, target: target, equal: rule.Equal})
+	}
+	return inhibitor, nil
+}
+
+// Inhibited reports whether target is inhibited by one of the active alerts. An alert
+// matching both sides of a rule does not inhibit itself, so target must not be among
+// active.
+func (in *Inhibitor) Inhibited(target AlertTarget, active []AlertTarget) bool {
+	for _, rule := range in.rules {
+		if !matchAll(rule.target, target) {
+			continue
+		}
+		for _, source := range active {
+			if matchAll(rule.source, source) && sameKeys(rule.equal, source, target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameKeys reports whether two alerts have the same values for keys
+func sameKeys(keys []string, a, b AlertTarget) bool {
+	for _, key := range keys {
+		if a.Key(key) != b.Key(key) {
+			return false
+		}
+	}
+	return true
+}
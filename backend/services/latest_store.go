@@ -0,0 +1,68 @@
+package services
+
+import (
+	"nabd/models"
+	"sort"
+	"sync"
+)
+
+// LatestStore keeps the most recent sample of each container in memory so that
+// current metrics can be served without scanning container_metrics
+type LatestStore struct {
+	mu      sync.RWMutex
+	samples map[string]models.ContainerMetric
+}
+
+// NewLatestStore creates an empty latest-sample store
+func NewLatestStore() *LatestStore {
+	return &LatestStore{
+		samples: make(map[string]models.ContainerMetric),
+	}
+}
+
+// Update records metrics, keeping only the newest sample of each container
+func (ls *LatestStore) Update(metrics []models.ContainerMetric) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for _, metric := range metrics {
+		if current, ok := ls.samples[metric.ContainerID]; ok && current.Timestamp.After(metric.Timestamp) {
+			continue
+		}
+		ls.samples[metric.ContainerID] = metric
+	}
+}
+
+// Retain drops the samples of containers not in ids
+func (ls *LatestStore) Retain(ids map[string]bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for id := range ls.samples {
+		if !ids[id] {
+			delete(ls.samples, id)
+		}
+	}
+}
+
+// Get returns the latest sample of a container
+func (ls *LatestStore) Get(containerID string) (models.ContainerMetric, bool) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	metric, ok := ls.samples[containerID]
+	return metric, ok
+}
+
+// All returns the latest sample of every container, ordered by name
+func (ls *LatestStore) All() []models.ContainerMetric {
+	ls.mu.RLock()
+	metrics := make([]models.ContainerMetric, 0, len(ls.samples))
+	for _, metric := range ls.samples {
+		metrics = append(metrics, metric)
+	}
+	ls.mu.RUnlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"nabd/models"
+	"nabd/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrLeakDetectionDisabled is returned for forecasts when memory leak detection is disabled
+var ErrLeakDetectionDisabled = errors.New("memory leak detection is disabled in configuration")
+
+type LeakService struct {
+	metricsService *MetricsService
+	config         *models.Config
+
+	mu         sync.Mutex
+	forecasts  []models.MemoryForecast
+	forecastAt time.Time
+}
+
+// NewLeakService creates a new memory leak detection service
+func NewLeakService(metricsService *MetricsService, config *models.Config) *LeakService {
+	return &LeakService{
+		metricsService: metricsService,
+		config:         config,
+	}
+}
+
+// StartLeakDetection starts the periodic memory trend analysis
+func (ls *LeakService) StartLeakDetection() {
+	if !ls.config.Alerts.MemoryLeak.Enabled {
+		log.Println("Memory leak detection is disabled in configuration")
+		return
+	}
+
+	interval := ls.interval()
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if _, err := ls.AnalyzeMemoryTrends(); err != nil {
+				log.Printf("Error analyzing memory trends: %v", err)
+			}
+		}
+	}()
+	log.Printf("Memory leak detection started with %v interval", interval)
+}
+
+// interval returns how often memory trends are analyzed
+func (ls *LeakService) interval() time.Duration {
+	interval := time.Duration(ls.config.Alerts.MemoryLeak.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute // Default to 5 minutes
+	}
+	return interval
+}
+
+// GetForecasts returns the forecasts of the last analysis while they are less than one
+// interval old, and computes new ones otherwise. It never raises or clears alerts;
+// only the periodic analysis does.
+func (ls *LeakService) GetForecasts() ([]models.MemoryForecast, error) {
+	if !ls.config.Alerts.MemoryLeak.Enabled {
+		return nil, ErrLeakDetectionDisabled
+	}
+
+	ls.mu.Lock()
+	forecasts, forecastAt := ls.forecasts, ls.forecastAt
+	ls.mu.Unlock()
+	if forecasts != nil && time.Since(forecastAt) < ls.interval() {
+		return forecasts, nil
+	}
+
+	now := time.Now()
+	forecasts, err := ls.ForecastAll(now)
+	if err != nil {
+		return nil, err
+	}
+	ls.setForecasts(forecasts, now)
+	return forecasts, nil
+}
+
+// setForecasts keeps the forecasts computed at the given time
+func (ls *LeakService) setForecasts(forecasts []models.MemoryForecast, at time.Time) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.forecasts = forecasts
+	ls.forecastAt = at
+}
+
+// AnalyzeMemoryTrends forecasts the memory usage of every container and raises
+// memory_leak_suspected alerts for running containers projected to reach their memory
+// limit within the horizon. Stopped and removed containers keep their forecast, and
+// the metrics cycle resolves their alerts.
+func (ls *LeakService) AnalyzeMemoryTrends() ([]models.MemoryForecast, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	containers, err := ls.metricsService.dockerService.GetRunningContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		running[container.ID[:12]] = true
+	}
+
+	now := time.Now()
+	forecasts, err := ls.ForecastAll(now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, forecast := range forecasts {
+		if !running[forecast.ContainerID] {
+			continue
+		}
+		if err := ls.updateLeakAlert(forecast); err != nil {
+			log.Printf("Error updating memory leak alert for container %s: %v", forecast.Name, err)
+		}
+	}
+	ls.setForecasts(forecasts, now)
+	return forecasts, nil
+}
+
+// ForecastAll fits a linear trend to the memory usage of each container with samples
+// in the configured window, reading one container at a time
+func (ls *LeakService) ForecastAll(now time.Time) ([]models.MemoryForecast, error) {
+	settings := ls.config.Alerts.MemoryLeak
+	window := time.Duration(settings.WindowHours) * time.Hour
+	if window <= 0 {
+		window = 6 * time.Hour
+	}
+	horizon := time.Duration(settings.HorizonHours) * time.Hour
+	if horizon <= 0 {
+		horizon = 24 * time.Hour
+	}
+
+	store := ls.metricsService.store
+	containerIDs, err := store.Containers(now.Add(-window), now)
+	if err != nil {
+		return nil, err
+	}
+
+	forecasts := make([]models.MemoryForecast, 0, len(containerIDs))
+	for _, containerID := range containerIDs {
+		samples, err := store.Range(containerID, now.Add(-window), now)
+		if err != nil {
+			return nil, err
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		forecasts = append(forecasts, ForecastMemory(samples, settings.MinSamples, settings.MinR2, horizon, now))
+	}
+	sort.Slice(forecasts, func(i, j int) bool { return forecasts[i].Name < forecasts[j].Name })
+	return forecasts, nil
+}
+
+// ForecastMemory fits a least-squares line to a container's memory samples (oldest
+// first) and projects when usage reaches the memory limit. A leak is suspected when
+// the trend is positive, fits well (R² of at least minR2), and the limit is projected
+// to be reached within horizon.
+func ForecastMemory(samples []models.ContainerMetric, minSamples int, minR2 float64, horizon time.Duration, now time.Time) models.MemoryForecast {
+	var forecast models.MemoryForecast
+	if len(samples) == 0 {
+		return forecast
+	}
+
+	first := samples[0]
+	last := samples[len(samples)-1]
+	forecast.ContainerID = last.ContainerID
+	forecast.Name = last.Name
+	forecast.Samples = len(samples)
+	forecast.WindowHours = last.Timestamp.Sub(first.Timestamp).Hours()
+	forecast.CurrentUsage = last.MemoryUsage
+	forecast.MemoryLimit = last.MemoryLimit
+
+	if minSamples < 2 {
+		minSamples = 2
+	}
+	if len(samples) < minSamples {
+		return forecast
+	}
+
+	xs := make([]float64, len(samples))
+	ys := make([]float64, len(samples))
+	for i, sample := range samples {
+		xs[i] = sample.Timestamp.Sub(first.Timestamp).Hours()
+		ys[i] = float64(sample.MemoryUsage)
+	}
+	slope, _, r2 := utils.LinearRegression(xs, ys)
+	forecast.GrowthBytesPerHour = slope
+	forecast.R2 = r2
+
+	if slope <= 0 || last.MemoryLimit <= 0 {
+		return forecast
+	}
+
+	hoursToLimit := float64(last.MemoryLimit-last.MemoryUsage) / slope
+	if hoursToLimit < 0 {
+		hoursToLimit = 0
+	}
+	projected := now.Add(time.Duration(hoursToLimit * float64(time.Hour)))
+	forecast.HoursToLimit = &hoursToLimit
+	forecast.ProjectedOOMAt = &projected
+	forecast.LeakSuspected = r2 >= minR2 && hoursToLimit <= horizon.Hours()
+
+	return forecast
+}
+
+// updateLeakAlert raises or clears the memory_leak_suspected alert of a container
+func (ls *LeakService) updateLeakAlert(forecast models.MemoryForecast) error {
+	if !forecast.LeakSuspected {
+		return ls.metricsService.deactivateAlert(forecast.ContainerID, "memory_leak_suspected")
+	}
+
+	message := fmt.Sprintf("Memory growing steadily at %.1f MB/h; projected to reach its limit in %.1fh (around %s)",
+		forecast.GrowthBytesPerHour/(1024*1024),
+		*forecast.HoursToLimit,
+		forecast.ProjectedOOMAt.Format("2006-01-02 15:04 MST"),
+	)
+
+	return ls.metricsService.storeAlert(models.Alert{
+		ContainerID: forecast.ContainerID,
+		Name:        forecast.Name,
+		Type:        "memory_leak_suspected",
+		Message:     message,
+		Severity:    "warning",
+		Active:      true,
+		Timestamp:   time.Now(),
+	})
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"nabd/models"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logSyncInterval is how often the tailed containers are matched against the running ones
+// and log rule windows are re-evaluated
+const logSyncInterval = 30 * time.Second
+
+// maxLogAlertLines is the number of matching lines included in a log alert
+const maxLogAlertLines = 5
+
+// maxLogLineSize is the longest log line read; longer lines end the stream until the
+// next sync
+const maxLogLineSize = 1024 * 1024
+
+// maxQueuedLogAlerts is the number of fired log alerts waiting to be stored; when the
+// queue is full a rule fires again at its next match
+const maxQueuedLogAlerts = 256
+
+// logAlertPrefix namespaces the alert types of log rules, so a log rule never shares a
+// type with a metric rule
+const logAlertPrefix = "log:"
+
+// LogContainer identifies the container a log line was written by
+type LogContainer struct {
+	ID     string
+	Name   string
+	Image  string
+	Labels map[string]string
+}
+
+// compiledLogRule is a validated log rule with its pattern compiled
+type compiledLogRule struct {
+	models.LogRule
+	pattern *regexp.Regexp
+	window  time.Duration
+}
+
+// logTail is a container whose logs are being followed
+type logTail struct {
+	cancel context.CancelFunc
+}
+
+// logWindow holds the recent matches of one log rule in one container
+type logWindow struct {
+	container LogContainer
+	matches   []time.Time
+	lines     []string // the last maxLogAlertLines matching lines
+	firing    bool
+}
+
+// LogService follows the logs of the containers selected by log rules and raises an
+// alert when a rule's pattern matches often enough within its window
+type LogService struct {
+	dockerService  *DockerService
+	metricsService *MetricsService
+	rules          []*compiledLogRule
+
+	// fired holds the alerts raised while reading logs until they are stored, so log
+	// reading never waits for the database
+	fired chan models.Alert
+
+	mu      sync.Mutex
+	tails   map[string]*logTail // by container ID
+	windows map[ruleStateKey]*logWindow
+}
+
+// NewLogService validates the configured log rules and creates a log service
+func NewLogService(dockerService *DockerService, metricsService *MetricsService, config *models.Config) (*LogService, error) {
+	ls := &LogService{
+		dockerService:  dockerService,
+		metricsService: metricsService,
+		fired:          make(chan models.Alert, maxQueuedLogAlerts),
+		tails:          make(map[string]*logTail),
+		windows:        make(map[ruleStateKey]*logWindow),
+	}
+
+	names := make(map[string]bool)
+	for i := range config.Alerts.LogRules {
+		rule, err := compileLogRule(config.Alerts.LogRules[i])
+		if err != nil {
+			return nil, err
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate log rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+		ls.rules = append(ls.rules, rule)
+	}
+	return ls, nil
+}
+
+// compileLogRule validates a log rule, fills in its defaults and compiles its pattern
+func compileLogRule(rule models.LogRule) (*compiledLogRule, error) {
+	if !ruleNamePattern.MatchString(rule.Name) {
+		return nil, fmt.Errorf("invalid log rule name %q: use letters, digits, '_', '.' and '-'", rule.Name)
+	}
+	if rule.Pattern == "" {
+		return nil, fmt.Errorf("log rule %s: pattern is required", rule.Name)
+	}
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("log rule %s: invalid pattern: %v", rule.Name, err)
+	}
+
+	if rule.Count <= 0 {
+		rule.Count = 1 // Default to a single match
+	}
+	if rule.Window <= 0 {
+		rule.Window = 300 // Default to 5 minutes
+	}
+	switch rule.Severity {
+	case "":
+		rule.Severity = "warning"
+	case "info", "warning", "critical":
+	default:
+		return nil, fmt.Errorf("log rule %s: unknown severity %q; use info, warning or critical", rule.Name, rule.Severity)
+	}
+	for _, glob := range []string{rule.Selector.Name, rule.Selector.Image} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("log rule %s: invalid selector pattern %q", rule.Name, glob)
+		}
+	}
+
+	return &compiledLogRule{
+		LogRule: rule,
+		pattern: pattern,
+		window:  time.Duration(rule.Window) * time.Second,
+	}, nil
+}
+
+// StartTailing follows the logs of the containers selected by log rules, picking up new
+// containers and re-evaluating the rule windows periodically. Fired alerts are stored as
+// they arrive, on the same goroutine as the resolutions so they are written in order.
+func (ls *LogService) StartTailing() {
+	if len(ls.rules) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(logSyncInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := ls.sync(); err != nil {
+				log.Printf("Error listing containers for log rules: %v", err)
+			}
+			if err := ls.Evaluate(time.Now()); err != nil {
+				log.Printf("Error evaluating log rules: %v", err)
+			}
+
+		wait:
+			for {
+				select {
+				case alert := <-ls.fired:
+					if err := ls.metricsService.storeAlert(alert); err != nil {
+						log.Printf("Error raising log alert for %s: %v", alert.Name, err)
+					}
+				case <-ticker.C:
+					break wait
+				}
+			}
+		}
+	}()
+	log.Printf("Log tailing started with %d log rules", len(ls.rules))
+}
+
+// sync starts following the selected running containers and stops following the ones
+// that are gone
+func (ls *LogService) sync() error {
+	containers, err := ls.dockerService.GetRunningContainers(context.Background())
+	if err != nil {
+		return err
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	running := make(map[string]bool)
+	for _, container := range containers {
+		target := LogContainer{
+			ID:     container.ID[:12],
+			Name:   strings.TrimPrefix(container.Names[0], "/"),
+			Image:  container.Image,
+			Labels: container.Labels,
+		}
+		if !ls.selects(target) {
+			continue
+		}
+		running[target.ID] = true
+		if _, ok := ls.tails[target.ID]; ok {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		tail := &logTail{cancel: cancel}
+		ls.tails[target.ID] = tail
+		go ls.follow(ctx, tail, container.ID, target)
+	}
+
+	for id, tail := range ls.tails {
+		if !running[id] {
+			tail.cancel()
+			delete(ls.tails, id)
+		}
+	}
+	return nil
+}
+
+// selects reports whether any log rule selects a container. It must be called with mu
+// held.
+func (ls *LogService) selects(container LogContainer) bool {
+	for _, rule := range ls.rules {
+		if selectorMatches(rule.Selector, container.Name, container.Image, container.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// follow reads a container's log lines as they are written. When the stream ends the
+// container is followed again from the next sync.
+func (ls *LogService) follow(ctx context.Context, tail *logTail, containerID string, container LogContainer) {
+	defer func() {
+		tail.cancel()
+		ls.mu.Lock()
+		if ls.tails[container.ID] == tail {
+			delete(ls.tails, container.ID)
+		}
+		ls.mu.Unlock()
+	}()
+
+	logs, err := ls.dockerService.FollowContainerLogs(ctx, containerID, time.Now())
+	if err != nil {
+		log.Printf("Error following logs of %s: %v", container.Name, err)
+		return
+	}
+	defer logs.Close()
+
+	scanner := bufio.NewScanner(logs)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		ls.Observe(container, scanner.Text(), time.Now())
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		log.Printf("Error reading logs of %s: %v", container.Name, err)
+	}
+}
+
+// Observe matches a log line against the log rules selecting its container and queues
+// the alerts of rules reaching their count for storing
+func (ls *LogService) Observe(container LogContainer, line string, at time.Time) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for _, rule := range ls.rules {
+		if !selectorMatches(rule.Selector, container.Name, container.Image, container.Labels) || !rule.pattern.MatchString(line) {
+			continue
+		}
+
+		key := ruleStateKey{rule: rule.Name, containerID: container.ID}
+		window := ls.windows[key]
+		if window == nil {
+			window = &logWindow{}
+			ls.windows[key] = window
+		}
+		window.container = container
+		window.matches = append(window.matches, at)
+		window.lines = append(window.lines, line)
+		if len(window.lines) > maxLogAlertLines {
+			window.lines = window.lines[len(window.lines)-maxLogAlertLines:]
+		}
+		window.prune(at.Add(-rule.window))
+
+		if !window.firing && len(window.matches) >= rule.Count {
+			select {
+			case ls.fired <- rule.alert(container, window, at):
+				window.firing = true
+			default:
+				log.Printf("Log alert queue is full; dropping %s alert for %s", rule.Name, container.Name)
+			}
+		}
+	}
+}
+
+// Evaluate stores the queued alerts of rules that reached their count, then resolves
+// the alerts of windows that no longer hold enough matches at now
+func (ls *LogService) Evaluate(now time.Time) error {
+	for queued := true; queued; {
+		select {
+		case alert := <-ls.fired:
+			if err := ls.metricsService.storeAlert(alert); err != nil {
+				return err
+			}
+		default:
+			queued = false
+		}
+	}
+
+	type resolution struct {
+		container LogContainer
+		rule      string
+	}
+	var resolved []resolution
+
+	ls.mu.Lock()
+	for _, rule := range ls.rules {
+		for key, window := range ls.windows {
+			if key.rule != rule.Name {
+				continue
+			}
+			window.prune(now.Add(-rule.window))
+			if window.firing && len(window.matches) < rule.Count {
+				window.firing = false
+				resolved = append(resolved, resolution{container: window.container, rule: rule.Name})
+			}
+			if !window.firing && len(window.matches) == 0 {
+				delete(ls.windows, key)
+			}
+		}
+	}
+	ls.mu.Unlock()
+
+	for _, r := range resolved {
+		if err := ls.metricsService.deactivateAlert(r.container.ID, logAlertPrefix+r.rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune drops the matches before cutoff
+func (w *logWindow) prune(cutoff time.Time) {
+	i := 0
+	for i < len(w.matches) && w.matches[i].Before(cutoff) {
+		i++
+	}
+	w.matches = w.matches[i:]
+	if len(w.lines) > len(w.matches) {
+		w.lines = w.lines[len(w.lines)-len(w.matches):]
+	}
+}
+
+// alert builds the alert of a log rule reaching its count, with the matching lines
+func (cr *compiledLogRule) alert(container LogContainer, window *logWindow, at time.Time) models.Alert {
+	return models.Alert{
+		ContainerID: container.ID,
+		Name:        container.Name,
+		Type:        logAlertPrefix + cr.Name,
+		Message: fmt.Sprintf("%d log lines matching %q within %s:\n%s",
+			len(window.matches), cr.Pattern, cr.window, strings.Join(window.lines, "\n")),
+		Severity:  cr.Severity,
+		Active:    true,
+		Timestamp: at,
+		Value:     float64(len(window.matches)),
+		Threshold: float64(cr.Count),
+	}
+}
@@ -1,230 +1,865 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"nabd/models"
+	"nabd/notify"
+	"nabd/storage"
+	"nabd/utils"
+	"os"
+	"sort"
+	"sync"
 	"time"
 )
 
+// maxRecentCycles is the number of collection cycles kept for the status endpoint
+const maxRecentCycles = 20
+
+// ErrCollectionInProgress is returned when a collection cycle is requested while
+// the previous one is still running
+var ErrCollectionInProgress = errors.New("metrics collection already in progress")
+
+// ErrUnknownTopMetric is returned when containers are ranked by an unsupported metric
+var ErrUnknownTopMetric = errors.New("unknown metric; use cpu, memory, network_rx, network_tx, block_read or block_write")
+
+// ErrInvalidTopWindow is returned when containers are ranked over a window longer than
+// the stored history
+var ErrInvalidTopWindow = errors.New("invalid window")
+
+// maxTopWindow bounds the window containers are ranked over
+const maxTopWindow = 30 * 24 * time.Hour
+
+// topMetrics maps the metrics containers can be ranked by to their values
+var topMetrics = map[string]struct {
+	value   func(models.ContainerMetric) float64
+	counter bool
+}{
+	"cpu":         {func(m models.ContainerMetric) float64 { return m.CPUPercent }, false},
+	"memory":      {func(m models.ContainerMetric) float64 { return float64(m.MemoryUsage) }, false},
+	"network_rx":  {func(m models.ContainerMetric) float64 { return float64(m.NetworkRx) }, true},
+	"network_tx":  {func(m models.ContainerMetric) float64 { return float64(m.NetworkTx) }, true},
+	"block_read":  {func(m models.ContainerMetric) float64 { return float64(m.BlockRead) }, true},
+	"block_write": {func(m models.ContainerMetric) float64 { return float64(m.BlockWrite) }, true},
+}
+
+// maxUnhealthyContainers is the number of containers listed in the overview
+const maxUnhealthyContainers = 5
+
+// MetricsObserver is notified of every batch of collected container metrics within the
+// cycle's transaction. It returns the notifications of the alert changes it made, sent
+// once the transaction commits.
+type MetricsObserver interface {
+	ObserveMetrics(tx *sql.Tx, metrics []models.ContainerMetric) ([]alertNotification, error)
+}
+
 type MetricsService struct {
 	dockerService *DockerService
+	store         storage.MetricsStore
 	config        *models.Config
+	observers     []MetricsObserver
+
+	// latest holds the newest sample of each running container for the API
+	latest *LatestStore
+
+	// collectMu ensures collection cycles never overlap
+	collectMu sync.Mutex
+
+	// lastCollected is the start of the cycle that last sampled each container, by name
+	lastCollected map[string]time.Time
+
+	// rules evaluates the alert rules against every collected sample
+	rules *RuleEngine
+
+	// notifier is told about firing and resolved alerts; nil disables notifications
+	notifier *notify.Dispatcher
+
+	// silences mute the notifications of matching alerts; they are managed by the
+	// SilenceService
+	silences *SilenceSet
+
+	// grouper batches alert notifications by the grouping keys; nil sends them one by one
+	grouper *notify.Grouper
+
+	// inhibitor suppresses the notifications of alerts inhibited by other active alerts
+	inhibitor *Inhibitor
+
+	// router sends notifications to the channels of the owning team; nil sends them to
+	// every channel
+	router *Router
+
+	// hostname is the host reported on host-level alerts and used by the host grouping key
+	hostname string
+
+	statusMu        sync.RWMutex
+	recentCycles    []models.CollectionCycle
+	containerStatus map[string]*models.ContainerCollectionStatus
 }
 
 // NewMetricsService creates a new metrics service
-func NewMetricsService(dockerService *DockerService, config *models.Config) *MetricsService {
+func NewMetricsService(dockerService *DockerService, store storage.MetricsStore, config *models.Config) *MetricsService {
+	// Configured and API rules are added by the RuleService
+	rules := NewRuleEngine()
+	if _, err := rules.SetRules(BuiltinRules(config)); err != nil {
+		log.Printf("Error loading builtin alert rules: %v", err)
+	}
+
+	hostname := HostAlertID
+	if name, err := os.Hostname(); err == nil {
+		hostname = name
+	}
+
 	return &MetricsService{
-		dockerService: dockerService,
-		config:        config,
+		hostname:        hostname,
+		dockerService:   dockerService,
+		store:           store,
+		config:          config,
+		latest:          NewLatestStore(),
+		lastCollected:   make(map[string]time.Time),
+		rules:           rules,
+		silences:        NewSilenceSet(),
+		containerStatus: make(map[string]*models.ContainerCollectionStatus),
+	}
+}
+
+// SetNotifier sets the dispatcher notified of firing and resolved alerts, along with
+// the grouping, inhibition and routing of alert notifications from the configuration.
+// It must be set before collection starts.
+func (ms *MetricsService) SetNotifier(notifier *notify.Dispatcher) error {
+	inhibitor, err := NewInhibitor(ms.config.Alerts.InhibitRules)
+	if err != nil {
+		return err
+	}
+
+	// Channels do not exist while notifications are disabled
+	var hasChannel func(string) bool
+	if ms.config.Notifications.Enabled {
+		hasChannel = notifier.HasChannel
+	}
+	router, err := NewRouter(ms.config, hasChannel)
+	if err != nil {
+		return fmt.Errorf("routing: %v", err)
+	}
+
+	if err := ms.validateEscalation(notifier); err != nil {
+		return err
+	}
+
+	grouping := ms.config.Alerts.Grouping
+	for _, key := range grouping.By {
+		if err := validateKey(key); err != nil {
+			return fmt.Errorf("alert grouping: %v", err)
+		}
+	}
+	if len(grouping.By) > 0 {
+		wait := time.Duration(grouping.Wait) * time.Second
+		interval := time.Duration(grouping.Interval) * time.Second
+		if interval <= 0 {
+			interval = 5 * time.Minute // Default to 5 minutes
+		}
+		ms.grouper = notify.NewGrouper(notifier, wait, interval)
+	}
+
+	ms.notifier = notifier
+	ms.inhibitor = inhibitor
+	ms.router = router
+	return nil
+}
+
+// validateEscalation checks that escalation tiers are in ascending order of duration and
+// only route to known channels
+func (ms *MetricsService) validateEscalation(notifier *notify.Dispatcher) error {
+	after := 0
+	for i, tier := range ms.config.Alerts.Escalation.Tiers {
+		if tier.After <= after {
+			return fmt.Errorf("escalation tier %d: after must be greater than %d seconds", i+1, after)
+		}
+		after = tier.After
+
+		switch tier.Severity {
+		case "info", "warning", "critical":
+		default:
+			return fmt.Errorf("escalation tier %d: unknown severity %q; use info, warning or critical", i+1, tier.Severity)
+		}
+
+		// Channels do not exist while notifications are disabled
+		if !ms.config.Notifications.Enabled {
+			continue
+		}
+		for _, channel := range tier.Channels {
+			if !notifier.HasChannel(channel) {
+				return fmt.Errorf("escalation tier %d: unknown notification channel %q", i+1, channel)
+			}
+		}
+	}
+	return nil
+}
+
+// AddObserver registers an observer for collected metrics. Observers must be added
+// before collection starts.
+func (ms *MetricsService) AddObserver(observer MetricsObserver) {
+	ms.observers = append(ms.observers, observer)
+}
+
+// StartMetricsCollection starts the background collection loop. The loop ticks at the
+// shortest configured interval plus a random jitter; containers with a longer
+// per-container interval are skipped until they are due.
+func (ms *MetricsService) StartMetricsCollection() {
+	// Serve the last stored samples until the first cycle completes
+	if err := ms.loadLatestMetrics(); err != nil {
+		log.Printf("Error loading latest metrics: %v", err)
+	}
+
+	tick := ms.CollectionTick()
+	jitter := time.Duration(ms.config.Metrics.Jitter) * time.Second
+
+	go func() {
+		for {
+			time.Sleep(CollectionWait(tick, jitter))
+
+			if err := ms.CollectAndStoreMetrics(); err != nil {
+				log.Printf("Error collecting metrics: %v", err)
+			}
+		}
+	}()
+	log.Printf("Metrics collection started with %v interval", tick)
+
+	ms.startRetention()
+}
+
+// startRetention periodically deletes samples older than the retention period
+func (ms *MetricsService) startRetention() {
+	if ms.config.Storage.RetentionDays <= 0 {
+		return
+	}
+	retention := time.Duration(ms.config.Storage.RetentionDays) * 24 * time.Hour
+
+	prune := func() {
+		if err := ms.Prune(time.Now().Add(-retention)); err != nil {
+			log.Printf("Error pruning metrics: %v", err)
+		}
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		prune()
+		for range ticker.C {
+			prune()
+		}
+	}()
+	log.Printf("Metrics retention set to %v", retention)
+}
+
+// Prune deletes the container, host and scraped samples older than before
+func (ms *MetricsService) Prune(before time.Time) error {
+	if err := ms.store.Prune(before); err != nil {
+		return err
+	}
+	return utils.WriteTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM host_metrics WHERE timestamp < ?`, before); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`DELETE FROM scraped_metrics WHERE timestamp < ?`, before)
+		return err
+	})
+}
+
+// CollectionTick returns the interval of the collection loop: the shortest of the
+// global and per-container intervals
+func (ms *MetricsService) CollectionTick() time.Duration {
+	tick := ms.collectionInterval("")
+	for name := range ms.config.Metrics.Overrides {
+		if interval := ms.collectionInterval(name); interval < tick {
+			tick = interval
+		}
+	}
+	return tick
+}
+
+// CollectionWait returns the wait before the next collection cycle: tick plus a random
+// jitter below jitter, so that several Nabd instances do not query Docker in step
+func CollectionWait(tick, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return tick
+	}
+	return tick + time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// collectionInterval returns the collection interval for a container, honouring
+// per-container overrides. An empty name returns the global interval.
+func (ms *MetricsService) collectionInterval(name string) time.Duration {
+	if seconds, ok := ms.config.Metrics.Overrides[name]; ok && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	interval := time.Duration(ms.config.Metrics.Interval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second // Default to 15 seconds
+	}
+	return interval
+}
+
+// isDue returns a filter selecting the containers whose interval has elapsed. It must
+// only be called while holding collectMu.
+func (ms *MetricsService) isDue(now time.Time) func(name string) bool {
+	return func(name string) bool {
+		last, ok := ms.lastCollected[name]
+		// Allow a little slack so that jitter does not push a container to the next tick
+		if ok && now.Sub(last) < ms.collectionInterval(name)*9/10 {
+			return false
+		}
+		ms.lastCollected[name] = now
+		return true
 	}
 }
 
 // CollectAndStoreMetrics collects metrics from Docker and stores them in the database
 func (ms *MetricsService) CollectAndStoreMetrics() error {
-	metrics, err := ms.dockerService.GetContainerMetrics()
+	if !ms.collectMu.TryLock() {
+		return ErrCollectionInProgress
+	}
+	defer ms.collectMu.Unlock()
+
+	startedAt := time.Now()
+	collection, err := ms.dockerService.CollectContainerMetrics(context.Background(), ms.isDue(startedAt))
 	if err != nil {
+		alertErr := ms.storeAlert(models.Alert{
+			ContainerID: HostAlertID,
+			Name:        ms.hostname,
+			Type:        DaemonUnreachableAlert,
+			Message:     fmt.Sprintf("Docker daemon unreachable: %v", err),
+			Severity:    "critical",
+			Active:      true,
+			Timestamp:   time.Now(),
+		})
+		if alertErr != nil {
+			log.Printf("Error storing Docker daemon alert: %v", alertErr)
+		}
 		return err
 	}
+	metrics := collection.Metrics
+	ms.recordCycle(startedAt, metrics, collection.Errors)
+
+	// Forget containers that have not been due for many intervals (most likely removed)
+	for name, last := range ms.lastCollected {
+		if startedAt.Sub(last) > 10*ms.collectionInterval(name) {
+			delete(ms.lastCollected, name)
+		}
+	}
 
 	// Get list of current container IDs for cleanup
 	currentContainerIDs := make(map[string]bool)
-	for _, metric := range metrics {
-		currentContainerIDs[metric.ContainerID] = true
+	for _, containerID := range collection.Running {
+		currentContainerIDs[containerID] = true
 	}
 
-	// Deactivate alerts for containers that no longer exist
-	if err := ms.deactivateAlertsForMissingContainers(currentContainerIDs); err != nil {
-		log.Printf("Error deactivating alerts for missing containers: %v", err)
-	}
+	// Write the samples and alert changes of the cycle in a single transaction, and
+	// notify the alert changes once it commits
+	var pending []alertNotification
+	err = utils.WriteTx(func(tx *sql.Tx) error {
+		if err := ms.store.AppendTx(tx, metrics); err != nil {
+			return fmt.Errorf("storing metrics: %v", err)
+		}
 
-	for _, metric := range metrics {
-		if err := ms.storeMetric(metric); err != nil {
-			log.Printf("Error storing metric for container %s: %v", metric.Name, err)
+		notifications, err := ms.deactivateAlertTx(tx, HostAlertID, DaemonUnreachableAlert)
+		pending = append(pending, notifications...)
+		if err != nil {
+			log.Printf("Error resolving Docker daemon alert: %v", err)
 		}
 
-		// Check for alerts
-		if err := ms.checkAlerts(metric); err != nil {
-			log.Printf("Error checking alerts for container %s: %v", metric.Name, err)
+		// Deactivate alerts for containers that no longer exist
+		notifications, err = ms.deactivateAlertsForMissingContainers(tx, currentContainerIDs)
+		pending = append(pending, notifications...)
+		if err != nil {
+			log.Printf("Error deactivating alerts for missing containers: %v", err)
 		}
+
+		for _, metric := range metrics {
+			notifications, err := ms.evaluateRules(tx, metric)
+			pending = append(pending, notifications...)
+			if err != nil {
+				log.Printf("Error checking alerts for container %s: %v", metric.Name, err)
+				// Report the rules' states as changed again at the next sample
+				ms.rules.Forget(metric.ContainerID, "")
+			}
+		}
+
+		for _, observer := range ms.observers {
+			notifications, err := observer.ObserveMetrics(tx, metrics)
+			pending = append(pending, notifications...)
+			if err != nil {
+				log.Printf("Error updating alerts of metrics observer: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error storing collection cycle: %v", err)
+		// The alert changes were rolled back; report them again at the next cycle
+		for _, metric := range metrics {
+			ms.rules.Forget(metric.ContainerID, "")
+		}
+	} else {
+		ms.sendAlertNotifications(pending)
 	}
+	ms.rules.Retain(currentContainerIDs)
+	ms.latest.Retain(currentContainerIDs)
+	ms.latest.Update(metrics)
 
 	return nil
 }
 
-// storeMetric stores a single metric in the database
-func (ms *MetricsService) storeMetric(metric models.ContainerMetric) error {
-	query := `INSERT INTO container_metrics 
-		(container_id, name, cpu_percent, memory_usage, memory_limit, network_rx, network_tx, status, timestamp)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-
-	_, err := models.DB.Exec(query,
-		metric.ContainerID,
-		metric.Name,
-		metric.CPUPercent,
-		metric.MemoryUsage,
-		metric.MemoryLimit,
-		metric.NetworkRx,
-		metric.NetworkTx,
-		metric.Status,
-		metric.Timestamp,
-	)
+// recordCycle records the timing and per-container outcome of a collection cycle
+func (ms *MetricsService) recordCycle(startedAt time.Time, metrics []models.ContainerMetric, collectionErrors []models.CollectionError) {
+	duration := time.Since(startedAt)
+
+	ms.statusMu.Lock()
+	defer ms.statusMu.Unlock()
+
+	cycle := models.CollectionCycle{
+		StartedAt:  startedAt,
+		DurationMs: duration.Milliseconds(),
+		Containers: len(metrics) + len(collectionErrors),
+		Collected:  len(metrics),
+		Errors:     collectionErrors,
+	}
+	ms.recentCycles = append(ms.recentCycles, cycle)
+	if len(ms.recentCycles) > maxRecentCycles {
+		ms.recentCycles = ms.recentCycles[len(ms.recentCycles)-maxRecentCycles:]
+	}
+
+	for _, metric := range metrics {
+		status := ms.collectionStatusFor(metric.ContainerID, metric.Name)
+		status.ContainerID = metric.ContainerID
+		status.LastSuccess = metric.Timestamp
+		status.ConsecutiveFailures = 0
+	}
+	for _, collectionError := range collectionErrors {
+		status := ms.collectionStatusFor(collectionError.ContainerID, collectionError.Name)
+		status.ContainerID = collectionError.ContainerID
+		status.LastError = collectionError.Error
+		status.LastErrorAt = collectionError.Timestamp
+		status.ConsecutiveFailures++
+		status.TotalFailures++
+	}
 
-	return err
+	// Forget containers that have not been sampled for a while
+	for name, status := range ms.containerStatus {
+		lastSeen := status.LastSuccess
+		if status.LastErrorAt.After(lastSeen) {
+			lastSeen = status.LastErrorAt
+		}
+		if startedAt.Sub(lastSeen) > 10*time.Minute {
+			delete(ms.containerStatus, name)
+		}
+	}
+
+	if len(collectionErrors) > 0 {
+		log.Printf("Metrics collection cycle took %v (%d/%d containers collected)", duration.Round(time.Millisecond), cycle.Collected, cycle.Containers)
+	}
 }
 
-// GetLatestMetrics returns the latest metrics for all containers
+// collectionStatusFor returns the status entry for a container, creating it if needed.
+// The caller must hold statusMu.
+func (ms *MetricsService) collectionStatusFor(containerID, name string) *models.ContainerCollectionStatus {
+	status, ok := ms.containerStatus[name]
+	if !ok {
+		status = &models.ContainerCollectionStatus{ContainerID: containerID, Name: name}
+		ms.containerStatus[name] = status
+	}
+	return status
+}
+
+// GetCollectionStatus returns recent collection cycles (newest first) and per-container collection health
+func (ms *MetricsService) GetCollectionStatus() ([]models.CollectionCycle, []models.ContainerCollectionStatus) {
+	ms.statusMu.RLock()
+	defer ms.statusMu.RUnlock()
+
+	cycles := make([]models.CollectionCycle, 0, len(ms.recentCycles))
+	for i := len(ms.recentCycles) - 1; i >= 0; i-- {
+		cycles = append(cycles, ms.recentCycles[i])
+	}
+
+	statuses := make([]models.ContainerCollectionStatus, 0, len(ms.containerStatus))
+	for _, status := range ms.containerStatus {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return cycles, statuses
+}
+
+// GetLatestMetrics returns the latest metrics of all running containers
 func (ms *MetricsService) GetLatestMetrics() ([]models.ContainerMetric, error) {
-	query := `SELECT DISTINCT 
-		container_id, name, cpu_percent, memory_usage, memory_limit, 
-		network_rx, network_tx, status, timestamp
-		FROM container_metrics cm1
-		WHERE timestamp = (
-			SELECT MAX(timestamp) 
-			FROM container_metrics cm2 
-			WHERE cm2.container_id = cm1.container_id
-		)
-		ORDER BY name`
+	return ms.latest.All(), nil
+}
 
-	rows, err := models.DB.Query(query)
+// loadLatestMetrics fills the latest-sample store with the newest stored sample of
+// each container seen in the last hour
+func (ms *MetricsService) loadLatestMetrics() error {
+	now := time.Now()
+	samples, err := ms.store.RangeAll(now.Add(-time.Hour), now)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
 
-	var metrics []models.ContainerMetric
-	for rows.Next() {
-		var metric models.ContainerMetric
-		err := rows.Scan(
-			&metric.ContainerID,
-			&metric.Name,
-			&metric.CPUPercent,
-			&metric.MemoryUsage,
-			&metric.MemoryLimit,
-			&metric.NetworkRx,
-			&metric.NetworkTx,
-			&metric.Status,
-			&metric.Timestamp,
-		)
-		if err != nil {
-			return nil, err
+	metrics := make([]models.ContainerMetric, 0, len(samples))
+	for _, containerSamples := range samples {
+		if len(containerSamples) > 0 {
+			metrics = append(metrics, containerSamples[len(containerSamples)-1])
 		}
-		metrics = append(metrics, metric)
+	}
+	ms.latest.Update(metrics)
+	return nil
+}
+
+// GetMetricsHistory returns historical metrics for a container, newest first
+func (ms *MetricsService) GetMetricsHistory(containerID string, hours int) ([]models.ContainerMetric, error) {
+	now := time.Now()
+	metrics, err := ms.store.Range(containerID, now.Add(-time.Duration(hours)*time.Hour), now)
+	if err != nil {
+		return nil, err
 	}
 
+	for i, j := 0, len(metrics)-1; i < j; i, j = i+1, j-1 {
+		metrics[i], metrics[j] = metrics[j], metrics[i]
+	}
 	return metrics, nil
 }
 
-// GetMetricsHistory returns historical metrics for a container
-func (ms *MetricsService) GetMetricsHistory(containerID string, hours int) ([]models.ContainerMetric, error) {
-	query := `SELECT container_id, name, cpu_percent, memory_usage, memory_limit,
-		network_rx, network_tx, status, timestamp
-		FROM container_metrics 
-		WHERE container_id = ? AND timestamp > datetime('now', '-' || ? || ' hours')
-		ORDER BY timestamp DESC`
+// GetTopContainers ranks containers by a metric over the window and returns the first
+// limit. The window is at most the retention period and 30 days; containers are read
+// one at a time.
+func (ms *MetricsService) GetTopContainers(by string, limit int, window time.Duration) ([]models.TopContainer, error) {
+	metric, ok := topMetrics[by]
+	if !ok {
+		return nil, ErrUnknownTopMetric
+	}
+	maxWindow := maxTopWindow
+	if days := ms.config.Storage.RetentionDays; days > 0 && time.Duration(days)*24*time.Hour < maxWindow {
+		maxWindow = time.Duration(days) * 24 * time.Hour
+	}
+	if window > maxWindow {
+		return nil, fmt.Errorf("%w: the window is longer than %v", ErrInvalidTopWindow, maxWindow)
+	}
 
-	rows, err := models.DB.Query(query, containerID, hours)
+	now := time.Now()
+	containerIDs, err := ms.store.Containers(now.Add(-window), now)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var metrics []models.ContainerMetric
-	for rows.Next() {
-		var metric models.ContainerMetric
-		err := rows.Scan(
-			&metric.ContainerID,
-			&metric.Name,
-			&metric.CPUPercent,
-			&metric.MemoryUsage,
-			&metric.MemoryLimit,
-			&metric.NetworkRx,
-			&metric.NetworkTx,
-			&metric.Status,
-			&metric.Timestamp,
-		)
+	top := []models.TopContainer{}
+	for _, containerID := range containerIDs {
+		containerSamples, err := ms.store.Range(containerID, now.Add(-window), now)
 		if err != nil {
 			return nil, err
 		}
-		metrics = append(metrics, metric)
+		if len(containerSamples) == 0 {
+			continue
+		}
+
+		container := models.TopContainer{
+			ContainerID: containerID,
+			Name:        containerSamples[len(containerSamples)-1].Name,
+			Samples:     len(containerSamples),
+		}
+		min, max, sum := math.Inf(1), math.Inf(-1), 0.0
+		for _, sample := range containerSamples {
+			value := metric.value(sample)
+			min = math.Min(min, value)
+			max = math.Max(max, value)
+			sum += value
+		}
+
+		// Counters are ranked by their growth; a restart resets them, so the growth of
+		// a container restarted during the window is understated rather than negative
+		if metric.counter {
+			container.Value = max - min
+			container.Rate = container.Value / window.Seconds()
+		} else {
+			container.Value = sum / float64(len(containerSamples))
+			container.Peak = max
+		}
+		top = append(top, container)
 	}
 
-	return metrics, nil
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Value != top[j].Value {
+			return top[i].Value > top[j].Value
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > limit {
+		top = top[:limit]
+	}
+	return top, nil
 }
 
-// checkAlerts checks if metrics trigger any alerts and deactivates resolved alerts
-func (ms *MetricsService) checkAlerts(metric models.ContainerMetric) error {
-	// Check CPU alert
-	if metric.CPUPercent > ms.config.Alerts.CPUThreshold {
-		alert := models.Alert{
-			ContainerID: metric.ContainerID,
-			Name:        metric.Name,
-			Type:        "high_cpu",
-			Message:     "High CPU usage detected",
-			Severity:    "warning",
-			Active:      true,
-			Timestamp:   time.Now(),
-		}
-		if err := ms.storeAlert(alert); err != nil {
-			return err
+// GetOverview summarizes container states, resource usage, alerts and recent heals
+func (ms *MetricsService) GetOverview() (*models.Overview, error) {
+	containers, err := ms.dockerService.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+	latest, err := ms.GetLatestMetrics()
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := ms.GetActiveAlerts()
+	if err != nil {
+		return nil, err
+	}
+
+	overview := &models.Overview{
+		Containers:        len(containers),
+		ContainersByState: make(map[string]int),
+		ActiveAlerts:      len(alerts),
+		AlertsBySeverity:  make(map[string]int),
+		Timestamp:         time.Now(),
+	}
+
+	running := make(map[string]bool)
+	for _, container := range containers {
+		overview.ContainersByState[container.State]++
+		if container.State == "running" {
+			running[container.ID] = true
 		}
-	} else {
-		// Deactivate CPU alerts that are no longer valid
-		if err := ms.deactivateAlert(metric.ContainerID, "high_cpu"); err != nil {
-			return err
+	}
+	// The latest sample of a removed or stopped container must not count towards the totals
+	for _, metric := range latest {
+		if running[metric.ContainerID] {
+			overview.CPUPercent += metric.CPUPercent
+			overview.MemoryUsage += metric.MemoryUsage
 		}
 	}
+	for _, alert := range alerts {
+		overview.AlertsBySeverity[alert.Severity]++
+	}
+
+	query := `SELECT COUNT(*), COALESCE(SUM(CASE WHEN success THEN 0 ELSE 1 END), 0)
+		FROM autoheal_events
+		WHERE timestamp > ?`
+	if err := models.DB.QueryRow(query, time.Now().Add(-24*time.Hour)).Scan(&overview.Heals24h, &overview.FailedHeals24h); err != nil {
+		return nil, err
+	}
+
+	overview.Unhealthy = RankUnhealthy(containers, latest, alerts, maxUnhealthyContainers)
+	return overview, nil
+}
+
+// RankUnhealthy scores containers by their state, health check, restarts and active
+// alerts and returns the limit highest scoring ones. Containers with nothing wrong
+// are left out.
+func RankUnhealthy(containers []models.ContainerInfo, latest []models.ContainerMetric, alerts []models.Alert, limit int) []models.UnhealthyContainer {
+	metrics := make(map[string]models.ContainerMetric, len(latest))
+	for _, metric := range latest {
+		metrics[metric.ContainerID] = metric
+	}
+	alertCounts := make(map[string]int)
+	for _, alert := range alerts {
+		alertCounts[alert.ContainerID]++
+	}
 
-	// Check memory alert
-	if metric.MemoryLimit > 0 {
-		memoryPercent := float64(metric.MemoryUsage) / float64(metric.MemoryLimit) * 100
-		if memoryPercent > ms.config.Alerts.MemoryThreshold {
-			alert := models.Alert{
-				ContainerID: metric.ContainerID,
-				Name:        metric.Name,
-				Type:        "high_memory",
-				Message:     "High memory usage detected",
-				Severity:    "warning",
-				Active:      true,
-				Timestamp:   time.Now(),
+	ranked := []models.UnhealthyContainer{}
+	for _, container := range containers {
+		entry := models.UnhealthyContainer{
+			ContainerID: container.ID,
+			Name:        container.Name,
+			State:       container.State,
+		}
+
+		switch container.State {
+		case "restarting", "dead":
+			entry.Score += 5
+			entry.Reasons = append(entry.Reasons, "container is "+container.State)
+		}
+		if metric, ok := metrics[container.ID]; ok && container.State == "running" {
+			if metric.Health == models.HealthUnhealthy {
+				entry.Score += 5
+				entry.Reasons = append(entry.Reasons, "health check failing")
 			}
-			if err := ms.storeAlert(alert); err != nil {
-				return err
+			if metric.RestartCount > 0 {
+				restarts := metric.RestartCount
+				if restarts > 5 {
+					restarts = 5
+				}
+				entry.Score += restarts
+				entry.Reasons = append(entry.Reasons, fmt.Sprintf("restarted %d times", metric.RestartCount))
 			}
-		} else {
-			// Deactivate memory alerts that are no longer valid
-			if err := ms.deactivateAlert(metric.ContainerID, "high_memory"); err != nil {
-				return err
+		}
+		if count := alertCounts[container.ID]; count > 0 {
+			entry.Score += 2 * count
+			entry.Reasons = append(entry.Reasons, fmt.Sprintf("%d active alerts", count))
+		}
+
+		if entry.Score > 0 {
+			ranked = append(ranked, entry)
+		}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
+
+// evaluateRules runs the alert rules on a sample and stores or deactivates the alerts of
+// the rules whose state changed. It returns the notifications to send once the
+// transaction commits.
+func (ms *MetricsService) evaluateRules(tx *sql.Tx, metric models.ContainerMetric) ([]alertNotification, error) {
+	return ms.applyRuleResults(tx, metric, ms.rules.Evaluate(metric))
+}
+
+// applyRuleResults stores or deactivates the alerts of the rules whose state changed with
+// a sample. It returns the notifications to send once the transaction commits.
+func (ms *MetricsService) applyRuleResults(tx *sql.Tx, metric models.ContainerMetric, results []RuleResult) ([]alertNotification, error) {
+	var pending []alertNotification
+	for _, result := range results {
+		if !result.Changed {
+			continue
+		}
+		if !result.Firing {
+			notifications, err := ms.deactivateAlertTx(tx, metric.ContainerID, result.Rule.Name)
+			pending = append(pending, notifications...)
+			if err != nil {
+				return pending, err
 			}
+			continue
+		}
+
+		notifications, err := ms.storeAlertTx(tx, models.Alert{
+			ContainerID: metric.ContainerID,
+			Name:        metric.Name,
+			Type:        result.Rule.Name,
+			Message:     result.Message,
+			Severity:    result.Rule.Severity,
+			Active:      true,
+			Timestamp:   time.Now(),
+			Value:       result.Value,
+			Threshold:   result.Rule.Threshold,
+		})
+		pending = append(pending, notifications...)
+		if err != nil {
+			return pending, err
 		}
 	}
+	return pending, nil
+}
+
+// alertNotification is the notification of an alert change, sent once the transaction
+// making the change commits
+type alertNotification struct {
+	alert        models.Alert
+	notification notify.Notification
+}
 
+// sendAlertNotifications sends the notifications of committed alert changes, skipping
+// the alerts inhibited by the alerts active now
+func (ms *MetricsService) sendAlertNotifications(pending []alertNotification) {
+	if len(pending) == 0 {
+		return
+	}
+	sources, err := ms.inhibitionSources(models.DB.Query)
+	if err != nil {
+		log.Printf("Error reading active alerts for inhibition: %v", err)
+	}
+	for _, p := range pending {
+		if ms.inhibited(p.alert, sources) {
+			continue
+		}
+		ms.notifyAlert(p.alert, p.notification)
+	}
+}
+
+// writeAlerts runs fn in a write transaction and sends the notifications it returns once
+// the transaction commits
+func (ms *MetricsService) writeAlerts(fn func(tx *sql.Tx) ([]alertNotification, error)) error {
+	var pending []alertNotification
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		var err error
+		pending, err = fn(tx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	ms.sendAlertNotifications(pending)
 	return nil
 }
 
+// updateAlert stores a firing alert or deactivates a resolved one
+func (ms *MetricsService) updateAlert(containerID, name, alertType string, firing bool, message string) error {
+	return ms.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		return ms.updateAlertTx(tx, containerID, name, alertType, firing, message)
+	})
+}
+
+// updateAlertTx is updateAlert within a write transaction. It returns the notifications
+// to send once the transaction commits.
+func (ms *MetricsService) updateAlertTx(tx *sql.Tx, containerID, name, alertType string, firing bool, message string) ([]alertNotification, error) {
+	if !firing {
+		return ms.deactivateAlertTx(tx, containerID, alertType)
+	}
+
+	return ms.storeAlertTx(tx, models.Alert{
+		ContainerID: containerID,
+		Name:        name,
+		Type:        alertType,
+		Message:     message,
+		Severity:    "warning",
+		Active:      true,
+		Timestamp:   time.Now(),
+	})
+}
+
 // storeAlert stores an alert in the database
 func (ms *MetricsService) storeAlert(alert models.Alert) error {
-	// Check if similar alert already exists and is active
+	return ms.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		return ms.storeAlertTx(tx, alert)
+	})
+}
+
+// storeAlertTx is storeAlert within a write transaction. It returns the notification to
+// send once the transaction commits.
+func (ms *MetricsService) storeAlertTx(tx *sql.Tx, alert models.Alert) ([]alertNotification, error) {
+	alert.Fingerprint = AlertFingerprint(alert)
+
+	// Don't create duplicate alerts. Alerts stored before fingerprints were added are
+	// matched by container and type.
 	var count int
 	checkQuery := `SELECT COUNT(*) FROM alerts 
-		WHERE container_id = ? AND type = ? AND active = 1 
-		AND timestamp > datetime('now', '-1 hour')`
-	
-	err := models.DB.QueryRow(checkQuery, alert.ContainerID, alert.Type).Scan(&count)
+		WHERE active = 1 AND (fingerprint = ? OR (fingerprint = '' AND container_id = ? AND type = ?))`
+
+	err := tx.QueryRow(checkQuery, alert.Fingerprint, alert.ContainerID, alert.Type).Scan(&count)
 	if err != nil && err != sql.ErrNoRows {
-		return err
+		return nil, err
 	}
-
-	// Don't create duplicate alerts
 	if count > 0 {
-		return nil
+		return nil, nil
 	}
 
+	target := ms.alertTarget(alert)
+	_, alert.Silenced = ms.silences.Match(target, time.Now())
+	sources, err := ms.inhibitionSources(tx.Query)
+	if err != nil {
+		return nil, err
+	}
+	alert.Inhibited = ms.inhibited(alert, sources)
+	alert.Team = target.Team
+	alert.PolicyStep = ms.router.InitialSteps(target)
+
 	query := `INSERT INTO alerts 
-		(container_id, name, type, message, severity, active, timestamp)
-		VALUES (?, ?, ?, ?, ?, ?, ?)`
+		(container_id, name, type, message, severity, active, timestamp, silenced, fingerprint, inhibited,
+		team, policy_step, value, threshold)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err = models.DB.Exec(query,
+	result, err := tx.Exec(query,
 		alert.ContainerID,
 		alert.Name,
 		alert.Type,
@@ -232,14 +867,162 @@ func (ms *MetricsService) storeAlert(alert models.Alert) error {
 		alert.Severity,
 		alert.Active,
 		alert.Timestamp,
+		alert.Silenced,
+		alert.Fingerprint,
+		alert.Inhibited,
+		alert.Team,
+		alert.PolicyStep,
+		alert.Value,
+		alert.Threshold,
 	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	alert.ID = int(id)
+
+	if alert.Silenced || alert.Inhibited {
+		return nil, nil
+	}
+	return []alertNotification{{alert: alert, notification: notify.AlertFiring(alert)}}, nil
+}
+
+// alertTarget describes an alert for matchers and grouping keys. The container's image
+// and labels come from its latest sample; the team is the one stored with the alert, or
+// else the current owner of the container.
+func (ms *MetricsService) alertTarget(alert models.Alert) AlertTarget {
+	target := ms.containerTarget(alert.ContainerID, alert.Name)
+	target.Type = alert.Type
+	target.Severity = alert.Severity
+	if alert.Team != "" {
+		target.Team = alert.Team
+	}
+	return target
+}
 
-	return err
+// containerTarget describes a container by its latest sample and owning team
+func (ms *MetricsService) containerTarget(containerID, name string) AlertTarget {
+	target := AlertTarget{Name: name, Host: ms.hostname}
+	if metric, ok := ms.latest.Get(containerID); ok {
+		target.Image = metric.Image
+		target.Labels = metric.Labels
+	}
+	target.Team = ms.router.Owner(name, target.Labels)
+	return target
+}
+
+// silencedBy returns the ID of a silence matching the alert
+func (ms *MetricsService) silencedBy(alert models.Alert) (int, bool) {
+	return ms.silences.Match(ms.alertTarget(alert), time.Now())
+}
+
+// inhibitionSource is an active alert that may inhibit others
+type inhibitionSource struct {
+	id     int
+	target AlertTarget
+}
+
+// inhibitionSources reads the active alerts through query (the database or a
+// transaction) for deciding inhibition. It returns nothing without inhibit rules.
+func (ms *MetricsService) inhibitionSources(query func(string, ...interface{}) (*sql.Rows, error)) ([]inhibitionSource, error) {
+	if ms.inhibitor == nil || len(ms.inhibitor.rules) == 0 {
+		return nil, nil
+	}
+
+	rows, err := query(`SELECT ` + alertColumns + ` FROM alerts WHERE active = 1`)
+	if err != nil {
+		return nil, err
+	}
+	active, err := scanAlerts(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]inhibitionSource, len(active))
+	for i, alert := range active {
+		sources[i] = inhibitionSource{id: alert.ID, target: ms.alertTarget(alert)}
+	}
+	return sources, nil
+}
+
+// inhibited reports whether an alert is inhibited by one of the active alerts in
+// sources other than itself. Inhibition is decided again whenever an alert is notified,
+// as its sources may have fired after it.
+func (ms *MetricsService) inhibited(alert models.Alert, sources []inhibitionSource) bool {
+	if len(sources) == 0 {
+		return false
+	}
+
+	targets := make([]AlertTarget, 0, len(sources))
+	for _, source := range sources {
+		if alert.ID == 0 || source.id != alert.ID {
+			targets = append(targets, source.target)
+		}
+	}
+	return ms.inhibitor.Inhibited(ms.alertTarget(alert), targets)
+}
+
+// notifyAlert sends an alert notification to the channels it is routed to, through its
+// group when grouping is configured
+func (ms *MetricsService) notifyAlert(alert models.Alert, notification notify.Notification) {
+	target := ms.alertTarget(alert)
+	notification = describe(notification, target)
+	channels := ms.router.Channels(target, alert.PolicyStep)
+	if ms.grouper == nil {
+		ms.send(channels, notification)
+		return
+	}
+
+	labels := make(map[string]string, len(ms.config.Alerts.Grouping.By))
+	for _, key := range ms.config.Alerts.Grouping.By {
+		labels[key] = target.Key(key)
+	}
+	ms.grouper.Add(labels, channels, notification)
+}
+
+// notifyAutoHeal sends an auto-heal notification to the channels of the container's team
+func (ms *MetricsService) notifyAutoHeal(event models.AutoHealEvent) {
+	notification := notify.AutoHeal(event)
+	target := ms.containerTarget(event.ContainerID, event.Name)
+	target.Type = "autoheal"
+	target.Severity = notification.Severity
+	ms.send(ms.router.Channels(target, 0), describe(notification, target))
+}
+
+// describe adds the container's image, labels and team to a notification for templates
+func describe(notification notify.Notification, target AlertTarget) notify.Notification {
+	notification.Image = target.Image
+	notification.Labels = target.Labels
+	notification.Team = target.Team
+	return notification
+}
+
+// AlertNotification builds the notification of an alert as it would be sent now: firing,
+// or resolved once the alert is no longer active
+func (ms *MetricsService) AlertNotification(alert models.Alert) notify.Notification {
+	notification := notify.AlertFiring(alert)
+	if !alert.Active && alert.ResolvedAt != nil {
+		notification = notify.AlertResolved(alert, *alert.ResolvedAt)
+	}
+	return describe(notification, ms.alertTarget(alert))
+}
+
+// send sends a notification to channels, or to every channel when channels is nil
+func (ms *MetricsService) send(channels []string, notification notify.Notification) {
+	if channels == nil {
+		ms.notifier.Notify(notification)
+	} else {
+		ms.notifier.NotifyChannels(channels, notification)
+	}
 }
 
 // GetActiveAlerts returns all active alerts
 func (ms *MetricsService) GetActiveAlerts() ([]models.Alert, error) {
-	query := `SELECT id, container_id, name, type, message, severity, active, timestamp
+	query := `SELECT ` + alertColumns + `
 		FROM alerts 
 		WHERE active = 1 
 		ORDER BY timestamp DESC`
@@ -250,6 +1033,27 @@ func (ms *MetricsService) GetActiveAlerts() ([]models.Alert, error) {
 	}
 	defer rows.Close()
 
+	alerts, err := scanAlerts(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flag alerts by the silences matching them now, so an alert silenced when it
+	// fired is no longer flagged once its silence ends
+	for i := range alerts {
+		alerts[i].SilenceID, alerts[i].Silenced = ms.silencedBy(alerts[i])
+	}
+	return alerts, nil
+}
+
+// alertColumns are the alert columns read by scanAlerts
+const alertColumns = `id, container_id, name, type, message, severity, active, timestamp,
+	resolved_at, acknowledged_by, acknowledged_at, silenced, fingerprint, inhibited,
+	escalation_level, escalated_at, team, policy_step, value, threshold`
+
+// scanAlerts scans alert rows selected with alertColumns and computes their durations
+func scanAlerts(rows *sql.Rows) ([]models.Alert, error) {
+	now := time.Now()
 	var alerts []models.Alert
 	for rows.Next() {
 		var alert models.Alert
@@ -262,33 +1066,89 @@ func (ms *MetricsService) GetActiveAlerts() ([]models.Alert, error) {
 			&alert.Severity,
 			&alert.Active,
 			&alert.Timestamp,
+			&alert.ResolvedAt,
+			&alert.AcknowledgedBy,
+			&alert.AcknowledgedAt,
+			&alert.Silenced,
+			&alert.Fingerprint,
+			&alert.Inhibited,
+			&alert.EscalationLevel,
+			&alert.EscalatedAt,
+			&alert.Team,
+			&alert.PolicyStep,
+			&alert.Value,
+			&alert.Threshold,
 		)
 		if err != nil {
 			return nil, err
 		}
+
+		// Alerts deactivated before resolution times were recorded have no duration
+		switch {
+		case alert.Active:
+			alert.Duration = int64(now.Sub(alert.Timestamp).Seconds())
+		case alert.ResolvedAt != nil:
+			alert.Duration = int64(alert.ResolvedAt.Sub(alert.Timestamp).Seconds())
+		}
 		alerts = append(alerts, alert)
 	}
 
-	return alerts, nil
+	return alerts, rows.Err()
 }
 
 // deactivateAlert deactivates alerts of a specific type for a container
 func (ms *MetricsService) deactivateAlert(containerID, alertType string) error {
-	query := `UPDATE alerts 
-		SET active = 0 
-		WHERE container_id = ? AND type = ? AND active = 1`
+	return ms.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		return ms.deactivateAlertTx(tx, containerID, alertType)
+	})
+}
+
+// deactivateAlertTx is deactivateAlert within a write transaction. It returns the
+// notifications to send once the transaction commits.
+func (ms *MetricsService) deactivateAlertTx(tx *sql.Tx, containerID, alertType string) ([]alertNotification, error) {
+	return ms.resolveAlertsTx(tx, "container_id = ? AND type = ?", containerID, alertType)
+}
+
+// resolveAlertsTx deactivates the active alerts matching condition and returns the
+// notifications of their resolution to send once the transaction commits
+func (ms *MetricsService) resolveAlertsTx(tx *sql.Tx, condition string, args ...interface{}) ([]alertNotification, error) {
+	rows, err := tx.Query(`SELECT `+alertColumns+`
+		FROM alerts
+		WHERE active = 1 AND `+condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	alerts, err := scanAlerts(rows)
+	rows.Close()
+	if err != nil || len(alerts) == 0 {
+		return nil, err
+	}
 
-	_, err := models.DB.Exec(query, containerID, alertType)
-	return err
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE alerts SET active = 0, resolved_at = ? WHERE active = 1 AND `+condition,
+		append([]interface{}{now}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []alertNotification
+	for _, alert := range alerts {
+		if _, silenced := ms.silencedBy(alert); alert.Inhibited || silenced {
+			continue
+		}
+		pending = append(pending, alertNotification{alert: alert, notification: notify.AlertResolved(alert, now)})
+	}
+	return pending, nil
 }
 
-// deactivateAlertsForMissingContainers deactivates all alerts for containers that no longer exist
-func (ms *MetricsService) deactivateAlertsForMissingContainers(currentContainerIDs map[string]bool) error {
+// deactivateAlertsForMissingContainers deactivates all alerts for containers that no
+// longer exist. It returns the notifications to send once the transaction commits.
+func (ms *MetricsService) deactivateAlertsForMissingContainers(tx *sql.Tx, currentContainerIDs map[string]bool) ([]alertNotification, error) {
 	// Get all active alerts
 	query := `SELECT DISTINCT container_id FROM alerts WHERE active = 1`
-	rows, err := models.DB.Query(query)
+	rows, err := tx.Query(query)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -296,20 +1156,36 @@ func (ms *MetricsService) deactivateAlertsForMissingContainers(currentContainerI
 	for rows.Next() {
 		var containerID string
 		if err := rows.Scan(&containerID); err != nil {
-			return err
+			return nil, err
 		}
 		alertContainerIDs = append(alertContainerIDs, containerID)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
 	// Deactivate alerts for containers that no longer exist
+	var pending []alertNotification
 	for _, containerID := range alertContainerIDs {
+		if containerID == HostAlertID {
+			continue
+		}
 		if !currentContainerIDs[containerID] {
-			updateQuery := `UPDATE alerts SET active = 0 WHERE container_id = ? AND active = 1`
-			if _, err := models.DB.Exec(updateQuery, containerID); err != nil {
+			notifications, err := ms.resolveAlertsTx(tx, "container_id = ?", containerID)
+			pending = append(pending, notifications...)
+			if err != nil {
 				log.Printf("Error deactivating alerts for missing container %s: %v", containerID, err)
 			}
 		}
 	}
 
-	return nil
-}
\ No newline at end of file
+	return pending, nil
+}
+
+// deactivateAlertType deactivates the alerts of a type for every container
+func (ms *MetricsService) deactivateAlertType(alertType string) error {
+	return ms.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		return ms.resolveAlertsTx(tx, "type = ?", alertType)
+	})
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"nabd/models"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParsePrometheusText parses the Prometheus text exposition format. Comments, HELP
+// and TYPE lines are skipped; sample timestamps are ignored since Nabd stamps each
+// scrape with its own collection time.
+func ParsePrometheusText(r io.Reader) ([]models.ScrapedSample, error) {
+	var samples []models.ScrapedSample
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sample, err := parsePrometheusLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return samples, nil
+}
+
+// parsePrometheusLine parses a single `name{label="value",...} value [timestamp]` line
+func parsePrometheusLine(line string) (models.ScrapedSample, error) {
+	var sample models.ScrapedSample
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return sample, fmt.Errorf("missing value")
+	}
+	sample.Metric = line[:end]
+	rest := line[end:]
+
+	if rest[0] == '{' {
+		labels, remaining, err := parsePrometheusLabels(rest[1:])
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = remaining
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("missing value")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value %q", fields[0])
+	}
+	sample.Value = value
+
+	return sample, nil
+}
+
+// parsePrometheusLabels parses a label set up to its closing brace and returns the
+// text that follows it
+func parsePrometheusLabels(s string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return nil, "", fmt.Errorf("unterminated label set")
+		}
+		if s[0] == '}' {
+			return labels, s[1:], nil
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, "", fmt.Errorf("invalid label")
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t")
+		if s == "" || s[0] != '"' {
+			return nil, "", fmt.Errorf("label %s has no quoted value", name)
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, "", fmt.Errorf("label %s has an unterminated value", name)
+		}
+		labels[name] = value.String()
+
+		s = strings.TrimLeft(s[i+1:], " \t")
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		}
+	}
+}
+
+// SeriesKey identifies a sample's series by its metric name and sorted labels
+func SeriesKey(sample models.ScrapedSample) string {
+	if len(sample.Labels) == 0 {
+		return sample.Metric
+	}
+
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(sample.Labels[name])
+	}
+	return sample.Metric + "{" + strings.Join(pairs, ",") + "}"
+}
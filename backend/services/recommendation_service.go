@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"nabd/models"
+	"nabd/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrApplyDisabled is returned when the configuration does not allow applying recommendations
+var ErrApplyDisabled = errors.New("applying recommendations is disabled in configuration")
+
+// ErrNoRecommendation is returned when there is no limit change to apply for a container
+var ErrNoRecommendation = errors.New("no limit change is recommended for container")
+
+// ErrLowConfidence is returned when applying a recommendation based on too little history
+var ErrLowConfidence = errors.New("recommendation confidence is too low to apply")
+
+// memoryStep is the granularity of suggested memory limits
+const memoryStep = 8 << 20
+
+type RecommendationService struct {
+	dockerService   *DockerService
+	metricsService  *MetricsService
+	autoHealService *AutoHealService
+	config          *models.Config
+}
+
+// NewRecommendationService creates a new resource recommendation service
+func NewRecommendationService(dockerService *DockerService, metricsService *MetricsService, autoHealService *AutoHealService, config *models.Config) *RecommendationService {
+	return &RecommendationService{
+		dockerService:   dockerService,
+		metricsService:  metricsService,
+		autoHealService: autoHealService,
+		config:          config,
+	}
+}
+
+// GetRecommendations suggests memory and CPU limits for every running container with history
+func (rs *RecommendationService) GetRecommendations() ([]models.Recommendation, error) {
+	days := rs.config.Recommendations.Days
+	if days <= 0 {
+		days = 14 // Default to 14 days
+	}
+
+	containers, err := rs.dockerService.GetContainers()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	since := now.AddDate(0, 0, -days)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	recommendations := []models.Recommendation{}
+	for _, container := range containers {
+		if container.State != "running" {
+			continue
+		}
+		// Each container's history is read and released before the next one
+		samples, err := rs.metricsService.store.Range(container.ID, since, now)
+		if err != nil {
+			return nil, err
+		}
+		if len(samples) == 0 {
+			continue
+		}
+
+		info, err := rs.dockerService.InspectContainer(ctx, container.ID)
+		if err != nil {
+			log.Printf("Error inspecting container %s: %v", container.Name, err)
+			continue
+		}
+		memory, cpus := ContainerLimits(info)
+
+		recommendation := RecommendLimits(samples, memory, cpus, rs.config.Recommendations.Headroom)
+		recommendation.Name = container.Name
+		recommendations = append(recommendations, recommendation)
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		return recommendations[i].Name < recommendations[j].Name
+	})
+	return recommendations, nil
+}
+
+// RecommendLimits compares a container's usage samples, oldest first, with its memory
+// limit in bytes and CPU limit in cores, and suggests limits with headroom percent on top.
+// Memory is sized from p99 and never below the observed peak, since exceeding the limit
+// gets the container killed; CPU is sized from p95, since exceeding it only throttles.
+func RecommendLimits(samples []models.ContainerMetric, memoryLimit int64, cpuLimit float64, headroom float64) models.Recommendation {
+	latest := samples[len(samples)-1]
+	history := latest.Timestamp.Sub(samples[0].Timestamp)
+
+	memory := make([]float64, len(samples))
+	cpu := make([]float64, len(samples))
+	for i, sample := range samples {
+		memory[i] = float64(sample.MemoryUsage)
+		cpu[i] = sample.CPUPercent / 100
+	}
+	sort.Float64s(memory)
+	sort.Float64s(cpu)
+
+	if headroom < 0 {
+		headroom = 0
+	}
+	factor := 1 + headroom/100
+
+	recommendation := models.Recommendation{
+		ContainerID: latest.ContainerID,
+		Name:        latest.Name,
+		Samples:     len(samples),
+		HistoryDays: history.Hours() / 24,
+		Confidence:  recommendationConfidence(history),
+		Memory:      resourceUsage(memory, float64(memoryLimit)),
+		CPU:         resourceUsage(cpu, cpuLimit),
+	}
+
+	suggestedMemory := math.Max(recommendation.Memory.P99*factor, recommendation.Memory.Peak)
+	recommendation.Memory.Suggested = math.Max(1, math.Ceil(suggestedMemory/memoryStep)) * memoryStep
+	recommendation.Memory.Action = recommendAction(recommendation.Memory)
+
+	// CPU limits are suggested in tenths of a core
+	recommendation.CPU.Suggested = math.Max(1, math.Ceil(recommendation.CPU.P95*factor*10-1e-9)) / 10
+	recommendation.CPU.Action = recommendAction(recommendation.CPU)
+
+	return recommendation
+}
+
+// resourceUsage summarizes sorted usage values against a limit
+func resourceUsage(sorted []float64, limit float64) models.ResourceRecommendation {
+	return models.ResourceRecommendation{
+		Limit: limit,
+		P95:   utils.Percentile(sorted, 95),
+		P99:   utils.Percentile(sorted, 99),
+		Peak:  sorted[len(sorted)-1],
+	}
+}
+
+// recommendAction decides how the current limit should change. Limits within 20% above
+// the suggestion are kept to avoid churn.
+func recommendAction(resource models.ResourceRecommendation) string {
+	switch {
+	case resource.Limit == 0:
+		return models.RecommendSetLimit
+	case resource.Suggested > resource.Limit:
+		return models.RecommendIncrease
+	case resource.Suggested < resource.Limit*0.8:
+		return models.RecommendDecrease
+	default:
+		return models.RecommendKeep
+	}
+}
+
+// recommendationConfidence rates how representative the history is: a week covers
+// weekly cycles, a day at least covers daily ones
+func recommendationConfidence(history time.Duration) string {
+	switch {
+	case history >= 7*24*time.Hour:
+		return "high"
+	case history >= 24*time.Hour:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// ApplyRecommendation sets the recommended limits of a container with docker update
+// and records the change as an auto-heal event. Only resources whose limit should
+// change are updated; resources restricts the update to "memory" and/or "cpu".
+func (rs *RecommendationService) ApplyRecommendation(name string, resources []string) (models.AutoHealEvent, error) {
+	if !rs.config.Recommendations.AllowApply {
+		return models.AutoHealEvent{}, ErrApplyDisabled
+	}
+
+	recommendations, err := rs.GetRecommendations()
+	if err != nil {
+		return models.AutoHealEvent{}, err
+	}
+	var recommendation *models.Recommendation
+	for i := range recommendations {
+		if recommendations[i].Name == name {
+			recommendation = &recommendations[i]
+			break
+		}
+	}
+	if recommendation == nil {
+		return models.AutoHealEvent{}, ErrNoRecommendation
+	}
+	if recommendation.Confidence == "low" {
+		return models.AutoHealEvent{}, ErrLowConfidence
+	}
+
+	selected := func(resource string) bool {
+		if len(resources) == 0 {
+			return true
+		}
+		for _, r := range resources {
+			if r == resource {
+				return true
+			}
+		}
+		return false
+	}
+
+	var (
+		memory  int64
+		cpus    float64
+		changes []string
+	)
+	if selected("memory") && recommendation.Memory.Action != models.RecommendKeep {
+		memory = int64(recommendation.Memory.Suggested)
+		changes = append(changes, fmt.Sprintf("memory %d MiB", memory>>20))
+	}
+	if selected("cpu") && recommendation.CPU.Action != models.RecommendKeep {
+		cpus = recommendation.CPU.Suggested
+		changes = append(changes, fmt.Sprintf("cpu %.1f cores", cpus))
+	}
+	if len(changes) == 0 {
+		return models.AutoHealEvent{}, ErrNoRecommendation
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err = rs.dockerService.UpdateContainerResources(ctx, recommendation.ContainerID, memory, cpus)
+
+	event := models.AutoHealEvent{
+		ContainerID: recommendation.ContainerID,
+		Name:        name,
+		Action:      "update_limits",
+		Reason:      fmt.Sprintf("Applied recommended limits: %s", strings.Join(changes, ", ")),
+		Success:     err == nil,
+		Timestamp:   time.Now(),
+	}
+	if storeErr := rs.autoHealService.storeAutoHealEvent(event); storeErr != nil {
+		log.Printf("Error storing auto-heal event: %v", storeErr)
+	}
+	if err != nil {
+		log.Printf("Failed to update limits of container %s: %v", name, err)
+		return event, err
+	}
+
+	log.Printf("Updated limits of container %s: %s", name, strings.Join(changes, ", "))
+	return event, nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"fmt"
+	"nabd/models"
+	"path"
+)
+
+// Container labels naming the team that owns a container, in order of precedence
+var ownerLabels = []string{"nabd.owner", "team"}
+
+// Router decides which notification channels receive the notifications of an alert from
+// the team owning its container
+type Router struct {
+	ownership []models.OwnershipRule
+	routes    []compiledRoute
+	fallback  []string
+	policies  map[string]models.EscalationPolicy
+}
+
+// compiledRoute is a route with its matchers compiled
+type compiledRoute struct {
+	models.Route
+	matchers []compiledMatcher
+}
+
+// NewRouter validates and compiles the routing configuration. hasChannel reports
+// whether a notification channel exists; nil skips the channel checks.
+func NewRouter(config *models.Config, hasChannel func(name string) bool) (*Router, error) {
+	routing := config.Routing
+
+	checkChannels := func(context string, channels []string) error {
+		if hasChannel == nil {
+			return nil
+		}
+		for _, channel := range channels {
+			if !hasChannel(channel) {
+				return fmt.Errorf("%s: unknown notification channel %q", context, channel)
+			}
+		}
+		return nil
+	}
+
+	router := &Router{
+		ownership: routing.Ownership,
+		fallback:  routing.Fallback,
+		policies:  make(map[string]models.EscalationPolicy),
+	}
+
+	for i, rule := range routing.Ownership {
+		if rule.Container == "" || rule.Team == "" {
+			return nil, fmt.Errorf("ownership rule %d: container and team are required", i+1)
+		}
+		if _, err := path.Match(rule.Container, ""); err != nil {
+			return nil, fmt.Errorf("ownership rule %d: invalid pattern %q", i+1, rule.Container)
+		}
+	}
+
+	for i, policy := range routing.Policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("escalation policy %d: name is required", i+1)
+		}
+		if _, ok := router.policies[policy.Name]; ok {
+			return nil, fmt.Errorf("escalation policy %q is defined twice", policy.Name)
+		}
+		if len(policy.Steps) == 0 {
+			return nil, fmt.Errorf("escalation policy %q: at least one step is required", policy.Name)
+		}
+		for j, step := range policy.Steps {
+			if step.After < 0 {
+				return nil, fmt.Errorf("escalation policy %q step %d: after must not be negative", policy.Name, j+1)
+			}
+			if j > 0 && step.After <= policy.Steps[j-1].After {
+				return nil, fmt.Errorf("escalation policy %q step %d: after must be greater than %d seconds", policy.Name, j+1, policy.Steps[j-1].After)
+			}
+			if len(step.Channels) == 0 {
+				return nil, fmt.Errorf("escalation policy %q step %d: channels are required", policy.Name, j+1)
+			}
+			if err := checkChannels(fmt.Sprintf("escalation policy %q step %d", policy.Name, j+1), step.Channels); err != nil {
+				return nil, err
+			}
+		}
+		router.policies[policy.Name] = policy
+	}
+
+	for i, route := range routing.Routes {
+		if len(route.Channels) == 0 && route.Policy == "" {
+			return nil, fmt.Errorf("route %d: channels or a policy are required", i+1)
+		}
+		if route.Policy != "" {
+			if _, ok := router.policies[route.Policy]; !ok {
+				return nil, fmt.Errorf("route %d: unknown escalation policy %q", i+1, route.Policy)
+			}
+		}
+		if err := checkChannels(fmt.Sprintf("route %d", i+1), route.Channels); err != nil {
+			return nil, err
+		}
+		matchers, err := compileMatchers(route.Matchers)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %v", i+1, err)
+		}
+		router.routes = append(router.routes, compiledRoute{Route: route, matchers: matchers})
+	}
+
+	if err := checkChannels("fallback route", routing.Fallback); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// Owner returns the team owning a container: the nabd.owner or team label, else the team
+// of the first ownership rule matching the container name
+func (r *Router) Owner(name string, labels map[string]string) string {
+	for _, label := range ownerLabels {
+		if team := labels[label]; team != "" {
+			return team
+		}
+	}
+	if r == nil {
+		return ""
+	}
+	for _, rule := range r.ownership {
+		if matched, _ := path.Match(rule.Container, name); matched {
+			return rule.Team
+		}
+	}
+	return ""
+}
+
+// Enabled reports whether notifications are routed; otherwise they go to every channel
+func (r *Router) Enabled() bool {
+	return r != nil && (len(r.routes) > 0 || len(r.fallback) > 0)
+}
+
+// Route returns the first route matching target, or the fallback route
+func (r *Router) Route(target AlertTarget) models.Route {
+	for _, route := range r.routes {
+		if (route.Team == "" || route.Team == target.Team) && matchAll(route.matchers, target) {
+			return route.Route
+		}
+	}
+	return models.Route{Channels: r.fallback}
+}
+
+// Policy returns the escalation policy of a route
+func (r *Router) Policy(route models.Route) (models.EscalationPolicy, bool) {
+	policy, ok := r.policies[route.Policy]
+	return policy, ok
+}
+
+// InitialSteps returns the number of escalation policy steps notified when an alert on
+// target fires: the leading steps with no delay
+func (r *Router) InitialSteps(target AlertTarget) int {
+	if !r.Enabled() {
+		return 0
+	}
+	policy, ok := r.Policy(r.Route(target))
+	if !ok {
+		return 0
+	}
+	return PolicySteps(policy, 0)
+}
+
+// Channels returns the channels receiving the notifications of an alert on target that
+// has notified steps of its escalation policy, or nil when routing is disabled
+func (r *Router) Channels(target AlertTarget, steps int) []string {
+	if !r.Enabled() {
+		return nil
+	}
+
+	route := r.Route(target)
+	channels := append([]string{}, route.Channels...)
+	if policy, ok := r.Policy(route); ok {
+		for i := 0; i < steps && i < len(policy.Steps); i++ {
+			channels = append(channels, policy.Steps[i].Channels...)
+		}
+	}
+	return uniqueStrings(channels)
+}
+
+// PolicySteps returns the number of steps of a policy due once an alert has been
+// unacknowledged for elapsed seconds
+func PolicySteps(policy models.EscalationPolicy, elapsed int) int {
+	steps := 0
+	for _, step := range policy.Steps {
+		if step.After > elapsed {
+			break
+		}
+		steps++
+	}
+	return steps
+}
+
+// uniqueStrings removes repeated values, keeping the first occurrence of each
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := values[:0]
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,690 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"nabd/models"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ruleSample is a container sample with the values derived from earlier samples, the
+// series of one scrape of the container's Prometheus endpoint, or a host sample
+type ruleSample struct {
+	metric   models.ContainerMetric
+	restarts int // restarts within the last hour
+	scrape   bool
+	scraped  []scrapedSeries
+	host     *models.HostMetric
+}
+
+// scrapedSeries is the value of one scraped series
+type scrapedSeries struct {
+	metric string
+	series string
+	value  float64
+}
+
+// ScrapedMetricPrefix marks rule metrics read from scraped series, as in
+// scraped:queue_depth or scraped:http_requests_total{code="500"}
+const ScrapedMetricPrefix = "scraped:"
+
+// ruleMetrics maps the metrics rules can use to their values. A metric without a
+// value for a sample (such as memory_percent without a limit) leaves the rule's
+// state unchanged.
+var ruleMetrics = map[string]func(sample ruleSample) (float64, bool){
+	"cpu_percent": func(s ruleSample) (float64, bool) { return s.metric.CPUPercent, true },
+	"memory_percent": func(s ruleSample) (float64, bool) {
+		if s.metric.MemoryLimit <= 0 {
+			return 0, false
+		}
+		return float64(s.metric.MemoryUsage) / float64(s.metric.MemoryLimit) * 100, true
+	},
+	"memory_usage":   func(s ruleSample) (float64, bool) { return float64(s.metric.MemoryUsage), true },
+	"network_rx":     func(s ruleSample) (float64, bool) { return float64(s.metric.NetworkRx), true },
+	"network_tx":     func(s ruleSample) (float64, bool) { return float64(s.metric.NetworkTx), true },
+	"block_read":     func(s ruleSample) (float64, bool) { return float64(s.metric.BlockRead), true },
+	"block_write":    func(s ruleSample) (float64, bool) { return float64(s.metric.BlockWrite), true },
+	"pids":           func(s ruleSample) (float64, bool) { return float64(s.metric.Pids), true },
+	"restart_count":  func(s ruleSample) (float64, bool) { return float64(s.metric.RestartCount), true },
+	"restarts_1h":    func(s ruleSample) (float64, bool) { return float64(s.restarts), true },
+	"uptime_seconds": func(s ruleSample) (float64, bool) { return float64(s.metric.UptimeSeconds), true },
+	// Uptime of containers that have restarted; a freshly created container is not flapping
+	"uptime_after_restart": func(s ruleSample) (float64, bool) {
+		return float64(s.metric.UptimeSeconds), s.metric.RestartCount > 0
+	},
+	"health": func(s ruleSample) (float64, bool) { return s.metric.Health, s.metric.Health != models.HealthNone },
+}
+
+// ruleComparators maps the comparators rules can use to their functions
+var ruleComparators = map[string]func(value, threshold float64) bool{
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// ruleNamePattern restricts rule names, which become alert types
+var ruleNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// reservedRuleNames are the alert types raised outside alert rules. A rule using one of
+// them would fire and resolve the other service's alerts.
+var reservedRuleNames = map[string]bool{
+	"anomaly":               true,
+	"memory_leak_suspected": true,
+	"host_high_cpu":         true,
+	"host_high_memory":      true,
+	"host_high_disk":        true,
+	"host_high_load":        true,
+	"dangling_images":       true,
+	"large_writable_layer":  true,
+	"large_log_file":        true,
+	"fast_log_growth":       true,
+	"unbounded_log":         true,
+	DaemonUnreachableAlert:  true,
+}
+
+// defaultRuleMessage is used for rules without a message template
+const defaultRuleMessage = `{{.Metric}} is {{printf "%.2f" .Value}} ({{.Comparator}} {{.Threshold}})`
+
+// ruleMessageData is the data available to rule message templates
+type ruleMessageData struct {
+	Rule        string
+	Name        string
+	ContainerID string
+	Image       string
+	Labels      map[string]string
+	Metric      string
+	Comparator  string
+	Value       float64
+	Threshold   float64
+	For         int
+	Severity    string
+}
+
+// compiledRule is a validated rule with its parsed message template
+type compiledRule struct {
+	models.AlertRule
+	compare func(value, threshold float64) bool
+	value   func(sample ruleSample) (float64, bool)
+	scraped bool // the rule reads scraped series and only applies to scrapes
+	host    bool // the rule reads host metrics and only applies to host samples
+	resolve float64
+	message *template.Template
+}
+
+// ruleState tracks one rule for one container
+type ruleState struct {
+	pendingSince time.Time
+	pending      bool
+	firing       bool
+	settled      bool // a result has been reported as changed since the state was created
+}
+
+// restartObservation is a container restart count seen in a sample
+type restartObservation struct {
+	count int
+	at    time.Time
+}
+
+type ruleStateKey struct {
+	rule        string
+	containerID string
+}
+
+// RuleResult is the outcome of evaluating one rule against one sample
+type RuleResult struct {
+	Rule   models.AlertRule
+	Firing bool
+	// Changed is set when the rule started or stopped firing with this sample, and for
+	// the first sample that is firing or not pending since the engine started tracking
+	// the rule for the container, so alerts stored before it are reconciled
+	Changed bool
+	Value   float64
+	Message string
+}
+
+// RuleEngine evaluates alert rules against container samples. A rule's condition must
+// hold for its For duration before it fires, and it keeps firing until the value
+// crosses the resolve threshold, so values hovering around a threshold do not flap.
+type RuleEngine struct {
+	mu             sync.Mutex
+	rules          []*compiledRule
+	states         map[ruleStateKey]*ruleState
+	restartHistory map[string][]restartObservation // by container ID
+}
+
+// NewRuleEngine creates a rule engine without rules
+func NewRuleEngine() *RuleEngine {
+	return &RuleEngine{
+		states:         make(map[ruleStateKey]*ruleState),
+		restartHistory: make(map[string][]restartObservation),
+	}
+}
+
+// ValidateRule checks that a rule can be evaluated and fills in its defaults
+func ValidateRule(rule *models.AlertRule) error {
+	_, err := compileRule(rule)
+	return err
+}
+
+// compileRule validates a rule, fills in its defaults and parses its message template
+func compileRule(rule *models.AlertRule) (*compiledRule, error) {
+	if !ruleNamePattern.MatchString(rule.Name) {
+		return nil, fmt.Errorf("invalid rule name %q: use letters, digits, '_', '.' and '-'", rule.Name)
+	}
+	if reservedRuleNames[rule.Name] {
+		return nil, fmt.Errorf("invalid rule name %q: it is the type of alerts raised outside alert rules", rule.Name)
+	}
+
+	scraped := strings.HasPrefix(rule.Metric, ScrapedMetricPrefix)
+	value, ok := ruleMetrics[rule.Metric]
+	if scraped {
+		if strings.TrimPrefix(rule.Metric, ScrapedMetricPrefix) == "" {
+			return nil, fmt.Errorf("rule %s: metric %q names no scraped series", rule.Name, rule.Metric)
+		}
+	} else if !ok {
+		return nil, fmt.Errorf("rule %s: unknown metric %q; use one of %s", rule.Name, rule.Metric, strings.Join(RuleMetricNames(), ", "))
+	}
+	compare, ok := ruleComparators[rule.Comparator]
+	if !ok {
+		return nil, fmt.Errorf("rule %s: unknown comparator %q; use >, >=, <, <=, == or !=", rule.Name, rule.Comparator)
+	}
+	if scraped {
+		value = scrapedValue(strings.TrimPrefix(rule.Metric, ScrapedMetricPrefix), rule.Comparator, rule.Threshold, compare)
+	}
+	if math.IsNaN(rule.Threshold) || math.IsInf(rule.Threshold, 0) {
+		return nil, fmt.Errorf("rule %s: threshold must be a number", rule.Name)
+	}
+	if rule.For < 0 {
+		return nil, fmt.Errorf("rule %s: for must not be negative", rule.Name)
+	}
+
+	resolve := rule.Threshold
+	if rule.ResolveThreshold != nil {
+		resolve = *rule.ResolveThreshold
+		// The resolve threshold must lie on the side of the threshold the value returns to
+		if ((rule.Comparator == ">" || rule.Comparator == ">=") && resolve > rule.Threshold) ||
+			((rule.Comparator == "<" || rule.Comparator == "<=") && resolve < rule.Threshold) {
+			return nil, fmt.Errorf("rule %s: resolve threshold %v would resolve the alert while it is still firing", rule.Name, resolve)
+		}
+	}
+
+	switch rule.Severity {
+	case "":
+		rule.Severity = "warning"
+	case "info", "warning", "critical":
+	default:
+		return nil, fmt.Errorf("rule %s: unknown severity %q; use info, warning or critical", rule.Name, rule.Severity)
+	}
+
+	for _, pattern := range []string{rule.Selector.Name, rule.Selector.Image} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("rule %s: invalid selector pattern %q", rule.Name, pattern)
+		}
+	}
+
+	text := rule.Message
+	if text == "" {
+		text = defaultRuleMessage
+	}
+	message, err := template.New(rule.Name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("rule %s: invalid message template: %v", rule.Name, err)
+	}
+
+	return &compiledRule{
+		AlertRule: *rule,
+		compare:   compare,
+		value:     value,
+		scraped:   scraped,
+		resolve:   resolve,
+		message:   message,
+	}, nil
+}
+
+// scrapedValue returns the value of a scraped series in a scrape. A bare metric name
+// matches each of its series, and the rule sees the series closest to firing: the
+// highest value for > and >=, the lowest for < and <=, and otherwise the first series
+// meeting the condition.
+func scrapedValue(name, comparator string, threshold float64, compare func(value, threshold float64) bool) func(sample ruleSample) (float64, bool) {
+	return func(s ruleSample) (float64, bool) {
+		var value float64
+		found := false
+		for _, series := range s.scraped {
+			if series.metric != name && series.series != name {
+				continue
+			}
+			switch {
+			case !found:
+				value, found = series.value, true
+			case comparator == ">" || comparator == ">=":
+				value = math.Max(value, series.value)
+			case comparator == "<" || comparator == "<=":
+				value = math.Min(value, series.value)
+			case !compare(value, threshold) && compare(series.value, threshold):
+				value = series.value
+			}
+		}
+		return value, found
+	}
+}
+
+// RuleMetricNames returns the metrics rules can use, sorted, followed by the form of
+// scraped series
+func RuleMetricNames() []string {
+	names := make([]string, 0, len(ruleMetrics)+1)
+	for name := range ruleMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, ScrapedMetricPrefix+"<series>")
+}
+
+// SetRules replaces the rules being evaluated. The state of rules whose definition is
+// unchanged is kept. It returns the names of the rules that were removed.
+func (re *RuleEngine) SetRules(rules []models.AlertRule) ([]string, error) {
+	compiled := make([]*compiledRule, 0, len(rules))
+	names := make(map[string]bool)
+	for i := range rules {
+		rule := rules[i]
+		if names[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q", rule.Name)
+		}
+		names[rule.Name] = true
+
+		compiledRule, err := compileRule(&rule)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, compiledRule)
+	}
+
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	previous := make(map[string]*compiledRule)
+	for _, rule := range re.rules {
+		previous[rule.Name] = rule
+	}
+	var removed []string
+	for name := range previous {
+		if !names[name] {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+
+	unchanged := make(map[string]bool)
+	for _, rule := range compiled {
+		if old, ok := previous[rule.Name]; ok && sameRule(old.AlertRule, rule.AlertRule) {
+			unchanged[rule.Name] = true
+		}
+	}
+	for key := range re.states {
+		if !unchanged[key.rule] {
+			delete(re.states, key)
+		}
+	}
+
+	re.rules = compiled
+	return removed, nil
+}
+
+// sameRule reports whether two rules have the same definition
+func sameRule(a, b models.AlertRule) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+// Rules returns the rules being evaluated
+func (re *RuleEngine) Rules() []models.AlertRule {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	rules := make([]models.AlertRule, len(re.rules))
+	for i, rule := range re.rules {
+		rules[i] = rule.AlertRule
+	}
+	return rules
+}
+
+// Evaluate advances every rule on container metrics that selects the sample's container
+// and returns their results. Samples of one container must be evaluated in time order.
+func (re *RuleEngine) Evaluate(metric models.ContainerMetric) []RuleResult {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	return re.evaluate(ruleSample{metric: metric, restarts: re.recentRestarts(metric)})
+}
+
+// EvaluateScrape advances every rule on scraped series that selects the container with
+// the samples of one scrape. The metric identifies the container and carries the time
+// of the scrape; scrapes of one container must be evaluated in time order.
+func (re *RuleEngine) EvaluateScrape(metric models.ContainerMetric, samples []models.ScrapedSample) []RuleResult {
+	scraped := make([]scrapedSeries, 0, len(samples))
+	for _, sample := range samples {
+		scraped = append(scraped, scrapedSeries{metric: sample.Metric, series: SeriesKey(sample), value: sample.Value})
+	}
+	return re.evaluateScrape(metric, scraped)
+}
+
+// evaluateScrape advances the rules on scraped series with the series of one scrape
+func (re *RuleEngine) evaluateScrape(metric models.ContainerMetric, scraped []scrapedSeries) []RuleResult {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	return re.evaluate(ruleSample{metric: metric, scrape: true, scraped: scraped})
+}
+
+// NewHostRuleEngine creates a rule engine evaluating host samples against the host
+// alert thresholds in the configuration. Like the built-in CPU and memory rules, the
+// conditions must hold for a minute and resolve below the threshold. diskPath names
+// the filesystem in disk alert messages.
+func NewHostRuleEngine(config *models.Config, diskPath string) *RuleEngine {
+	re := NewRuleEngine()
+	for _, rule := range hostRules(config, diskPath) {
+		resolve := rule.Threshold
+		if rule.ResolveThreshold != nil {
+			resolve = *rule.ResolveThreshold
+		}
+		// Host rules are built in and named after the reserved host alert types, so
+		// they are compiled without the checks of compileRule
+		re.rules = append(re.rules, &compiledRule{
+			AlertRule: rule,
+			compare:   ruleComparators[rule.Comparator],
+			value:     hostRuleMetrics[rule.Metric],
+			host:      true,
+			resolve:   resolve,
+			message:   template.Must(template.New(rule.Name).Option("missingkey=zero").Parse(rule.Message)),
+		})
+	}
+	return re
+}
+
+// EvaluateHost advances the host rules with a host sample and returns their results.
+// Host samples must be evaluated in time order.
+func (re *RuleEngine) EvaluateHost(metric models.HostMetric) []RuleResult {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	return re.evaluate(ruleSample{
+		metric: models.ContainerMetric{ContainerID: HostAlertID, Name: metric.Hostname, Timestamp: metric.Timestamp},
+		host:   &metric,
+	})
+}
+
+// evaluate advances the rules that apply to a sample. It must be called with mu held.
+func (re *RuleEngine) evaluate(sample ruleSample) []RuleResult {
+	metric := sample.metric
+
+	var results []RuleResult
+	for _, rule := range re.rules {
+		if rule.scraped != sample.scrape || rule.host != (sample.host != nil) || !rule.selects(metric) {
+			continue
+		}
+		value, ok := rule.value(sample)
+		if !ok {
+			continue
+		}
+
+		key := ruleStateKey{rule: rule.Name, containerID: metric.ContainerID}
+		state := re.states[key]
+		if state == nil {
+			state = &ruleState{}
+			re.states[key] = state
+		}
+
+		wasFiring := state.firing
+		if state.firing {
+			state.firing = rule.compare(value, rule.resolve)
+			state.pending = state.firing
+		} else if rule.compare(value, rule.Threshold) {
+			if !state.pending {
+				state.pending = true
+				state.pendingSince = metric.Timestamp
+			}
+			state.firing = metric.Timestamp.Sub(state.pendingSince) >= time.Duration(rule.For)*time.Second
+		} else {
+			state.pending = false
+		}
+
+		changed := state.firing != wasFiring || (!state.settled && (state.firing || !state.pending))
+		if changed {
+			state.settled = true
+		}
+
+		results = append(results, RuleResult{
+			Rule:    rule.AlertRule,
+			Firing:  state.firing,
+			Changed: changed,
+			Value:   value,
+			Message: rule.render(metric, value),
+		})
+	}
+	return results
+}
+
+// Retain drops the state and restart history of containers that are not in ids
+func (re *RuleEngine) Retain(ids map[string]bool) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	for key := range re.states {
+		if !ids[key.containerID] {
+			delete(re.states, key)
+		}
+	}
+	for id := range re.restartHistory {
+		if !ids[id] {
+			delete(re.restartHistory, id)
+		}
+	}
+}
+
+// Forget drops the state of a rule for a container, or of every rule when rule is
+// empty, so the next sample reports the rule's state as changed again
+func (re *RuleEngine) Forget(containerID, rule string) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	for key := range re.states {
+		if key.containerID == containerID && (rule == "" || key.rule == rule) {
+			delete(re.states, key)
+		}
+	}
+}
+
+// recentRestarts returns how many times a container restarted within the hour before
+// the sample, based on the restart counts of earlier samples. It must be called with
+// mu held.
+func (re *RuleEngine) recentRestarts(metric models.ContainerMetric) int {
+	cutoff := metric.Timestamp.Add(-time.Hour)
+	observations := re.restartHistory[metric.ContainerID]
+	for len(observations) > 0 && observations[0].at.Before(cutoff) {
+		observations = observations[1:]
+	}
+	observations = append(observations, restartObservation{count: metric.RestartCount, at: metric.Timestamp})
+	re.restartHistory[metric.ContainerID] = observations
+
+	restarts := metric.RestartCount - observations[0].count
+	if restarts < 0 {
+		// The container was recreated and its counter started over
+		return 0
+	}
+	return restarts
+}
+
+// selects reports whether the rule applies to the sample's container
+func (cr *compiledRule) selects(metric models.ContainerMetric) bool {
+	return selectorMatches(cr.Selector, metric.Name, metric.Image, metric.Labels)
+}
+
+// selectorMatches reports whether a rule selector matches a container
+func selectorMatches(selector models.RuleSelector, name, image string, labels map[string]string) bool {
+	if selector.Name != "" {
+		if ok, _ := path.Match(selector.Name, name); !ok {
+			return false
+		}
+	}
+	if selector.Image != "" {
+		if ok, _ := path.Match(selector.Image, image); !ok {
+			return false
+		}
+	}
+	for label, value := range selector.Labels {
+		if actual, ok := labels[label]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// render executes the rule's message template for a sample
+func (cr *compiledRule) render(metric models.ContainerMetric, value float64) string {
+	var buf bytes.Buffer
+	err := cr.message.Execute(&buf, ruleMessageData{
+		Rule:        cr.Name,
+		Name:        metric.Name,
+		ContainerID: metric.ContainerID,
+		Image:       metric.Image,
+		Labels:      metric.Labels,
+		Metric:      cr.Metric,
+		Comparator:  cr.Comparator,
+		Value:       value,
+		Threshold:   cr.Threshold,
+		For:         cr.For,
+		Severity:    cr.Severity,
+	})
+	if err != nil {
+		return fmt.Sprintf("%s: %s is %.2f (%s %v)", cr.Name, cr.Metric, value, cr.Comparator, cr.Threshold)
+	}
+	return buf.String()
+}
+
+// BuiltinRules returns the rules derived from the alert thresholds in the configuration.
+// CPU and memory alerts must hold for a minute and resolve 10 points below the threshold.
+func BuiltinRules(config *models.Config) []models.AlertRule {
+	var rules []models.AlertRule
+	resolveBelow := func(threshold float64) *float64 {
+		resolve := math.Max(0, threshold-10)
+		return &resolve
+	}
+
+	if threshold := config.Alerts.CPUThreshold; threshold > 0 {
+		rules = append(rules, models.AlertRule{
+			Name:             "high_cpu",
+			Metric:           "cpu_percent",
+			Comparator:       ">",
+			Threshold:        threshold,
+			For:              60,
+			ResolveThreshold: resolveBelow(threshold),
+			Message:          `High CPU usage detected: {{printf "%.1f" .Value}}%`,
+		})
+	}
+	if threshold := config.Alerts.MemoryThreshold; threshold > 0 {
+		rules = append(rules, models.AlertRule{
+			Name:             "high_memory",
+			Metric:           "memory_percent",
+			Comparator:       ">",
+			Threshold:        threshold,
+			For:              60,
+			ResolveThreshold: resolveBelow(threshold),
+			Message:          `High memory usage detected: {{printf "%.1f" .Value}}% of limit`,
+		})
+	}
+	if limit := config.Alerts.PidsLimit; limit > 0 {
+		rules = append(rules, models.AlertRule{
+			Name:       "high_pids",
+			Metric:     "pids",
+			Comparator: ">",
+			Threshold:  float64(limit),
+			Message:    `Process count {{.Value}} exceeds limit of {{.Threshold}}`,
+		})
+	}
+	if limit := config.Alerts.RestartLimit; limit > 0 {
+		rules = append(rules, models.AlertRule{
+			Name:       "frequent_restarts",
+			Metric:     "restarts_1h",
+			Comparator: ">=",
+			Threshold:  float64(limit),
+			Message:    `Container restarted {{.Value}} times in the last hour`,
+		})
+	}
+	if minUptime := config.Alerts.MinUptime; minUptime > 0 {
+		rules = append(rules, models.AlertRule{
+			Name:       "low_uptime",
+			Metric:     "uptime_after_restart",
+			Comparator: "<",
+			Threshold:  float64(minUptime),
+			Message:    `Container has only been up for {{.Value}}s after restarting`,
+		})
+	}
+	rules = append(rules, models.AlertRule{
+		Name:       "unhealthy",
+		Metric:     "health",
+		Comparator: "==",
+		Threshold:  models.HealthUnhealthy,
+		Message:    "Container health check is failing",
+	})
+
+	for i := range rules {
+		rules[i].Severity = "warning"
+		rules[i].Source = models.RuleSourceBuiltin
+	}
+	return append(rules, scrapedRules(config)...)
+}
+
+// invalidRuleNameChars matches the characters rule names cannot contain
+var invalidRuleNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// scrapedRules returns the rules derived from the scraped metric thresholds in the
+// configuration, one per bound, named like scraped.queue_depth.above
+func scrapedRules(config *models.Config) []models.AlertRule {
+	var rules []models.AlertRule
+	names := make(map[string]bool)
+	add := func(threshold models.ScrapeRule, bound, comparator string, value float64) {
+		name := "scraped." + invalidRuleNameChars.ReplaceAllString(threshold.Metric, "_")
+		if threshold.Container != "" {
+			name += "." + invalidRuleNameChars.ReplaceAllString(threshold.Container, "_")
+		}
+		name += "." + bound
+		for base, i := name, 2; names[name]; i++ {
+			name = fmt.Sprintf("%s.%d", base, i)
+		}
+		names[name] = true
+
+		severity := threshold.Severity
+		if severity == "" {
+			severity = "warning"
+		}
+		rules = append(rules, models.AlertRule{
+			Name:       name,
+			Metric:     ScrapedMetricPrefix + threshold.Metric,
+			Comparator: comparator,
+			Threshold:  value,
+			Severity:   severity,
+			Selector:   models.RuleSelector{Name: threshold.Container},
+			Message:    fmt.Sprintf(`%s is {{printf "%%g" .Value}}, %s {{.Threshold}}`, threshold.Metric, bound),
+			Source:     models.RuleSourceBuiltin,
+		})
+	}
+
+	for _, threshold := range config.Alerts.Scraped {
+		if threshold.Above != nil {
+			add(threshold, "above", ">", *threshold.Above)
+		}
+		if threshold.Below != nil {
+			add(threshold, "below", "<", *threshold.Below)
+		}
+	}
+	return rules
+}
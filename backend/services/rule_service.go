@@ -0,0 +1,252 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nabd/models"
+	"nabd/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrRuleNotFound is returned for a rule name that does not exist
+var ErrRuleNotFound = errors.New("alert rule not found")
+
+// ErrRuleExists is returned when creating a rule whose name is already used
+var ErrRuleExists = errors.New("an alert rule with this name already exists")
+
+// ErrRuleReadOnly is returned when changing a builtin or configured rule through the API
+var ErrRuleReadOnly = errors.New("alert rule is defined in the configuration and cannot be changed through the API")
+
+// ErrInvalidRule wraps validation errors of rules submitted through the API
+var ErrInvalidRule = errors.New("invalid alert rule")
+
+// RuleService manages the alert rules evaluated by the metrics service: the builtin
+// rules derived from the alert thresholds, the rules in the configuration file and
+// the rules created through the API, which are stored in the database.
+type RuleService struct {
+	metricsService *MetricsService
+	config         *models.Config
+
+	mu       sync.Mutex
+	apiRules map[string]models.AlertRule
+}
+
+// NewRuleService creates a new alert rule service
+func NewRuleService(metricsService *MetricsService, config *models.Config) *RuleService {
+	return &RuleService{
+		metricsService: metricsService,
+		config:         config,
+		apiRules:       make(map[string]models.AlertRule),
+	}
+}
+
+// LoadRules loads the stored API rules and starts evaluating all rules. It fails if a
+// configured rule is invalid. Stored rules that are no longer valid or whose name is now
+// used by a builtin or configured rule are skipped.
+func (rs *RuleService) LoadRules() error {
+	rows, err := models.DB.Query(`SELECT definition FROM alert_rules`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	defined := make(map[string]bool)
+	for _, rule := range rs.rules() {
+		defined[rule.Name] = true
+	}
+	for rows.Next() {
+		var definition string
+		if err := rows.Scan(&definition); err != nil {
+			return err
+		}
+		var rule models.AlertRule
+		if err := json.Unmarshal([]byte(definition), &rule); err != nil {
+			return err
+		}
+		if err := ValidateRule(&rule); err != nil {
+			log.Printf("Skipping stored alert rule: %v", err)
+			continue
+		}
+		if defined[rule.Name] {
+			log.Printf("Skipping stored alert rule %s: a builtin or configured rule has the same name", rule.Name)
+			continue
+		}
+		rule.Source = models.RuleSourceAPI
+		rs.apiRules[rule.Name] = rule
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := rs.apply(); err != nil {
+		return err
+	}
+	log.Printf("Loaded %d alert rules", len(rs.metricsService.rules.Rules()))
+	return nil
+}
+
+// GetRules returns the rules being evaluated
+func (rs *RuleService) GetRules() []models.AlertRule {
+	return rs.metricsService.rules.Rules()
+}
+
+// CreateRule validates and stores a new rule and starts evaluating it
+func (rs *RuleService) CreateRule(rule models.AlertRule) (models.AlertRule, error) {
+	rule.Source = models.RuleSourceAPI
+	if err := ValidateRule(&rule); err != nil {
+		return rule, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if _, ok := rs.findRule(rule.Name); ok {
+		return rule, ErrRuleExists
+	}
+
+	definition, err := json.Marshal(rule)
+	if err != nil {
+		return rule, err
+	}
+	now := time.Now()
+	err = utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO alert_rules (name, definition, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+			rule.Name, string(definition), now, now)
+		return err
+	})
+	if err != nil {
+		return rule, err
+	}
+
+	rs.apiRules[rule.Name] = rule
+	return rule, rs.apply()
+}
+
+// UpdateRule replaces the definition of a rule created through the API
+func (rs *RuleService) UpdateRule(name string, rule models.AlertRule) (models.AlertRule, error) {
+	rule.Name = name
+	rule.Source = models.RuleSourceAPI
+	if err := ValidateRule(&rule); err != nil {
+		return rule, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.checkWritable(name); err != nil {
+		return rule, err
+	}
+
+	definition, err := json.Marshal(rule)
+	if err != nil {
+		return rule, err
+	}
+	err = utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE alert_rules SET definition = ?, updated_at = ? WHERE name = ?`,
+			string(definition), time.Now(), name)
+		return err
+	})
+	if err != nil {
+		return rule, err
+	}
+
+	rs.apiRules[name] = rule
+	return rule, rs.apply()
+}
+
+// DeleteRule deletes a rule created through the API and resolves its alerts
+func (rs *RuleService) DeleteRule(name string) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if err := rs.checkWritable(name); err != nil {
+		return err
+	}
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM alert_rules WHERE name = ?`, name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	delete(rs.apiRules, name)
+	return rs.apply()
+}
+
+// checkWritable returns an error unless name is a rule created through the API. It
+// must be called with mu held.
+func (rs *RuleService) checkWritable(name string) error {
+	if _, ok := rs.apiRules[name]; ok {
+		return nil
+	}
+	if _, ok := rs.findRule(name); ok {
+		return ErrRuleReadOnly
+	}
+	return ErrRuleNotFound
+}
+
+// findRule looks up a rule by name among all sources. It must be called with mu held.
+func (rs *RuleService) findRule(name string) (models.AlertRule, bool) {
+	for _, rule := range rs.rules() {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return models.AlertRule{}, false
+}
+
+// rules merges the builtin, configured and API rules. A configured rule replaces the
+// builtin rule of the same name. It must be called with mu held.
+func (rs *RuleService) rules() []models.AlertRule {
+	configured := make(map[string]bool)
+	for _, rule := range rs.config.Alerts.Rules {
+		configured[rule.Name] = true
+	}
+
+	var rules []models.AlertRule
+	for _, rule := range BuiltinRules(rs.config) {
+		if !configured[rule.Name] {
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range rs.config.Alerts.Rules {
+		rule.Source = models.RuleSourceConfig
+		rules = append(rules, rule)
+	}
+
+	names := make([]string, 0, len(rs.apiRules))
+	for name := range rs.apiRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rules = append(rules, rs.apiRules[name])
+	}
+	return rules
+}
+
+// apply replaces the rules being evaluated and resolves the alerts of removed rules.
+// It must be called with mu held.
+func (rs *RuleService) apply() error {
+	removed, err := rs.metricsService.rules.SetRules(rs.rules())
+	if err != nil {
+		return err
+	}
+
+	for _, name := range removed {
+		if err := rs.metricsService.deactivateAlertType(name); err != nil {
+			log.Printf("Error deactivating alerts of removed rule %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"nabd/models"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxScrapeBytes bounds the size of a single /metrics response
+const maxScrapeBytes = 10 * 1024 * 1024
+
+type ScrapeService struct {
+	dockerService  *DockerService
+	metricsService *MetricsService
+	config         *models.Config
+	client         *http.Client
+
+	mu      sync.Mutex
+	targets map[string]models.ScrapeTarget
+}
+
+// NewScrapeService creates a new Prometheus scraping service
+func NewScrapeService(dockerService *DockerService, metricsService *MetricsService, config *models.Config) *ScrapeService {
+	timeout := time.Duration(config.Scrape.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second // Default to 5 seconds
+	}
+
+	return &ScrapeService{
+		dockerService:  dockerService,
+		metricsService: metricsService,
+		config:         config,
+		client:         &http.Client{Timeout: timeout},
+		targets:        make(map[string]models.ScrapeTarget),
+	}
+}
+
+// StartScraping starts the periodic scrape of containers exposing Prometheus metrics
+func (ss *ScrapeService) StartScraping() {
+	if !ss.config.Scrape.Enabled {
+		log.Println("Prometheus scraping is disabled in configuration")
+		return
+	}
+
+	interval := time.Duration(ss.config.Scrape.Interval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second // Default to 30 seconds
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := ss.ScrapeTargets(); err != nil {
+				log.Printf("Error scraping application metrics: %v", err)
+			}
+		}
+	}()
+	log.Printf("Prometheus scraping started with %v interval", interval)
+}
+
+// ScrapeTargets scrapes every labelled container, stores the selected series and
+// evaluates the alert rules on scraped series
+func (ss *ScrapeService) ScrapeTargets() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	targets, err := ss.dockerService.GetScrapeTargets(ctx)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target models.ScrapeTarget) {
+			defer wg.Done()
+			ss.scrapeTarget(ctx, target)
+		}(target)
+	}
+	wg.Wait()
+
+	// Forget containers that stopped or removed their labels
+	active := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		active[target.ContainerID] = true
+	}
+	ss.mu.Lock()
+	for id := range ss.targets {
+		if !active[id] {
+			delete(ss.targets, id)
+		}
+	}
+	ss.mu.Unlock()
+
+	return nil
+}
+
+// scrapeTarget scrapes, stores and evaluates a single target, recording the outcome
+func (ss *ScrapeService) scrapeTarget(ctx context.Context, target models.ScrapeTarget) {
+	now := time.Now()
+	target.LastScrape = now
+
+	samples, err := ss.fetch(ctx, target.URL)
+	if err != nil {
+		log.Printf("Error scraping container %s: %v", target.Name, err)
+		target.LastError = err.Error()
+		ss.setTarget(target)
+		return
+	}
+
+	patterns := target.Metrics
+	if len(patterns) == 0 {
+		patterns = ss.config.Scrape.Metrics
+	}
+	selected := SelectSamples(samples, patterns)
+	if limit := ss.config.Scrape.MaxSeries; limit > 0 && len(selected) > limit {
+		log.Printf("Container %s exposes %d series, keeping the first %d", target.Name, len(selected), limit)
+		selected = selected[:limit]
+	}
+	target.Series = len(selected)
+
+	if err := ss.storeScrape(target, SelectSamples(samples, nil), selected, now); err != nil {
+		log.Printf("Error storing scraped metrics for container %s: %v", target.Name, err)
+		target.LastError = err.Error()
+	}
+	ss.setTarget(target)
+}
+
+// fetch downloads and parses a Prometheus text exposition
+func (ss *ScrapeService) fetch(ctx context.Context, url string) ([]models.ScrapedSample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := ss.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return ParsePrometheusText(io.LimitReader(resp.Body, maxScrapeBytes))
+}
+
+// SelectSamples keeps the samples whose metric name matches one of the glob patterns
+// (all of them when there are none), dropping NaN and infinite values that cannot be
+// stored. The result is sorted by series.
+func SelectSamples(samples []models.ScrapedSample, patterns []string) []models.ScrapedSample {
+	var selected []models.ScrapedSample
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+			continue
+		}
+		if len(patterns) > 0 && !matchesAny(sample.Metric, patterns) {
+			continue
+		}
+		selected = append(selected, sample)
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return SeriesKey(selected[i]) < SeriesKey(selected[j])
+	})
+	return selected
+}
+
+// matchesAny reports whether name matches one of the glob patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// storeScrape stores the selected samples of one scrape and the alert changes of the
+// rules on scraped series, which see every sample, in a single transaction, and
+// notifies the alert changes once it commits
+func (ss *ScrapeService) storeScrape(target models.ScrapeTarget, samples, selected []models.ScrapedSample, timestamp time.Time) error {
+	ms := ss.metricsService
+	metric := models.ContainerMetric{ContainerID: target.ContainerID, Name: target.Name, Timestamp: timestamp}
+	if latest, ok := ms.latest.Get(target.ContainerID); ok {
+		metric.Image = latest.Image
+		metric.Labels = latest.Labels
+	}
+	results := ms.rules.EvaluateScrape(metric, samples)
+
+	err := ms.writeAlerts(func(tx *sql.Tx) ([]alertNotification, error) {
+		if err := storeSamplesTx(tx, target, selected, timestamp); err != nil {
+			return nil, err
+		}
+		return ms.applyRuleResults(tx, metric, results)
+	})
+	if err != nil {
+		// The alert changes were rolled back; report them again at the next scrape
+		for _, result := range results {
+			if result.Changed {
+				ms.rules.Forget(target.ContainerID, result.Rule.Name)
+			}
+		}
+	}
+	return err
+}
+
+// storeSamplesTx stores the samples of one scrape
+func storeSamplesTx(tx *sql.Tx, target models.ScrapeTarget, samples []models.ScrapedSample, timestamp time.Time) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO scraped_metrics (container_id, name, metric, series, value, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, sample := range samples {
+		if _, err := stmt.Exec(target.ContainerID, target.Name, sample.Metric, SeriesKey(sample), sample.Value, timestamp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTarget records the outcome of a target's latest scrape
+func (ss *ScrapeService) setTarget(target models.ScrapeTarget) {
+	ss.mu.Lock()
+	ss.targets[target.ContainerID] = target
+	ss.mu.Unlock()
+}
+
+// GetTargets returns the containers being scraped and the outcome of their latest scrape
+func (ss *ScrapeService) GetTargets() []models.ScrapeTarget {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	targets := make([]models.ScrapeTarget, 0, len(ss.targets))
+	for _, target := range ss.targets {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+	return targets
+}
+
+// GetSeries returns the series stored for a container
+func (ss *ScrapeService) GetSeries(containerID string) ([]string, error) {
+	rows, err := models.DB.Query(`SELECT DISTINCT series FROM scraped_metrics
+		WHERE container_id = ? ORDER BY series`, containerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		series = append(series, s)
+	}
+
+	return series, rows.Err()
+}
+
+// GetScrapedHistory returns the samples of a container's series (or of every series
+// of a metric when a bare metric name is given) over the last hours
+func (ss *ScrapeService) GetScrapedHistory(containerID, series string, hours int) ([]models.ScrapedMetric, error) {
+	query := `SELECT container_id, name, metric, series, value, timestamp
+		FROM scraped_metrics
+		WHERE container_id = ? AND (series = ? OR metric = ?) AND timestamp > ?
+		ORDER BY timestamp DESC`
+
+	since := time.Now().Add(-time.Duration(hours) * time.Hour)
+	rows, err := models.DB.Query(query, containerID, series, series, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []models.ScrapedMetric
+	for rows.Next() {
+		var metric models.ScrapedMetric
+		err := rows.Scan(
+			&metric.ContainerID,
+			&metric.Name,
+			&metric.Metric,
+			&metric.Series,
+			&metric.Value,
+			&metric.Timestamp,
+		)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, rows.Err()
+}
+
+// storedScrape is the stored samples of one scrape of a container
+type storedScrape struct {
+	name   string
+	at     time.Time
+	series []scrapedSeries
+}
+
+// scrapedContainers returns the IDs of the containers with stored samples of a series,
+// or of any series of a metric when a bare metric name is given, in [from, to]
+func scrapedContainers(name string, from, to time.Time) ([]string, error) {
+	rows, err := models.DB.Query(`SELECT DISTINCT container_id FROM scraped_metrics
+		WHERE (series = ? OR metric = ?) AND timestamp >= ? AND timestamp <= ?
+		ORDER BY container_id`, name, name, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// scrapedRange returns the stored scrapes of a container in [from, to] holding a series,
+// or any series of a metric when a bare metric name is given, oldest first. Each scrape
+// only carries the matching series.
+func scrapedRange(containerID, name string, from, to time.Time) ([]storedScrape, error) {
+	rows, err := models.DB.Query(`SELECT name, metric, series, value, timestamp
+		FROM scraped_metrics
+		WHERE container_id = ? AND (series = ? OR metric = ?) AND timestamp >= ? AND timestamp <= ?
+		ORDER BY timestamp, series`, containerID, name, name, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scrapes []storedScrape
+	for rows.Next() {
+		var (
+			scrape storedScrape
+			series scrapedSeries
+		)
+		if err := rows.Scan(&scrape.name, &series.metric, &series.series, &series.value, &scrape.at); err != nil {
+			return nil, err
+		}
+		// The samples of one scrape share its timestamp
+		if last := len(scrapes) - 1; last >= 0 && scrapes[last].at.Equal(scrape.at) {
+			scrapes[last].series = append(scrapes[last].series, series)
+			continue
+		}
+		scrape.series = []scrapedSeries{series}
+		scrapes = append(scrapes, scrape)
+	}
+	return scrapes, rows.Err()
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"nabd/models"
+	"nabd/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrSilenceNotFound is returned when no silence has the requested ID
+var ErrSilenceNotFound = errors.New("silence not found")
+
+// ErrInvalidSilence is returned for silences that fail validation
+var ErrInvalidSilence = errors.New("invalid silence")
+
+// SilenceService manages the silences matched by the metrics service. Silences are
+// stored in the database and deleted once they have been expired for the retention
+// period.
+type SilenceService struct {
+	metricsService *MetricsService
+	config         *models.Config
+
+	mu       sync.Mutex
+	silences map[int]models.Silence
+}
+
+// NewSilenceService creates a new silence service
+func NewSilenceService(metricsService *MetricsService, config *models.Config) *SilenceService {
+	return &SilenceService{
+		metricsService: metricsService,
+		config:         config,
+		silences:       make(map[int]models.Silence),
+	}
+}
+
+// LoadSilences loads the stored silences and starts matching them
+func (ss *SilenceService) LoadSilences() error {
+	rows, err := models.DB.Query(`SELECT id, matchers, starts_at, ends_at, created_by, comment, created_at FROM silences`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for rows.Next() {
+		var (
+			silence  models.Silence
+			matchers string
+		)
+		err := rows.Scan(
+			&silence.ID,
+			&matchers,
+			&silence.StartsAt,
+			&silence.EndsAt,
+			&silence.CreatedBy,
+			&silence.Comment,
+			&silence.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(matchers), &silence.Matchers); err != nil {
+			return err
+		}
+		ss.silences[silence.ID] = silence
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return ss.apply()
+}
+
+// StartExpiry periodically deletes silences expired for longer than the retention period
+func (ss *SilenceService) StartExpiry() {
+	retentionDays := ss.config.Silences.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = 5 // Default to 5 days
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := ss.purge(time.Now().AddDate(0, 0, -retentionDays)); err != nil {
+				log.Printf("Error deleting expired silences: %v", err)
+			}
+		}
+	}()
+}
+
+// GetSilences returns all silences with their status, newest first
+func (ss *SilenceService) GetSilences() []models.Silence {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	now := time.Now()
+	silences := make([]models.Silence, 0, len(ss.silences))
+	for _, silence := range ss.silences {
+		silence.Status = SilenceStatus(silence, now)
+		silences = append(silences, silence)
+	}
+	sort.Slice(silences, func(i, j int) bool {
+		return silences[i].ID > silences[j].ID
+	})
+	return silences
+}
+
+// GetSilence returns a silence with its status
+func (ss *SilenceService) GetSilence(id int) (models.Silence, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	silence, ok := ss.silences[id]
+	if !ok {
+		return silence, ErrSilenceNotFound
+	}
+	silence.Status = SilenceStatus(silence, time.Now())
+	return silence, nil
+}
+
+// CreateSilence validates and stores a silence. It starts now unless starts_at is set.
+func (ss *SilenceService) CreateSilence(silence models.Silence) (models.Silence, error) {
+	silence.CreatedAt = time.Now()
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = silence.CreatedAt
+	}
+	if err := ValidateSilence(&silence); err != nil {
+		return silence, fmt.Errorf("%w: %v", ErrInvalidSilence, err)
+	}
+	if !silence.EndsAt.After(time.Now()) {
+		return silence, fmt.Errorf("%w: ends_at must be in the future", ErrInvalidSilence)
+	}
+
+	matchers, err := json.Marshal(silence.Matchers)
+	if err != nil {
+		return silence, err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	err = utils.WriteTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO silences (matchers, starts_at, ends_at, created_by, comment, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			string(matchers), silence.StartsAt, silence.EndsAt, silence.CreatedBy, silence.Comment, silence.CreatedAt)
+		if err != nil {
+			return err
+		}
+		id, err := result.LastInsertId()
+		silence.ID = int(id)
+		return err
+	})
+	if err != nil {
+		return silence, err
+	}
+
+	ss.silences[silence.ID] = silence
+	silence.Status = SilenceStatus(silence, time.Now())
+	return silence, ss.apply()
+}
+
+// UpdateSilence replaces the matchers, time range and comment of a silence
+func (ss *SilenceService) UpdateSilence(id int, silence models.Silence) (models.Silence, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	existing, ok := ss.silences[id]
+	if !ok {
+		return silence, ErrSilenceNotFound
+	}
+	silence.ID = id
+	silence.CreatedAt = existing.CreatedAt
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = existing.StartsAt
+	}
+	if err := ValidateSilence(&silence); err != nil {
+		return silence, fmt.Errorf("%w: %v", ErrInvalidSilence, err)
+	}
+	if !silence.EndsAt.After(time.Now()) {
+		return silence, fmt.Errorf("%w: ends_at must be in the future", ErrInvalidSilence)
+	}
+
+	matchers, err := json.Marshal(silence.Matchers)
+	if err != nil {
+		return silence, err
+	}
+	err = utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE silences SET matchers = ?, starts_at = ?, ends_at = ?, created_by = ?, comment = ?
+			WHERE id = ?`,
+			string(matchers), silence.StartsAt, silence.EndsAt, silence.CreatedBy, silence.Comment, id)
+		return err
+	})
+	if err != nil {
+		return silence, err
+	}
+
+	ss.silences[id] = silence
+	silence.Status = SilenceStatus(silence, time.Now())
+	return silence, ss.apply()
+}
+
+// DeleteSilence deletes a silence
+func (ss *SilenceService) DeleteSilence(id int) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, ok := ss.silences[id]; !ok {
+		return ErrSilenceNotFound
+	}
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM silences WHERE id = ?`, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	delete(ss.silences, id)
+	return ss.apply()
+}
+
+// purge deletes the silences that ended before cutoff
+func (ss *SilenceService) purge(cutoff time.Time) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	var expired []int
+	for id, silence := range ss.silences {
+		if silence.EndsAt.Before(cutoff) {
+			expired = append(expired, id)
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		for _, id := range expired {
+			if _, err := tx.Exec(`DELETE FROM silences WHERE id = ?`, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range expired {
+		delete(ss.silences, id)
+	}
+	log.Printf("Deleted %d expired silences", len(expired))
+	return ss.apply()
+}
+
+// apply replaces the silences matched by the metrics service. It must be called with
+// mu held.
+func (ss *SilenceService) apply() error {
+	silences := make([]models.Silence, 0, len(ss.silences))
+	for _, silence := range ss.silences {
+		silences = append(silences, silence)
+	}
+	return ss.metricsService.silences.Set(silences)
+}
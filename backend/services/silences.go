@@ -0,0 +1,92 @@
+package services
+
+import (
+	"fmt"
+	"nabd/models"
+	"sync"
+	"time"
+)
+
+// SilenceSet matches alerts against the current silences
+type SilenceSet struct {
+	mu       sync.RWMutex
+	silences []*compiledSilence
+}
+
+// compiledSilence is a silence with its matchers compiled
+type compiledSilence struct {
+	models.Silence
+	matchers []compiledMatcher
+}
+
+// NewSilenceSet creates an empty silence set
+func NewSilenceSet() *SilenceSet {
+	return &SilenceSet{}
+}
+
+// ValidateSilence checks a silence and fills in the default matcher operators
+func ValidateSilence(silence *models.Silence) error {
+	_, err := compileSilence(silence)
+	return err
+}
+
+// compileSilence validates a silence and compiles its matchers
+func compileSilence(silence *models.Silence) (*compiledSilence, error) {
+	if len(silence.Matchers) == 0 {
+		return nil, fmt.Errorf("a silence needs at least one matcher")
+	}
+	if silence.EndsAt.IsZero() || !silence.EndsAt.After(silence.StartsAt) {
+		return nil, fmt.Errorf("ends_at must be after starts_at")
+	}
+	if silence.CreatedBy == "" || silence.Comment == "" {
+		return nil, fmt.Errorf("created_by and comment are required")
+	}
+
+	matchers, err := compileMatchers(silence.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	return &compiledSilence{Silence: *silence, matchers: matchers}, nil
+}
+
+// Set replaces the silences being matched
+func (ss *SilenceSet) Set(silences []models.Silence) error {
+	compiled := make([]*compiledSilence, 0, len(silences))
+	for i := range silences {
+		silence, err := compileSilence(&silences[i])
+		if err != nil {
+			return fmt.Errorf("silence %d: %v", silences[i].ID, err)
+		}
+		compiled = append(compiled, silence)
+	}
+
+	ss.mu.Lock()
+	ss.silences = compiled
+	ss.mu.Unlock()
+	return nil
+}
+
+// Match returns the ID of a silence active at now matching target
+func (ss *SilenceSet) Match(target AlertTarget, now time.Time) (int, bool) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	for _, silence := range ss.silences {
+		if SilenceStatus(silence.Silence, now) == models.SilenceActive && matchAll(silence.matchers, target) {
+			return silence.ID, true
+		}
+	}
+	return 0, false
+}
+
+// SilenceStatus returns whether a silence is pending, active or expired at now
+func SilenceStatus(silence models.Silence, now time.Time) string {
+	switch {
+	case now.Before(silence.StartsAt):
+		return models.SilencePending
+	case now.Before(silence.EndsAt):
+		return models.SilenceActive
+	default:
+		return models.SilenceExpired
+	}
+}
@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"database/sql"
+	"nabd/models"
+	"nabd/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Chunk holds the compressed samples of one container in one time partition
+type Chunk struct {
+	ContainerID string
+	Start       time.Time // start of the partition
+	MinTime     time.Time
+	MaxTime     time.Time
+	Count       int
+	Data        []byte
+}
+
+// ChunkBackend persists chunks. A chunk is identified by its container and
+// partition start; writing it again replaces the previous version.
+type ChunkBackend interface {
+	// WriteChunks writes chunks within tx; backends outside the database write them
+	// immediately
+	WriteChunks(tx *sql.Tx, chunks []Chunk) error
+	// ReadChunks returns the chunks overlapping [from, to]; an empty containerID
+	// returns the chunks of every container
+	ReadChunks(containerID string, from, to time.Time) ([]Chunk, error)
+	// ChunkContainers returns the IDs of the containers with chunks overlapping
+	// [from, to], without reading the chunks
+	ChunkContainers(from, to time.Time) ([]string, error)
+	// DeleteChunks deletes the chunks whose samples are all older than before
+	DeleteChunks(before time.Time) error
+}
+
+// ChunkStore keeps samples in compressed chunks partitioned by time. Samples of the
+// partitions still being written are appended one row each to the metric_head table,
+// whatever the backend, and a partition is encoded into a chunk once samples of a later
+// partition arrive. Chunks are written once, so the cost of an append does not grow
+// with the size of its partition.
+type ChunkStore struct {
+	backend       ChunkBackend
+	chunkDuration time.Duration
+
+	mu sync.Mutex
+	// last is the newest sample time stored for each container, in milliseconds
+	last map[string]int64
+	// sealed is the start of the newest partition whose predecessors are all chunks
+	sealed time.Time
+}
+
+// NewChunkStore creates a chunk store with partitions of chunkDuration
+func NewChunkStore(backend ChunkBackend, chunkDuration time.Duration) *ChunkStore {
+	return &ChunkStore{
+		backend:       backend,
+		chunkDuration: chunkDuration,
+		last:          make(map[string]int64),
+	}
+}
+
+// Append adds samples to their containers' partitions in one transaction
+func (cs *ChunkStore) Append(metrics []models.ContainerMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+	return utils.WriteTx(func(tx *sql.Tx) error {
+		return cs.AppendTx(tx, metrics)
+	})
+}
+
+// AppendTx adds samples to their containers' partitions within a write transaction.
+// Samples older than the newest sample already stored for a container are dropped.
+func (cs *ChunkStore) AppendTx(tx *sql.Tx, metrics []models.ContainerMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	stmt, err := tx.Prepare(`INSERT OR IGNORE INTO metric_head
+		(container_id, partition_start, timestamp, data)
+		VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	newest, late := cs.sealed, false
+	for _, metric := range metrics {
+		start := metric.Timestamp.Truncate(cs.chunkDuration)
+		last, err := cs.lastSample(tx, metric.ContainerID, start)
+		if err != nil {
+			return err
+		}
+		t := metric.Timestamp.UnixMilli()
+		if last != nil && t <= *last {
+			continue
+		}
+
+		var sample chunkAppender
+		sample.append(metric)
+		if _, err := stmt.Exec(metric.ContainerID, start.Unix(), t, sample.bytes()); err != nil {
+			return err
+		}
+		cs.last[metric.ContainerID] = t
+
+		if start.After(newest) {
+			newest = start
+		}
+		if start.Before(cs.sealed) {
+			late = true
+		}
+	}
+
+	// Encode the partitions that are complete: the ones before the newest partition,
+	// and late samples of partitions already encoded
+	if !newest.After(cs.sealed) && !late {
+		return nil
+	}
+	if err := cs.seal(tx, newest); err != nil {
+		return err
+	}
+	cs.sealed = newest
+	return nil
+}
+
+// lastSample returns the newest sample time stored for a container, looking in the
+// head table and the stored chunk of the sample's partition the first time the
+// container is seen. It must be called with mu held.
+func (cs *ChunkStore) lastSample(tx *sql.Tx, containerID string, start time.Time) (*int64, error) {
+	if last, ok := cs.last[containerID]; ok {
+		return &last, nil
+	}
+
+	var head sql.NullInt64
+	if err := tx.QueryRow(`SELECT MAX(timestamp) FROM metric_head WHERE container_id = ?`, containerID).Scan(&head); err != nil {
+		return nil, err
+	}
+	stored, err := cs.backend.ReadChunks(containerID, start, start.Add(cs.chunkDuration-time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+
+	var last *int64
+	if head.Valid {
+		last = &head.Int64
+	}
+	for _, chunk := range stored {
+		if t := chunk.MaxTime.UnixMilli(); chunk.Start.Equal(start) && (last == nil || t > *last) {
+			last = &t
+		}
+	}
+	if last != nil {
+		cs.last[containerID] = *last
+	}
+	return last, nil
+}
+
+// seal encodes the head samples of the partitions starting before before into chunks,
+// merged with any chunk already stored for the partition, and removes them from the
+// head table. It must be called with mu held.
+func (cs *ChunkStore) seal(tx *sql.Tx, before time.Time) error {
+	head, err := readHead(tx.Query, "partition_start < ?", before.Unix())
+	if err != nil {
+		return err
+	}
+
+	var chunks []Chunk
+	for containerID, samples := range head {
+		partitions := make(map[int64][]models.ContainerMetric)
+		for _, sample := range samples {
+			start := sample.Timestamp.Truncate(cs.chunkDuration).Unix()
+			partitions[start] = append(partitions[start], sample)
+		}
+
+		for unix, samples := range partitions {
+			start := time.Unix(unix, 0)
+			stored, err := cs.backend.ReadChunks(containerID, start, start.Add(cs.chunkDuration-time.Millisecond))
+			if err != nil {
+				return err
+			}
+			for _, chunk := range stored {
+				if !chunk.Start.Equal(start) {
+					continue
+				}
+				decoded, err := decodeChunk(containerID, chunk.Data, chunk.Count)
+				if err != nil {
+					return err
+				}
+				samples = append(samples, decoded...)
+			}
+
+			var appender chunkAppender
+			for _, sample := range mergeSamples(samples) {
+				appender.append(sample)
+			}
+			chunks = append(chunks, Chunk{
+				ContainerID: containerID,
+				Start:       start,
+				MinTime:     appender.minTime,
+				MaxTime:     appender.maxTime,
+				Count:       appender.count,
+				Data:        appender.bytes(),
+			})
+		}
+	}
+
+	if err := cs.backend.WriteChunks(tx, chunks); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM metric_head WHERE partition_start < ?`, before.Unix())
+	return err
+}
+
+// readHead returns the head samples matching condition, grouped by container and
+// oldest first
+func readHead(query func(string, ...interface{}) (*sql.Rows, error), condition string, args ...interface{}) (map[string][]models.ContainerMetric, error) {
+	rows, err := query(`SELECT container_id, data FROM metric_head
+		WHERE `+condition+`
+		ORDER BY container_id, timestamp`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make(map[string][]models.ContainerMetric)
+	for rows.Next() {
+		var (
+			containerID string
+			data        []byte
+		)
+		if err := rows.Scan(&containerID, &data); err != nil {
+			return nil, err
+		}
+		decoded, err := decodeChunk(containerID, data, 1)
+		if err != nil {
+			return nil, err
+		}
+		samples[containerID] = append(samples[containerID], decoded...)
+	}
+	return samples, rows.Err()
+}
+
+// mergeSamples sorts samples by time and drops repeated timestamps
+func mergeSamples(samples []models.ContainerMetric) []models.ContainerMetric {
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp.Before(samples[j].Timestamp) })
+	merged := samples[:0]
+	for _, sample := range samples {
+		if len(merged) > 0 && merged[len(merged)-1].Timestamp.UnixMilli() == sample.Timestamp.UnixMilli() {
+			continue
+		}
+		merged = append(merged, sample)
+	}
+	return merged
+}
+
+// Range returns the samples of a container in [from, to], oldest first
+func (cs *ChunkStore) Range(containerID string, from, to time.Time) ([]models.ContainerMetric, error) {
+	samples, err := cs.scan(containerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return samples[containerID], nil
+}
+
+// RangeAll returns the samples of every container in [from, to], oldest first
+func (cs *ChunkStore) RangeAll(from, to time.Time) (map[string][]models.ContainerMetric, error) {
+	return cs.scan("", from, to)
+}
+
+// Containers returns the IDs of the containers with chunks or head samples in
+// [from, to]. A chunk overlapping the range may hold no sample inside it.
+func (cs *ChunkStore) Containers(from, to time.Time) ([]string, error) {
+	ids, err := cs.backend.ChunkContainers(from, to)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		seen[id] = true
+	}
+
+	rows, err := models.DB.Query(`SELECT DISTINCT container_id FROM metric_head
+		WHERE timestamp >= ? AND timestamp <= ?`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// scan decodes the chunks and head samples overlapping [from, to] and keeps the
+// samples inside it
+func (cs *ChunkStore) scan(containerID string, from, to time.Time) (map[string][]models.ContainerMetric, error) {
+	chunks, err := cs.backend.ReadChunks(containerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Start.Before(chunks[j].Start) })
+
+	samples := make(map[string][]models.ContainerMetric)
+	for _, chunk := range chunks {
+		decoded, err := decodeChunk(chunk.ContainerID, chunk.Data, chunk.Count)
+		if err != nil {
+			return nil, err
+		}
+		for _, sample := range decoded {
+			if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+				continue
+			}
+			samples[chunk.ContainerID] = append(samples[chunk.ContainerID], sample)
+		}
+	}
+
+	condition := "timestamp >= ? AND timestamp <= ?"
+	args := []interface{}{from.UnixMilli(), to.UnixMilli()}
+	if containerID != "" {
+		condition += " AND container_id = ?"
+		args = append(args, containerID)
+	}
+	head, err := readHead(models.DB.Query, condition, args...)
+	if err != nil {
+		return nil, err
+	}
+	for id, headSamples := range head {
+		// A partition can be in both after an interrupted seal
+		samples[id] = mergeSamples(append(samples[id], headSamples...))
+	}
+	return samples, nil
+}
+
+// Prune deletes the chunks whose samples are all older than before, and the head
+// samples of partitions ending before it
+func (cs *ChunkStore) Prune(before time.Time) error {
+	cs.mu.Lock()
+	for id, last := range cs.last {
+		if last < before.UnixMilli() {
+			delete(cs.last, id)
+		}
+	}
+	cs.mu.Unlock()
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM metric_head WHERE partition_start <= ?`, before.Add(-cs.chunkDuration).Unix())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return cs.backend.DeleteChunks(before)
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunkHeaderSize is the size of the min time, max time and count written before
+// the data of a chunk file
+const chunkHeaderSize = 8 + 8 + 4
+
+// DirectoryBackend stores chunks as files in a directory per partition:
+// <dir>/<partition start unix>/<container id>.chunk
+type DirectoryBackend struct {
+	dir           string
+	chunkDuration time.Duration
+}
+
+// NewDirectoryBackend creates a chunk backend rooted at dir
+func NewDirectoryBackend(dir string, chunkDuration time.Duration) (*DirectoryBackend, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("storage directory is not configured")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirectoryBackend{dir: dir, chunkDuration: chunkDuration}, nil
+}
+
+// WriteChunks writes each chunk to a temporary file and renames it into place so a
+// crash never leaves a partially written chunk. The files are written immediately,
+// whatever the outcome of tx.
+func (db *DirectoryBackend) WriteChunks(tx *sql.Tx, chunks []Chunk) error {
+	for _, chunk := range chunks {
+		partition := filepath.Join(db.dir, strconv.FormatInt(chunk.Start.Unix(), 10))
+		if err := os.MkdirAll(partition, 0755); err != nil {
+			return err
+		}
+
+		buf := make([]byte, chunkHeaderSize, chunkHeaderSize+len(chunk.Data))
+		binary.BigEndian.PutUint64(buf[0:], uint64(chunk.MinTime.UnixMilli()))
+		binary.BigEndian.PutUint64(buf[8:], uint64(chunk.MaxTime.UnixMilli()))
+		binary.BigEndian.PutUint32(buf[16:], uint32(chunk.Count))
+		buf = append(buf, chunk.Data...)
+
+		path := filepath.Join(partition, chunk.ContainerID+".chunk")
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadChunks returns the chunks overlapping [from, to]
+func (db *DirectoryBackend) ReadChunks(containerID string, from, to time.Time) ([]Chunk, error) {
+	partitions, err := db.partitions()
+	if err != nil {
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for _, start := range partitions {
+		if start.After(to) || !start.Add(db.chunkDuration).After(from) {
+			continue
+		}
+
+		partition := filepath.Join(db.dir, strconv.FormatInt(start.Unix(), 10))
+		files, err := ioutil.ReadDir(partition)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			id := strings.TrimSuffix(file.Name(), ".chunk")
+			if id == file.Name() || (containerID != "" && id != containerID) {
+				continue
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(partition, file.Name()))
+			if err != nil {
+				return nil, err
+			}
+			if len(data) < chunkHeaderSize {
+				return nil, fmt.Errorf("chunk %s/%s is truncated", partition, file.Name())
+			}
+			chunk := Chunk{
+				ContainerID: id,
+				Start:       start,
+				MinTime:     time.UnixMilli(int64(binary.BigEndian.Uint64(data[0:]))),
+				MaxTime:     time.UnixMilli(int64(binary.BigEndian.Uint64(data[8:]))),
+				Count:       int(binary.BigEndian.Uint32(data[16:])),
+				Data:        data[chunkHeaderSize:],
+			}
+			if chunk.MaxTime.Before(from) || chunk.MinTime.After(to) {
+				continue
+			}
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	return chunks, nil
+}
+
+// ChunkContainers returns the IDs of the containers with a chunk in the partitions
+// overlapping [from, to]. Only file names are read, so a chunk whose samples all fall
+// outside the range is still listed.
+func (db *DirectoryBackend) ChunkContainers(from, to time.Time) ([]string, error) {
+	partitions, err := db.partitions()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, start := range partitions {
+		if start.After(to) || !start.Add(db.chunkDuration).After(from) {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(db.dir, strconv.FormatInt(start.Unix(), 10)))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			id := strings.TrimSuffix(file.Name(), ".chunk")
+			if id == file.Name() || seen[id] {
+				continue
+			}
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// DeleteChunks removes the partitions that end before before
+func (db *DirectoryBackend) DeleteChunks(before time.Time) error {
+	partitions, err := db.partitions()
+	if err != nil {
+		return err
+	}
+
+	for _, start := range partitions {
+		if start.Add(db.chunkDuration).After(before) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(db.dir, strconv.FormatInt(start.Unix(), 10))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitions lists the start times of the partition directories
+func (db *DirectoryBackend) partitions() ([]time.Time, error) {
+	entries, err := ioutil.ReadDir(db.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var starts []time.Time
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		unix, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		starts = append(starts, time.Unix(unix, 0))
+	}
+	return starts, nil
+}
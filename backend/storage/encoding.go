@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"nabd/models"
+	"time"
+)
+
+// errShortChunk is returned when a chunk ends before all of its samples are decoded
+var errShortChunk = errors.New("chunk data is truncated")
+
+// numFields is the number of numeric fields encoded per sample
+const numFields = 11
+
+// sampleFields returns the numeric fields of a metric in encoding order. Integer
+// fields are stored as float64, which is exact up to 2^53.
+func sampleFields(metric models.ContainerMetric) [numFields]float64 {
+	return [numFields]float64{
+		metric.CPUPercent,
+		float64(metric.MemoryUsage),
+		float64(metric.MemoryLimit),
+		float64(metric.NetworkRx),
+		float64(metric.NetworkTx),
+		float64(metric.BlockRead),
+		float64(metric.BlockWrite),
+		float64(metric.Pids),
+		float64(metric.RestartCount),
+		float64(metric.UptimeSeconds),
+		metric.Health,
+	}
+}
+
+// setSampleFields is the inverse of sampleFields
+func setSampleFields(metric *models.ContainerMetric, fields [numFields]float64) {
+	metric.CPUPercent = fields[0]
+	metric.MemoryUsage = int64(fields[1])
+	metric.MemoryLimit = int64(fields[2])
+	metric.NetworkRx = int64(fields[3])
+	metric.NetworkTx = int64(fields[4])
+	metric.BlockRead = int64(fields[5])
+	metric.BlockWrite = int64(fields[6])
+	metric.Pids = int64(fields[7])
+	metric.RestartCount = int(fields[8])
+	metric.UptimeSeconds = int64(fields[9])
+	metric.Health = fields[10]
+}
+
+// bitWriter appends bits to a byte slice, most significant bit first
+type bitWriter struct {
+	buf  []byte
+	free uint8 // unused bits in the last byte
+}
+
+func (w *bitWriter) writeBit(bit bool) {
+	if w.free == 0 {
+		w.buf = append(w.buf, 0)
+		w.free = 8
+	}
+	w.free--
+	if bit {
+		w.buf[len(w.buf)-1] |= 1 << w.free
+	}
+}
+
+func (w *bitWriter) writeBits(value uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		w.writeBit(value&(1<<uint(i)) != 0)
+	}
+}
+
+// bitReader reads bits written by bitWriter
+type bitReader struct {
+	buf []byte
+	pos int // position in bits
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.buf)*8 {
+		return false, errShortChunk
+	}
+	bit := r.buf[r.pos/8]&(1<<uint(7-r.pos%8)) != 0
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(nbits int) (uint64, error) {
+	var value uint64
+	for i := 0; i < nbits; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		value <<= 1
+		if bit {
+			value |= 1
+		}
+	}
+	return value, nil
+}
+
+// Delta-of-delta buckets for timestamps in milliseconds: a control prefix of 1 to 4
+// bits followed by a two's complement value of the given width
+var timestampBuckets = []struct {
+	prefix, prefixBits uint64
+	bits               int
+}{
+	{0b10, 2, 7},
+	{0b110, 3, 9},
+	{0b1110, 4, 12},
+	{0b1111, 4, 64},
+}
+
+// xorState is the previous value and bit window of one XOR-compressed column
+type xorState struct {
+	prev     uint64
+	leading  int
+	trailing int
+}
+
+// chunkAppender encodes samples of one container with Gorilla compression:
+// delta-of-delta timestamps and XOR floats. Name and status strings are only
+// written when they change.
+type chunkAppender struct {
+	w       bitWriter
+	count   int
+	t       int64
+	tDelta  int64
+	values  [numFields]xorState
+	name    string
+	status  string
+	minTime time.Time
+	maxTime time.Time
+}
+
+func (a *chunkAppender) append(metric models.ContainerMetric) {
+	t := metric.Timestamp.UnixMilli()
+	fields := sampleFields(metric)
+
+	if a.count == 0 {
+		a.w.writeBits(uint64(t), 64)
+		for i, value := range fields {
+			a.values[i] = xorState{prev: math.Float64bits(value), leading: -1}
+			a.w.writeBits(a.values[i].prev, 64)
+		}
+		a.minTime = metric.Timestamp
+	} else {
+		delta := t - a.t
+		a.writeDoD(delta - a.tDelta)
+		a.tDelta = delta
+		for i, value := range fields {
+			a.writeXOR(&a.values[i], math.Float64bits(value))
+		}
+	}
+	a.t = t
+
+	a.writeString(&a.name, metric.Name)
+	a.writeString(&a.status, metric.Status)
+
+	a.count++
+	a.maxTime = metric.Timestamp
+}
+
+func (a *chunkAppender) writeDoD(dod int64) {
+	if dod == 0 {
+		a.w.writeBit(false)
+		return
+	}
+	for _, bucket := range timestampBuckets {
+		limit := int64(1) << uint(bucket.bits-1)
+		if bucket.bits == 64 || (dod >= -limit && dod < limit) {
+			a.w.writeBits(bucket.prefix, int(bucket.prefixBits))
+			a.w.writeBits(uint64(dod), bucket.bits)
+			return
+		}
+	}
+}
+
+func (a *chunkAppender) writeXOR(state *xorState, value uint64) {
+	xor := state.prev ^ value
+	state.prev = value
+	if xor == 0 {
+		a.w.writeBit(false)
+		return
+	}
+	a.w.writeBit(true)
+
+	leading := bits.LeadingZeros64(xor)
+	trailing := bits.TrailingZeros64(xor)
+	if leading > 31 {
+		leading = 31 // stored in 5 bits
+	}
+
+	// Reuse the previous window when the meaningful bits fit inside it
+	if state.leading >= 0 && leading >= state.leading && trailing >= state.trailing {
+		a.w.writeBit(false)
+		a.w.writeBits(xor>>uint(state.trailing), 64-state.leading-state.trailing)
+		return
+	}
+
+	significant := 64 - leading - trailing
+	a.w.writeBit(true)
+	a.w.writeBits(uint64(leading), 5)
+	a.w.writeBits(uint64(significant%64), 6) // 64 significant bits are stored as 0
+	a.w.writeBits(xor>>uint(trailing), significant)
+	state.leading = leading
+	state.trailing = trailing
+}
+
+func (a *chunkAppender) writeString(prev *string, value string) {
+	if a.count > 0 && value == *prev {
+		a.w.writeBit(false)
+		return
+	}
+	if len(value) > math.MaxUint16 {
+		value = value[:math.MaxUint16]
+	}
+	a.w.writeBit(true)
+	a.w.writeBits(uint64(len(value)), 16)
+	for i := 0; i < len(value); i++ {
+		a.w.writeBits(uint64(value[i]), 8)
+	}
+	*prev = value
+}
+
+// bytes returns a copy of the encoded samples
+func (a *chunkAppender) bytes() []byte {
+	return append([]byte(nil), a.w.buf...)
+}
+
+// decodeChunk decodes count samples of a container from chunk data
+func decodeChunk(containerID string, data []byte, count int) ([]models.ContainerMetric, error) {
+	r := bitReader{buf: data}
+	metrics := make([]models.ContainerMetric, 0, count)
+
+	var (
+		t      int64
+		tDelta int64
+		values [numFields]xorState
+		fields [numFields]float64
+		name   string
+		status string
+	)
+	for n := 0; n < count; n++ {
+		if n == 0 {
+			first, err := r.readBits(64)
+			if err != nil {
+				return nil, err
+			}
+			t = int64(first)
+			for i := range values {
+				if values[i].prev, err = r.readBits(64); err != nil {
+					return nil, err
+				}
+				values[i].leading = -1
+			}
+		} else {
+			dod, err := readDoD(&r)
+			if err != nil {
+				return nil, err
+			}
+			tDelta += dod
+			t += tDelta
+			for i := range values {
+				if err := readXOR(&r, &values[i]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for i := range values {
+			fields[i] = math.Float64frombits(values[i].prev)
+		}
+
+		var err error
+		if name, err = readString(&r, name); err != nil {
+			return nil, err
+		}
+		if status, err = readString(&r, status); err != nil {
+			return nil, err
+		}
+
+		metric := models.ContainerMetric{
+			ContainerID: containerID,
+			Name:        name,
+			Status:      status,
+			Timestamp:   time.UnixMilli(t),
+		}
+		setSampleFields(&metric, fields)
+		metrics = append(metrics, metric)
+	}
+
+	return metrics, nil
+}
+
+func readDoD(r *bitReader) (int64, error) {
+	var prefix uint64
+	for prefixBits := 1; prefixBits <= 4; prefixBits++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		prefix = prefix<<1 | boolToBit(bit)
+		if prefixBits == 1 && !bit {
+			return 0, nil
+		}
+		for _, bucket := range timestampBuckets {
+			if bucket.prefixBits == uint64(prefixBits) && bucket.prefix == prefix {
+				value, err := r.readBits(bucket.bits)
+				if err != nil {
+					return 0, err
+				}
+				// Sign-extend the two's complement value
+				shift := uint(64 - bucket.bits)
+				return int64(value<<shift) >> shift, nil
+			}
+		}
+	}
+	return 0, errShortChunk
+}
+
+func readXOR(r *bitReader, state *xorState) error {
+	changed, err := r.readBit()
+	if err != nil || !changed {
+		return err
+	}
+
+	newWindow, err := r.readBit()
+	if err != nil {
+		return err
+	}
+	if newWindow {
+		leading, err := r.readBits(5)
+		if err != nil {
+			return err
+		}
+		significant, err := r.readBits(6)
+		if err != nil {
+			return err
+		}
+		if significant == 0 {
+			significant = 64
+		}
+		state.leading = int(leading)
+		state.trailing = 64 - int(leading) - int(significant)
+	}
+
+	meaningful, err := r.readBits(64 - state.leading - state.trailing)
+	if err != nil {
+		return err
+	}
+	state.prev ^= meaningful << uint(state.trailing)
+	return nil
+}
+
+func readString(r *bitReader, prev string) (string, error) {
+	changed, err := r.readBit()
+	if err != nil || !changed {
+		return prev, err
+	}
+
+	length, err := r.readBits(16)
+	if err != nil {
+		return "", err
+	}
+	value := make([]byte, length)
+	for i := range value {
+		b, err := r.readBits(8)
+		if err != nil {
+			return "", err
+		}
+		value[i] = byte(b)
+	}
+	return string(value), nil
+}
+
+func boolToBit(bit bool) uint64 {
+	if bit {
+		return 1
+	}
+	return 0
+}
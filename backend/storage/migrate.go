@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"database/sql"
+	"nabd/models"
+	"nabd/utils"
+)
+
+// MigrateRows moves container_metrics rows into store in batches, oldest first, and
+// deletes each batch once it is stored. An interrupted migration resumes where it
+// stopped; rows already in the store are skipped by Append. It returns the number of
+// rows moved.
+func MigrateRows(store MetricsStore, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 5000
+	}
+
+	moved := 0
+	for {
+		rows, err := models.DB.Query(`SELECT id, container_id, name, cpu_percent, memory_usage, memory_limit,
+			network_rx, network_tx, block_read, block_write, pids,
+			restart_count, uptime_seconds, health, status, timestamp
+			FROM container_metrics
+			ORDER BY id
+			LIMIT ?`, batchSize)
+		if err != nil {
+			return moved, err
+		}
+
+		var (
+			batch []models.ContainerMetric
+			maxID int64
+		)
+		for rows.Next() {
+			var metric models.ContainerMetric
+			err := rows.Scan(
+				&maxID,
+				&metric.ContainerID,
+				&metric.Name,
+				&metric.CPUPercent,
+				&metric.MemoryUsage,
+				&metric.MemoryLimit,
+				&metric.NetworkRx,
+				&metric.NetworkTx,
+				&metric.BlockRead,
+				&metric.BlockWrite,
+				&metric.Pids,
+				&metric.RestartCount,
+				&metric.UptimeSeconds,
+				&metric.Health,
+				&metric.Status,
+				&metric.Timestamp,
+			)
+			if err != nil {
+				rows.Close()
+				return moved, err
+			}
+			batch = append(batch, metric)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return moved, err
+		}
+		if len(batch) == 0 {
+			return moved, nil
+		}
+
+		if err := store.Append(batch); err != nil {
+			return moved, err
+		}
+		err = utils.WriteTx(func(tx *sql.Tx) error {
+			_, err := tx.Exec(`DELETE FROM container_metrics WHERE id <= ?`, maxID)
+			return err
+		})
+		if err != nil {
+			return moved, err
+		}
+		moved += len(batch)
+	}
+}
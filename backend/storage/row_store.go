@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"database/sql"
+	"nabd/models"
+	"nabd/utils"
+	"time"
+)
+
+// RowStore keeps one container_metrics row per sample
+type RowStore struct{}
+
+// NewRowStore creates a store backed by the container_metrics table
+func NewRowStore() *RowStore {
+	return &RowStore{}
+}
+
+// Append stores the samples in one transaction with a prepared statement
+func (rs *RowStore) Append(metrics []models.ContainerMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	return utils.WriteTx(func(tx *sql.Tx) error {
+		return rs.AppendTx(tx, metrics)
+	})
+}
+
+// AppendTx stores the samples within a write transaction
+func (rs *RowStore) AppendTx(tx *sql.Tx, metrics []models.ContainerMetric) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO container_metrics
+		(container_id, name, cpu_percent, memory_usage, memory_limit, network_rx, network_tx,
+		block_read, block_write, pids, restart_count, uptime_seconds, health, status, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, metric := range metrics {
+		_, err := stmt.Exec(
+			metric.ContainerID,
+			metric.Name,
+			metric.CPUPercent,
+			metric.MemoryUsage,
+			metric.MemoryLimit,
+			metric.NetworkRx,
+			metric.NetworkTx,
+			metric.BlockRead,
+			metric.BlockWrite,
+			metric.Pids,
+			metric.RestartCount,
+			metric.UptimeSeconds,
+			metric.Health,
+			metric.Status,
+			metric.Timestamp,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Range returns the samples of a container in [from, to], oldest first
+func (rs *RowStore) Range(containerID string, from, to time.Time) ([]models.ContainerMetric, error) {
+	rows, err := models.DB.Query(rowSelect+`
+		WHERE container_id = ? AND timestamp >= ? AND timestamp <= ?
+		ORDER BY timestamp`, containerID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []models.ContainerMetric
+	err = scanRows(rows, func(metric models.ContainerMetric) error {
+		metrics = append(metrics, metric)
+		return nil
+	})
+	return metrics, err
+}
+
+// RangeAll returns the samples of every container in [from, to], oldest first
+func (rs *RowStore) RangeAll(from, to time.Time) (map[string][]models.ContainerMetric, error) {
+	rows, err := models.DB.Query(rowSelect+`
+		WHERE timestamp >= ? AND timestamp <= ?
+		ORDER BY container_id, timestamp`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make(map[string][]models.ContainerMetric)
+	err = scanRows(rows, func(metric models.ContainerMetric) error {
+		samples[metric.ContainerID] = append(samples[metric.ContainerID], metric)
+		return nil
+	})
+	return samples, err
+}
+
+// Containers returns the IDs of the containers with samples in [from, to]
+func (rs *RowStore) Containers(from, to time.Time) ([]string, error) {
+	rows, err := models.DB.Query(`SELECT DISTINCT container_id FROM container_metrics
+		WHERE timestamp >= ? AND timestamp <= ?
+		ORDER BY container_id`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Prune deletes samples older than before
+func (rs *RowStore) Prune(before time.Time) error {
+	return utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM container_metrics WHERE timestamp < ?`, before)
+		return err
+	})
+}
+
+// rowSelect selects every column of container_metrics in scanRows order
+const rowSelect = `SELECT container_id, name, cpu_percent, memory_usage, memory_limit,
+		network_rx, network_tx, block_read, block_write, pids,
+		restart_count, uptime_seconds, health, status, timestamp
+		FROM container_metrics`
+
+// scanRows scans container_metrics rows selected with rowSelect
+func scanRows(rows *sql.Rows, fn func(metric models.ContainerMetric) error) error {
+	for rows.Next() {
+		var metric models.ContainerMetric
+		err := rows.Scan(
+			&metric.ContainerID,
+			&metric.Name,
+			&metric.CPUPercent,
+			&metric.MemoryUsage,
+			&metric.MemoryLimit,
+			&metric.NetworkRx,
+			&metric.NetworkTx,
+			&metric.BlockRead,
+			&metric.BlockWrite,
+			&metric.Pids,
+			&metric.RestartCount,
+			&metric.UptimeSeconds,
+			&metric.Health,
+			&metric.Status,
+			&metric.Timestamp,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(metric); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
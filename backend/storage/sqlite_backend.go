@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"database/sql"
+	"nabd/models"
+	"nabd/utils"
+	"time"
+)
+
+// SQLiteBackend stores chunks as blobs in the metric_chunks table
+type SQLiteBackend struct{}
+
+// NewSQLiteBackend creates a chunk backend in the Nabd database
+func NewSQLiteBackend() *SQLiteBackend {
+	return &SQLiteBackend{}
+}
+
+// WriteChunks inserts or replaces chunks within tx
+func (sb *SQLiteBackend) WriteChunks(tx *sql.Tx, chunks []Chunk) error {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`INSERT OR REPLACE INTO metric_chunks
+		(container_id, partition_start, min_time, max_time, count, data)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, chunk := range chunks {
+		_, err := stmt.Exec(
+			chunk.ContainerID,
+			chunk.Start.Unix(),
+			chunk.MinTime.UnixMilli(),
+			chunk.MaxTime.UnixMilli(),
+			chunk.Count,
+			chunk.Data,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadChunks returns the chunks overlapping [from, to]
+func (sb *SQLiteBackend) ReadChunks(containerID string, from, to time.Time) ([]Chunk, error) {
+	query := `SELECT container_id, partition_start, min_time, max_time, count, data
+		FROM metric_chunks
+		WHERE max_time >= ? AND min_time <= ?`
+	args := []interface{}{from.UnixMilli(), to.UnixMilli()}
+	if containerID != "" {
+		query += ` AND container_id = ?`
+		args = append(args, containerID)
+	}
+
+	rows, err := models.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []Chunk
+	for rows.Next() {
+		var (
+			chunk                   Chunk
+			start, minTime, maxTime int64
+		)
+		if err := rows.Scan(&chunk.ContainerID, &start, &minTime, &maxTime, &chunk.Count, &chunk.Data); err != nil {
+			return nil, err
+		}
+		chunk.Start = time.Unix(start, 0)
+		chunk.MinTime = time.UnixMilli(minTime)
+		chunk.MaxTime = time.UnixMilli(maxTime)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, rows.Err()
+}
+
+// ChunkContainers returns the IDs of the containers with chunks overlapping [from, to]
+func (sb *SQLiteBackend) ChunkContainers(from, to time.Time) ([]string, error) {
+	rows, err := models.DB.Query(`SELECT DISTINCT container_id FROM metric_chunks
+		WHERE max_time >= ? AND min_time <= ?`, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteChunks deletes the chunks whose samples are all older than before
+func (sb *SQLiteBackend) DeleteChunks(before time.Time) error {
+	return utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM metric_chunks WHERE max_time < ?`, before.UnixMilli())
+		return err
+	})
+}
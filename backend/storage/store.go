@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"nabd/models"
+	"time"
+)
+
+// MetricsStore persists container samples and serves time range scans
+type MetricsStore interface {
+	// Append stores the samples of one collection cycle
+	Append(metrics []models.ContainerMetric) error
+	// AppendTx is Append within a write transaction
+	AppendTx(tx *sql.Tx, metrics []models.ContainerMetric) error
+	// Range returns the samples of a container in [from, to], oldest first
+	Range(containerID string, from, to time.Time) ([]models.ContainerMetric, error)
+	// RangeAll returns the samples of every container in [from, to], grouped by
+	// container and oldest first
+	RangeAll(from, to time.Time) (map[string][]models.ContainerMetric, error)
+	// Containers returns the IDs of the containers with samples in [from, to]
+	Containers(from, to time.Time) ([]string, error)
+	// Prune deletes samples older than before
+	Prune(before time.Time) error
+}
+
+// Open creates the metrics store selected by the storage configuration
+func Open(config *models.Config) (MetricsStore, error) {
+	switch config.Storage.Engine {
+	case "", "rows":
+		return NewRowStore(), nil
+	case "chunks":
+		chunkDuration := time.Duration(config.Storage.ChunkHours) * time.Hour
+		if chunkDuration <= 0 {
+			chunkDuration = 2 * time.Hour // Default to 2 hours
+		}
+
+		var backend ChunkBackend
+		switch config.Storage.Backend {
+		case "", "sqlite":
+			backend = NewSQLiteBackend()
+		case "directory":
+			dirBackend, err := NewDirectoryBackend(config.Storage.Directory, chunkDuration)
+			if err != nil {
+				return nil, err
+			}
+			backend = dirBackend
+		default:
+			return nil, fmt.Errorf("unknown chunk backend: %s", config.Storage.Backend)
+		}
+		return NewChunkStore(backend, chunkDuration), nil
+	default:
+		return nil, fmt.Errorf("unknown storage engine: %s", config.Storage.Engine)
+	}
+}
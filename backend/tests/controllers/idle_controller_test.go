@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"nabd/controllers"
+	"nabd/models"
+	"nabd/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleController_StopIdleContainer_RequiresConfirmation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := &models.Config{}
+	controller := controllers.NewIdleController(services.NewIdleService(nil, nil, nil, config))
+	router := gin.New()
+	router.POST("/idle/:name/stop", controller.StopIdleContainer)
+
+	stop := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/idle/forgotten/stop", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, stop("").Code)
+	assert.Equal(t, http.StatusBadRequest, stop(`{"confirm": false}`).Code)
+
+	// Confirmed, but the policy does not allow stopping
+	w := stop(`{"confirm": true}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "disabled")
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nabd/controllers"
+	"nabd/models"
+	"nabd/services"
+
+	"github.com/docker/docker/api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const streamContainerID = "web000000000000000000000000000000000000000000000000000000000000"
+
+// startStatsDaemon starts a fake Docker daemon listing one container, web, whose stats
+// stream sends a sample every 10ms. streamClosed is closed once the stats stream ends.
+func startStatsDaemon(t *testing.T) (streamClosed chan struct{}) {
+	streamClosed = make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.41")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			fmt.Fprint(w, "OK")
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			json.NewEncoder(w).Encode([]types.Container{{ID: streamContainerID, Names: []string{"/web"}, State: "running"}})
+		case strings.HasSuffix(r.URL.Path, "/containers/"+streamContainerID+"/stats"):
+			defer close(streamClosed)
+			var stats types.StatsJSON
+			stats.MemoryStats.Usage = 64 << 20
+			for {
+				json.NewEncoder(w).Encode(stats)
+				w.(http.Flusher).Flush()
+				select {
+				case <-time.After(10 * time.Millisecond):
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(func() {
+		server.CloseClientConnections()
+		server.Close()
+	})
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+	return streamClosed
+}
+
+func TestContainerController_StreamStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	streamClosed := startStatsDaemon(t)
+
+	dockerService, err := services.NewDockerService(&models.Config{})
+	require.NoError(t, err)
+	// Live samples are never stored, so the controller needs no metrics service
+	controller := controllers.NewContainerController(dockerService, nil, nil)
+	router := gin.New()
+	router.GET("/containers/:name/stats/stream", controller.StreamStats)
+	api := httptest.NewServer(router)
+	defer api.Close()
+
+	resp, err := http.Get(api.URL + "/containers/missing/stats/stream")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", api.URL+"/containers/web/stats/stream", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// Each sample is a stats event carrying a metric
+	scanner := bufio.NewScanner(resp.Body)
+	var samples []models.ContainerMetric
+	for len(samples) < 3 && scanner.Scan() {
+		line := scanner.Text()
+		if line == "event:stats" {
+			require.True(t, scanner.Scan())
+			var sample models.ContainerMetric
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), "data:")), &sample))
+			samples = append(samples, sample)
+		}
+	}
+	require.Len(t, samples, 3)
+	assert.Equal(t, "web", samples[0].Name)
+	assert.Equal(t, streamContainerID[:12], samples[0].ContainerID)
+	assert.Equal(t, int64(64<<20), samples[0].MemoryUsage)
+
+	// The Docker stats stream is closed once the client goes away
+	cancel()
+	select {
+	case <-streamClosed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the Docker stats stream is still open after the client disconnected")
+	}
+}
@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureServer records the JSON bodies posted to it
+func captureServer(t *testing.T, bodies chan<- map[string]interface{}) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Errorf("invalid JSON payload: %v", err)
+		}
+		body["_token"] = r.Header.Get("X-Token")
+		bodies <- body
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func firingAlert() notify.Notification {
+	return notify.AlertFiring(models.Alert{
+		ContainerID: "abc123",
+		Name:        "web",
+		Type:        "high_cpu",
+		Severity:    "critical",
+		Message:     "CPU usage is 97.0%",
+		Timestamp:   time.Now(),
+	})
+}
+
+func TestWebhookChannel_PostsNotification(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+	server := captureServer(t, bodies)
+
+	channel := notify.NewWebhookChannel(server.URL, map[string]string{"X-Token": "secret"}, server.Client())
+	require.NoError(t, channel.Send(context.Background(), firingAlert()))
+
+	body := <-bodies
+	assert.Equal(t, "alert_firing", body["event"])
+	assert.Equal(t, "[CRITICAL] high_cpu on web", body["title"])
+	assert.Equal(t, "abc123", body["container_id"])
+	assert.Equal(t, "secret", body["_token"])
+}
+
+func TestChatChannels_Payloads(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+	server := captureServer(t, bodies)
+
+	require.NoError(t, notify.NewSlackChannel(server.URL, server.Client()).Send(context.Background(), firingAlert()))
+	slack := <-bodies
+	assert.Contains(t, slack["text"], "*[CRITICAL] high_cpu on web*")
+	assert.Len(t, slack["attachments"], 1)
+
+	require.NoError(t, notify.NewTeamsChannel(server.URL, server.Client()).Send(context.Background(), firingAlert()))
+	teams := <-bodies
+	assert.Equal(t, "MessageCard", teams["@type"])
+	assert.Equal(t, "d00000", teams["themeColor"])
+
+	long := firingAlert()
+	long.Text = strings.Repeat("é", 3000)
+	require.NoError(t, notify.NewDiscordChannel(server.URL, server.Client()).Send(context.Background(), long))
+	discord := <-bodies
+	content := discord["content"].(string)
+	assert.LessOrEqual(t, len(content), 2000)
+	assert.True(t, strings.HasSuffix(content, "..."))
+}
+
+func TestWebhookChannel_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := notify.NewSlackChannel(server.URL, server.Client()).Send(context.Background(), firingAlert())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+	assert.Contains(t, err.Error(), "invalid_token")
+}
+
+// smtpServer is a minimal SMTP stand-in that hands received messages to messages
+func smtpServer(t *testing.T, messages chan<- string) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, messages)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	return host, portNumber
+}
+
+func serveSMTP(conn net.Conn, messages chan<- string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 end with .")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			messages <- data.String()
+			reply("250 queued")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestEmailChannel_SendsMessage(t *testing.T) {
+	messages := make(chan string, 1)
+	host, port := smtpServer(t, messages)
+
+	channel, err := notify.NewEmailChannel(host, port, "", "", "nabd@example.com", []string{"ops@example.com"})
+	require.NoError(t, err)
+
+	notification := firingAlert()
+	notification.Title = "multi\r\nBcc: victim@example.com"
+	require.NoError(t, channel.Send(context.Background(), notification))
+
+	message := <-messages
+	assert.Contains(t, message, "To: ops@example.com\r\n")
+	assert.Contains(t, message, "Subject: multi  Bcc: victim@example.com\r\n")
+	assert.Contains(t, message, "CPU usage is 97.0%")
+	assert.Contains(t, message, "Container: web (abc123)")
+}
+
+func TestNewChannel_Validation(t *testing.T) {
+	_, err := notify.NewChannel(models.NotificationChannel{Name: "a", Type: "pager", URL: "http://x"}, http.DefaultClient)
+	assert.Error(t, err)
+
+	_, err = notify.NewChannel(models.NotificationChannel{Name: "a", Type: "slack"}, http.DefaultClient)
+	assert.Error(t, err)
+
+	_, err = notify.NewChannel(models.NotificationChannel{Name: "a", Type: "email", SMTPHost: "mail"}, http.DefaultClient)
+	assert.Error(t, err)
+
+	channel, err := notify.NewChannel(models.NotificationChannel{Name: "a", Type: "discord", URL: "http://x"}, http.DefaultClient)
+	require.NoError(t, err)
+	assert.NotNil(t, channel)
+}
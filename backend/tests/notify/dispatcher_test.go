@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"nabd/notify"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyChannel fails its first `failures` sends and records every notification it accepts
+type flakyChannel struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	sent     []notify.Notification
+}
+
+func (fc *flakyChannel) Send(ctx context.Context, notification notify.Notification) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.calls++
+	if fc.calls <= fc.failures {
+		return errors.New("connection refused")
+	}
+	fc.sent = append(fc.sent, notification)
+	return nil
+}
+
+func setupDatabase(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+}
+
+func TestDispatcher_RetriesUntilDelivered(t *testing.T) {
+	setupDatabase(t)
+
+	channel := &flakyChannel{failures: 1}
+	dispatcher := notify.NewDispatcher(3, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", channel, nil, ""))
+	dispatcher.Start()
+	dispatcher.Notify(firingAlert())
+	dispatcher.Close()
+
+	assert.Len(t, channel.sent, 1)
+	deliveries, err := notify.GetDeliveries(10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, "ops", deliveries[0].Channel)
+	assert.Equal(t, "alert_firing", deliveries[0].Event)
+	assert.True(t, deliveries[0].Success)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Empty(t, deliveries[0].Error)
+}
+
+func TestDispatcher_GivesUpAfterMaxAttempts(t *testing.T) {
+	setupDatabase(t)
+
+	channel := &flakyChannel{failures: 10}
+	dispatcher := notify.NewDispatcher(3, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", channel, nil, ""))
+	dispatcher.Start()
+	dispatcher.Notify(firingAlert())
+	dispatcher.Close()
+
+	assert.Equal(t, 3, channel.calls)
+	deliveries, err := notify.GetDeliveries(10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.False(t, deliveries[0].Success)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, "connection refused", deliveries[0].Error)
+}
+
+func TestDispatcher_Filters(t *testing.T) {
+	setupDatabase(t)
+
+	critical := &flakyChannel{}
+	resolvedOnly := &flakyChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("critical", critical, nil, "critical"))
+	require.NoError(t, dispatcher.AddChannel("resolved", resolvedOnly, []string{notify.EventAlertResolved}, ""))
+	assert.Error(t, dispatcher.AddChannel("critical", &flakyChannel{}, nil, ""))
+	assert.Error(t, dispatcher.AddChannel("other", &flakyChannel{}, []string{"paged"}, ""))
+
+	warning := firingAlert()
+	warning.Severity = "warning"
+
+	dispatcher.Start()
+	dispatcher.Notify(firingAlert())
+	dispatcher.Notify(warning)
+	dispatcher.Notify(notify.Test())
+	dispatcher.Close()
+
+	require.Len(t, critical.sent, 2)
+	assert.Equal(t, "critical", critical.sent[0].Severity)
+	assert.Equal(t, notify.EventTest, critical.sent[1].Event)
+	require.Len(t, resolvedOnly.sent, 1)
+	assert.Equal(t, notify.EventTest, resolvedOnly.sent[0].Event)
+}
+
+func TestDispatcher_NilIsNoop(t *testing.T) {
+	var dispatcher *notify.Dispatcher
+	assert.NotPanics(t, func() { dispatcher.Notify(firingAlert()) })
+}
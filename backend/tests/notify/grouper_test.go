@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"nabd/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupNotifications(t *testing.T) {
+	labels := map[string]string{"compose_project": "shop"}
+	warning := firingAlert()
+	warning.Severity = "warning"
+	resolved := firingAlert()
+	resolved.Event = notify.EventAlertResolved
+
+	grouped := notify.GroupNotifications(labels, []notify.Notification{warning, firingAlert(), resolved})
+	require.Len(t, grouped, 2)
+
+	firing := grouped[0]
+	assert.Equal(t, notify.EventAlertFiring, firing.Event)
+	assert.Equal(t, "[FIRING:2] compose_project=shop", firing.Title)
+	assert.Equal(t, "critical", firing.Severity)
+	assert.Equal(t, labels, firing.Group)
+	assert.Len(t, firing.Alerts, 2)
+	assert.Contains(t, firing.Text, "CPU usage is 97.0%")
+
+	// A lone notification is passed on unchanged
+	assert.Equal(t, resolved, grouped[1])
+}
+
+func TestGrouper_BatchesAlerts(t *testing.T) {
+	setupDatabase(t)
+
+	channel := &flakyChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", channel, nil, ""))
+	dispatcher.Start()
+
+	grouper := notify.NewGrouper(dispatcher, 50*time.Millisecond, time.Hour)
+	shop := map[string]string{"compose_project": "shop"}
+	grouper.Add(shop, nil, firingAlert())
+	grouper.Add(shop, nil, firingAlert())
+	grouper.Add(map[string]string{"compose_project": "blog"}, nil, firingAlert())
+	time.Sleep(200 * time.Millisecond)
+
+	// Within the interval, further alerts of a group wait for the next batch
+	grouper.Add(shop, nil, firingAlert())
+	time.Sleep(100 * time.Millisecond)
+	channel.mu.Lock()
+	assert.Len(t, channel.sent, 2)
+	channel.mu.Unlock()
+
+	grouper.Flush()
+	dispatcher.Close()
+
+	require.Len(t, channel.sent, 3)
+	titles := []string{channel.sent[0].Title, channel.sent[1].Title}
+	assert.Contains(t, titles, "[FIRING:2] compose_project=shop")
+	assert.Contains(t, titles, "[CRITICAL] high_cpu on web")
+}
@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"errors"
+	"testing"
+
+	"nabd/models"
+	"nabd/notify"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTemplates_Validation(t *testing.T) {
+	_, err := notify.NewTemplates([]models.NotificationTemplate{{Type: "high_cpu"}})
+	assert.ErrorIs(t, err, notify.ErrInvalidTemplate)
+
+	_, err = notify.NewTemplates([]models.NotificationTemplate{{Text: "{{.Name"}})
+	assert.ErrorIs(t, err, notify.ErrInvalidTemplate)
+
+	_, err = notify.NewTemplates([]models.NotificationTemplate{
+		{Channel: "ops", Text: "a"},
+		{Channel: "ops", Text: "b"},
+	})
+	assert.ErrorIs(t, err, notify.ErrInvalidTemplate)
+}
+
+func TestDispatcher_Preview(t *testing.T) {
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	dispatcher.SetDashboardURL("https://nabd.example.com/")
+	require.NoError(t, dispatcher.SetTemplates([]models.NotificationTemplate{
+		{Text: "default: {{.Message}}"},
+		{Channel: "ops", Text: "ops: {{.Message}}"},
+		{Type: "high_cpu", Title: "{{upper .Name}} CPU {{printf \"%.1f\" .Value}}% > {{.Threshold}}"},
+		{Channel: "ops", Type: "high_cpu", Text: "{{.Name}} ({{.Image}}) for {{round .Duration}}\n{{join .Logs \"\\n\"}}\n{{.DashboardURL}}"},
+	}))
+
+	sample := notify.Sample()
+
+	// The template for both the channel and type wins over the less specific ones
+	rendered, err := dispatcher.Preview("ops", nil, sample)
+	require.NoError(t, err)
+	assert.Equal(t, sample.Title, rendered.Title)
+	assert.Contains(t, rendered.Text, "web (nginx:1.25) for 5m0s")
+	assert.Contains(t, rendered.Text, "worker process exited on signal 9")
+	assert.Contains(t, rendered.Text, "https://nabd.example.com/dashboard")
+
+	rendered, err = dispatcher.Preview("pager", nil, sample)
+	require.NoError(t, err)
+	assert.Equal(t, "WEB CPU 97.3% > 90", rendered.Title)
+	assert.Equal(t, sample.Text, rendered.Text)
+
+	autoheal := sample
+	autoheal.Type = "restart"
+	rendered, err = dispatcher.Preview("pager", nil, autoheal)
+	require.NoError(t, err)
+	assert.Equal(t, "default: "+sample.Message, rendered.Text)
+
+	// A template from the request replaces the configured ones
+	rendered, err = dispatcher.Preview("ops", &models.NotificationTemplate{Text: "{{.Team}} owns {{.Name}}"}, sample)
+	require.NoError(t, err)
+	assert.Equal(t, "payments owns web", rendered.Text)
+
+	_, err = dispatcher.Preview("ops", &models.NotificationTemplate{Text: "{{.Missing}}"}, sample)
+	assert.ErrorIs(t, err, notify.ErrInvalidTemplate)
+}
+
+func TestDispatcher_RendersTemplatesPerChannel(t *testing.T) {
+	setupDatabase(t)
+
+	ops, chat := &flakyChannel{}, &flakyChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", ops, nil, ""))
+	require.NoError(t, dispatcher.AddChannel("chat", chat, nil, ""))
+	require.NoError(t, dispatcher.SetTemplates([]models.NotificationTemplate{
+		{Channel: "ops", Text: "{{.Message}}\n{{join .Logs \"\\n\"}}"},
+	}))
+
+	var requested []string
+	dispatcher.SetLogSource(func(name string, lines int) ([]string, error) {
+		requested = append(requested, name)
+		if name == "web" {
+			return []string{"panic: runtime error"}, nil
+		}
+		return nil, errors.New("container not found")
+	})
+	dispatcher.Start()
+	dispatcher.Notify(firingAlert())
+	dispatcher.Close()
+
+	require.Len(t, ops.sent, 1)
+	assert.Equal(t, "CPU usage is 97.0%\npanic: runtime error", ops.sent[0].Text)
+	require.Len(t, chat.sent, 1)
+	assert.Equal(t, "CPU usage is 97.0%", chat.sent[0].Text)
+
+	// Logs are only read for templates that use them
+	assert.Equal(t, []string{"web"}, requested)
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/notify"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// insertAlert stores an active alert raised at the given time and returns its ID
+func insertAlert(t *testing.T, containerID, name, alertType, severity string, at time.Time) int {
+	var id int64
+	require.NoError(t, utils.WriteTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO alerts (container_id, name, type, message, severity, active, timestamp)
+			VALUES (?, ?, ?, ?, ?, 1, ?)`, containerID, name, alertType, "test alert", severity, at)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	}))
+	return int(id)
+}
+
+func newAlertService(t *testing.T) *services.AlertService {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	return services.NewAlertService(services.NewMetricsService(nil, storage.NewRowStore(), config), config)
+}
+
+func TestAlertService_AcknowledgeAndResolve(t *testing.T) {
+	as := newAlertService(t)
+	id := insertAlert(t, "aaa", "web", "high_cpu", "critical", time.Now().Add(-10*time.Minute))
+
+	_, err := as.Acknowledge(id, "", "")
+	assert.ErrorIs(t, err, services.ErrActorRequired)
+
+	alert, err := as.Acknowledge(id, "alice", "looking into it")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", alert.AcknowledgedBy)
+	require.NotNil(t, alert.AcknowledgedAt)
+	assert.True(t, alert.Active)
+	require.Len(t, alert.Notes, 1)
+	assert.Equal(t, "looking into it", alert.Notes[0].Text)
+
+	_, err = as.Acknowledge(id, "bob", "")
+	assert.ErrorIs(t, err, services.ErrAlertAcknowledged)
+
+	alert, err = as.Resolve(id, "alice", "scaled up")
+	require.NoError(t, err)
+	assert.False(t, alert.Active)
+	require.NotNil(t, alert.ResolvedAt)
+	assert.InDelta(t, 600, alert.Duration, 5)
+	assert.Len(t, alert.Notes, 2)
+
+	_, err = as.Resolve(id, "alice", "")
+	assert.ErrorIs(t, err, services.ErrAlertResolved)
+	_, err = as.Acknowledge(id, "bob", "")
+	assert.ErrorIs(t, err, services.ErrAlertResolved)
+	_, err = as.Resolve(id+1, "alice", "")
+	assert.ErrorIs(t, err, services.ErrAlertNotFound)
+}
+
+func TestAlertService_ResolveNotifiesAfterCommit(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	channel := &recordingChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", channel, nil, ""))
+	dispatcher.Start()
+
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	require.NoError(t, ms.SetNotifier(dispatcher))
+	as := services.NewAlertService(ms, config)
+	id := insertAlert(t, "aaa", "web", "high_cpu", "critical", time.Now())
+
+	// Storing the note fails, so the resolution is rolled back and not notified
+	_, err := models.DB.Exec(`DROP TABLE alert_notes`)
+	require.NoError(t, err)
+	_, err = as.Resolve(id, "alice", "scaled up")
+	require.Error(t, err)
+
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Len(t, alerts, 1)
+
+	_, err = as.Resolve(id, "alice", "")
+	require.Error(t, err, "reading the notes of the resolved alert fails")
+	dispatcher.Close()
+
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+	require.Len(t, channel.sent, 1)
+	assert.Contains(t, channel.sent[0].Title, "RESOLVED")
+}
+
+func TestAlertService_Notes(t *testing.T) {
+	as := newAlertService(t)
+	id := insertAlert(t, "aaa", "web", "high_cpu", "critical", time.Now())
+
+	_, err := as.AddNote(id, "alice", " ")
+	assert.ErrorIs(t, err, services.ErrInvalidNote)
+	_, err = as.AddNote(id+1, "alice", "hello")
+	assert.ErrorIs(t, err, services.ErrAlertNotFound)
+
+	note, err := as.AddNote(id, "alice", "first")
+	require.NoError(t, err)
+	assert.NotZero(t, note.ID)
+	_, err = as.AddNote(id, "bob", "second")
+	require.NoError(t, err)
+
+	alert, err := as.GetAlert(id)
+	require.NoError(t, err)
+	require.Len(t, alert.Notes, 2)
+	assert.Equal(t, "first", alert.Notes[0].Text)
+	assert.Equal(t, "bob", alert.Notes[1].Author)
+}
+
+func TestAlertService_GetAlertHistory(t *testing.T) {
+	as := newAlertService(t)
+	now := time.Now()
+	old := insertAlert(t, "aaa", "web", "high_cpu", "critical", now.Add(-48*time.Hour))
+	insertAlert(t, "aaa", "web", "high_memory", "warning", now.Add(-2*time.Hour))
+	insertAlert(t, "bbb", "db", "high_cpu", "warning", now.Add(-time.Hour))
+	_, err := as.Resolve(old, "alice", "")
+	require.NoError(t, err)
+
+	all, err := as.GetAlertHistory(models.AlertHistoryFilter{})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, "db", all[0].Name)
+	assert.InDelta(t, 3600, all[0].Duration, 5)
+
+	byContainer, err := as.GetAlertHistory(models.AlertHistoryFilter{Container: "web"})
+	require.NoError(t, err)
+	assert.Len(t, byContainer, 2)
+
+	cpu, err := as.GetAlertHistory(models.AlertHistoryFilter{Type: "high_cpu", Severity: "critical"})
+	require.NoError(t, err)
+	require.Len(t, cpu, 1)
+	assert.False(t, cpu[0].Active)
+	assert.InDelta(t, 48*3600, cpu[0].Duration, 5)
+
+	recent, err := as.GetAlertHistory(models.AlertHistoryFilter{Since: now.Add(-3 * time.Hour), Until: now.Add(-90 * time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, recent, 1)
+	assert.Equal(t, "high_memory", recent[0].Type)
+
+	limited, err := as.GetAlertHistory(models.AlertHistoryFilter{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, limited, 1)
+}
+
+func TestAlertService_Escalate(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	config.Notifications.Enabled = true
+	config.Alerts.Escalation.Tiers = []models.EscalationTier{
+		{After: 600, Severity: "critical", Channels: []string{"pager"}},
+		{After: 3600, Severity: "critical"},
+	}
+
+	ops, pager := &recordingChannel{}, &recordingChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", ops, nil, ""))
+	require.NoError(t, dispatcher.AddChannel("pager", pager, nil, ""))
+	dispatcher.Start()
+
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	require.NoError(t, ms.SetNotifier(dispatcher))
+	as := services.NewAlertService(ms, config)
+
+	now := time.Now()
+	sustained := insertAlert(t, "aaa", "web", "high_cpu", "warning", now.Add(-20*time.Minute))
+	longest := insertAlert(t, "bbb", "db", "high_memory", "warning", now.Add(-2*time.Hour))
+	recent := insertAlert(t, "ccc", "cache", "high_cpu", "warning", now.Add(-time.Minute))
+	acknowledged := insertAlert(t, "ddd", "queue", "high_cpu", "warning", now.Add(-30*time.Minute))
+	_, err := as.Acknowledge(acknowledged, "alice", "")
+	require.NoError(t, err)
+
+	require.NoError(t, as.Escalate(now))
+	// Alerts already at their tier are not escalated again
+	require.NoError(t, as.Escalate(now.Add(time.Minute)))
+	dispatcher.Close()
+
+	alert, err := as.GetAlert(sustained)
+	require.NoError(t, err)
+	assert.Equal(t, "critical", alert.Severity)
+	assert.Equal(t, 1, alert.EscalationLevel)
+	require.NotNil(t, alert.EscalatedAt)
+	require.Len(t, alert.Escalations, 1)
+	assert.Equal(t, "warning", alert.Escalations[0].FromSeverity)
+	assert.Equal(t, "critical", alert.Escalations[0].ToSeverity)
+
+	// Tiers passed while escalation was not running are skipped to the highest one
+	alert, err = as.GetAlert(longest)
+	require.NoError(t, err)
+	assert.Equal(t, 2, alert.EscalationLevel)
+	assert.Len(t, alert.Escalations, 1)
+
+	alert, err = as.GetAlert(recent)
+	require.NoError(t, err)
+	assert.Equal(t, "warning", alert.Severity)
+	assert.Zero(t, alert.EscalationLevel)
+
+	alert, err = as.GetAlert(acknowledged)
+	require.NoError(t, err)
+	assert.Equal(t, 1, alert.EscalationLevel)
+
+	// The first tier routes to the pager only; the second uses every channel
+	require.Len(t, pager.sent, 2)
+	require.Len(t, ops.sent, 1)
+	assert.Equal(t, notify.EventAlertEscalated, ops.sent[0].Event)
+	assert.Equal(t, "[ESCALATED:CRITICAL] high_memory on db", ops.sent[0].Title)
+}
+
+func TestMetricsService_EscalationValidation(t *testing.T) {
+	config := &models.Config{}
+	config.Notifications.Enabled = true
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+
+	config.Alerts.Escalation.Tiers = []models.EscalationTier{{After: 600, Severity: "critical"}, {After: 300, Severity: "critical"}}
+	assert.Error(t, ms.SetNotifier(notify.NewDispatcher(1, 0, 0)))
+
+	config.Alerts.Escalation.Tiers = []models.EscalationTier{{After: 600, Severity: "urgent"}}
+	assert.Error(t, ms.SetNotifier(notify.NewDispatcher(1, 0, 0)))
+
+	config.Alerts.Escalation.Tiers = []models.EscalationTier{{After: 600, Severity: "critical", Channels: []string{"pager"}}}
+	assert.Error(t, ms.SetNotifier(notify.NewDispatcher(1, 0, 0)))
+
+	config.Notifications.Enabled = false
+	assert.NoError(t, ms.SetNotifier(notify.NewDispatcher(1, 0, 0)))
+}
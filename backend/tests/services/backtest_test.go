@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleService_Backtest(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	store := storage.NewRowStore()
+	config := &models.Config{}
+	rs := services.NewRuleService(services.NewMetricsService(nil, store, config), config)
+
+	// web is busy for 2 minutes, calm for 3, then busy until the end; db stays calm
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 40; i++ {
+		at := start.Add(time.Duration(i) * 15 * time.Second)
+		cpu := 10.0
+		if i < 8 || i >= 20 {
+			cpu = 95
+		}
+		require.NoError(t, store.Append([]models.ContainerMetric{
+			{ContainerID: "aaa", Name: "web", CPUPercent: cpu, Timestamp: at},
+			{ContainerID: "bbb", Name: "db", CPUPercent: 5, Timestamp: at},
+		}))
+	}
+
+	result, err := rs.Backtest(models.BacktestRequest{
+		Rule:  models.AlertRule{Metric: "cpu_percent", Comparator: ">", Threshold: 80, For: 30},
+		Start: start.Add(-time.Minute),
+		End:   start.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "backtest", result.Rule.Name)
+	assert.Equal(t, 80, result.Samples)
+
+	require.Len(t, result.Alerts, 2)
+	first := result.Alerts[0]
+	assert.Equal(t, "web", first.Name)
+	assert.Equal(t, start.Add(30*time.Second), first.Start.Local())
+	require.NotNil(t, first.End)
+	assert.Equal(t, start.Add(2*time.Minute), first.End.Local())
+	assert.Equal(t, 90.0, first.Duration)
+	assert.Nil(t, result.Alerts[1].End, "the second alert is still firing at the last sample")
+
+	require.Len(t, result.Containers, 2)
+	web := result.Containers[0]
+	assert.Equal(t, "web", web.Name)
+	assert.Equal(t, 2, web.Alerts)
+	assert.Equal(t, 1, web.Flaps)
+	assert.Equal(t, 90.0+255, web.FiringSeconds)
+	assert.Zero(t, result.Containers[1].Alerts)
+
+	// Resolving again only after the flap window is not a flap
+	result, err = rs.Backtest(models.BacktestRequest{
+		Rule:       models.AlertRule{Metric: "cpu_percent", Comparator: ">", Threshold: 80, For: 30},
+		Start:      start.Add(-time.Minute),
+		End:        start.Add(time.Hour),
+		FlapWindow: 60,
+	})
+	require.NoError(t, err)
+	assert.Zero(t, result.Containers[0].Flaps)
+
+	_, err = rs.Backtest(models.BacktestRequest{Rule: models.AlertRule{Metric: "cpu", Comparator: ">"}, Start: start})
+	assert.True(t, errors.Is(err, services.ErrInvalidRule))
+	_, err = rs.Backtest(models.BacktestRequest{
+		Rule:  models.AlertRule{Metric: "cpu_percent", Comparator: ">", Threshold: 80},
+		Start: start,
+		End:   start.Add(-time.Hour),
+	})
+	assert.True(t, errors.Is(err, services.ErrInvalidBacktest))
+	_, err = rs.Backtest(models.BacktestRequest{
+		Rule:  models.AlertRule{Metric: "cpu_percent", Comparator: ">", Threshold: 80},
+		Start: start.Add(-31 * 24 * time.Hour),
+		End:   start,
+	})
+	assert.True(t, errors.Is(err, services.ErrInvalidBacktest), "ranges are capped at 30 days")
+}
+
+func TestRuleService_BacktestScrapedSeries(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	rs := services.NewRuleService(services.NewMetricsService(nil, storage.NewRowStore(), config), config)
+
+	// worker's queue is deep for the first 2 minutes of 30-second scrapes; api is not scraped
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 10; i++ {
+		at := start.Add(time.Duration(i) * 30 * time.Second)
+		depth := 5.0
+		if i < 4 {
+			depth = 500
+		}
+		_, err := models.DB.Exec(`INSERT INTO scraped_metrics (container_id, name, metric, series, value, timestamp)
+			VALUES ('ccc', 'worker', 'queue_depth', 'queue_depth', ?, ?), ('ccc', 'worker', 'other', 'other', 1, ?)`,
+			depth, at, at)
+		require.NoError(t, err)
+	}
+
+	result, err := rs.Backtest(models.BacktestRequest{
+		Rule:  models.AlertRule{Metric: "scraped:queue_depth", Comparator: ">", Threshold: 100, For: 30},
+		Start: start.Add(-time.Minute),
+		End:   start.Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 10, result.Samples)
+	require.Len(t, result.Alerts, 1)
+	assert.Equal(t, "worker", result.Alerts[0].Name)
+	assert.Equal(t, start.Add(30*time.Second), result.Alerts[0].Start.Local())
+	assert.Equal(t, 90.0, result.Alerts[0].Duration)
+	require.Len(t, result.Containers, 1)
+	assert.Equal(t, "ccc", result.Containers[0].ContainerID)
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBaselineTestService() *services.BaselineService {
+	config := &models.Config{}
+	config.Alerts.Anomaly.Deviations = 3.0
+	config.Alerts.Anomaly.Alpha = 0.05
+	config.Alerts.Anomaly.MinSamples = 50
+	return services.NewBaselineService(nil, config)
+}
+
+func TestBaselineService_Learn_DetectsSpike(t *testing.T) {
+	service := newBaselineTestService()
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 100; i++ {
+		anomalies := service.Learn(models.ContainerMetric{
+			Name:        "worker",
+			CPUPercent:  float64(10 + i%3),
+			MemoryUsage: 200 * mb,
+			NetworkRx:   int64(i * 1000),
+			NetworkTx:   int64(i * 1000),
+			Timestamp:   start.Add(time.Duration(i) * 15 * time.Second),
+		})
+		assert.Empty(t, anomalies)
+	}
+
+	anomalies := service.Learn(models.ContainerMetric{
+		Name:        "worker",
+		CPUPercent:  95,
+		MemoryUsage: 200 * mb,
+		NetworkRx:   100 * 1000,
+		NetworkTx:   100 * 1000,
+		Timestamp:   start.Add(100 * 15 * time.Second),
+	})
+
+	require.Len(t, anomalies, 1)
+	assert.Equal(t, "cpu_percent", anomalies[0].Metric)
+	assert.Equal(t, 95.0, anomalies[0].Value)
+	assert.InDelta(t, 11.0, anomalies[0].Expected, 0.5)
+	assert.Greater(t, anomalies[0].Deviations, 3.0)
+}
+
+func TestBaselineService_Learn_NoAlertsDuringWarmup(t *testing.T) {
+	service := newBaselineTestService()
+	start := time.Now()
+
+	for i := 0; i < 50; i++ {
+		cpu := 5.0
+		if i == 49 {
+			cpu = 99
+		}
+		anomalies := service.Learn(models.ContainerMetric{
+			Name:       "fresh",
+			CPUPercent: cpu,
+			Timestamp:  start.Add(time.Duration(i) * 15 * time.Second),
+		})
+		assert.Empty(t, anomalies)
+	}
+}
+
+func TestBaselineService_GetBaselines(t *testing.T) {
+	service := newBaselineTestService()
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		service.Learn(models.ContainerMetric{Name: "api", CPUPercent: 20, Timestamp: start.Add(time.Duration(i) * time.Minute)})
+		service.Learn(models.ContainerMetric{Name: "db", CPUPercent: 40, Timestamp: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	all := service.GetBaselines("")
+	// cpu_percent and memory_usage per container, plus network rates after the first sample
+	assert.Len(t, all, 8)
+
+	api := service.GetBaselines("api")
+	require.Len(t, api, 4)
+	assert.Equal(t, "cpu_percent", api[0].Metric)
+	assert.InDelta(t, 20.0, api[0].Mean, 1e-9)
+	assert.Equal(t, 10, api[0].Samples)
+	require.Len(t, api[0].Hourly, 1)
+	assert.Equal(t, 3, api[0].Hourly[0].Hour)
+}
+
+func TestBaselineService_AlertsWithinCollectionCycle(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	config := &models.Config{}
+	config.Alerts.Anomaly.Enabled = true
+	config.Alerts.Anomaly.MinSamples = 50
+	config.Alerts.Anomaly.Consecutive = 1
+	store := storage.NewRowStore()
+	ms := services.NewMetricsService(fd.newDockerService(t, config), store, config)
+
+	// An hour of calm history for web and a container that has since been removed; the
+	// fake daemon reports 20% CPU
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 100; i++ {
+		at := start.Add(time.Duration(i) * 15 * time.Second)
+		require.NoError(t, store.Append([]models.ContainerMetric{
+			{ContainerID: fakeContainerID("web")[:12], Name: "web", CPUPercent: float64(5 + i%3), MemoryUsage: 64 * mb, Timestamp: at},
+			{ContainerID: "removed", Name: "removed", CPUPercent: 50, MemoryUsage: 32 * mb, Timestamp: at},
+		}))
+	}
+	bs := services.NewBaselineService(ms, config)
+	bs.StartBaselineLearning()
+	assert.Len(t, bs.GetBaselines("web"), 4, "baselines are learned from each container's history")
+	assert.Len(t, bs.GetBaselines("removed"), 4)
+
+	require.NoError(t, ms.CollectAndStoreMetrics())
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "anomaly", alerts[0].Type)
+	assert.Equal(t, "web", alerts[0].Name)
+}
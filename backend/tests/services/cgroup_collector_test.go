@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nabd/services"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testContainerID = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func writeTestFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestCgroupCollector_ReadCgroupStats_V2(t *testing.T) {
+	root := t.TempDir()
+	procRoot := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "cgroup.controllers"), "cpu io memory pids\n")
+
+	dir := filepath.Join(root, "system.slice", "docker-"+testContainerID+".scope")
+	writeTestFile(t, filepath.Join(dir, "cpu.stat"), "usage_usec 2500\nuser_usec 2000\nsystem_usec 500\n")
+	writeTestFile(t, filepath.Join(dir, "memory.current"), "104857600\n")
+	writeTestFile(t, filepath.Join(dir, "memory.max"), "max\n")
+	writeTestFile(t, filepath.Join(dir, "io.stat"), "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2\n8:16 rbytes=1024 wbytes=0 rios=1 wios=0\n")
+	writeTestFile(t, filepath.Join(dir, "pids.current"), "7\n")
+	writeTestFile(t, filepath.Join(procRoot, "meminfo"), "MemTotal:        2048 kB\nMemFree:         1024 kB\n")
+
+	collector := services.NewCgroupCollector(nil, root, procRoot)
+	stats, err := collector.ReadCgroupStats(testContainerID)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2500000), stats.CPUUsageNanos)
+	assert.Equal(t, int64(104857600), stats.MemoryUsage)
+	assert.Equal(t, int64(2048*1024), stats.MemoryLimit)
+	assert.Equal(t, int64(5120), stats.BlockRead)
+	assert.Equal(t, int64(8192), stats.BlockWrite)
+	assert.Equal(t, int64(7), stats.Pids)
+}
+
+func TestCgroupCollector_ReadCgroupStats_V1(t *testing.T) {
+	root := t.TempDir()
+
+	writeTestFile(t, filepath.Join(root, "cpu,cpuacct", "docker", testContainerID, "cpuacct.usage"), "123456789\n")
+	writeTestFile(t, filepath.Join(root, "memory", "docker", testContainerID, "memory.usage_in_bytes"), "52428800\n")
+	writeTestFile(t, filepath.Join(root, "memory", "docker", testContainerID, "memory.limit_in_bytes"), "268435456\n")
+	writeTestFile(t, filepath.Join(root, "blkio", "docker", testContainerID, "blkio.throttle.io_service_bytes"),
+		"8:0 Read 2048\n8:0 Write 4096\n8:0 Sync 0\n8:0 Total 6144\nTotal 6144\n")
+	writeTestFile(t, filepath.Join(root, "pids", "docker", testContainerID, "pids.current"), "3\n")
+
+	collector := services.NewCgroupCollector(nil, root, t.TempDir())
+	stats, err := collector.ReadCgroupStats(testContainerID)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(123456789), stats.CPUUsageNanos)
+	assert.Equal(t, int64(52428800), stats.MemoryUsage)
+	assert.Equal(t, int64(268435456), stats.MemoryLimit)
+	assert.Equal(t, int64(2048), stats.BlockRead)
+	assert.Equal(t, int64(4096), stats.BlockWrite)
+	assert.Equal(t, int64(3), stats.Pids)
+}
+
+func TestCgroupCollector_ReadCgroupStats_NotFound(t *testing.T) {
+	collector := services.NewCgroupCollector(nil, t.TempDir(), t.TempDir())
+	_, err := collector.ReadCgroupStats(testContainerID)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cgroup not found")
+}
+
+func TestParseNetDev(t *testing.T) {
+	content := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0
+  eth0:   52000     400    0    0    0     0          0         0    31000     300    0    0    0     0       0          0
+`
+	counters, err := services.ParseNetDev(strings.NewReader(content))
+
+	require.NoError(t, err)
+	assert.Len(t, counters, 2)
+	assert.Equal(t, int64(52000), counters["eth0"].RxBytes)
+	assert.Equal(t, int64(31000), counters["eth0"].TxBytes)
+	assert.Equal(t, int64(100), counters["lo"].RxBytes)
+}
+
+func TestCgroupCollector_RetainDropsStoppedContainers(t *testing.T) {
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	fd.setPid("web", 100)
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	procRoot := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "cgroup.controllers"), "cpu io memory pids\n")
+	dir := filepath.Join(root, "system.slice", "docker-"+fakeContainerID("web")+".scope")
+	writeTestFile(t, filepath.Join(dir, "cpu.stat"), "usage_usec 2500\n")
+	writeTestFile(t, filepath.Join(dir, "memory.current"), "1024\n")
+	netDev := "Inter-| Receive\n face |bytes\n  eth0: %d 0 0 0 0 0 0 0 %d 0 0 0 0 0 0 0\n"
+	writeTestFile(t, filepath.Join(procRoot, "100", "net", "dev"), fmt.Sprintf(netDev, 1000, 2000))
+
+	collector := services.NewCgroupCollector(cli, root, procRoot)
+	container := types.Container{ID: fakeContainerID("web"), Names: []string{"/web"}}
+	metric, err := collector.Collect(context.Background(), container)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), metric.NetworkRx)
+
+	// Once the container is gone its PID is forgotten, even if another process reuses it
+	collector.Retain(map[string]bool{})
+	fd.setPid("web", 200)
+	writeTestFile(t, filepath.Join(procRoot, "200", "net", "dev"), fmt.Sprintf(netDev, 5000, 6000))
+	writeTestFile(t, filepath.Join(dir, "cpu.stat"), "usage_usec 900000\n")
+
+	metric, err = collector.Collect(context.Background(), container)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5000), metric.NetworkRx)
+	assert.Zero(t, metric.CPUPercent, "the first reading after a container is forgotten has no rate")
+	assert.Equal(t, 2, fd.inspected("web"))
+
+	// Running containers keep their state
+	collector.Retain(map[string]bool{fakeContainerID("web"): true})
+	_, err = collector.Collect(context.Background(), container)
+	require.NoError(t, err)
+	assert.Equal(t, 2, fd.inspected("web"))
+}
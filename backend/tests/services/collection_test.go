@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerService_CollectsWithBoundedWorkers(t *testing.T) {
+	fd := startFakeDocker(t)
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("app%d", i)
+		fd.add(name, "Up 1 minute")
+		fd.setStatsDelay(name, 100*time.Millisecond)
+	}
+	config := &models.Config{}
+	config.Metrics.Workers = 2
+	ds := fd.newDockerService(t, config)
+
+	started := time.Now()
+	result, err := ds.CollectContainerMetrics(context.Background(), nil)
+	require.NoError(t, err)
+
+	assert.Len(t, result.Metrics, 6)
+	assert.Empty(t, result.Errors)
+	_, max := fd.statsInFlight()
+	assert.Equal(t, 2, max, "no more stats calls run at once than there are workers")
+	assert.GreaterOrEqual(t, time.Since(started), 300*time.Millisecond)
+}
+
+func TestDockerService_TimesOutSlowContainers(t *testing.T) {
+	fd := startFakeDocker(t)
+	fd.add("fast", "Up 1 minute")
+	fd.add("slow", "Up 1 minute")
+	fd.setStatsDelay("slow", time.Minute)
+	config := &models.Config{}
+	config.Metrics.StatsTimeout = 1
+	ds := fd.newDockerService(t, config)
+
+	started := time.Now()
+	result, err := ds.CollectContainerMetrics(context.Background(), nil)
+	require.NoError(t, err)
+
+	// The slow container fails on its own without holding up the cycle
+	assert.Less(t, time.Since(started), 5*time.Second)
+	require.Len(t, result.Metrics, 1)
+	assert.Equal(t, "fast", result.Metrics[0].Name)
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "slow", result.Errors[0].Name)
+	assert.Contains(t, result.Errors[0].Error, "deadline exceeded")
+	assert.ElementsMatch(t, []string{fakeContainerID("fast")[:12], fakeContainerID("slow")[:12]}, result.Running)
+}
+
+func TestMetricsService_RecordsCollectionErrors(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	fd.add("broken", "Up 1 minute")
+	fd.failStats("broken")
+	config := &models.Config{}
+	config.Metrics.Interval = 1
+	ms := services.NewMetricsService(fd.newDockerService(t, config), storage.NewRowStore(), config)
+
+	require.NoError(t, ms.CollectAndStoreMetrics())
+	time.Sleep(time.Second)
+	require.NoError(t, ms.CollectAndStoreMetrics())
+
+	cycles, statuses := ms.GetCollectionStatus()
+	require.Len(t, cycles, 2)
+	assert.Equal(t, 2, cycles[0].Containers)
+	assert.Equal(t, 1, cycles[0].Collected)
+	require.Len(t, cycles[0].Errors, 1)
+	assert.Equal(t, "broken", cycles[0].Errors[0].Name)
+
+	require.Len(t, statuses, 2)
+	broken, web := statuses[0], statuses[1]
+	assert.Equal(t, "broken", broken.Name)
+	assert.Equal(t, 2, broken.ConsecutiveFailures)
+	assert.Equal(t, 2, broken.TotalFailures)
+	assert.Contains(t, broken.LastError, "stats unavailable")
+	assert.True(t, broken.LastSuccess.IsZero())
+	assert.Equal(t, "web", web.Name)
+	assert.Zero(t, web.ConsecutiveFailures)
+	assert.False(t, web.LastSuccess.IsZero())
+}
+
+func TestMetricsService_CyclesDoNotOverlap(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	fd.setStatsDelay("web", 500*time.Millisecond)
+	config := &models.Config{}
+	ms := services.NewMetricsService(fd.newDockerService(t, config), storage.NewRowStore(), config)
+
+	done := make(chan error)
+	go func() { done <- ms.CollectAndStoreMetrics() }()
+	require.Eventually(t, func() bool {
+		current, _ := fd.statsInFlight()
+		return current == 1
+	}, 5*time.Second, 5*time.Millisecond)
+
+	assert.ErrorIs(t, ms.CollectAndStoreMetrics(), services.ErrCollectionInProgress)
+	require.NoError(t, <-done)
+
+	cycles, _ := ms.GetCollectionStatus()
+	require.Len(t, cycles, 1)
+	assert.GreaterOrEqual(t, cycles[0].DurationMs, int64(500))
+}
+
+func TestMetricsService_CollectionTick(t *testing.T) {
+	config := &models.Config{}
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	assert.Equal(t, 15*time.Second, ms.CollectionTick(), "the default interval")
+
+	config.Metrics.Interval = 30
+	config.Metrics.Overrides = map[string]int{"db": 10, "batch": 120}
+	assert.Equal(t, 10*time.Second, ms.CollectionTick(), "the loop ticks at the shortest override")
+}
+
+func TestCollectionWait(t *testing.T) {
+	assert.Equal(t, 15*time.Second, services.CollectionWait(15*time.Second, 0))
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		wait := services.CollectionWait(15*time.Second, 2*time.Second)
+		assert.GreaterOrEqual(t, wait, 15*time.Second)
+		assert.Less(t, wait, 17*time.Second)
+		seen[wait] = true
+	}
+	assert.Greater(t, len(seen), 1, "the jitter varies between cycles")
+}
+
+func TestMetricsService_PerContainerIntervals(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	fd.add("batch", "Up 1 minute")
+	config := &models.Config{}
+	config.Metrics.Interval = 1
+	config.Metrics.Overrides = map[string]int{"batch": 60}
+	ms := services.NewMetricsService(fd.newDockerService(t, config), storage.NewRowStore(), config)
+
+	require.NoError(t, ms.CollectAndStoreMetrics())
+	// Cycles within 90% of an interval skip the container
+	require.NoError(t, ms.CollectAndStoreMetrics())
+	time.Sleep(time.Second)
+	require.NoError(t, ms.CollectAndStoreMetrics())
+
+	cycles, _ := ms.GetCollectionStatus()
+	require.Len(t, cycles, 3)
+	assert.Equal(t, 1, cycles[0].Collected, "batch is not due again for a minute")
+	assert.Zero(t, cycles[1].Collected)
+	assert.Equal(t, 2, cycles[2].Collected)
+
+	// Containers skipped by a cycle keep their latest sample
+	latest, err := ms.GetLatestMetrics()
+	require.NoError(t, err)
+	assert.Len(t, latest, 2)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeDiskUsage(t *testing.T) {
+	usage := types.DiskUsage{
+		LayersSize: 5000,
+		Images: []*types.ImageSummary{
+			{ID: "sha256:a", RepoTags: []string{"nginx:latest"}, Size: 1000, SharedSize: 200, Containers: 1},
+			{ID: "sha256:b", RepoTags: []string{"<none>:<none>"}, Size: 600, SharedSize: 100, Containers: 0},
+			{ID: "sha256:c", Size: 400, Containers: 0},
+		},
+		Containers: []*types.Container{
+			{ID: "aaaaaaaaaaaaaaaa", Names: []string{"/web"}, Image: "nginx:latest", State: "running", SizeRw: 300},
+			{ID: "bbbbbbbbbbbbbbbb", Names: []string{"/old-job"}, Image: "busybox", State: "exited", SizeRw: 900},
+		},
+		Volumes: []*types.Volume{
+			{Name: "data", UsageData: &types.VolumeUsageData{Size: 2000, RefCount: 1}},
+			{Name: "orphan", UsageData: &types.VolumeUsageData{Size: 700, RefCount: 0}},
+			{Name: "unknown", UsageData: &types.VolumeUsageData{Size: -1, RefCount: -1}},
+		},
+		BuildCache: []*types.BuildCache{
+			{ID: "c1", Size: 50, InUse: true},
+			{ID: "c2", Size: 80},
+		},
+	}
+
+	report := services.SummarizeDiskUsage(usage)
+
+	assert.Equal(t, int64(5000), report.LayersSize)
+	assert.Equal(t, 3, report.Images.Count)
+	assert.Equal(t, int64(2000), report.Images.Size)
+	assert.Equal(t, int64(900), report.Images.Reclaimable)
+	assert.Equal(t, 2, report.Dangling.Count)
+	assert.Equal(t, int64(1000), report.Dangling.Size)
+	assert.Equal(t, 2, report.Containers.Count)
+	assert.Equal(t, int64(1200), report.Containers.Size)
+	assert.Equal(t, int64(900), report.Containers.Reclaimable)
+	assert.Equal(t, 3, report.Volumes.Count)
+	assert.Equal(t, int64(2700), report.Volumes.Size)
+	assert.Equal(t, int64(700), report.Volumes.Reclaimable)
+	assert.Equal(t, int64(130), report.BuildCache.Size)
+	assert.Equal(t, int64(80), report.BuildCache.Reclaimable)
+
+	require.Len(t, report.PerContainer, 2)
+	assert.Equal(t, "old-job", report.PerContainer[0].Name)
+	assert.Equal(t, "web", report.PerContainer[1].Name)
+	assert.Equal(t, "aaaaaaaaaaaa", report.PerContainer[1].ContainerID)
+}
+
+func TestDiskService_ReadsDoNotRaiseAlerts(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	config := &models.Config{}
+	config.Disk.HostRoot = t.TempDir()
+	config.Alerts.Disk.UnboundedLogs = true
+	logPath := filepath.Join(config.Disk.HostRoot, "web.log")
+	require.NoError(t, os.WriteFile(logPath, make([]byte, 100), 0644))
+
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	dks := services.NewDiskService(fd.newDockerService(t, config), ms, config)
+
+	report, err := dks.GetDiskUsage(true)
+	require.NoError(t, err)
+	require.Len(t, report.PerContainer, 1)
+	assert.True(t, report.PerContainer[0].LogUnbounded)
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts, "reading disk usage leaves alerting to the periodic check")
+
+	_, err = dks.CheckDiskUsage()
+	require.NoError(t, err)
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "unbounded_log", alerts[0].Type)
+
+	// The log size of a removed container is forgotten, so a new container with the
+	// same ID starts without a growth rate
+	fd.remove("web")
+	_, err = dks.GetDiskUsage(true)
+	require.NoError(t, err)
+	fd.add("web", "Up 1 second")
+	require.NoError(t, os.WriteFile(logPath, make([]byte, 5000), 0644))
+	report, err = dks.GetDiskUsage(true)
+	require.NoError(t, err)
+	require.Len(t, report.PerContainer, 1)
+	assert.Equal(t, int64(5000), report.PerContainer[0].LogSize)
+	assert.Zero(t, report.PerContainer[0].LogGrowthPerHour)
+}
+
+func TestDiskService_RefreshKeepsGrowthBaseline(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	config := &models.Config{}
+	config.Disk.HostRoot = t.TempDir()
+	logPath := filepath.Join(config.Disk.HostRoot, "web.log")
+	require.NoError(t, os.WriteFile(logPath, make([]byte, 100), 0644))
+
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	dks := services.NewDiskService(fd.newDockerService(t, config), ms, config)
+	_, err := dks.CheckDiskUsage()
+	require.NoError(t, err)
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, os.WriteFile(logPath, make([]byte, 200), 0644))
+	report, err := dks.GetDiskUsage(true)
+	require.NoError(t, err)
+	assert.Positive(t, report.PerContainer[0].LogGrowthPerHour, "reads measure growth since the last periodic check")
+
+	// The refresh did not become the baseline of the next periodic check
+	report, err = dks.CheckDiskUsage()
+	require.NoError(t, err)
+	assert.Positive(t, report.PerContainer[0].LogGrowthPerHour)
+}
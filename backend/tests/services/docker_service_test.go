@@ -1,13 +1,17 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
 
 	"nabd/models"
+	"nabd/services"
 
+	"github.com/docker/docker/api/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDockerService_NewDockerService(t *testing.T) {
@@ -59,6 +63,37 @@ func TestDockerService_RestartContainer_MockImplementation(t *testing.T) {
 	assert.Contains(t, err.Error(), "container not found")
 }
 
+func TestApplyContainerState(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	info := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+		RestartCount: 4,
+		State: &types.ContainerState{
+			Running:   true,
+			StartedAt: now.Add(-90 * time.Second).Format(time.RFC3339Nano),
+			Health:    &types.Health{Status: types.Unhealthy},
+		},
+	}}
+
+	var metric models.ContainerMetric
+	services.ApplyContainerState(&metric, info, now)
+
+	assert.Equal(t, 4, metric.RestartCount)
+	assert.Equal(t, int64(90), metric.UptimeSeconds)
+	assert.Equal(t, models.HealthUnhealthy, metric.Health)
+}
+
+func TestApplyContainerState_NoHealthCheck(t *testing.T) {
+	info := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+		State: &types.ContainerState{Running: false, StartedAt: "0001-01-01T00:00:00Z"},
+	}}
+
+	var metric models.ContainerMetric
+	services.ApplyContainerState(&metric, info, time.Now())
+
+	assert.Equal(t, models.HealthNone, metric.Health)
+	assert.Equal(t, int64(0), metric.UptimeSeconds)
+}
+
 type dockerServiceTestWrapper struct{}
 
 func (ds *dockerServiceTestWrapper) GetContainers() ([]models.ContainerInfo, error) {
@@ -132,4 +167,49 @@ func (ds *dockerServiceTestWrapper) RestartContainer(containerName string) error
 	}
 	
 	return fmt.Errorf("container not found: %s", containerName)
-}
\ No newline at end of file
+}
+
+func TestContainerHealth(t *testing.T) {
+	assert.Equal(t, models.HealthHealthy, services.ContainerHealth("Up 5 minutes (healthy)"))
+	assert.Equal(t, models.HealthUnhealthy, services.ContainerHealth("Up 5 minutes (unhealthy)"))
+	assert.Equal(t, models.HealthStarting, services.ContainerHealth("Up 3 seconds (health: starting)"))
+	assert.Equal(t, models.HealthNone, services.ContainerHealth("Up 5 minutes"))
+}
+
+func TestDockerService_CachesInspectedState(t *testing.T) {
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute (unhealthy)")
+	fd.setRestarts("web", 2)
+	ds := fd.newDockerService(t, &models.Config{})
+	ds.StartEventWatch()
+
+	collect := func() models.ContainerMetric {
+		result, err := ds.CollectContainerMetrics(context.Background(), nil)
+		require.NoError(t, err)
+		require.Len(t, result.Metrics, 1)
+		return result.Metrics[0]
+	}
+
+	metric := collect()
+	assert.Equal(t, 2, metric.RestartCount)
+	assert.InDelta(t, 60, metric.UptimeSeconds, 5)
+	assert.Equal(t, models.HealthUnhealthy, metric.Health, "health is read from the container list")
+
+	// Later cycles reuse the inspected state
+	fd.setRestarts("web", 3)
+	assert.Equal(t, 2, collect().RestartCount)
+	assert.Equal(t, 1, fd.inspected("web"))
+
+	// A start event makes the next cycle inspect the container again
+	fd.sendEvent(t, "start", "web")
+	assert.Eventually(t, func() bool { return collect().RestartCount == 3 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, fd.inspected("web"))
+
+	// The state of containers that are no longer running is dropped
+	fd.remove("web")
+	_, err := ds.CollectContainerMetrics(context.Background(), nil)
+	require.NoError(t, err)
+	fd.add("web", "Up 1 second")
+	collect()
+	assert.Equal(t, 3, fd.inspected("web"))
+}
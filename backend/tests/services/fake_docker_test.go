@@ -0,0 +1,275 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+
+	"github.com/docker/docker/api/types"
+	containertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker serves the parts of the Docker API used by metrics collection
+type fakeDocker struct {
+	mu         sync.Mutex
+	containers []types.Container
+	restarts   map[string]int
+	pids       map[string]int
+	statsDelay map[string]time.Duration
+	statsFail  map[string]bool
+	inspects   map[string]int
+	inFlight   int
+	// maxInFlight is the highest number of concurrent stats calls
+	maxInFlight int
+	events      chan events.Message
+}
+
+// apiPath matches versioned Docker API paths such as /v1.41/containers/json
+var apiPath = regexp.MustCompile(`^/v[0-9.]+(/.*)$`)
+
+// startFakeDocker starts a fake Docker daemon and points DOCKER_HOST at it
+func startFakeDocker(t *testing.T) *fakeDocker {
+	fd := &fakeDocker{
+		restarts:   make(map[string]int),
+		pids:       make(map[string]int),
+		statsDelay: make(map[string]time.Duration),
+		statsFail:  make(map[string]bool),
+		inspects:   make(map[string]int),
+		events:     make(chan events.Message),
+	}
+	server := httptest.NewServer(http.HandlerFunc(fd.serve))
+	t.Cleanup(func() {
+		// The event stream only ends when its connection is closed
+		server.CloseClientConnections()
+		server.Close()
+	})
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+	return fd
+}
+
+// newDockerService creates a Docker service talking to the fake daemon
+func (fd *fakeDocker) newDockerService(t *testing.T, config *models.Config) *services.DockerService {
+	ds, err := services.NewDockerService(config)
+	require.NoError(t, err)
+	return ds
+}
+
+// fakeContainerID returns the full ID of a fake container, whose first 12 characters
+// are the name padded with zeros
+func fakeContainerID(name string) string {
+	return (name + strings.Repeat("0", 64))[:64]
+}
+
+// add lists a running container with the given ContainerList status
+func (fd *fakeDocker) add(name, status string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.containers = append(fd.containers, types.Container{
+		ID:     fakeContainerID(name),
+		Names:  []string{"/" + name},
+		Image:  name + ":latest",
+		State:  "running",
+		Status: status,
+	})
+}
+
+// addScrapeTarget lists a running container on the host network whose Prometheus
+// endpoint is scraped on port
+func (fd *fakeDocker) addScrapeTarget(name string, port int) {
+	fd.add(name, "Up 1 minute")
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	container := &fd.containers[len(fd.containers)-1]
+	container.Labels = map[string]string{services.ScrapePortLabel: strconv.Itoa(port)}
+	container.HostConfig.NetworkMode = "host"
+}
+
+// remove stops listing a container
+func (fd *fakeDocker) remove(name string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	for i, container := range fd.containers {
+		if container.Names[0] == "/"+name {
+			fd.containers = append(fd.containers[:i], fd.containers[i+1:]...)
+			return
+		}
+	}
+}
+
+// inspected returns how many times a container was inspected
+func (fd *fakeDocker) inspected(name string) int {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.inspects[name]
+}
+
+// setRestarts sets the restart count reported by inspect
+func (fd *fakeDocker) setRestarts(name string, count int) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.restarts[name] = count
+}
+
+// setPid sets the PID of a container's init process reported by inspect
+func (fd *fakeDocker) setPid(name string, pid int) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.pids[name] = pid
+}
+
+// setStatsDelay delays the stats responses of a container
+func (fd *fakeDocker) setStatsDelay(name string, delay time.Duration) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.statsDelay[name] = delay
+}
+
+// statsInFlight returns the number of stats calls in progress and the highest number
+// of concurrent stats calls so far
+func (fd *fakeDocker) statsInFlight() (current, max int) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	return fd.inFlight, fd.maxInFlight
+}
+
+// failStats makes the stats calls of a container fail
+func (fd *fakeDocker) failStats(name string) {
+	fd.mu.Lock()
+	defer fd.mu.Unlock()
+	fd.statsFail[name] = true
+}
+
+func (fd *fakeDocker) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("API-Version", "1.41")
+	path := r.URL.Path
+	if match := apiPath.FindStringSubmatch(path); match != nil {
+		path = match[1]
+	}
+
+	switch {
+	case path == "/_ping":
+		fmt.Fprint(w, "OK")
+	case path == "/containers/json":
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		json.NewEncoder(w).Encode(fd.containers)
+	case path == "/events":
+		fd.serveEvents(w, r)
+	case path == "/system/df":
+		fd.mu.Lock()
+		defer fd.mu.Unlock()
+		usage := types.DiskUsage{}
+		for i := range fd.containers {
+			usage.Containers = append(usage.Containers, &fd.containers[i])
+		}
+		json.NewEncoder(w).Encode(usage)
+	case strings.HasSuffix(path, "/stats"):
+		fd.serveStats(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/stats"))
+	case strings.HasSuffix(path, "/json"):
+		fd.serveInspect(w, strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// name returns the name of a fake container from its ID
+func (fd *fakeDocker) name(containerID string) string {
+	return strings.TrimRight(containerID[:12], "0")
+}
+
+func (fd *fakeDocker) serveStats(w http.ResponseWriter, r *http.Request, containerID string) {
+	name := fd.name(containerID)
+	fd.mu.Lock()
+	delay, fail := fd.statsDelay[name], fd.statsFail[name]
+	fd.inFlight++
+	if fd.inFlight > fd.maxInFlight {
+		fd.maxInFlight = fd.inFlight
+	}
+	fd.mu.Unlock()
+	defer func() {
+		fd.mu.Lock()
+		fd.inFlight--
+		fd.mu.Unlock()
+	}()
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+	if fail {
+		http.Error(w, `{"message":"stats unavailable"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var stats types.StatsJSON
+	stats.CPUStats.CPUUsage.TotalUsage = 2e9
+	stats.CPUStats.SystemUsage = 10e9
+	stats.CPUStats.OnlineCPUs = 1
+	stats.PreCPUStats.CPUUsage.TotalUsage = 1e9
+	stats.PreCPUStats.SystemUsage = 5e9
+	stats.MemoryStats.Usage = 64 << 20
+	stats.MemoryStats.Limit = 1 << 30
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (fd *fakeDocker) serveInspect(w http.ResponseWriter, containerID string) {
+	name := fd.name(containerID)
+	fd.mu.Lock()
+	fd.inspects[name]++
+	restarts, pid := fd.restarts[name], fd.pids[name]
+	fd.mu.Unlock()
+
+	json.NewEncoder(w).Encode(types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+		ID:           containerID,
+		Name:         "/" + name,
+		LogPath:      "/" + name + ".log",
+		HostConfig:   &containertypes.HostConfig{LogConfig: containertypes.LogConfig{Type: "json-file"}},
+		RestartCount: restarts,
+		State: &types.ContainerState{
+			Running:   true,
+			Pid:       pid,
+			StartedAt: time.Now().Add(-time.Minute).Format(time.RFC3339Nano),
+		},
+	}})
+}
+
+// serveEvents streams the messages sent on fd.events until the client disconnects
+func (fd *fakeDocker) serveEvents(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case message := <-fd.events:
+			json.NewEncoder(w).Encode(message)
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// sendEvent delivers a container event to the connected event stream
+func (fd *fakeDocker) sendEvent(t *testing.T, action, name string) {
+	select {
+	case fd.events <- events.Message{
+		Type:   events.ContainerEventType,
+		Action: action,
+		Actor:  events.Actor{ID: fakeContainerID(name)},
+	}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no client is following the event stream")
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProcStat(t *testing.T, procRoot, user, idle string) {
+	writeTestFile(t, filepath.Join(procRoot, "stat"),
+		"cpu  "+user+" 0 100 "+idle+" 0 0 0 0 0 0\ncpu0 50 0 50 400 0 0 0 0 0 0\ncpu1 50 0 50 400 0 0 0 0 0 0\nintr 12345\n")
+}
+
+func TestHostService_ReadHostMetric(t *testing.T) {
+	procRoot := t.TempDir()
+	writeProcStat(t, procRoot, "100", "800")
+	writeTestFile(t, filepath.Join(procRoot, "meminfo"), "MemTotal:        4096 kB\nMemFree:         1024 kB\nMemAvailable:    3072 kB\n")
+	writeTestFile(t, filepath.Join(procRoot, "loadavg"), "0.50 1.25 2.00 1/123 4567\n")
+	writeTestFile(t, filepath.Join(procRoot, "sys", "kernel", "hostname"), "docker-host\n")
+	writeTestFile(t, filepath.Join(procRoot, "1", "net", "dev"), `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:     100       1    0    0    0     0          0         0      100       1    0    0    0     0       0          0
+  eth0:    5000      40    0    0    0     0          0         0     3000      30    0    0    0     0       0          0
+docker0:    700       7    0    0    0     0          0         0      900       9    0    0    0     0       0          0
+`)
+
+	config := &models.Config{}
+	config.Metrics.ProcRoot = procRoot
+	config.Host.DockerRoot = t.TempDir()
+	service := services.NewHostService(nil, nil, config)
+
+	metric, err := service.ReadHostMetric()
+	require.NoError(t, err)
+	assert.Equal(t, "docker-host", metric.Hostname)
+	assert.Equal(t, 2, metric.CPUCount)
+	assert.Equal(t, 0.0, metric.CPUPercent)
+	assert.Equal(t, int64(4096*1024), metric.MemoryTotal)
+	assert.Equal(t, int64(1024*1024), metric.MemoryUsed)
+	assert.Equal(t, 0.5, metric.Load1)
+	assert.Equal(t, 1.25, metric.Load5)
+	assert.Equal(t, 2.0, metric.Load15)
+	assert.Equal(t, int64(5000), metric.NetworkRx)
+	assert.Equal(t, int64(3000), metric.NetworkTx)
+	require.Len(t, metric.Interfaces, 1)
+	assert.Equal(t, "eth0", metric.Interfaces[0].Name)
+	assert.Greater(t, metric.DiskTotal, int64(0))
+
+	// 300 more busy and 100 more idle jiffies since the previous sample
+	writeProcStat(t, procRoot, "400", "900")
+	metric, err = service.ReadHostMetric()
+	require.NoError(t, err)
+	assert.InDelta(t, 75.0, metric.CPUPercent, 0.001)
+}
+
+func TestHostService_ReadHostMetric_MissingProc(t *testing.T) {
+	config := &models.Config{}
+	config.Metrics.ProcRoot = t.TempDir()
+	service := services.NewHostService(nil, nil, config)
+
+	_, err := service.ReadHostMetric()
+	assert.Error(t, err)
+}
+
+func TestHostService_CollectAndStoreHostMetrics(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	procRoot := t.TempDir()
+	writeProcStat(t, procRoot, "100", "800")
+	writeTestFile(t, filepath.Join(procRoot, "meminfo"), "MemTotal:        4096 kB\nMemAvailable:    3072 kB\n")
+	writeTestFile(t, filepath.Join(procRoot, "loadavg"), "4.00 1.25 2.00 1/123 4567\n")
+	writeTestFile(t, filepath.Join(procRoot, "sys", "kernel", "hostname"), "docker-host\n")
+	writeTestFile(t, filepath.Join(procRoot, "net", "dev"), "")
+
+	config := &models.Config{}
+	config.Metrics.ProcRoot = procRoot
+	config.Host.DockerRoot = t.TempDir()
+	config.Alerts.Host.MemoryThreshold = 90
+	config.Alerts.Host.LoadThreshold = 1
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	service := services.NewHostService(nil, ms, config)
+
+	// Alerts of disabled checks, and of checks no longer holding, are cleared
+	insertAlert(t, services.HostAlertID, "docker-host", "host_high_cpu", "warning", time.Now().Add(-time.Hour))
+	insertAlert(t, services.HostAlertID, "docker-host", "host_high_memory", "warning", time.Now().Add(-time.Hour))
+	require.NoError(t, service.CollectAndStoreHostMetrics())
+
+	// The load is above its threshold but has not held for a minute yet
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	history, err := service.GetHostMetricsHistory(1)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	// Samples older than the retention are pruned
+	_, err = models.DB.Exec(`UPDATE host_metrics SET timestamp = ?`, time.Now().Add(-48*time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, ms.Prune(time.Now().Add(-24*time.Hour)))
+	var count int
+	require.NoError(t, models.DB.QueryRow(`SELECT COUNT(*) FROM host_metrics`).Scan(&count))
+	assert.Zero(t, count)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idleSamples returns hourly samples of a quiet container over the given number of hours
+func idleSamples(now time.Time, hours int) []models.ContainerMetric {
+	samples := make([]models.ContainerMetric, hours)
+	for i := range samples {
+		samples[i] = models.ContainerMetric{
+			ContainerID: "aaa",
+			Name:        "forgotten",
+			CPUPercent:  0.1,
+			MemoryUsage: 300 << 20,
+			MemoryLimit: 1 << 30,
+			NetworkRx:   10000 + int64(i)*100,
+			Pids:        4,
+			Timestamp:   now.Add(-time.Duration(hours-i) * time.Hour),
+		}
+	}
+	return samples
+}
+
+func TestDetectIdle_WholeWindow(t *testing.T) {
+	now := time.Now()
+	samples := idleSamples(now, 48)
+
+	idle, ok := services.DetectIdle(samples, 1.0, 100, now)
+	require.True(t, ok)
+	assert.True(t, idle.WholeWindow)
+	assert.Equal(t, samples[0].Timestamp, idle.IdleSince)
+	assert.Equal(t, int64(48*3600), idle.IdleSeconds)
+	assert.Equal(t, int64(300<<20), idle.MemoryUsage)
+	assert.InDelta(t, 0.1, idle.CPUPercent, 0.0001)
+}
+
+func TestDetectIdle_LastActivity(t *testing.T) {
+	now := time.Now()
+
+	samples := idleSamples(now, 48)
+	samples[10].CPUPercent = 40
+	idle, ok := services.DetectIdle(samples, 1.0, 100, now)
+	require.True(t, ok)
+	assert.False(t, idle.WholeWindow)
+	assert.Equal(t, samples[10].Timestamp, idle.IdleSince)
+
+	// 1 MB in an hour is well above 100 bytes per second
+	samples = idleSamples(now, 48)
+	samples[20].NetworkTx = 1 << 20
+	for i := 21; i < len(samples); i++ {
+		samples[i].NetworkTx = 1 << 20
+	}
+	idle, ok = services.DetectIdle(samples, 1.0, 100, now)
+	require.True(t, ok)
+	assert.Equal(t, samples[20].Timestamp, idle.IdleSince)
+
+	// A counter reset means the container restarted
+	samples = idleSamples(now, 48)
+	samples[30].NetworkRx = 0
+	idle, ok = services.DetectIdle(samples, 1.0, 100, now)
+	require.True(t, ok)
+	assert.Equal(t, samples[30].Timestamp, idle.IdleSince)
+}
+
+func TestDetectIdle_Active(t *testing.T) {
+	now := time.Now()
+
+	samples := idleSamples(now, 48)
+	samples[47].CPUPercent = 5
+	_, ok := services.DetectIdle(samples, 1.0, 100, now)
+	assert.False(t, ok)
+
+	_, ok = services.DetectIdle(nil, 1.0, 100, now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/notify"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInhibitor(t *testing.T) {
+	inhibitor, err := services.NewInhibitor([]models.InhibitRule{
+		{SourceMatchers: []models.SilenceMatcher{{Field: "type", Value: services.DaemonUnreachableAlert}}},
+		{
+			SourceMatchers: []models.SilenceMatcher{{Field: "type", Value: "high_memory"}},
+			TargetMatchers: []models.SilenceMatcher{{Field: "type", Value: "high_cpu"}},
+			Equal:          []string{"compose_project"},
+		},
+	})
+	require.NoError(t, err)
+
+	shop := map[string]string{"com.docker.compose.project": "shop"}
+	blog := map[string]string{"com.docker.compose.project": "blog"}
+	cpu := services.AlertTarget{Name: "web", Type: "high_cpu", Labels: shop}
+	daemon := services.AlertTarget{Name: "host", Type: services.DaemonUnreachableAlert}
+
+	assert.False(t, inhibitor.Inhibited(cpu, nil))
+	assert.True(t, inhibitor.Inhibited(cpu, []services.AlertTarget{daemon}))
+	assert.False(t, inhibitor.Inhibited(daemon, nil))
+
+	// Equal keys must have the same values on both alerts
+	assert.True(t, inhibitor.Inhibited(cpu, []services.AlertTarget{{Name: "db", Type: "high_memory", Labels: shop}}))
+	assert.False(t, inhibitor.Inhibited(cpu, []services.AlertTarget{{Name: "db", Type: "high_memory", Labels: blog}}))
+	assert.False(t, inhibitor.Inhibited(services.AlertTarget{Name: "web", Type: "high_pids", Labels: shop},
+		[]services.AlertTarget{{Name: "db", Type: "high_memory", Labels: shop}}))
+
+	_, err = services.NewInhibitor([]models.InhibitRule{{TargetMatchers: []models.SilenceMatcher{{Field: "type", Value: "x"}}}})
+	assert.Error(t, err)
+	_, err = services.NewInhibitor([]models.InhibitRule{{
+		SourceMatchers: []models.SilenceMatcher{{Field: "type", Value: "x"}},
+		Equal:          []string{"project"},
+	}})
+	assert.Error(t, err)
+}
+
+func TestAlertTargetKeysAndFingerprint(t *testing.T) {
+	target := services.AlertTarget{
+		Name:   "shop_web_1",
+		Host:   "node1",
+		Labels: map[string]string{"com.docker.compose.project": "shop", "com.docker.compose.service": "web", "team": "payments"},
+	}
+	assert.Equal(t, "shop", target.Key("compose_project"))
+	assert.Equal(t, "web", target.Key("compose_service"))
+	assert.Equal(t, "node1", target.Key("host"))
+	assert.Equal(t, "payments", target.Key("label:team"))
+
+	a := services.AlertFingerprint(models.Alert{ContainerID: "aaa", Name: "web", Type: "high_cpu"})
+	b := services.AlertFingerprint(models.Alert{ContainerID: "bbb", Name: "web", Type: "high_cpu", Message: "other"})
+	c := services.AlertFingerprint(models.Alert{ContainerID: "aaa", Name: "web", Type: "high_memory"})
+	assert.Equal(t, a, b, "fingerprints survive the container being recreated")
+	assert.NotEqual(t, a, c)
+	assert.Len(t, a, 16)
+}
+
+// recordingChannel records the notifications sent to it
+type recordingChannel struct {
+	mu   sync.Mutex
+	sent []notify.Notification
+}
+
+func (rc *recordingChannel) Send(ctx context.Context, notification notify.Notification) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.sent = append(rc.sent, notification)
+	return nil
+}
+
+func TestMetricsService_DaemonUnreachableAlert(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "missing.sock"))
+
+	config := &models.Config{}
+	dockerService, err := services.NewDockerService(config)
+	require.NoError(t, err)
+
+	channel := &recordingChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", channel, nil, ""))
+	dispatcher.Start()
+
+	ms := services.NewMetricsService(dockerService, storage.NewRowStore(), config)
+	require.NoError(t, ms.SetNotifier(dispatcher))
+
+	// Repeated failures raise a single alert, deduplicated by fingerprint
+	assert.Error(t, ms.CollectAndStoreMetrics())
+	assert.Error(t, ms.CollectAndStoreMetrics())
+	dispatcher.Close()
+
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, services.DaemonUnreachableAlert, alerts[0].Type)
+	assert.Equal(t, "critical", alerts[0].Severity)
+	assert.NotEmpty(t, alerts[0].Fingerprint)
+
+	require.Len(t, channel.sent, 1)
+	assert.Equal(t, alerts[0].Fingerprint, channel.sent[0].Fingerprint)
+}
+
+func TestMetricsService_SetNotifierValidation(t *testing.T) {
+	config := &models.Config{}
+	config.Alerts.Grouping.By = []string{"project"}
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	assert.Error(t, ms.SetNotifier(nil))
+
+	config.Alerts.Grouping.By = []string{"compose_project", "label:team"}
+	assert.NoError(t, ms.SetNotifier(nil))
+}
+
+func TestMetricsService_InhibitsAlertsFiringBeforeTheSource(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "missing.sock"))
+
+	config := &models.Config{}
+	config.Alerts.InhibitRules = []models.InhibitRule{
+		{SourceMatchers: []models.SilenceMatcher{{Field: "type", Value: services.DaemonUnreachableAlert}}},
+	}
+	config.Alerts.Escalation.Tiers = []models.EscalationTier{{After: 60, Severity: "critical"}}
+	dockerService, err := services.NewDockerService(config)
+	require.NoError(t, err)
+
+	channel := &recordingChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", channel, nil, ""))
+	dispatcher.Start()
+
+	ms := services.NewMetricsService(dockerService, storage.NewRowStore(), config)
+	require.NoError(t, ms.SetNotifier(dispatcher))
+	as := services.NewAlertService(ms, config)
+
+	// The container alert fired before the daemon became unreachable
+	cpu := insertAlert(t, "aaa", "web", "high_cpu", "warning", time.Now().Add(-10*time.Minute))
+	assert.Error(t, ms.CollectAndStoreMetrics())
+
+	require.NoError(t, as.Escalate(time.Now()))
+	_, err = as.Resolve(cpu, "alice", "")
+	require.NoError(t, err)
+	dispatcher.Close()
+
+	// Only the daemon alert itself is notified
+	require.Len(t, channel.sent, 1)
+	assert.Equal(t, services.DaemonUnreachableAlert, channel.sent[0].Type)
+}
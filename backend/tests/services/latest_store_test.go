@@ -0,0 +1,213 @@
+package services
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestStore(t *testing.T) {
+	store := services.NewLatestStore()
+	now := time.Now()
+
+	store.Update([]models.ContainerMetric{
+		{ContainerID: "bbb", Name: "web", CPUPercent: 10, Timestamp: now},
+		{ContainerID: "aaa", Name: "db", CPUPercent: 5, Timestamp: now},
+	})
+	// An older sample arriving late must not replace a newer one
+	store.Update([]models.ContainerMetric{{ContainerID: "bbb", Name: "web", CPUPercent: 99, Timestamp: now.Add(-time.Minute)}})
+
+	all := store.All()
+	require.Len(t, all, 2)
+	assert.Equal(t, "db", all[0].Name)
+	assert.Equal(t, 10.0, all[1].CPUPercent)
+
+	store.Retain(map[string]bool{"bbb": true})
+	_, ok := store.Get("aaa")
+	assert.False(t, ok)
+	metric, ok := store.Get("bbb")
+	assert.True(t, ok)
+	assert.Equal(t, "web", metric.Name)
+}
+
+func TestLatestStore_Concurrent(t *testing.T) {
+	store := services.NewLatestStore()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				store.Update([]models.ContainerMetric{{ContainerID: "aaa", Timestamp: time.Now()}})
+				store.All()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, store.All(), 1)
+}
+
+func TestMetricsService_LatestMetricsListRunningContainers(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("web", "Up 1 minute")
+	fd.add("db", "Up 1 minute")
+	config := &models.Config{}
+	ms := services.NewMetricsService(fd.newDockerService(t, config), storage.NewRowStore(), config)
+	require.NoError(t, ms.CollectAndStoreMetrics())
+
+	latest, err := ms.GetLatestMetrics()
+	require.NoError(t, err)
+	assert.Len(t, latest, 2)
+
+	// Unlike the correlated subquery it replaced, the latest metrics leave out stopped
+	// containers; their samples stay in the history
+	fd.remove("db")
+	require.NoError(t, ms.CollectAndStoreMetrics())
+	latest, err = ms.GetLatestMetrics()
+	require.NoError(t, err)
+	require.Len(t, latest, 1)
+	assert.Equal(t, "web", latest[0].Name)
+
+	history, err := ms.GetMetricsHistory(fakeContainerID("db")[:12], 1)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+}
+
+const (
+	benchmarkContainers = 100
+	benchmarkRows       = 1000000
+)
+
+// legacyLatestQuery is the correlated subquery GetLatestMetrics used to run per request
+const legacyLatestQuery = `SELECT DISTINCT
+	container_id, name, cpu_percent, memory_usage, memory_limit,
+	network_rx, network_tx, block_read, block_write, pids,
+	restart_count, uptime_seconds, health, status, timestamp
+	FROM container_metrics cm1
+	WHERE timestamp = (
+		SELECT MAX(timestamp)
+		FROM container_metrics cm2
+		WHERE cm2.container_id = cm1.container_id
+	)
+	ORDER BY name`
+
+// benchmarkDBs holds the filled benchmark databases, with and without the
+// container_metrics indexes
+var benchmarkDBs = make(map[bool]*sql.DB)
+
+// benchmarkDirs holds the directories of the benchmark databases, removed by TestMain
+var benchmarkDirs []string
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	for _, db := range benchmarkDBs {
+		db.Close()
+	}
+	for _, dir := range benchmarkDirs {
+		os.RemoveAll(dir)
+	}
+	os.Exit(code)
+}
+
+// setupBenchmarkDB opens a database with benchmarkRows samples across
+// benchmarkContainers containers.
+// The unindexed database has no indexes on container_metrics, as when GetLatestMetrics
+// ran the correlated subquery.
+func setupBenchmarkDB(b *testing.B, unindexed bool) {
+	if db, ok := benchmarkDBs[unindexed]; ok {
+		models.DB = db
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "nabd-bench")
+	require.NoError(b, err)
+	benchmarkDirs = append(benchmarkDirs, dir)
+	require.NoError(b, utils.InitDatabase(filepath.Join(dir, "nabd.db")))
+	if unindexed {
+		for _, index := range []string{"idx_container_metrics_container", "idx_container_metrics_timestamp"} {
+			_, err := models.DB.Exec(`DROP INDEX ` + index)
+			require.NoError(b, err)
+		}
+	}
+
+	_, err = models.DB.Exec(`WITH RECURSIVE seq(n) AS (
+			SELECT 0 UNION ALL SELECT n + 1 FROM seq WHERE n < ? - 1
+		)
+		INSERT INTO container_metrics (container_id, name, cpu_percent, memory_usage, memory_limit,
+			network_rx, network_tx, status, timestamp)
+		SELECT printf('c%011d', n % ?), printf('container-%d', n % ?), n % 100, n, 1073741824,
+			n * 10, n * 5, 'running', datetime('2024-01-01', '+' || (n / ? * 15) || ' seconds')
+		FROM seq`, benchmarkRows, benchmarkContainers, benchmarkContainers, benchmarkContainers)
+	require.NoError(b, err)
+	benchmarkDBs[unindexed] = models.DB
+}
+
+// queryLatestMetrics runs the legacy per-request query
+func queryLatestMetrics(b *testing.B) []models.ContainerMetric {
+	rows, err := models.DB.Query(legacyLatestQuery)
+	require.NoError(b, err)
+	defer rows.Close()
+
+	var metrics []models.ContainerMetric
+	for rows.Next() {
+		var metric models.ContainerMetric
+		require.NoError(b, rows.Scan(&metric.ContainerID, &metric.Name, &metric.CPUPercent, &metric.MemoryUsage,
+			&metric.MemoryLimit, &metric.NetworkRx, &metric.NetworkTx, &metric.BlockRead, &metric.BlockWrite,
+			&metric.Pids, &metric.RestartCount, &metric.UptimeSeconds, &metric.Health, &metric.Status, &metric.Timestamp))
+		metrics = append(metrics, metric)
+	}
+	require.NoError(b, rows.Err())
+	return metrics
+}
+
+// BenchmarkLatestMetrics_CorrelatedSubquery runs the legacy query on the indexed
+// schema, where each row's subquery is an index search
+func BenchmarkLatestMetrics_CorrelatedSubquery(b *testing.B) {
+	setupBenchmarkDB(b, false)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		require.Len(b, queryLatestMetrics(b), benchmarkContainers)
+	}
+}
+
+// BenchmarkLatestMetrics_CorrelatedSubqueryUnindexed runs the legacy query on the schema
+// without indexes. Each row's subquery scans the table, so the cost grows with the
+// square of the row count (about 80s for 40,000 rows) and a single query over 1M rows
+// takes hours; it only runs with NABD_BENCH_UNINDEXED=1 and -benchtime=1x.
+func BenchmarkLatestMetrics_CorrelatedSubqueryUnindexed(b *testing.B) {
+	if os.Getenv("NABD_BENCH_UNINDEXED") == "" {
+		b.Skip("set NABD_BENCH_UNINDEXED=1 to run the legacy query without indexes")
+	}
+	setupBenchmarkDB(b, true)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		require.Len(b, queryLatestMetrics(b), benchmarkContainers)
+	}
+}
+
+func BenchmarkLatestMetrics_Store(b *testing.B) {
+	setupBenchmarkDB(b, false)
+	store := services.NewLatestStore()
+	store.Update(queryLatestMetrics(b))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		require.Len(b, store.All(), benchmarkContainers)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mb = 1024 * 1024
+
+func memorySeries(start time.Time, count int, step time.Duration, usage func(i int) int64, limit int64) []models.ContainerMetric {
+	samples := make([]models.ContainerMetric, count)
+	for i := range samples {
+		samples[i] = models.ContainerMetric{
+			ContainerID: "leaky",
+			Name:        "leaky-app",
+			MemoryUsage: usage(i),
+			MemoryLimit: limit,
+			Timestamp:   start.Add(time.Duration(i) * step),
+		}
+	}
+	return samples
+}
+
+func TestForecastMemory_SteadyGrowth(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	// 10 MB per hour over 6 hours, from 100 MB to 160 MB, with a 200 MB limit
+	samples := memorySeries(now.Add(-6*time.Hour), 25, 15*time.Minute, func(i int) int64 {
+		return int64(100*mb + i*mb*10/4)
+	}, 200*mb)
+
+	forecast := services.ForecastMemory(samples, 20, 0.8, 24*time.Hour, now)
+
+	assert.Equal(t, "leaky-app", forecast.Name)
+	assert.Equal(t, 25, forecast.Samples)
+	assert.InDelta(t, 10*mb, forecast.GrowthBytesPerHour, 1)
+	assert.InDelta(t, 1.0, forecast.R2, 1e-9)
+	require.NotNil(t, forecast.HoursToLimit)
+	assert.InDelta(t, 4.0, *forecast.HoursToLimit, 1e-6)
+	assert.Equal(t, now.Add(4*time.Hour), forecast.ProjectedOOMAt.Round(time.Second))
+	assert.True(t, forecast.LeakSuspected)
+}
+
+func TestForecastMemory_BeyondHorizon(t *testing.T) {
+	now := time.Now()
+	// 1 MB per hour with 1 GB of headroom is weeks away
+	samples := memorySeries(now.Add(-6*time.Hour), 25, 15*time.Minute, func(i int) int64 {
+		return int64(100*mb + i*mb/4)
+	}, 1124*mb)
+
+	forecast := services.ForecastMemory(samples, 20, 0.8, 24*time.Hour, now)
+
+	require.NotNil(t, forecast.HoursToLimit)
+	assert.Greater(t, *forecast.HoursToLimit, 24.0)
+	assert.False(t, forecast.LeakSuspected)
+}
+
+func TestForecastMemory_NoisyOrFlat(t *testing.T) {
+	now := time.Now()
+	flat := memorySeries(now.Add(-6*time.Hour), 25, 15*time.Minute, func(i int) int64 {
+		return int64(150 * mb)
+	}, 200*mb)
+	forecast := services.ForecastMemory(flat, 20, 0.8, 24*time.Hour, now)
+	assert.Nil(t, forecast.HoursToLimit)
+	assert.False(t, forecast.LeakSuspected)
+
+	// Sawtooth usage (e.g. a garbage-collected heap) has a poor linear fit
+	noisy := memorySeries(now.Add(-6*time.Hour), 25, 15*time.Minute, func(i int) int64 {
+		return int64(100*mb + (i%5)*20*mb + i*mb/10)
+	}, 200*mb)
+	forecast = services.ForecastMemory(noisy, 20, 0.8, 24*time.Hour, now)
+	assert.Less(t, forecast.R2, 0.8)
+	assert.False(t, forecast.LeakSuspected)
+}
+
+func TestForecastMemory_TooFewSamples(t *testing.T) {
+	now := time.Now()
+	samples := memorySeries(now.Add(-time.Hour), 5, 15*time.Minute, func(i int) int64 {
+		return int64(100*mb + i*10*mb)
+	}, 200*mb)
+
+	forecast := services.ForecastMemory(samples, 20, 0.8, 24*time.Hour, now)
+
+	assert.Equal(t, 5, forecast.Samples)
+	assert.Nil(t, forecast.HoursToLimit)
+	assert.False(t, forecast.LeakSuspected)
+}
+
+func TestLeakService_ForecastsDoNotRaiseAlerts(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	fd := startFakeDocker(t)
+	fd.add("leaky-app", "Up 5 hours")
+	store := storage.NewRowStore()
+	config := &models.Config{}
+	ms := services.NewMetricsService(fd.newDockerService(t, config), store, config)
+	ls := services.NewLeakService(ms, config)
+
+	_, err := ls.GetForecasts()
+	assert.ErrorIs(t, err, services.ErrLeakDetectionDisabled)
+
+	config.Alerts.MemoryLeak.Enabled = true
+	now := time.Now()
+	growing := func(i int) int64 { return int64(100*mb + i*mb*10/6) }
+	running := memorySeries(now.Add(-5*time.Hour), 25, 10*time.Minute, growing, 200*mb)
+	removed := memorySeries(now.Add(-5*time.Hour), 25, 10*time.Minute, growing, 200*mb)
+	for i := range running {
+		running[i].ContainerID = fakeContainerID("leaky-app")[:12]
+		removed[i].ContainerID = "removed"
+		removed[i].Name = "removed-app"
+	}
+	require.NoError(t, store.Append(running))
+	require.NoError(t, store.Append(removed))
+
+	forecasts, err := ls.GetForecasts()
+	require.NoError(t, err)
+	require.Len(t, forecasts, 2)
+	assert.True(t, forecasts[0].LeakSuspected)
+	assert.True(t, forecasts[1].LeakSuspected)
+
+	// Reading forecasts leaves alerting to the periodic analysis
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	_, err = ls.AnalyzeMemoryTrends()
+	require.NoError(t, err)
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1, "containers that are no longer running do not alert")
+	assert.Equal(t, "memory_leak_suspected", alerts[0].Type)
+	assert.Equal(t, "leaky-app", alerts[0].Name)
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogService_RaisesAndResolvesAlerts(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	config.Alerts.LogRules = []models.LogRule{
+		{
+			Name:     "connection_refused",
+			Selector: models.RuleSelector{Name: "api-*"},
+			Pattern:  `connection refused`,
+			Count:    3,
+			Window:   60,
+			Severity: "critical",
+		},
+		{Name: "panic", Pattern: `^panic:`},
+	}
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	ls, err := services.NewLogService(nil, ms, config)
+	require.NoError(t, err)
+
+	api := services.LogContainer{ID: "aaa", Name: "api-1"}
+	worker := services.LogContainer{ID: "bbb", Name: "worker"}
+	now := time.Now()
+
+	// Matches outside the window do not count towards the rule's count
+	ls.Observe(api, "dial tcp: connection refused", now.Add(-2*time.Minute))
+	ls.Observe(api, "dial tcp: connection refused", now.Add(-20*time.Second))
+	ls.Observe(api, "GET /health 200", now.Add(-10*time.Second))
+	ls.Observe(worker, "dial tcp: connection refused", now.Add(-10*time.Second))
+	ls.Observe(api, "dial tcp: connection refused", now.Add(-5*time.Second))
+
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	ls.Observe(api, "redis: connection refused", now)
+	ls.Observe(worker, "panic: runtime error: index out of range", now)
+
+	// Fired alerts are stored by the next evaluation, not while reading logs
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+	require.NoError(t, ls.Evaluate(now))
+
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	byType := map[string]models.Alert{}
+	for _, alert := range alerts {
+		byType[alert.Type] = alert
+	}
+
+	// Log alert types are namespaced apart from metric rules
+	refused := byType["log:connection_refused"]
+	assert.Equal(t, "api-1", refused.Name)
+	assert.Equal(t, "critical", refused.Severity)
+	assert.Equal(t, 3.0, refused.Value)
+	assert.Equal(t, 3.0, refused.Threshold)
+	assert.Contains(t, refused.Message, "redis: connection refused")
+	assert.NotContains(t, refused.Message, "GET /health")
+
+	// Defaults: a single match within 5 minutes raises a warning
+	assert.Equal(t, "warning", byType["log:panic"].Severity)
+	assert.Contains(t, byType["log:panic"].Message, "index out of range")
+
+	// Alerts resolve once the matches leave the window
+	require.NoError(t, ls.Evaluate(now.Add(50*time.Second)))
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "log:panic", alerts[0].Type)
+
+	require.NoError(t, ls.Evaluate(now.Add(10*time.Minute)))
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+}
+
+func TestNewLogService_Validation(t *testing.T) {
+	invalid := []models.LogRule{
+		{Name: "missing_pattern"},
+		{Name: "bad pattern", Pattern: "x"},
+		{Name: "bad_regex", Pattern: "("},
+		{Name: "bad_severity", Pattern: "x", Severity: "page"},
+		{Name: "bad_selector", Pattern: "x", Selector: models.RuleSelector{Name: "["}},
+	}
+	for _, rule := range invalid {
+		config := &models.Config{}
+		config.Alerts.LogRules = []models.LogRule{rule}
+		_, err := services.NewLogService(nil, nil, config)
+		assert.Error(t, err, rule.Name)
+	}
+
+	config := &models.Config{}
+	config.Alerts.LogRules = []models.LogRule{{Name: "a", Pattern: "x"}, {Name: "a", Pattern: "y"}}
+	_, err := services.NewLogService(nil, nil, config)
+	assert.Error(t, err)
+}
@@ -1,15 +1,19 @@
 package services
 
 import (
+	"path/filepath"
 	"testing"
 	"time"
 
 	"nabd/interfaces"
 	"nabd/models"
 	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 type MockDockerService struct {
@@ -44,7 +48,7 @@ func TestNewMetricsService(t *testing.T) {
 	config.Alerts.MemoryThreshold = 85.0
 	config.Alerts.RestartLimit = 3
 	
-	service := services.NewMetricsService(nil, config)
+	service := services.NewMetricsService(nil, storage.NewRowStore(), config)
 	assert.NotNil(t, service)
 }
 
@@ -208,4 +212,75 @@ func (ms *metricsServiceTestWrapper) GetActiveAlerts() []models.Alert {
 			Timestamp:   time.Now(),
 		},
 	}
+}
+
+func TestMetricsService_GetTopContainers(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	now := time.Now()
+	insert := func(id, name string, cpu float64, rx int64, at time.Time) {
+		_, err := models.DB.Exec(`INSERT INTO container_metrics (container_id, name, cpu_percent, memory_usage,
+			memory_limit, network_rx, network_tx, status, timestamp) VALUES (?, ?, ?, 0, 0, ?, 0, 'running', ?)`,
+			id, name, cpu, rx, at)
+		require.NoError(t, err)
+	}
+	insert("aaa", "web", 10, 1000, now.Add(-30*time.Minute))
+	insert("aaa", "web", 30, 4600, now.Add(-time.Minute))
+	insert("bbb", "db", 50, 0, now.Add(-time.Minute))
+	insert("ccc", "old", 99, 0, now.Add(-2*time.Hour))
+
+	config := &models.Config{}
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+
+	top, err := ms.GetTopContainers("cpu", 10, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, "db", top[0].Name)
+	assert.Equal(t, "web", top[1].Name)
+	assert.Equal(t, 20.0, top[1].Value)
+	assert.Equal(t, 30.0, top[1].Peak)
+	assert.Equal(t, 2, top[1].Samples)
+
+	top, err = ms.GetTopContainers("network_rx", 1, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	assert.Equal(t, "web", top[0].Name)
+	assert.Equal(t, 3600.0, top[0].Value)
+	assert.Equal(t, 1.0, top[0].Rate)
+
+	_, err = ms.GetTopContainers("disk", 10, time.Hour)
+	assert.ErrorIs(t, err, services.ErrUnknownTopMetric)
+
+	// Windows are bounded by 30 days and by the retention period
+	_, err = ms.GetTopContainers("cpu", 10, 87600*time.Hour)
+	assert.ErrorIs(t, err, services.ErrInvalidTopWindow)
+	config.Storage.RetentionDays = 7
+	_, err = ms.GetTopContainers("cpu", 10, 8*24*time.Hour)
+	assert.ErrorIs(t, err, services.ErrInvalidTopWindow)
+	_, err = ms.GetTopContainers("cpu", 10, 7*24*time.Hour)
+	assert.NoError(t, err)
+}
+
+func TestRankUnhealthy(t *testing.T) {
+	containers := []models.ContainerInfo{
+		{ID: "aaa", Name: "web", State: "running"},
+		{ID: "bbb", Name: "worker", State: "restarting"},
+		{ID: "ccc", Name: "db", State: "running"},
+		{ID: "ddd", Name: "batch", State: "exited"},
+	}
+	latest := []models.ContainerMetric{
+		{ContainerID: "aaa", Health: models.HealthUnhealthy, RestartCount: 2},
+		{ContainerID: "ccc", Health: models.HealthHealthy},
+	}
+	alerts := []models.Alert{{ContainerID: "aaa"}, {ContainerID: "bbb"}}
+
+	ranked := services.RankUnhealthy(containers, latest, alerts, 5)
+
+	require.Len(t, ranked, 2)
+	assert.Equal(t, "web", ranked[0].Name)
+	assert.Equal(t, 9, ranked[0].Score)
+	assert.Equal(t, []string{"health check failing", "restarted 2 times", "1 active alerts"}, ranked[0].Reasons)
+	assert.Equal(t, "worker", ranked[1].Name)
+	assert.Equal(t, 7, ranked[1].Score)
+
+	assert.Len(t, services.RankUnhealthy(containers, latest, alerts, 1), 1)
 }
\ No newline at end of file
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+// usageSamples returns hourly samples over the given number of days with memory and
+// CPU cycling through the given values
+func usageSamples(days int, memory []int64, cpu []float64) []models.ContainerMetric {
+	start := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+	samples := make([]models.ContainerMetric, days*24+1)
+	for i := range samples {
+		samples[i] = models.ContainerMetric{
+			ContainerID: "aaa",
+			Name:        "api",
+			MemoryUsage: memory[i%len(memory)],
+			CPUPercent:  cpu[i%len(cpu)],
+			Timestamp:   start.Add(time.Duration(i) * time.Hour),
+		}
+	}
+	return samples
+}
+
+func TestRecommendLimits_NoLimits(t *testing.T) {
+	samples := usageSamples(10, []int64{100 << 20, 120 << 20, 200 << 20}, []float64{10, 20, 50})
+
+	recommendation := services.RecommendLimits(samples, 0, 0, 20)
+
+	assert.Equal(t, "high", recommendation.Confidence)
+	assert.Equal(t, len(samples), recommendation.Samples)
+	assert.InDelta(t, 10.0, recommendation.HistoryDays, 0.01)
+
+	assert.Equal(t, models.RecommendSetLimit, recommendation.Memory.Action)
+	assert.Equal(t, float64(200<<20), recommendation.Memory.Peak)
+	// p99 of 200 MiB plus 20% is 240 MiB, a multiple of the 8 MiB step
+	assert.Equal(t, float64(240<<20), recommendation.Memory.Suggested)
+
+	assert.Equal(t, models.RecommendSetLimit, recommendation.CPU.Action)
+	assert.InDelta(t, 0.5, recommendation.CPU.P95, 1e-9)
+	assert.InDelta(t, 0.6, recommendation.CPU.Suggested, 1e-9)
+}
+
+func TestRecommendLimits_Actions(t *testing.T) {
+	samples := usageSamples(2, []int64{100 << 20}, []float64{150})
+
+	recommendation := services.RecommendLimits(samples, 1<<30, 1, 20)
+	assert.Equal(t, "medium", recommendation.Confidence)
+	assert.Equal(t, models.RecommendDecrease, recommendation.Memory.Action)
+	assert.Equal(t, float64(120<<20), recommendation.Memory.Suggested)
+	assert.Equal(t, models.RecommendIncrease, recommendation.CPU.Action)
+	assert.InDelta(t, 1.8, recommendation.CPU.Suggested, 1e-9)
+
+	recommendation = services.RecommendLimits(samples, 128<<20, 2, 20)
+	assert.Equal(t, models.RecommendKeep, recommendation.Memory.Action)
+	assert.Equal(t, models.RecommendKeep, recommendation.CPU.Action)
+
+	recommendation = services.RecommendLimits(samples[:5], 128<<20, 2, 20)
+	assert.Equal(t, "low", recommendation.Confidence)
+}
+
+func TestContainerLimits(t *testing.T) {
+	info := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{HostConfig: &container.HostConfig{}}}
+	info.HostConfig.Memory = 512 << 20
+	info.HostConfig.NanoCPUs = 1500000000
+
+	memory, cpus := services.ContainerLimits(info)
+	assert.Equal(t, int64(512<<20), memory)
+	assert.Equal(t, 1.5, cpus)
+
+	info.HostConfig.NanoCPUs = 0
+	info.HostConfig.CPUQuota = 50000
+	_, cpus = services.ContainerLimits(info)
+	assert.Equal(t, 0.5, cpus)
+
+	info.HostConfig.CPUQuota = 0
+	_, cpus = services.ContainerLimits(info)
+	assert.Zero(t, cpus)
+}
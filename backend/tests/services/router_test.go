@@ -0,0 +1,141 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/notify"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routingConfig routes the payments team to its own channel and policy and everything
+// else to ops
+func routingConfig() *models.Config {
+	config := &models.Config{}
+	config.Routing.Ownership = []models.OwnershipRule{
+		{Container: "payments-*", Team: "payments"},
+		{Container: "*", Team: "platform"},
+	}
+	config.Routing.Routes = []models.Route{
+		{Team: "payments", Matchers: []models.SilenceMatcher{{Field: "type", Value: "autoheal"}}, Channels: []string{"payments-chat"}},
+		{Team: "payments", Channels: []string{"payments-chat"}, Policy: "payments-oncall"},
+	}
+	config.Routing.Fallback = []string{"ops"}
+	config.Routing.Policies = []models.EscalationPolicy{{
+		Name: "payments-oncall",
+		Steps: []models.PolicyStep{
+			{After: 0, Channels: []string{"payments-primary"}},
+			{After: 900, Channels: []string{"payments-secondary"}},
+		},
+	}}
+	return config
+}
+
+func TestRouter(t *testing.T) {
+	router, err := services.NewRouter(routingConfig(), nil)
+	require.NoError(t, err)
+	assert.True(t, router.Enabled())
+
+	// Labels take precedence over the ownership rules
+	assert.Equal(t, "payments", router.Owner("payments-api", nil))
+	assert.Equal(t, "platform", router.Owner("proxy", nil))
+	assert.Equal(t, "search", router.Owner("payments-api", map[string]string{"nabd.owner": "search", "team": "other"}))
+	assert.Equal(t, "other", router.Owner("proxy", map[string]string{"team": "other"}))
+
+	payments := services.AlertTarget{Name: "payments-api", Type: "high_cpu", Team: "payments"}
+	assert.Equal(t, 1, router.InitialSteps(payments))
+	assert.Equal(t, []string{"payments-chat", "payments-primary"}, router.Channels(payments, 1))
+	assert.Equal(t, []string{"payments-chat", "payments-primary", "payments-secondary"}, router.Channels(payments, 2))
+
+	autoheal := services.AlertTarget{Name: "payments-api", Type: "autoheal", Team: "payments"}
+	assert.Equal(t, []string{"payments-chat"}, router.Channels(autoheal, 0))
+
+	platform := services.AlertTarget{Name: "proxy", Type: "high_cpu", Team: "platform"}
+	assert.Zero(t, router.InitialSteps(platform))
+	assert.Equal(t, []string{"ops"}, router.Channels(platform, 0))
+
+	// Without routes every channel is notified
+	disabled, err := services.NewRouter(&models.Config{}, nil)
+	require.NoError(t, err)
+	assert.False(t, disabled.Enabled())
+	assert.Nil(t, disabled.Channels(payments, 0))
+}
+
+func TestRouterValidation(t *testing.T) {
+	invalid := map[string]func(config *models.Config){
+		"ownership without team": func(config *models.Config) { config.Routing.Ownership[0].Team = "" },
+		"invalid pattern":        func(config *models.Config) { config.Routing.Ownership[0].Container = "[" },
+		"unknown policy":         func(config *models.Config) { config.Routing.Routes[1].Policy = "missing" },
+		"route without channels": func(config *models.Config) { config.Routing.Routes[0].Channels = nil },
+		"unknown matcher field":  func(config *models.Config) { config.Routing.Routes[0].Matchers[0].Field = "owner" },
+		"steps out of order":     func(config *models.Config) { config.Routing.Policies[0].Steps[1].After = 0 },
+		"duplicate policy": func(config *models.Config) {
+			config.Routing.Policies = append(config.Routing.Policies, config.Routing.Policies[0])
+		},
+	}
+	for name, change := range invalid {
+		config := routingConfig()
+		change(config)
+		_, err := services.NewRouter(config, nil)
+		assert.Error(t, err, name)
+	}
+
+	known := map[string]bool{"ops": true, "payments-chat": true, "payments-primary": true}
+	_, err := services.NewRouter(routingConfig(), func(name string) bool { return known[name] })
+	assert.ErrorContains(t, err, "payments-secondary")
+}
+
+func TestAlertService_NotifyUnacknowledged(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := routingConfig()
+	config.Notifications.Enabled = true
+
+	channels := make(map[string]*recordingChannel)
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	for _, name := range []string{"ops", "payments-chat", "payments-primary", "payments-secondary"} {
+		channels[name] = &recordingChannel{}
+		require.NoError(t, dispatcher.AddChannel(name, channels[name], nil, ""))
+	}
+	dispatcher.Start()
+
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	require.NoError(t, ms.SetNotifier(dispatcher))
+	as := services.NewAlertService(ms, config)
+
+	now := time.Now()
+	unacknowledged := insertAlert(t, "aaa", "payments-api", "high_cpu", "critical", now.Add(-20*time.Minute))
+	recent := insertAlert(t, "bbb", "payments-worker", "high_cpu", "critical", now.Add(-time.Minute))
+	acknowledged := insertAlert(t, "ccc", "payments-db", "high_memory", "critical", now.Add(-30*time.Minute))
+	insertAlert(t, "ddd", "proxy", "high_cpu", "critical", now.Add(-time.Hour))
+	_, err := as.Acknowledge(acknowledged, "alice", "")
+	require.NoError(t, err)
+
+	require.NoError(t, as.NotifyUnacknowledged(now))
+	// Steps already notified are not notified again
+	require.NoError(t, as.NotifyUnacknowledged(now.Add(time.Minute)))
+	dispatcher.Close()
+
+	alert, err := as.GetAlert(unacknowledged)
+	require.NoError(t, err)
+	assert.Equal(t, 2, alert.PolicyStep)
+	alert, err = as.GetAlert(recent)
+	require.NoError(t, err)
+	assert.Equal(t, 1, alert.PolicyStep)
+	alert, err = as.GetAlert(acknowledged)
+	require.NoError(t, err)
+	assert.Zero(t, alert.PolicyStep)
+
+	// Alerts stored before the policy get every due step at once
+	assert.Len(t, channels["payments-primary"].sent, 2)
+	require.Len(t, channels["payments-secondary"].sent, 1)
+	assert.Equal(t, "[UNACKNOWLEDGED:CRITICAL] high_cpu on payments-api", channels["payments-secondary"].sent[0].Title)
+	assert.Empty(t, channels["payments-chat"].sent)
+	assert.Empty(t, channels["ops"].sent)
+}
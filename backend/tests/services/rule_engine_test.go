@@ -0,0 +1,353 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+// cpuRule fires when CPU stays above 80% for a minute and resolves below 70%
+func cpuRule() models.AlertRule {
+	return models.AlertRule{
+		Name:             "busy",
+		Metric:           "cpu_percent",
+		Comparator:       ">",
+		Threshold:        80,
+		For:              60,
+		ResolveThreshold: float64Ptr(70),
+		Message:          `{{.Name}} CPU at {{printf "%.0f" .Value}}%`,
+	}
+}
+
+// evaluateCPU evaluates samples 15 seconds apart and returns whether the rule fired after each
+func evaluateCPU(engine *services.RuleEngine, start time.Time, values ...float64) []bool {
+	firing := make([]bool, len(values))
+	for i, value := range values {
+		results := engine.Evaluate(models.ContainerMetric{
+			ContainerID: "aaa",
+			Name:        "web",
+			CPUPercent:  value,
+			Timestamp:   start.Add(time.Duration(i) * 15 * time.Second),
+		})
+		if len(results) > 0 {
+			firing[i] = results[0].Firing
+		}
+	}
+	return firing
+}
+
+func TestRuleEngine_ForDuration(t *testing.T) {
+	engine := services.NewRuleEngine()
+	_, err := engine.SetRules([]models.AlertRule{cpuRule()})
+	require.NoError(t, err)
+
+	// A single spike does not fire; a minute above the threshold does
+	firing := evaluateCPU(engine, time.Now(), 95, 50, 85, 90, 95, 90, 85)
+	assert.Equal(t, []bool{false, false, false, false, false, false, true}, firing)
+}
+
+func TestRuleEngine_Hysteresis(t *testing.T) {
+	engine := services.NewRuleEngine()
+	rule := cpuRule()
+	rule.For = 0
+	_, err := engine.SetRules([]models.AlertRule{rule})
+	require.NoError(t, err)
+
+	// Values between the resolve threshold and the threshold keep the alert firing
+	firing := evaluateCPU(engine, time.Now(), 85, 79, 75, 81, 69, 75)
+	assert.Equal(t, []bool{true, true, true, true, false, false}, firing)
+}
+
+func TestRuleEngine_ResultAndMessage(t *testing.T) {
+	engine := services.NewRuleEngine()
+	rule := cpuRule()
+	rule.For = 0
+	_, err := engine.SetRules([]models.AlertRule{rule})
+	require.NoError(t, err)
+
+	results := engine.Evaluate(models.ContainerMetric{ContainerID: "aaa", Name: "web", CPUPercent: 91.6, Timestamp: time.Now()})
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Firing)
+	assert.True(t, results[0].Changed)
+	assert.Equal(t, "warning", results[0].Rule.Severity)
+	assert.Equal(t, "web CPU at 92%", results[0].Message)
+}
+
+func TestRuleEngine_Changed(t *testing.T) {
+	engine := services.NewRuleEngine()
+	_, err := engine.SetRules([]models.AlertRule{cpuRule()})
+	require.NoError(t, err)
+
+	start := time.Now()
+	changed := func(i int, value float64) bool {
+		results := engine.Evaluate(models.ContainerMetric{
+			ContainerID: "aaa",
+			Name:        "web",
+			CPUPercent:  value,
+			Timestamp:   start.Add(time.Duration(i) * 15 * time.Second),
+		})
+		require.Len(t, results, 1)
+		return results[0].Changed
+	}
+
+	// A pending first sample is not settled; the first one that fires is a change
+	var got []bool
+	for i, value := range []float64{90, 90, 90, 90, 90, 90, 60, 60} {
+		got = append(got, changed(i, value))
+	}
+	assert.Equal(t, []bool{false, false, false, false, true, false, true, false}, got)
+
+	// A forgotten rule reports its first settled state again
+	engine.Forget("aaa", "busy")
+	assert.True(t, changed(8, 50))
+	assert.False(t, changed(9, 50))
+}
+
+func TestRuleEngine_RetainDropsRestartHistory(t *testing.T) {
+	engine := services.NewRuleEngine()
+	_, err := engine.SetRules([]models.AlertRule{{Name: "restarts", Metric: "restarts_1h", Comparator: ">=", Threshold: 2}})
+	require.NoError(t, err)
+
+	restarts := func(count int, at time.Time) float64 {
+		results := engine.Evaluate(models.ContainerMetric{ContainerID: "aaa", Name: "web", RestartCount: count, Timestamp: at})
+		require.Len(t, results, 1)
+		return results[0].Value
+	}
+
+	now := time.Now()
+	assert.Equal(t, 0.0, restarts(1, now))
+	assert.Equal(t, 2.0, restarts(3, now.Add(time.Minute)))
+
+	// Once the container is gone its restarts are forgotten
+	engine.Retain(map[string]bool{"bbb": true})
+	assert.Equal(t, 0.0, restarts(3, now.Add(2*time.Minute)))
+}
+
+func TestRuleEngine_Selector(t *testing.T) {
+	rule := cpuRule()
+	rule.For = 0
+	rule.Selector = models.RuleSelector{Name: "api-*", Labels: map[string]string{"team": "payments"}}
+
+	engine := services.NewRuleEngine()
+	_, err := engine.SetRules([]models.AlertRule{rule})
+	require.NoError(t, err)
+
+	evaluate := func(name string, labels map[string]string) int {
+		return len(engine.Evaluate(models.ContainerMetric{ContainerID: name, Name: name, Labels: labels, CPUPercent: 99, Timestamp: time.Now()}))
+	}
+	assert.Equal(t, 1, evaluate("api-1", map[string]string{"team": "payments", "tier": "web"}))
+	assert.Equal(t, 0, evaluate("api-2", map[string]string{"team": "search"}))
+	assert.Equal(t, 0, evaluate("worker", map[string]string{"team": "payments"}))
+}
+
+func TestRuleEngine_SetRules(t *testing.T) {
+	engine := services.NewRuleEngine()
+	other := cpuRule()
+	other.Name = "other"
+	_, err := engine.SetRules([]models.AlertRule{cpuRule(), other})
+	require.NoError(t, err)
+
+	start := time.Now()
+	evaluateCPU(engine, start, 90, 90, 90)
+
+	// Unchanged rules keep their pending state
+	removed, err := engine.SetRules([]models.AlertRule{cpuRule()})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"other"}, removed)
+	firing := evaluateCPU(engine, start.Add(45*time.Second), 90, 90)
+	assert.Equal(t, []bool{false, true}, firing)
+
+	// A changed rule starts over
+	changed := cpuRule()
+	changed.Threshold = 85
+	_, err = engine.SetRules([]models.AlertRule{changed})
+	require.NoError(t, err)
+	firing = evaluateCPU(engine, start.Add(75*time.Second), 90)
+	assert.Equal(t, []bool{false}, firing)
+
+	_, err = engine.SetRules([]models.AlertRule{cpuRule(), cpuRule()})
+	assert.Error(t, err)
+}
+
+func TestValidateRule(t *testing.T) {
+	invalid := map[string]func(rule *models.AlertRule){
+		"name":       func(rule *models.AlertRule) { rule.Name = "high cpu" },
+		"reserved":   func(rule *models.AlertRule) { rule.Name = "anomaly" },
+		"metric":     func(rule *models.AlertRule) { rule.Metric = "temperature" },
+		"comparator": func(rule *models.AlertRule) { rule.Comparator = "=>" },
+		"for":        func(rule *models.AlertRule) { rule.For = -1 },
+		"resolve":    func(rule *models.AlertRule) { rule.ResolveThreshold = float64Ptr(90) },
+		"severity":   func(rule *models.AlertRule) { rule.Severity = "page" },
+		"selector":   func(rule *models.AlertRule) { rule.Selector.Name = "api-[" },
+		"message":    func(rule *models.AlertRule) { rule.Message = "{{.Value" },
+	}
+	for name, mutate := range invalid {
+		t.Run(name, func(t *testing.T) {
+			rule := cpuRule()
+			mutate(&rule)
+			assert.Error(t, services.ValidateRule(&rule))
+		})
+	}
+
+	rule := cpuRule()
+	require.NoError(t, services.ValidateRule(&rule))
+	assert.Equal(t, "warning", rule.Severity)
+}
+
+func TestBuiltinRules(t *testing.T) {
+	config := &models.Config{}
+	config.Alerts.CPUThreshold = 90
+	config.Alerts.RestartLimit = 3
+
+	engine := services.NewRuleEngine()
+	_, err := engine.SetRules(services.BuiltinRules(config))
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, rule := range engine.Rules() {
+		names = append(names, rule.Name)
+		assert.Equal(t, models.RuleSourceBuiltin, rule.Source)
+	}
+	assert.Equal(t, []string{"high_cpu", "frequent_restarts", "unhealthy"}, names)
+
+	// Three restarts within an hour fire frequent_restarts
+	start := time.Now()
+	var results []services.RuleResult
+	for i := 0; i <= 3; i++ {
+		results = engine.Evaluate(models.ContainerMetric{
+			ContainerID:  "aaa",
+			Name:         "web",
+			RestartCount: i,
+			Health:       models.HealthNone,
+			Timestamp:    start.Add(time.Duration(i) * 10 * time.Minute),
+		})
+	}
+	for _, result := range results {
+		if result.Rule.Name == "frequent_restarts" {
+			assert.True(t, result.Firing)
+			assert.Equal(t, "Container restarted 3 times in the last hour", result.Message)
+		}
+	}
+}
+
+func TestHostRuleEngine(t *testing.T) {
+	config := &models.Config{}
+	config.Alerts.Host.DiskThreshold = 85
+	config.Alerts.Host.LoadThreshold = 1
+
+	engine := services.NewHostRuleEngine(config, "/var/lib/docker")
+	names := []string{}
+	for _, rule := range engine.Rules() {
+		names = append(names, rule.Name)
+	}
+	assert.Equal(t, []string{"host_high_disk", "host_high_load"}, names)
+
+	// Load per CPU must hold above 1 for a minute and resolves below 0.8
+	start := time.Now()
+	var firing []bool
+	var results []services.RuleResult
+	for i, load := range []float64{3, 3, 3, 1.8, 1.4} {
+		results = engine.EvaluateHost(models.HostMetric{
+			Hostname:  "docker-host",
+			CPUCount:  2,
+			Load1:     load,
+			Timestamp: start.Add(time.Duration(i) * 30 * time.Second),
+		})
+		// Disk usage that could not be read is not evaluated
+		require.Len(t, results, 1)
+		firing = append(firing, results[0].Firing)
+		if i == 2 {
+			assert.True(t, results[0].Changed)
+			assert.Equal(t, "High host load average detected (1.50 per CPU)", results[0].Message)
+		}
+	}
+	assert.Equal(t, []bool{false, false, true, true, false}, firing)
+	assert.True(t, results[0].Changed)
+
+	for i := 0; i < 3; i++ {
+		results = engine.EvaluateHost(models.HostMetric{
+			Hostname:  "docker-host",
+			DiskUsed:  90,
+			DiskTotal: 100,
+			Timestamp: start.Add(time.Duration(5+i) * 30 * time.Second),
+		})
+	}
+	require.Len(t, results, 2)
+	assert.Equal(t, "host_high_disk", results[0].Rule.Name)
+	assert.True(t, results[0].Firing)
+	assert.Equal(t, "Docker data filesystem /var/lib/docker is 90.0% full", results[0].Message)
+}
+
+func TestRuleService_CRUD(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	config.Alerts.CPUThreshold = 90
+	config.Alerts.Rules = []models.AlertRule{{Name: "high_cpu", Metric: "cpu_percent", Comparator: ">", Threshold: 95}}
+
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	rs := services.NewRuleService(ms, config)
+	require.NoError(t, rs.LoadRules())
+
+	// The configured rule replaces the builtin one
+	rules := rs.GetRules()
+	require.Len(t, rules, 2)
+	assert.Equal(t, models.RuleSourceConfig, rules[1].Source)
+	assert.Equal(t, 95.0, rules[1].Threshold)
+
+	_, err := rs.CreateRule(cpuRule())
+	require.NoError(t, err)
+	_, err = rs.CreateRule(cpuRule())
+	assert.ErrorIs(t, err, services.ErrRuleExists)
+	bad := cpuRule()
+	bad.Name = "bad"
+	bad.Metric = "temperature"
+	_, err = rs.CreateRule(bad)
+	assert.ErrorIs(t, err, services.ErrInvalidRule)
+	reserved := cpuRule()
+	reserved.Name = "memory_leak_suspected"
+	_, err = rs.CreateRule(reserved)
+	assert.ErrorIs(t, err, services.ErrInvalidRule, "rules cannot take over the alerts of other services")
+
+	_, err = rs.UpdateRule("high_cpu", cpuRule())
+	assert.ErrorIs(t, err, services.ErrRuleReadOnly)
+	assert.ErrorIs(t, rs.DeleteRule("missing"), services.ErrRuleNotFound)
+
+	updated := cpuRule()
+	updated.Threshold = 85
+	_, err = rs.UpdateRule("busy", updated)
+	require.NoError(t, err)
+
+	// API rules are stored and loaded again on startup
+	reloaded := services.NewRuleService(services.NewMetricsService(nil, storage.NewRowStore(), config), config)
+	require.NoError(t, reloaded.LoadRules())
+	rules = reloaded.GetRules()
+	require.Len(t, rules, 3)
+	assert.Equal(t, "busy", rules[2].Name)
+	assert.Equal(t, 85.0, rules[2].Threshold)
+	assert.Equal(t, models.RuleSourceAPI, rules[2].Source)
+
+	// A configured rule added later takes the name of a stored rule over
+	clashing := *config
+	clashing.Alerts.Rules = append([]models.AlertRule{cpuRule()}, config.Alerts.Rules...)
+	reloaded = services.NewRuleService(services.NewMetricsService(nil, storage.NewRowStore(), &clashing), &clashing)
+	require.NoError(t, reloaded.LoadRules())
+	rules = reloaded.GetRules()
+	require.Len(t, rules, 3)
+	assert.Equal(t, "busy", rules[1].Name)
+	assert.Equal(t, models.RuleSourceConfig, rules[1].Source)
+
+	require.NoError(t, rs.DeleteRule("busy"))
+	assert.Len(t, rs.GetRules(), 2)
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exposition = `# HELP http_requests_total Total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="get",code="200"} 1027 1395066363000
+http_requests_total{code="500", method="post",} 3
+# A comment
+queue_depth 42
+go_gc_duration_seconds{quantile="0.5"} NaN
+path_info{path="C:\\temp\"x\""} 1
+`
+
+func TestParsePrometheusText(t *testing.T) {
+	samples, err := services.ParsePrometheusText(strings.NewReader(exposition))
+
+	require.NoError(t, err)
+	require.Len(t, samples, 5)
+	assert.Equal(t, "http_requests_total", samples[0].Metric)
+	assert.Equal(t, map[string]string{"method": "get", "code": "200"}, samples[0].Labels)
+	assert.Equal(t, 1027.0, samples[0].Value)
+	assert.Equal(t, map[string]string{"method": "post", "code": "500"}, samples[1].Labels)
+	assert.Equal(t, "queue_depth", samples[2].Metric)
+	assert.Nil(t, samples[2].Labels)
+	assert.True(t, math.IsNaN(samples[3].Value))
+	assert.Equal(t, `C:\temp"x"`, samples[4].Labels["path"])
+}
+
+func TestParsePrometheusText_Invalid(t *testing.T) {
+	_, err := services.ParsePrometheusText(strings.NewReader("ok 1\nbroken{code=\"200\" 1\n"))
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestSeriesKey(t *testing.T) {
+	sample := models.ScrapedSample{Metric: "http_requests_total", Labels: map[string]string{"method": "get", "code": "200"}}
+
+	assert.Equal(t, `http_requests_total{code="200",method="get"}`, services.SeriesKey(sample))
+	assert.Equal(t, "up", services.SeriesKey(models.ScrapedSample{Metric: "up"}))
+}
+
+func TestSelectSamples(t *testing.T) {
+	samples, err := services.ParsePrometheusText(strings.NewReader(exposition))
+	require.NoError(t, err)
+
+	selected := services.SelectSamples(samples, []string{"http_*", "go_gc_duration_seconds"})
+
+	require.Len(t, selected, 2)
+	assert.Equal(t, `http_requests_total{code="200",method="get"}`, services.SeriesKey(selected[0]))
+	assert.Equal(t, `http_requests_total{code="500",method="post"}`, services.SeriesKey(selected[1]))
+	assert.Len(t, services.SelectSamples(samples, nil), 4)
+}
+
+func TestScrapeTargetFromContainer(t *testing.T) {
+	container := types.Container{
+		ID:     testContainerID,
+		Names:  []string{"/api"},
+		Labels: map[string]string{services.ScrapePortLabel: "9100", services.ScrapeMetricsLabel: "http_*, queue_depth"},
+		NetworkSettings: &types.SummaryNetworkSettings{Networks: map[string]*network.EndpointSettings{
+			"bridge":  {IPAddress: "172.17.0.5"},
+			"backend": {IPAddress: "10.0.1.4"},
+		}},
+	}
+
+	target, ok := services.ScrapeTargetFromContainer(container, "")
+	require.True(t, ok)
+	assert.Equal(t, "api", target.Name)
+	assert.Equal(t, testContainerID[:12], target.ContainerID)
+	assert.Equal(t, "http://10.0.1.4:9100/metrics", target.URL)
+	assert.Equal(t, []string{"http_*", "queue_depth"}, target.Metrics)
+
+	container.Labels[services.ScrapePathLabel] = "internal/metrics"
+	target, ok = services.ScrapeTargetFromContainer(container, "bridge")
+	require.True(t, ok)
+	assert.Equal(t, "http://172.17.0.5:9100/internal/metrics", target.URL)
+
+	container.HostConfig.NetworkMode = "host"
+	target, ok = services.ScrapeTargetFromContainer(container, "")
+	require.True(t, ok)
+	assert.Equal(t, "http://127.0.0.1:9100/internal/metrics", target.URL)
+}
+
+func TestScrapeTargetFromContainer_NotLabelled(t *testing.T) {
+	container := types.Container{ID: testContainerID, Names: []string{"/db"}, Labels: map[string]string{}}
+
+	_, ok := services.ScrapeTargetFromContainer(container, "")
+	assert.False(t, ok)
+}
+
+func TestRuleEngine_ScrapedSeries(t *testing.T) {
+	samples, err := services.ParsePrometheusText(strings.NewReader(exposition))
+	require.NoError(t, err)
+
+	engine := services.NewRuleEngine()
+	_, err = engine.SetRules([]models.AlertRule{
+		{Name: "errors", Metric: `scraped:http_requests_total{code="500",method="post"}`, Comparator: ">", Threshold: 2},
+		{Name: "requests", Metric: "scraped:http_requests_total", Comparator: "<", Threshold: 5},
+		{Name: "missing", Metric: "scraped:missing_metric", Comparator: ">", Threshold: 0},
+		cpuRule(),
+	})
+	require.NoError(t, err)
+
+	// A scrape only advances the rules on scraped series it holds; a bare metric name
+	// sees the series closest to firing
+	metric := models.ContainerMetric{ContainerID: "aaa", Name: "web", Timestamp: time.Now()}
+	results := engine.EvaluateScrape(metric, services.SelectSamples(samples, nil))
+	require.Len(t, results, 2)
+	assert.Equal(t, "errors", results[0].Rule.Name)
+	assert.True(t, results[0].Firing)
+	assert.Equal(t, 3.0, results[0].Value)
+	assert.Equal(t, "requests", results[1].Rule.Name)
+	assert.True(t, results[1].Firing)
+	assert.Equal(t, 3.0, results[1].Value)
+
+	// Container samples leave the rules on scraped series alone
+	metric.CPUPercent = 90
+	results = engine.Evaluate(metric)
+	require.Len(t, results, 1)
+	assert.Equal(t, "busy", results[0].Rule.Name)
+
+	rule := models.AlertRule{Name: "empty", Metric: "scraped:", Comparator: ">"}
+	assert.Error(t, services.ValidateRule(&rule))
+}
+
+func TestBuiltinRules_ScrapedThresholds(t *testing.T) {
+	config := &models.Config{}
+	config.Alerts.Scraped = []models.ScrapeRule{
+		{Metric: "queue_depth", Container: "worker", Above: float64Ptr(10), Severity: "critical"},
+		{Metric: `http_requests_total{code="500",method="post"}`, Above: float64Ptr(100), Below: float64Ptr(5)},
+	}
+
+	engine := services.NewRuleEngine()
+	_, err := engine.SetRules(services.BuiltinRules(config))
+	require.NoError(t, err)
+
+	scraped := map[string]models.AlertRule{}
+	for _, rule := range engine.Rules() {
+		if strings.HasPrefix(rule.Metric, services.ScrapedMetricPrefix) {
+			scraped[rule.Name] = rule
+			assert.Equal(t, models.RuleSourceBuiltin, rule.Source)
+		}
+	}
+	require.Len(t, scraped, 3)
+	queue := scraped["scraped.queue_depth.worker.above"]
+	assert.Equal(t, "critical", queue.Severity)
+	assert.Equal(t, "worker", queue.Selector.Name)
+	assert.Equal(t, "<", scraped["scraped.http_requests_total_code_500_method_post_.below"].Comparator)
+	assert.Equal(t, ">", scraped["scraped.http_requests_total_code_500_method_post_.above"].Comparator)
+
+	samples, err := services.ParsePrometheusText(strings.NewReader(exposition))
+	require.NoError(t, err)
+	results := engine.EvaluateScrape(models.ContainerMetric{ContainerID: "aaa", Name: "worker", Timestamp: time.Now()}, samples)
+	firing := map[string]string{}
+	for _, result := range results {
+		if result.Firing {
+			firing[result.Rule.Name] = result.Message
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"scraped.queue_depth.worker.above":                        "queue_depth is 42, above 10",
+		"scraped.http_requests_total_code_500_method_post_.below": `http_requests_total{code="500",method="post"} is 3, below 5`,
+	}, firing)
+}
+
+func TestScrapeService_AlertsThroughRules(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+
+	var depth atomic.Int64
+	depth.Store(42)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "queue_depth %d\nother_metric 1\n", depth.Load())
+	}))
+	defer endpoint.Close()
+	port, err := strconv.Atoi(endpoint.URL[strings.LastIndex(endpoint.URL, ":")+1:])
+	require.NoError(t, err)
+
+	fd := startFakeDocker(t)
+	fd.addScrapeTarget("worker", port)
+	fd.addScrapeTarget("excluded", port)
+	config := &models.Config{}
+	config.AutoHeal.ExcludeContainers = []string{"excluded"}
+	config.Scrape.Metrics = []string{"queue_*"}
+	config.Alerts.Scraped = []models.ScrapeRule{{Metric: "queue_depth", Above: float64Ptr(10)}}
+	ds := fd.newDockerService(t, config)
+	ms := services.NewMetricsService(ds, storage.NewRowStore(), config)
+	ss := services.NewScrapeService(ds, ms, config)
+
+	require.NoError(t, ss.ScrapeTargets())
+	targets := ss.GetTargets()
+	require.Len(t, targets, 1, "excluded containers are not scraped")
+	assert.Equal(t, "worker", targets[0].Name)
+	assert.Equal(t, 1, targets[0].Series)
+	assert.Empty(t, targets[0].LastError)
+
+	series, err := ss.GetSeries(fakeContainerID("worker")[:12])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"queue_depth"}, series)
+
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "scraped.queue_depth.above", alerts[0].Type)
+	assert.Equal(t, "worker", alerts[0].Name)
+	assert.Equal(t, "queue_depth is 42, above 10", alerts[0].Message)
+
+	depth.Store(3)
+	require.NoError(t, ss.ScrapeTargets())
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+
+	// Scraped samples are pruned with the container samples
+	_, err = models.DB.Exec(`UPDATE scraped_metrics SET timestamp = ? WHERE value = 42`, time.Now().Add(-48*time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, ms.Prune(time.Now().Add(-24*time.Hour)))
+	var values []float64
+	rows, err := models.DB.Query(`SELECT value FROM scraped_metrics`)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var value float64
+		require.NoError(t, rows.Scan(&value))
+		values = append(values, value)
+	}
+	assert.Equal(t, []float64{3}, values)
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/notify"
+	"nabd/services"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func batchSilence(now time.Time) models.Silence {
+	return models.Silence{
+		Matchers: []models.SilenceMatcher{
+			{Field: "container", Operator: models.MatchRegex, Value: "batch-.*"},
+			{Field: "type", Value: "high_cpu"},
+			{Field: "label", Label: "env", Operator: models.MatchNotEqual, Value: "prod"},
+		},
+		StartsAt:  now.Add(-time.Minute),
+		EndsAt:    now.Add(time.Hour),
+		CreatedBy: "alice",
+		Comment:   "nightly batch spikes CPU",
+	}
+}
+
+func TestSilenceSet_Match(t *testing.T) {
+	now := time.Now()
+	silence := batchSilence(now)
+	silence.ID = 7
+	set := services.NewSilenceSet()
+	require.NoError(t, set.Set([]models.Silence{silence}))
+
+	target := services.AlertTarget{Name: "batch-report", Type: "high_cpu", Labels: map[string]string{"env": "staging"}}
+	id, ok := set.Match(target, now)
+	assert.True(t, ok)
+	assert.Equal(t, 7, id)
+
+	// Regular expressions match the whole value
+	_, ok = set.Match(services.AlertTarget{Name: "nightly-batch-report", Type: "high_cpu"}, now)
+	assert.False(t, ok)
+
+	_, ok = set.Match(services.AlertTarget{Name: "batch-report", Type: "high_memory"}, now)
+	assert.False(t, ok)
+
+	prod := target
+	prod.Labels = map[string]string{"env": "prod"}
+	_, ok = set.Match(prod, now)
+	assert.False(t, ok)
+
+	// Silences only match between their start and end
+	_, ok = set.Match(target, now.Add(-time.Hour))
+	assert.False(t, ok)
+	_, ok = set.Match(target, now.Add(2*time.Hour))
+	assert.False(t, ok)
+	assert.Equal(t, models.SilencePending, services.SilenceStatus(silence, now.Add(-time.Hour)))
+	assert.Equal(t, models.SilenceActive, services.SilenceStatus(silence, now))
+	assert.Equal(t, models.SilenceExpired, services.SilenceStatus(silence, now.Add(2*time.Hour)))
+}
+
+func TestValidateSilence(t *testing.T) {
+	now := time.Now()
+
+	valid := batchSilence(now)
+	valid.Matchers = []models.SilenceMatcher{{Field: "image", Value: "postgres:15"}}
+	require.NoError(t, services.ValidateSilence(&valid))
+	assert.Equal(t, models.MatchEqual, valid.Matchers[0].Operator)
+
+	for name, mutate := range map[string]func(*models.Silence){
+		"no matchers":   func(s *models.Silence) { s.Matchers = nil },
+		"unknown field": func(s *models.Silence) { s.Matchers[0].Field = "hostname" },
+		"label key":     func(s *models.Silence) { s.Matchers[2].Label = "" },
+		"bad operator":  func(s *models.Silence) { s.Matchers[0].Operator = "~" },
+		"bad regex":     func(s *models.Silence) { s.Matchers[0].Value = "batch-(" },
+		"ends first":    func(s *models.Silence) { s.EndsAt = s.StartsAt },
+		"no comment":    func(s *models.Silence) { s.Comment = "" },
+	} {
+		silence := batchSilence(now)
+		mutate(&silence)
+		assert.Error(t, services.ValidateSilence(&silence), name)
+	}
+}
+
+func TestSilenceService_CRUDAndAlertFlag(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	ss := services.NewSilenceService(ms, config)
+	require.NoError(t, ss.LoadSilences())
+
+	insertAlert(t, "aaa", "batch-report", "high_cpu", "warning", time.Now())
+	insertAlert(t, "bbb", "web", "high_cpu", "warning", time.Now())
+
+	now := time.Now()
+	expired := batchSilence(now)
+	expired.EndsAt = now.Add(-time.Minute)
+	_, err := ss.CreateSilence(expired)
+	assert.ErrorIs(t, err, services.ErrInvalidSilence)
+
+	silence := batchSilence(now)
+	silence.StartsAt = time.Time{}
+	created, err := ss.CreateSilence(silence)
+	require.NoError(t, err)
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, models.SilenceActive, created.Status)
+
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	for _, alert := range alerts {
+		assert.Equal(t, alert.Name == "batch-report", alert.Silenced, alert.Name)
+		if alert.Silenced {
+			assert.Equal(t, created.ID, alert.SilenceID)
+		}
+	}
+
+	// Silences are stored and loaded again on startup
+	reloaded := services.NewSilenceService(services.NewMetricsService(nil, storage.NewRowStore(), config), config)
+	require.NoError(t, reloaded.LoadSilences())
+	stored, err := reloaded.GetSilence(created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.Matchers, stored.Matchers)
+	assert.Equal(t, "alice", stored.CreatedBy)
+
+	update := batchSilence(now)
+	update.Matchers = []models.SilenceMatcher{{Field: "container", Value: "web"}}
+	_, err = ss.UpdateSilence(created.ID, update)
+	require.NoError(t, err)
+	alerts, err = ms.GetActiveAlerts()
+	require.NoError(t, err)
+	for _, alert := range alerts {
+		assert.Equal(t, alert.Name == "web", alert.Silenced, alert.Name)
+	}
+
+	_, err = ss.UpdateSilence(created.ID+1, update)
+	assert.ErrorIs(t, err, services.ErrSilenceNotFound)
+	require.NoError(t, ss.DeleteSilence(created.ID))
+	assert.ErrorIs(t, ss.DeleteSilence(created.ID), services.ErrSilenceNotFound)
+	assert.Empty(t, ss.GetSilences())
+}
+
+func TestSilenceService_AlertNotifiedAfterSilenceEnds(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	config := &models.Config{}
+	config.Notifications.Enabled = true
+	config.Alerts.Escalation.Tiers = []models.EscalationTier{{After: 600, Severity: "critical"}}
+
+	channel := &recordingChannel{}
+	dispatcher := notify.NewDispatcher(1, 0, 0)
+	require.NoError(t, dispatcher.AddChannel("ops", channel, nil, ""))
+	dispatcher.Start()
+
+	ms := services.NewMetricsService(nil, storage.NewRowStore(), config)
+	require.NoError(t, ms.SetNotifier(dispatcher))
+	ss := services.NewSilenceService(ms, config)
+	require.NoError(t, ss.LoadSilences())
+	as := services.NewAlertService(ms, config)
+
+	// The alert fired while the silence matched it
+	now := time.Now()
+	silence, err := ss.CreateSilence(batchSilence(now))
+	require.NoError(t, err)
+	id := insertAlert(t, "aaa", "batch-report", "high_cpu", "warning", now.Add(-20*time.Minute))
+	_, err = models.DB.Exec(`UPDATE alerts SET silenced = 1 WHERE id = ?`, id)
+	require.NoError(t, err)
+
+	require.NoError(t, ss.DeleteSilence(silence.ID))
+	alerts, err := ms.GetActiveAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.False(t, alerts[0].Silenced)
+
+	require.NoError(t, as.Escalate(now))
+	_, err = as.Resolve(id, "alice", "")
+	require.NoError(t, err)
+	dispatcher.Close()
+
+	require.Len(t, channel.sent, 2)
+	assert.Equal(t, notify.EventAlertEscalated, channel.sent[0].Event)
+	assert.Contains(t, channel.sent[1].Title, "RESOLVED")
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nabd/models"
+	"nabd/storage"
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// generateSamples returns count samples of a container every interval from start,
+// with realistic noise in the gauges and growing counters
+func generateSamples(containerID string, start time.Time, interval time.Duration, count int) []models.ContainerMetric {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]models.ContainerMetric, count)
+	for i := range samples {
+		samples[i] = models.ContainerMetric{
+			ContainerID:   containerID,
+			Name:          "web-" + containerID,
+			CPUPercent:    float64(rng.Intn(10000)) / 100,
+			MemoryUsage:   200<<20 + int64(rng.Intn(4096))*1024,
+			MemoryLimit:   1 << 30,
+			NetworkRx:     int64(i) * 15000,
+			NetworkTx:     int64(i) * 9000,
+			BlockRead:     int64(i) * 4096,
+			BlockWrite:    int64(i/4) * 8192,
+			Pids:          12,
+			RestartCount:  i / 1000,
+			UptimeSeconds: int64(i) * 15,
+			Health:        models.HealthHealthy,
+			Status:        "running",
+			Timestamp:     start.Add(time.Duration(i) * interval),
+		}
+	}
+	// A jittered timestamp and a status change exercise the less common encodings
+	if count > 10 {
+		samples[5].Timestamp = samples[5].Timestamp.Add(37 * time.Millisecond)
+		samples[7].Status = "restarting"
+		samples[7].Health = models.HealthStarting
+	}
+	return samples
+}
+
+// backends returns a fresh chunk backend of every kind. Subtests using them must call
+// freshDatabase, as head samples are kept in the database whatever the backend.
+func backends(t *testing.T, chunkDuration time.Duration) map[string]storage.ChunkBackend {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	dirBackend, err := storage.NewDirectoryBackend(filepath.Join(t.TempDir(), "chunks"), chunkDuration)
+	require.NoError(t, err)
+
+	return map[string]storage.ChunkBackend{
+		"sqlite":    storage.NewSQLiteBackend(),
+		"directory": dirBackend,
+	}
+}
+
+// freshDatabase opens an empty database
+func freshDatabase(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+}
+
+func assertSamplesEqual(t *testing.T, expected, actual []models.ContainerMetric) {
+	t.Helper()
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		want, got := expected[i], actual[i]
+		assert.Equal(t, want.Timestamp.UnixMilli(), got.Timestamp.UnixMilli(), "sample %d", i)
+		got.Timestamp = want.Timestamp
+		assert.Equal(t, want, got, "sample %d", i)
+	}
+}
+
+func TestChunkStore_RoundTrip(t *testing.T) {
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	samples := generateSamples("aaa", start, 15*time.Second, 2000)
+
+	for name, backend := range backends(t, 2*time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			freshDatabase(t)
+			store := storage.NewChunkStore(backend, 2*time.Hour)
+			for _, sample := range samples {
+				require.NoError(t, store.Append([]models.ContainerMetric{sample}))
+			}
+
+			// The samples span five partitions; the range crosses four of them
+			from, to := start.Add(90*time.Minute), start.Add(7*time.Hour)
+			got, err := store.Range("aaa", from, to)
+			require.NoError(t, err)
+
+			var want []models.ContainerMetric
+			for _, sample := range samples {
+				if !sample.Timestamp.Before(from) && !sample.Timestamp.After(to) {
+					want = append(want, sample)
+				}
+			}
+			assertSamplesEqual(t, want, got)
+
+			// A restarted store resumes the stored head chunk
+			restarted := storage.NewChunkStore(backend, 2*time.Hour)
+			next := generateSamples("aaa", samples[len(samples)-1].Timestamp.Add(15*time.Second), 15*time.Second, 3)
+			require.NoError(t, restarted.Append(next))
+			require.NoError(t, restarted.Append(samples[:1]), "older samples are dropped")
+
+			all, err := restarted.Range("aaa", start, start.Add(24*time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, all, len(samples)+len(next))
+			assertSamplesEqual(t, next, all[len(samples):])
+		})
+	}
+}
+
+func TestChunkStore_RangeAllAndPrune(t *testing.T) {
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	for name, backend := range backends(t, time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			freshDatabase(t)
+			store := storage.NewChunkStore(backend, time.Hour)
+			require.NoError(t, store.Append(generateSamples("aaa", start, time.Minute, 180)))
+			require.NoError(t, store.Append(generateSamples("bbb", start, time.Minute, 60)))
+
+			all, err := store.RangeAll(start, start.Add(3*time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, all["aaa"], 180)
+			assert.Len(t, all["bbb"], 60)
+
+			ids, err := store.Containers(start, start.Add(3*time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"aaa", "bbb"}, ids)
+			ids, err = store.Containers(start.Add(2*time.Hour), start.Add(3*time.Hour))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"aaa"}, ids)
+
+			require.NoError(t, store.Prune(start.Add(time.Hour)))
+			all, err = store.RangeAll(start, start.Add(3*time.Hour))
+			require.NoError(t, err)
+			assert.Len(t, all["aaa"], 120)
+			assert.Empty(t, all["bbb"])
+		})
+	}
+}
+
+func TestChunkStore_Compression(t *testing.T) {
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	backend := backends(t, 2*time.Hour)["directory"]
+	store := storage.NewChunkStore(backend, 2*time.Hour)
+
+	// One full partition of 15 second samples, encoded once the next partition starts
+	samples := generateSamples("aaa", start, 15*time.Second, 481)
+	require.NoError(t, store.Append(samples))
+	samples = samples[:480]
+
+	chunks, err := backend.ReadChunks("aaa", start, start.Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, chunks, 1)
+
+	// An uncompressed sample is 11 eight-byte fields plus a timestamp
+	raw := len(samples) * 12 * 8
+	assert.Less(t, len(chunks[0].Data)*3, raw, "expected at least 3x compression, got %d of %d bytes", len(chunks[0].Data), raw)
+}
+
+func TestChunkStore_EncodesCompletePartitions(t *testing.T) {
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+
+	for name, backend := range backends(t, time.Hour) {
+		t.Run(name, func(t *testing.T) {
+			freshDatabase(t)
+			store := storage.NewChunkStore(backend, time.Hour)
+			samples := generateSamples("aaa", start, time.Minute, 61)
+			for _, sample := range samples[:60] {
+				require.NoError(t, store.Append([]models.ContainerMetric{sample}))
+			}
+
+			// The partition being written stays out of the backend but is readable
+			chunks, err := backend.ReadChunks("aaa", start, start.Add(time.Hour))
+			require.NoError(t, err)
+			assert.Empty(t, chunks)
+			got, err := store.Range("aaa", start, start.Add(time.Hour))
+			require.NoError(t, err)
+			assertSamplesEqual(t, samples[:60], got)
+
+			// A sample of the next partition encodes the previous one in a single chunk
+			require.NoError(t, store.Append(samples[60:]))
+			chunks, err = backend.ReadChunks("aaa", start, start.Add(time.Hour-time.Millisecond))
+			require.NoError(t, err)
+			require.Len(t, chunks, 1)
+			assert.Equal(t, 60, chunks[0].Count)
+
+			var head int
+			require.NoError(t, models.DB.QueryRow("SELECT COUNT(*) FROM metric_head").Scan(&head))
+			assert.Equal(t, 1, head)
+
+			got, err = store.Range("aaa", start, start.Add(2*time.Hour))
+			require.NoError(t, err)
+			assertSamplesEqual(t, samples, got)
+		})
+	}
+}
+
+func TestMigrateRows(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	samples := generateSamples("aaa", start, 15*time.Second, 120)
+	require.NoError(t, storage.NewRowStore().Append(samples))
+
+	store := storage.NewChunkStore(storage.NewSQLiteBackend(), 2*time.Hour)
+	moved, err := storage.MigrateRows(store, 50)
+	require.NoError(t, err)
+	assert.Equal(t, 120, moved)
+
+	var count int
+	require.NoError(t, models.DB.QueryRow("SELECT COUNT(*) FROM container_metrics").Scan(&count))
+	assert.Zero(t, count)
+
+	got, err := store.Range("aaa", start, time.Now())
+	require.NoError(t, err)
+	assertSamplesEqual(t, samples, got)
+
+	moved, err = storage.MigrateRows(store, 50)
+	require.NoError(t, err)
+	assert.Zero(t, moved)
+}
+
+func TestOpen(t *testing.T) {
+	config := &models.Config{}
+	store, err := storage.Open(config)
+	require.NoError(t, err)
+	assert.IsType(t, &storage.RowStore{}, store)
+
+	config.Storage.Engine = "chunks"
+	config.Storage.Backend = "directory"
+	config.Storage.Directory = t.TempDir()
+	store, err = storage.Open(config)
+	require.NoError(t, err)
+	assert.IsType(t, &storage.ChunkStore{}, store)
+
+	config.Storage.Backend = "s3"
+	_, err = storage.Open(config)
+	assert.Error(t, err)
+
+	config.Storage.Engine = "tsdb"
+	_, err = storage.Open(config)
+	assert.Error(t, err)
+}
+
+// BenchmarkRange compares a one day range scan of one container among 20 over
+// 7 days of 15 second samples
+func BenchmarkRange(b *testing.B) {
+	start := time.Now().Add(-7 * 24 * time.Hour).Truncate(time.Hour)
+	perContainer := 7 * 24 * 60 * 4
+
+	for _, engine := range []string{"rows", "chunks"} {
+		b.Run(engine, func(b *testing.B) {
+			require.NoError(b, utils.InitDatabase(filepath.Join(b.TempDir(), "nabd.db")))
+			var store storage.MetricsStore = storage.NewRowStore()
+			if engine == "chunks" {
+				store = storage.NewChunkStore(storage.NewSQLiteBackend(), 2*time.Hour)
+			}
+			for c := 0; c < 20; c++ {
+				id := string(rune('a'+c)) + "00"
+				samples := generateSamples(id, start, 15*time.Second, perContainer)
+				for i := 0; i < len(samples); i += 5000 {
+					end := i + 5000
+					if end > len(samples) {
+						end = len(samples)
+					}
+					require.NoError(b, store.Append(samples[i:end]))
+				}
+			}
+
+			from := start.Add(3 * 24 * time.Hour)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				samples, err := store.Range("e00", from, from.Add(24*time.Hour))
+				if err != nil || len(samples) != 24*60*4+1 {
+					b.Fatalf("unexpected range result: %d samples, %v", len(samples), err)
+				}
+			}
+		})
+	}
+}
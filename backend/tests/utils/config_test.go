@@ -29,6 +29,36 @@ func TestLoadConfig_Defaults(t *testing.T) {
 	assert.Equal(t, 90.0, config.Alerts.CPUThreshold)
 	assert.Equal(t, 90.0, config.Alerts.MemoryThreshold)
 	assert.Equal(t, 3, config.Alerts.RestartLimit)
+	assert.Equal(t, int64(1000), config.Alerts.PidsLimit)
+	assert.Equal(t, int64(60), config.Alerts.MinUptime)
+	assert.Equal(t, 15, config.Metrics.Interval)
+	assert.Equal(t, 2, config.Metrics.Jitter)
+	assert.Equal(t, 8, config.Metrics.Workers)
+	assert.Equal(t, 5, config.Metrics.StatsTimeout)
+	assert.Equal(t, 7, config.Idle.MinDays)
+	assert.Equal(t, 30, config.Idle.LookbackDays)
+	assert.False(t, config.Idle.AllowStop)
+	assert.Equal(t, 14, config.Recommendations.Days)
+	assert.Equal(t, 20.0, config.Recommendations.Headroom)
+	assert.False(t, config.Recommendations.AllowApply)
+	assert.Equal(t, 30, config.Alerts.Grouping.Wait)
+	assert.Equal(t, 300, config.Alerts.Grouping.Interval)
+	assert.Equal(t, 30, config.Alerts.Escalation.Interval)
+	assert.Empty(t, config.Alerts.Escalation.Tiers)
+	assert.Equal(t, 5, config.Silences.RetentionDays)
+	assert.Equal(t, 10, config.Notifications.LogLines)
+	assert.True(t, config.Notifications.Enabled)
+	assert.Equal(t, 5, config.Notifications.MaxAttempts)
+	assert.Equal(t, 2, config.Notifications.Backoff)
+	assert.Equal(t, 10, config.Notifications.Timeout)
+	assert.Equal(t, "rows", config.Storage.Engine)
+	assert.Equal(t, "sqlite", config.Storage.Backend)
+	assert.Equal(t, 2, config.Storage.ChunkHours)
+	assert.Equal(t, 90, config.Storage.RetentionDays)
+	assert.True(t, config.Storage.Migrate)
+	assert.True(t, config.Scrape.Enabled)
+	assert.Equal(t, 30, config.Scrape.Interval)
+	assert.Equal(t, 500, config.Scrape.MaxSeries)
 }
 
 func TestLoadConfig_WithEnvironmentVariables(t *testing.T) {
@@ -97,4 +127,32 @@ alerts:
 	assert.Equal(t, 80.0, config.Alerts.CPUThreshold)
 	assert.Equal(t, 85.0, config.Alerts.MemoryThreshold)
 	assert.Equal(t, 5, config.Alerts.RestartLimit)
-}
\ No newline at end of file
+}
+
+func TestLoadConfig_MetricsOverrides(t *testing.T) {
+	originalWd, _ := os.Getwd()
+	tempDir := t.TempDir()
+	err := os.Chdir(tempDir)
+	require.NoError(t, err)
+	defer func() {
+		os.Chdir(originalWd)
+	}()
+
+	configContent := `
+metrics:
+  interval: 30
+  overrides:
+    redis: 5
+    batch: 120
+`
+	err = os.WriteFile("config.yaml", []byte(configContent), 0644)
+	require.NoError(t, err)
+
+	config, err := utils.LoadConfig()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 30, config.Metrics.Interval)
+	assert.Equal(t, 5, config.Metrics.Overrides["redis"])
+	assert.Equal(t, 120, config.Metrics.Overrides["batch"])
+	assert.Equal(t, 8, config.Metrics.Workers)
+}
@@ -1,9 +1,15 @@
 package utils
 
 import (
+	"database/sql"
+	"errors"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"nabd/models"
 	"nabd/utils"
 
 	"github.com/stretchr/testify/assert"
@@ -25,4 +31,61 @@ func TestInitDatabase(t *testing.T) {
 func TestInitDatabase_InvalidPath(t *testing.T) {
 	err := utils.InitDatabase("/invalid/path/that/does/not/exist/test.db")
 	assert.Error(t, err)
-}
\ No newline at end of file
+}
+
+func TestInitDatabase_WALMode(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+
+	var journalMode string
+	require.NoError(t, models.DB.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.Equal(t, "wal", journalMode)
+
+	var busyTimeout int
+	require.NoError(t, models.DB.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.Equal(t, 5000, busyTimeout)
+}
+
+func TestWriteTx_RollsBackOnError(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+	failure := errors.New("failed")
+
+	err := utils.WriteTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO autoheal_events (container_id, name, action, reason, success) VALUES ('a', 'a', 'restart', 'test', 1)`)
+		require.NoError(t, err)
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	var count int
+	require.NoError(t, models.DB.QueryRow("SELECT COUNT(*) FROM autoheal_events").Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestWriteTx_ConcurrentWritesAndReads(t *testing.T) {
+	require.NoError(t, utils.InitDatabase(filepath.Join(t.TempDir(), "nabd.db")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			err := utils.WriteTx(func(tx *sql.Tx) error {
+				_, err := tx.Exec(`INSERT INTO host_metrics (hostname, cpu_percent, cpu_count, memory_used, memory_total,
+					load1, load5, load15, disk_path, disk_used, disk_total, network_rx, network_tx, timestamp)
+					VALUES ('host', 1, 1, 1, 1, 0, 0, 0, '/', 1, 1, 0, 0, ?)`, time.Now())
+				return err
+			})
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			var count int
+			assert.NoError(t, models.DB.QueryRow("SELECT COUNT(*) FROM host_metrics").Scan(&count))
+		}()
+	}
+	wg.Wait()
+
+	var count int
+	require.NoError(t, models.DB.QueryRow("SELECT COUNT(*) FROM host_metrics").Scan(&count))
+	assert.Equal(t, 20, count)
+}
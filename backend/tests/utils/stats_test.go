@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"testing"
+
+	"nabd/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinearRegression_PerfectFit(t *testing.T) {
+	xs := []float64{0, 1, 2, 3, 4}
+	ys := []float64{10, 12, 14, 16, 18}
+
+	slope, intercept, r2 := utils.LinearRegression(xs, ys)
+
+	assert.InDelta(t, 2.0, slope, 1e-9)
+	assert.InDelta(t, 10.0, intercept, 1e-9)
+	assert.InDelta(t, 1.0, r2, 1e-9)
+}
+
+func TestLinearRegression_NoisyFit(t *testing.T) {
+	xs := []float64{0, 1, 2, 3, 4, 5}
+	ys := []float64{1, 3, 2, 5, 4, 6}
+
+	slope, _, r2 := utils.LinearRegression(xs, ys)
+
+	assert.Greater(t, slope, 0.0)
+	assert.Greater(t, r2, 0.5)
+	assert.Less(t, r2, 1.0)
+}
+
+func TestLinearRegression_Degenerate(t *testing.T) {
+	slope, intercept, r2 := utils.LinearRegression([]float64{1}, []float64{1})
+	assert.Equal(t, 0.0, slope)
+	assert.Equal(t, 0.0, intercept)
+	assert.Equal(t, 0.0, r2)
+
+	slope, _, r2 = utils.LinearRegression([]float64{2, 2, 2}, []float64{1, 2, 3})
+	assert.Equal(t, 0.0, slope)
+	assert.Equal(t, 0.0, r2)
+}
+
+func TestEWMA_RunningMeanWarmup(t *testing.T) {
+	var ewma utils.EWMA
+	for _, x := range []float64{2, 4, 6} {
+		ewma.Update(x, 0.01)
+	}
+
+	assert.Equal(t, 3, ewma.Count)
+	assert.InDelta(t, 4.0, ewma.Mean, 1e-9)
+	// Population variance of 2, 4, 6
+	assert.InDelta(t, 8.0/3.0, ewma.Variance, 1e-9)
+}
+
+func TestEWMA_TracksLevelShift(t *testing.T) {
+	var ewma utils.EWMA
+	for i := 0; i < 100; i++ {
+		ewma.Update(10, 0.1)
+	}
+	assert.InDelta(t, 10.0, ewma.Mean, 1e-9)
+	assert.InDelta(t, 0.0, ewma.StdDev(), 1e-9)
+
+	for i := 0; i < 100; i++ {
+		ewma.Update(20, 0.1)
+	}
+	assert.InDelta(t, 20.0, ewma.Mean, 0.01)
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	assert.Equal(t, 1.0, utils.Percentile(values, 0))
+	assert.Equal(t, 10.0, utils.Percentile(values, 100))
+	assert.InDelta(t, 5.5, utils.Percentile(values, 50), 1e-9)
+	assert.InDelta(t, 9.55, utils.Percentile(values, 95), 1e-9)
+	assert.Equal(t, 0.0, utils.Percentile(nil, 99))
+}
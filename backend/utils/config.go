@@ -19,6 +19,64 @@ func LoadConfig() (*models.Config, error) {
 	config.Alerts.CPUThreshold = 90.0
 	config.Alerts.MemoryThreshold = 90.0
 	config.Alerts.RestartLimit = 3
+	config.Alerts.PidsLimit = 1000
+	config.Alerts.MinUptime = 60
+	config.Alerts.Host.CPUThreshold = 90.0
+	config.Alerts.Host.MemoryThreshold = 90.0
+	config.Alerts.Host.DiskThreshold = 85.0
+	config.Alerts.Host.LoadThreshold = 2.0
+	config.Alerts.Disk.WritableLayerMB = 1024
+	config.Alerts.Disk.LogSizeMB = 1024
+	config.Alerts.Disk.LogGrowthMBHour = 100
+	config.Alerts.Disk.DanglingImagesMB = 5120
+	config.Alerts.Disk.UnboundedLogs = true
+	config.Alerts.MemoryLeak.Enabled = true
+	config.Alerts.MemoryLeak.Interval = 300
+	config.Alerts.MemoryLeak.WindowHours = 6
+	config.Alerts.MemoryLeak.MinSamples = 20
+	config.Alerts.MemoryLeak.MinR2 = 0.8
+	config.Alerts.MemoryLeak.HorizonHours = 24
+	config.Alerts.Anomaly.Enabled = true
+	config.Alerts.Anomaly.Deviations = 3.0
+	config.Alerts.Anomaly.Alpha = 0.01
+	config.Alerts.Anomaly.MinSamples = 240
+	config.Alerts.Anomaly.Consecutive = 3
+	config.Alerts.Anomaly.LearnDays = 7
+	config.Metrics.Interval = 15
+	config.Metrics.Jitter = 2
+	config.Metrics.Workers = 8
+	config.Metrics.StatsTimeout = 5
+	config.Metrics.Collector = "docker"
+	config.Metrics.CgroupRoot = "/sys/fs/cgroup"
+	config.Metrics.ProcRoot = "/proc"
+	config.Host.Enabled = true
+	config.Disk.Enabled = true
+	config.Disk.Interval = 300
+	config.Idle.MinDays = 7
+	config.Idle.LookbackDays = 30
+	config.Idle.CPUPercent = 1.0
+	config.Idle.NetworkRate = 100
+	config.Recommendations.Days = 14
+	config.Recommendations.Headroom = 20
+	config.Alerts.Grouping.Wait = 30
+	config.Alerts.Grouping.Interval = 300
+	config.Alerts.Escalation.Interval = 30
+	config.Silences.RetentionDays = 5
+	config.Notifications.Enabled = true
+	config.Notifications.MaxAttempts = 5
+	config.Notifications.LogLines = 10
+	config.Notifications.Backoff = 2
+	config.Notifications.Timeout = 10
+	config.Storage.Engine = "rows"
+	config.Storage.Backend = "sqlite"
+	config.Storage.Directory = "./chunks"
+	config.Storage.ChunkHours = 2
+	config.Storage.RetentionDays = 90
+	config.Storage.Migrate = true
+	config.Scrape.Enabled = true
+	config.Scrape.Interval = 30
+	config.Scrape.Timeout = 5
+	config.Scrape.MaxSeries = 500
 
 	// Try to load from config file
 	if _, err := os.Stat("config.yaml"); err == nil {
@@ -2,16 +2,43 @@ package utils
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"nabd/models"
+	"strings"
+	"sync"
 
 	_ "modernc.org/sqlite"
 )
 
+// sqlitePragmas are applied to every connection. WAL lets API reads proceed while a
+// write is in progress, and the busy timeout makes a connection wait for a lock
+// instead of failing with SQLITE_BUSY.
+var sqlitePragmas = []string{
+	"journal_mode(WAL)",
+	"busy_timeout(5000)",
+	"synchronous(NORMAL)",
+}
+
+// ErrDatabaseClosed is returned by WriteTx before InitDatabase has been called
+var ErrDatabaseClosed = errors.New("database is not initialized")
+
+// writeRequest is a transaction queued for the writer goroutine
+type writeRequest struct {
+	fn   func(tx *sql.Tx) error
+	done chan error
+}
+
+var (
+	writerMu sync.RWMutex
+	writes   chan writeRequest
+)
+
 // InitDatabase initializes the SQLite database and creates tables
 func InitDatabase(dbPath string) error {
 	var err error
-	models.DB, err = sql.Open("sqlite", dbPath)
+	models.DB, err = sql.Open("sqlite", sqliteDSN(dbPath))
 	if err != nil {
 		return err
 	}
@@ -27,9 +54,73 @@ func InitDatabase(dbPath string) error {
 		return err
 	}
 
+	startWriter(models.DB)
 	return nil
 }
 
+// sqliteDSN appends the connection pragmas to a database path
+func sqliteDSN(dbPath string) string {
+	params := make([]string, len(sqlitePragmas))
+	for i, pragma := range sqlitePragmas {
+		params[i] = "_pragma=" + pragma
+	}
+
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	return dbPath + separator + strings.Join(params, "&")
+}
+
+// startWriter starts the goroutine that runs every write transaction, replacing the
+// writer of a previously opened database
+func startWriter(db *sql.DB) {
+	writerMu.Lock()
+	defer writerMu.Unlock()
+
+	if writes != nil {
+		close(writes)
+	}
+	writes = make(chan writeRequest, 64)
+
+	go func(requests <-chan writeRequest) {
+		for req := range requests {
+			req.done <- runTx(db, req.fn)
+		}
+	}(writes)
+}
+
+// runTx runs fn in a transaction, committing if it succeeds
+func runTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// WriteTx runs fn in a transaction on the single writer goroutine and waits for it to
+// commit. Serializing writes means they never contend for SQLite's write lock, so
+// readers in WAL mode are never blocked.
+func WriteTx(fn func(tx *sql.Tx) error) error {
+	req := writeRequest{fn: fn, done: make(chan error, 1)}
+
+	// Hold the read lock while queueing so a re-initialization cannot close the channel
+	writerMu.RLock()
+	if writes == nil {
+		writerMu.RUnlock()
+		return ErrDatabaseClosed
+	}
+	writes <- req
+	writerMu.RUnlock()
+
+	return <-req.done
+}
+
 // createTables creates the necessary database tables
 func createTables() error {
 	queries := []string{
@@ -42,6 +133,12 @@ func createTables() error {
 			memory_limit INTEGER NOT NULL,
 			network_rx INTEGER NOT NULL,
 			network_tx INTEGER NOT NULL,
+			block_read INTEGER NOT NULL DEFAULT 0,
+			block_write INTEGER NOT NULL DEFAULT 0,
+			pids INTEGER NOT NULL DEFAULT 0,
+			restart_count INTEGER NOT NULL DEFAULT 0,
+			uptime_seconds INTEGER NOT NULL DEFAULT 0,
+			health REAL NOT NULL DEFAULT -1,
 			status TEXT NOT NULL,
 			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
@@ -64,6 +161,111 @@ func createTables() error {
 			active BOOLEAN NOT NULL DEFAULT 1,
 			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS alert_notes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alert_id INTEGER NOT NULL,
+			author TEXT NOT NULL,
+			text TEXT NOT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS alert_escalations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			alert_id INTEGER NOT NULL,
+			level INTEGER NOT NULL,
+			from_severity TEXT NOT NULL,
+			to_severity TEXT NOT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS host_metrics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hostname TEXT NOT NULL,
+			cpu_percent REAL NOT NULL,
+			cpu_count INTEGER NOT NULL,
+			memory_used INTEGER NOT NULL,
+			memory_total INTEGER NOT NULL,
+			load1 REAL NOT NULL,
+			load5 REAL NOT NULL,
+			load15 REAL NOT NULL,
+			disk_path TEXT NOT NULL,
+			disk_used INTEGER NOT NULL,
+			disk_total INTEGER NOT NULL,
+			network_rx INTEGER NOT NULL,
+			network_tx INTEGER NOT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS metric_baselines (
+			name TEXT NOT NULL,
+			metric TEXT NOT NULL,
+			overall TEXT NOT NULL,
+			hourly TEXT NOT NULL,
+			updated_at DATETIME NOT NULL,
+			PRIMARY KEY (name, metric)
+		)`,
+		`CREATE TABLE IF NOT EXISTS scraped_metrics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			container_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			metric TEXT NOT NULL,
+			series TEXT NOT NULL,
+			value REAL NOT NULL,
+			timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS metric_chunks (
+			container_id TEXT NOT NULL,
+			partition_start INTEGER NOT NULL,
+			min_time INTEGER NOT NULL,
+			max_time INTEGER NOT NULL,
+			count INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (container_id, partition_start)
+		)`,
+		`CREATE TABLE IF NOT EXISTS metric_head (
+			container_id TEXT NOT NULL,
+			partition_start INTEGER NOT NULL,
+			timestamp INTEGER NOT NULL,
+			data BLOB NOT NULL,
+			PRIMARY KEY (container_id, timestamp)
+		)`,
+		`CREATE TABLE IF NOT EXISTS alert_rules (
+			name TEXT PRIMARY KEY,
+			definition TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS silences (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			matchers TEXT NOT NULL,
+			starts_at DATETIME NOT NULL,
+			ends_at DATETIME NOT NULL,
+			created_by TEXT NOT NULL,
+			comment TEXT NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS notification_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			channel TEXT NOT NULL,
+			event TEXT NOT NULL,
+			title TEXT NOT NULL,
+			container_id TEXT NOT NULL,
+			success BOOLEAN NOT NULL,
+			attempts INTEGER NOT NULL,
+			error TEXT NOT NULL,
+			timestamp DATETIME NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_deliveries_timestamp ON notification_deliveries (timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_metric_chunks_time ON metric_chunks (max_time, min_time)`,
+		`CREATE INDEX IF NOT EXISTS idx_metric_head_partition ON metric_head (partition_start)`,
+		`CREATE INDEX IF NOT EXISTS idx_scraped_metrics_series ON scraped_metrics (container_id, series, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_scraped_metrics_timestamp ON scraped_metrics (timestamp)`,
+		// History, trend and top-N queries filter by container and/or time range
+		`CREATE INDEX IF NOT EXISTS idx_container_metrics_container ON container_metrics (container_id, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_container_metrics_timestamp ON container_metrics (timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_host_metrics_timestamp ON host_metrics (timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_autoheal_events_timestamp ON autoheal_events (timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_active ON alerts (active, container_id, type)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_timestamp ON alerts (timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_notes_alert ON alert_notes (alert_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_escalations_alert ON alert_escalations (alert_id)`,
 	}
 
 	for _, query := range queries {
@@ -72,6 +274,71 @@ func createTables() error {
 		}
 	}
 
+	// Columns added after the initial schema; existing databases are migrated in place
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"container_metrics", "block_read", "INTEGER NOT NULL DEFAULT 0"},
+		{"container_metrics", "block_write", "INTEGER NOT NULL DEFAULT 0"},
+		{"container_metrics", "pids", "INTEGER NOT NULL DEFAULT 0"},
+		{"container_metrics", "restart_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"container_metrics", "uptime_seconds", "INTEGER NOT NULL DEFAULT 0"},
+		{"container_metrics", "health", "REAL NOT NULL DEFAULT -1"},
+		{"alerts", "resolved_at", "DATETIME"},
+		{"alerts", "acknowledged_by", "TEXT NOT NULL DEFAULT ''"},
+		{"alerts", "acknowledged_at", "DATETIME"},
+		{"alerts", "silenced", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"alerts", "fingerprint", "TEXT NOT NULL DEFAULT ''"},
+		{"alerts", "inhibited", "BOOLEAN NOT NULL DEFAULT 0"},
+		{"alerts", "escalation_level", "INTEGER NOT NULL DEFAULT 0"},
+		{"alerts", "escalated_at", "DATETIME"},
+		{"alerts", "team", "TEXT NOT NULL DEFAULT ''"},
+		{"alerts", "policy_step", "INTEGER NOT NULL DEFAULT 0"},
+		{"alerts", "value", "REAL NOT NULL DEFAULT 0"},
+		{"alerts", "threshold", "REAL NOT NULL DEFAULT 0"},
+	}
+
+	for _, col := range columns {
+		if err := addColumnIfMissing(col.table, col.column, col.definition); err != nil {
+			return err
+		}
+	}
+
 	log.Println("Database tables created successfully")
 	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table if it is not already present
+func addColumnIfMissing(table, column, definition string) error {
+	rows, err := models.DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = models.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
 }
\ No newline at end of file
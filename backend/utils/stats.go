@@ -0,0 +1,95 @@
+package utils
+
+import "math"
+
+// LinearRegression fits y = slope*x + intercept by least squares and returns the
+// coefficient of determination (R²) of the fit. It returns zeros when fewer than
+// two points are given or all x values are equal.
+func LinearRegression(xs, ys []float64) (slope, intercept, r2 float64) {
+	n := len(xs)
+	if n < 2 || n != len(ys) {
+		return 0, 0, 0
+	}
+
+	var sumX, sumY float64
+	for i := 0; i < n; i++ {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX := sumX / float64(n)
+	meanY := sumY / float64(n)
+
+	var sxx, sxy, syy float64
+	for i := 0; i < n; i++ {
+		dx := xs[i] - meanX
+		dy := ys[i] - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return 0, 0, 0
+	}
+
+	slope = sxy / sxx
+	intercept = meanY - slope*meanX
+	if syy == 0 {
+		// A perfectly flat series is fully explained by the fit
+		return slope, intercept, 1
+	}
+	r2 = (sxy * sxy) / (sxx * syy)
+	return slope, intercept, math.Min(r2, 1)
+}
+
+// EWMA tracks an exponentially weighted moving average and variance of a series
+type EWMA struct {
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Count    int     `json:"count"`
+}
+
+// Update adds an observation with smoothing factor alpha (0 < alpha <= 1). Until
+// 1/alpha observations have been seen the plain running mean and variance are used,
+// so the first values are not dragged towards the zero starting point.
+func (e *EWMA) Update(x, alpha float64) {
+	e.Count++
+	if e.Count == 1 {
+		e.Mean = x
+		e.Variance = 0
+		return
+	}
+
+	weight := alpha
+	if running := 1 / float64(e.Count); running > weight {
+		weight = running
+	}
+
+	diff := x - e.Mean
+	increment := weight * diff
+	e.Mean += increment
+	e.Variance = (1 - weight) * (e.Variance + diff*increment)
+}
+
+// StdDev returns the standard deviation of the series
+func (e *EWMA) StdDev() float64 {
+	return math.Sqrt(e.Variance)
+}
+
+// Percentile returns the p-th percentile (0-100) of values sorted in ascending order,
+// interpolating linearly between the closest ranks. It returns 0 for no values.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	if lower < 0 {
+		return sorted[0]
+	}
+	if upper >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}